@@ -5,12 +5,21 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"tradetracker/internal"
 	"tradetracker/internal/app/apps"
 	"tradetracker/internal/app/cfg"
+	"tradetracker/internal/pkg/instrument"
 	"tradetracker/internal/pkg/log"
+	"tradetracker/internal/pkg/output"
+	"tradetracker/internal/pkg/position"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/retention"
+	"tradetracker/internal/pkg/timeexpr"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -28,16 +37,14 @@ var (
 	}
 
 	tradeCmd = &cobra.Command{
-		Use:   "trade num instrumentID...",
+		Use:   "trade num instrument...",
 		Short: "Generates random trade data.",
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 2 {
 				return errors.New("requires at least two arguments")
 			}
-			for i := range args {
-				if _, err := strconv.ParseInt(args[i], 10, 64); err != nil {
-					return errors.Wrap(err, "parse arg failed")
-				}
+			if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
+				return errors.Wrap(err, "parse num failed")
 			}
 			return nil
 		},
@@ -45,78 +52,946 @@ var (
 	}
 
 	positionCmd = &cobra.Command{
-		Use:   "position intrumentID",
+		Use:   "position instrument",
 		Short: "Generates positions for an instrument from trade data after the given timestamp.",
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 1 {
 				return errors.New("requires at least one argument")
 			}
-			if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
-				return errors.Wrap(err, "parse instrumentID failed")
-			}
 			return nil
 		},
 		RunE: runCmd,
 	}
 
 	queryCmd = &cobra.Command{
-		Use:   "query intrumentID [timestamp]",
-		Short: "Query for the position of an instrument at a given time.",
+		Use:   "query instrument [timestamp]",
+		Short: "Query for the position of an instrument at a given time, or over a range of time.",
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 1 {
 				return errors.New("requires at least one argument")
 			}
-			if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
-				return errors.Wrap(err, "parse instrument ID failed")
+			if cmd.Flags().Changed("account") && cmd.Flags().Changed("portfolio") {
+				return errors.New("account and portfolio flags are mutually exclusive")
+			}
+			if isHistoryQuery(cmd) {
+				if len(args) > 1 {
+					return errors.New("timestamp argument cannot be used with from and to flags")
+				}
+				if cmd.Flags().Changed("as-of") {
+					return errors.New("as-of flag cannot be used with from and to flags")
+				}
+				if _, _, err := parseTimeRange(); err != nil {
+					return errors.Wrap(err, "parse time range failed")
+				}
+				if _, err := output.ParseFormat(format); err != nil {
+					return errors.Wrap(err, "parse format failed")
+				}
+				return nil
+			}
+			if cmd.Flags().Changed("every") {
+				return errors.New("every flag requires from or to flags")
+			}
+			if asOf != "" {
+				if _, err := timeexpr.Parse(asOf); err != nil {
+					return errors.Wrap(err, "parse as-of timestamp failed")
+				}
 			}
 			if len(args) <= 1 {
 				return nil
 			}
-			if _, err := time.Parse(time.RFC3339, args[1]); err != nil {
+			if _, err := timeexpr.Parse(args[1]); err != nil {
 				return errors.Wrap(err, "parse timestamp failed")
 			}
 			return nil
 		},
 		RunE: runCmd,
 	}
+
+	compactCmd = &cobra.Command{
+		Use:   "compact",
+		Short: "Drops positions superseded before the given time from the file store.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return errors.New("takes no arguments")
+			}
+			if before != "" {
+				if _, err := timeexpr.Parse(before); err != nil {
+					return errors.Wrap(err, "parse before timestamp failed")
+				}
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	archiveCmd = &cobra.Command{
+		Use:   "archive [instrument...]",
+		Short: "Moves trades and positions older than the retention policy, or the given time, out of the database into archive files.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if before != "" {
+				if _, err := timeexpr.Parse(before); err != nil {
+					return errors.Wrap(err, "parse before timestamp failed")
+				}
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	restoreCmd = &cobra.Command{
+		Use:   "restore dir...",
+		Short: "Restores archives to the database, latest first.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runCmd,
+	}
+
+	locksCmd = &cobra.Command{
+		Use:   "locks",
+		Short: "Lists the instruments locked by processes writing their positions, and who holds the locks.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return errors.New("takes no arguments")
+			}
+			if _, err := output.ParseFormat(format); err != nil {
+				return errors.Wrap(err, "parse format failed")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Runs continuously, ingesting trades from a file as it is appended to, building positions and serving queries for them.",
+		Args:  cobra.NoArgs,
+		RunE:  runCmd,
+	}
+
+	retentionCmd = &cobra.Command{
+		Use:   "retention",
+		Short: "Manages how long the trades and positions in each instrument are kept in the database.",
+	}
+
+	retentionSetCmd = &cobra.Command{
+		Use:   "set instrument retention",
+		Short: "Sets the retention period of an instrument, e.g. 90d or 720h.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("requires an instrument and a retention period")
+			}
+			if _, err := retention.ParseRetention(args[1]); err != nil {
+				return errors.Wrap(err, "parse retention failed")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	retentionRemoveCmd = &cobra.Command{
+		Use:   "remove instrument",
+		Short: "Removes the retention policy of an instrument, so it is kept indefinitely.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runCmd,
+	}
+
+	retentionListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the retention policies and the archives made.",
+		Args:  cobra.NoArgs,
+		RunE:  runCmd,
+	}
+
+	barCmd = &cobra.Command{
+		Use:   "bar instrument",
+		Short: "Generates OHLCV bars for an instrument from trade data.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("requires at least one argument")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	barsCmd = &cobra.Command{
+		Use:   "bars instrument",
+		Short: "Query for the OHLCV bars of an instrument over a range of time.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("requires at least one argument")
+			}
+			if _, _, err := parseTimeRange(); err != nil {
+				return errors.Wrap(err, "parse time range failed")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	tradesCmd = &cobra.Command{
+		Use:   "trades instrument",
+		Short: "Lists the trades in an instrument, optionally filtered by time, size and price.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires exactly one argument")
+			}
+			if _, _, err := parseTimeRange(); err != nil {
+				return errors.Wrap(err, "parse time range failed")
+			}
+			if _, _, err := parsePriceRange(); err != nil {
+				return errors.Wrap(err, "parse price range failed")
+			}
+			if _, err := output.ParseFormat(format); err != nil {
+				return errors.Wrap(err, "parse format failed")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	explainCmd = &cobra.Command{
+		Use:   "explain instrument timestamp",
+		Short: "Explains the position of an instrument at a given time by the trades which produced it.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("requires exactly two arguments")
+			}
+			if cmd.Flags().Changed("account") && cmd.Flags().Changed("portfolio") {
+				return errors.New("account and portfolio flags are mutually exclusive")
+			}
+			if _, err := timeexpr.Parse(args[1]); err != nil {
+				return errors.Wrap(err, "parse timestamp failed")
+			}
+			if _, err := output.ParseFormat(format); err != nil {
+				return errors.Wrap(err, "parse format failed")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	verifyCmd = &cobra.Command{
+		Use:   "verify [instrument]",
+		Short: "Verifies that stored positions match the trades they were built from, failing if they have drifted.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if verifyAll == (len(args) == 1) {
+				return errors.New("requires exactly one of an instrument argument or the all flag")
+			}
+			if len(args) > 1 {
+				return errors.New("accepts at most one argument")
+			}
+			if _, err := output.ParseFormat(format); err != nil {
+				return errors.Wrap(err, "parse format failed")
+			}
+			return nil
+		},
+		// drift is reported as an error so that the command exits non-zero, which is not a usage error
+		SilenceUsage: true,
+		RunE:         runCmd,
+	}
+
+	whatifCmd = &cobra.Command{
+		Use:   "whatif instrument --trade size@price[@time]...",
+		Short: "Simulates the position, cost basis and PnL of an account after hypothetical trades, without storing them.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires exactly one argument")
+			}
+			for _, s := range whatifTrades {
+				if _, err := position.ParseTrade(s, 0, 0, time.Now()); err != nil {
+					return errors.Wrap(err, "parse trade failed")
+				}
+			}
+			if cmd.Flags().Changed("mark") {
+				if _, err := decimal.Parse(mark); err != nil {
+					return errors.Wrap(err, "parse mark price failed")
+				}
+			}
+			if _, err := output.ParseFormat(format); err != nil {
+				return errors.Wrap(err, "parse format failed")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	diffCmd = &cobra.Command{
+		Use:   "diff timestamp [timestamp]",
+		Short: "Reports how positions changed between two times, or since a snapshot saved before a rebuild.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if against != "" && len(args) != 1 {
+				return errors.New("requires exactly one argument with the against flag")
+			}
+			if against == "" && len(args) != 2 {
+				return errors.New("requires exactly two arguments")
+			}
+			if cmd.Flags().Changed("account") && cmd.Flags().Changed("portfolio") {
+				return errors.New("account and portfolio flags are mutually exclusive")
+			}
+			for _, arg := range args {
+				if _, err := timeexpr.Parse(arg); err != nil {
+					return errors.Wrap(err, "parse timestamp failed")
+				}
+			}
+			if _, err := output.ParseFormat(format); err != nil {
+				return errors.Wrap(err, "parse format failed")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	statsCmd = &cobra.Command{
+		Use:   "stats instrument",
+		Short: "Summarises the trading activity and position in an instrument over each day, week or month.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires exactly one argument")
+			}
+			if _, _, err := parseTimeRange(); err != nil {
+				return errors.Wrap(err, "parse time range failed")
+			}
+			if _, err := repo.ParsePeriod(by); err != nil {
+				return errors.Wrap(err, "parse period failed")
+			}
+			if _, err := output.ParseFormat(format); err != nil {
+				return errors.Wrap(err, "parse format failed")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	snapshotCmd = &cobra.Command{
+		Use:   "snapshot [timestamp]",
+		Short: "Lists the position in every instrument at a given time.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return errors.New("accepts at most one argument")
+			}
+			if cmd.Flags().Changed("account") && cmd.Flags().Changed("portfolio") {
+				return errors.New("account and portfolio flags are mutually exclusive")
+			}
+			if _, err := output.ParseFormat(format); err != nil {
+				return errors.Wrap(err, "parse format failed")
+			}
+			if len(args) == 0 {
+				return nil
+			}
+			if _, err := timeexpr.Parse(args[0]); err != nil {
+				return errors.Wrap(err, "parse timestamp failed")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	portfolioCmd = &cobra.Command{
+		Use:   "portfolio",
+		Short: "Manages the hierarchy of portfolios that accounts are grouped into.",
+	}
+
+	portfolioCreateCmd = &cobra.Command{
+		Use:   "create name [parentID]",
+		Short: "Creates a portfolio, optionally nested under a parent portfolio.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("requires at least one argument")
+			}
+			if len(args) <= 1 {
+				return nil
+			}
+			if _, err := strconv.ParseInt(args[1], 10, 64); err != nil {
+				return errors.Wrap(err, "parse parent ID failed")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	portfolioAssignCmd = &cobra.Command{
+		Use:   "assign portfolioID accountID...",
+		Short: "Assigns accounts to a portfolio.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("requires at least two arguments")
+			}
+			for i := range args {
+				if _, err := strconv.ParseInt(args[i], 10, 64); err != nil {
+					return errors.Wrap(err, "parse arg failed")
+				}
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	portfolioListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists all portfolios and the accounts assigned to them.",
+		Args:  cobra.NoArgs,
+		RunE:  runCmd,
+	}
+
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrates the database with the migrations built into the binary.",
+	}
+
+	migrateUpCmd = &cobra.Command{
+		Use:   "up",
+		Short: "Applies pending migrations.",
+		Args:  cobra.NoArgs,
+		RunE:  runCmd,
+	}
+
+	migrateDownCmd = &cobra.Command{
+		Use:   "down",
+		Short: "Rolls back the latest applied migrations.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return errors.New("takes no arguments")
+			}
+			if cmd.Flags().Changed("limit") && migrateAll {
+				return errors.New("limit and all flags are mutually exclusive")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	migrateStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Lists every migration and whether it has been applied.",
+		Args:  cobra.NoArgs,
+		RunE:  runCmd,
+	}
+
+	migrateRedoCmd = &cobra.Command{
+		Use:   "redo",
+		Short: "Rolls back the latest applied migration and applies it again.",
+		Args:  cobra.NoArgs,
+		RunE:  runCmd,
+	}
+
+	instrumentCmd = &cobra.Command{
+		Use:   "instrument",
+		Short: "Manages instrument reference data.",
+	}
+
+	instrumentAddCmd = &cobra.Command{
+		Use:   "add symbol",
+		Short: "Adds an instrument.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("requires at least one argument")
+			}
+			if _, err := decimal.Parse(tickSize); err != nil {
+				return errors.Wrap(err, "parse tick size failed")
+			}
+			if _, err := decimal.Parse(multiplier); err != nil {
+				return errors.Wrap(err, "parse multiplier failed")
+			}
+			if _, err := instrument.ParseDate(activeFrom); err != nil {
+				return errors.Wrap(err, "parse active from failed")
+			}
+			if _, err := instrument.ParseDate(activeTo); err != nil {
+				return errors.Wrap(err, "parse active to failed")
+			}
+			return nil
+		},
+		RunE: runCmd,
+	}
+
+	instrumentListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists all instruments.",
+		Args:  cobra.NoArgs,
+		RunE:  runCmd,
+	}
+
+	instrumentShowCmd = &cobra.Command{
+		Use:   "show instrument",
+		Short: "Shows the reference data for an instrument.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runCmd,
+	}
+
+	instrumentImportCmd = &cobra.Command{
+		Use:   "import file",
+		Short: "Imports instruments from a CSV file with a header row, or from stdin if the file is -.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runCmd,
+	}
+)
+
+// CLI command flag values.
+var (
+	interval time.Duration
+	from, to string
+
+	asOf               string
+	every              time.Duration
+	format, outputPath string
+	excludeFlat        bool
+	by                 string
+	against            string
+	before             string
+	instrumentRefs     []string
+	verifyAll          bool
+
+	whatifTrades []string
+	mark         string
+
+	afterID, limit int64
+	migrateLimit   int
+	migrateAll     bool
+	minSize        string
+	priceRange     string
+	archiveDir     string
+	lockTimeout    time.Duration
+
+	serveInput      string
+	commitInterval  time.Duration
+	shutdownTimeout time.Duration
+	allowedLateness time.Duration
+	latePolicy      string
+	lateOutput      string
+
+	accountIDs  []int64
+	accountID   int64
+	portfolioID int64
+
+	newInstrument        models.Instrument
+	tickSize, multiplier string
+	activeFrom, activeTo string
 )
 
 func newApp(_ context.Context, cmd *cobra.Command, args []string) (apps.App, []string, error) {
 	var err error
 	var app apps.App
-	switch cmd.Name() {
+	name := commandName(cmd)
+	switch name {
+	case "trade", "position", "query", "compact":
+	default:
+		if internal.Store != internal.PostgresStore {
+			return nil, nil, errors.Errorf("the %s command requires the postgres store", name)
+		}
+	}
+	switch name {
 	case "trade":
-		app, err = apps.NewTradeApp(
-			cfg.DBFromEnv(),
-		)
+		cfgs := []apps.TradeAppCfg{
+			cfg.NewAccountCfg(accountIDs...),
+			cfg.StoreFromEnv(),
+		}
+		if internal.Store == internal.PostgresStore {
+			cfgs = append(cfgs, cfg.DBFromEnv())
+		}
+		app, err = apps.NewTradeApp(cfgs...)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "new trade app failed")
 		}
 		return app, args, nil
 	case "position":
-		app, err = apps.NewPositionApp(
-			cfg.DBFromEnv(),
-		)
+		cfgs := []apps.PositionAppCfg{cfg.StoreFromEnv(), cfg.NewLockCfg(lockTimeout)}
+		if internal.Store == internal.PostgresStore {
+			cfgs = append(cfgs, cfg.DBFromEnv())
+		}
+		app, err = apps.NewPositionApp(cfgs...)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "new trade app failed")
 		}
 		return app, args, nil
 	case "query":
-		app, err = apps.NewQueryApp(
+		cfgs := []apps.QueryAppCfg{cfg.StoreFromEnv()}
+		if internal.Store == internal.PostgresStore {
+			cfgs = append(cfgs, cfg.DBFromEnv())
+		}
+		if isHistoryQuery(cmd) {
+			fromTime, toTime, err := parseTimeRange()
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "parse time range failed")
+			}
+			outputFormat, err := output.ParseFormat(format)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "parse format failed")
+			}
+			cfgs = append(cfgs,
+				cfg.NewTimeRangeCfg(fromTime, toTime),
+				cfg.NewIntervalCfg(every),
+				cfg.NewOutputCfg(outputFormat, outputPath),
+			)
+		}
+		if cmd.Flags().Changed("account") {
+			cfgs = append(cfgs, cfg.NewAccountCfg(accountID))
+		}
+		if cmd.Flags().Changed("portfolio") {
+			cfgs = append(cfgs, cfg.NewPortfolioCfg(portfolioID))
+		}
+		if asOf != "" {
+			asOfTime, err := timeexpr.Parse(asOf)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "parse as-of timestamp failed")
+			}
+			cfgs = append(cfgs, cfg.NewAsOfCfg(asOfTime))
+		}
+		app, err = apps.NewQueryApp(cfgs...)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new query app failed")
+		}
+		return app, args, nil
+	case "trades":
+		fromTime, toTime, err := parseTimeRange()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse time range failed")
+		}
+		minPrice, maxPrice, err := parsePriceRange()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse price range failed")
+		}
+		var size decimal.Decimal
+		if minSize != "" {
+			if size, err = decimal.Parse(minSize); err != nil {
+				return nil, nil, errors.Wrap(err, "parse min size failed")
+			}
+		}
+		outputFormat, err := output.ParseFormat(format)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse format failed")
+		}
+		app, err = apps.NewTradeQueryApp(
 			cfg.DBFromEnv(),
+			cfg.NewTimeRangeCfg(fromTime, toTime),
+			cfg.NewTradeFilterCfg(size, minPrice, maxPrice, afterID, limit),
+			cfg.NewOutputCfg(outputFormat, outputPath),
 		)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, "new query app failed")
+			return nil, nil, errors.Wrap(err, "new trade query app failed")
+		}
+		return app, args, nil
+	case "explain":
+		outputFormat, err := output.ParseFormat(format)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse format failed")
+		}
+		cfgs := []apps.ExplainAppCfg{
+			cfg.DBFromEnv(),
+			cfg.NewOutputCfg(outputFormat, outputPath),
+		}
+		if cmd.Flags().Changed("account") {
+			cfgs = append(cfgs, cfg.NewAccountCfg(accountID))
+		}
+		if cmd.Flags().Changed("portfolio") {
+			cfgs = append(cfgs, cfg.NewPortfolioCfg(portfolioID))
+		}
+		app, err = apps.NewExplainApp(cfgs...)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new explain app failed")
+		}
+		return app, args, nil
+	case "verify":
+		outputFormat, err := output.ParseFormat(format)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse format failed")
+		}
+		app, err = apps.NewVerifyApp(
+			cfg.DBFromEnv(),
+			cfg.NewVerifyCfg(verifyAll),
+			cfg.NewOutputCfg(outputFormat, outputPath),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new verify app failed")
+		}
+		return app, args, nil
+	case "whatif":
+		outputFormat, err := output.ParseFormat(format)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse format failed")
+		}
+		var markPrice *decimal.Decimal
+		if cmd.Flags().Changed("mark") {
+			price, err := decimal.Parse(mark)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "parse mark price failed")
+			}
+			markPrice = &price
+		}
+		app, err = apps.NewWhatIfApp(
+			cfg.DBFromEnv(),
+			cfg.NewAccountCfg(accountID),
+			cfg.NewWhatIfCfg(whatifTrades, markPrice),
+			cfg.NewOutputCfg(outputFormat, outputPath),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new whatif app failed")
+		}
+		return app, args, nil
+	case "diff":
+		outputFormat, err := output.ParseFormat(format)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse format failed")
+		}
+		cfgs := []apps.DiffAppCfg{
+			cfg.DBFromEnv(),
+			cfg.NewDiffCfg(instrumentRefs, against),
+			cfg.NewOutputCfg(outputFormat, outputPath),
+		}
+		if cmd.Flags().Changed("account") {
+			cfgs = append(cfgs, cfg.NewAccountCfg(accountID))
+		}
+		if cmd.Flags().Changed("portfolio") {
+			cfgs = append(cfgs, cfg.NewPortfolioCfg(portfolioID))
+		}
+		app, err = apps.NewDiffApp(cfgs...)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new diff app failed")
+		}
+		return app, args, nil
+	case "stats":
+		fromTime, toTime, err := parseTimeRange()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse time range failed")
+		}
+		period, err := repo.ParsePeriod(by)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse period failed")
+		}
+		outputFormat, err := output.ParseFormat(format)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse format failed")
+		}
+		app, err = apps.NewStatsApp(
+			cfg.DBFromEnv(),
+			cfg.NewTimeRangeCfg(fromTime, toTime),
+			cfg.NewStatsCfg(period),
+			cfg.NewOutputCfg(outputFormat, outputPath),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new stats app failed")
+		}
+		return app, args, nil
+	case "snapshot":
+		outputFormat, err := output.ParseFormat(format)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse format failed")
+		}
+		cfgs := []apps.SnapshotAppCfg{
+			cfg.DBFromEnv(),
+			cfg.NewSnapshotCfg(excludeFlat),
+			cfg.NewOutputCfg(outputFormat, outputPath),
+		}
+		if cmd.Flags().Changed("account") {
+			cfgs = append(cfgs, cfg.NewAccountCfg(accountID))
+		}
+		if cmd.Flags().Changed("portfolio") {
+			cfgs = append(cfgs, cfg.NewPortfolioCfg(portfolioID))
+		}
+		app, err = apps.NewSnapshotApp(cfgs...)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new snapshot app failed")
+		}
+		return app, args, nil
+	case "compact":
+		var beforeTime time.Time
+		if before != "" {
+			if beforeTime, err = timeexpr.Parse(before); err != nil {
+				return nil, nil, errors.Wrap(err, "parse before timestamp failed")
+			}
+		}
+		app, err = apps.NewCompactApp(
+			cfg.StoreFromEnv(),
+			cfg.NewCompactCfg(beforeTime),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new compact app failed")
+		}
+		return app, args, nil
+	case "bar":
+		app, err = apps.NewBarApp(
+			cfg.DBFromEnv(),
+			cfg.NewIntervalCfg(interval),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new bar app failed")
+		}
+		return app, args, nil
+	case "bars":
+		fromTime, toTime, err := parseTimeRange()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse time range failed")
+		}
+		app, err = apps.NewBarQueryApp(
+			cfg.DBFromEnv(),
+			cfg.NewIntervalCfg(interval),
+			cfg.NewTimeRangeCfg(fromTime, toTime),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new bar query app failed")
+		}
+		return app, args, nil
+	case "portfolio":
+		app, err = apps.NewPortfolioApp(
+			cfg.DBFromEnv(),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new portfolio app failed")
+		}
+		return app, append([]string{cmd.Name()}, args...), nil
+	case "migrate":
+		app, err = apps.NewMigrateApp(
+			cfg.DBFromEnv(),
+			cfg.NewMigrateCfg(migrateLimit, migrateAll),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new migrate app failed")
+		}
+		return app, append([]string{cmd.Name()}, args...), nil
+	case "archive", "restore":
+		var beforeTime time.Time
+		if before != "" {
+			if beforeTime, err = timeexpr.Parse(before); err != nil {
+				return nil, nil, errors.Wrap(err, "parse before timestamp failed")
+			}
+		}
+		app, err = apps.NewArchiveApp(
+			cfg.DBFromEnv(),
+			cfg.NewArchiveCfg(archiveDir, beforeTime),
+			cfg.NewLockCfg(lockTimeout),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new archive app failed")
+		}
+		return app, append([]string{cmd.Name()}, args...), nil
+	case "serve":
+		// only the log level and timezone are reloaded, as the other settings are in use by the running app
+		reload := func(ctx context.Context) error {
+			if err := internal.LoadConfig(cmd, &internal.LogLevelFlag, &internal.TimezoneFlag); err != nil {
+				return errors.Wrap(err, "load config failed")
+			}
+			log.SetLogger(internal.LogLevel)
+			return errors.Wrap(timeexpr.SetLocation(internal.Timezone), "set timezone failed")
+		}
+		policy, err := position.ParseLatePolicy(latePolicy)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse late policy failed")
+		}
+		app, err = apps.NewServeApp(
+			cfg.DBFromEnv(),
+			cfg.ServerFromEnv(),
+			cfg.NewServeCfg(serveInput, commitInterval, shutdownTimeout, reload),
+			cfg.NewLateCfg(allowedLateness, policy, lateOutput),
+			cfg.NewLockCfg(lockTimeout),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new serve app failed")
+		}
+		return app, args, nil
+	case "locks":
+		outputFormat, err := output.ParseFormat(format)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse format failed")
+		}
+		app, err = apps.NewLocksApp(
+			cfg.DBFromEnv(),
+			cfg.NewOutputCfg(outputFormat, outputPath),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new locks app failed")
 		}
 		return app, args, nil
+	case "retention":
+		app, err = apps.NewRetentionApp(
+			cfg.DBFromEnv(),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new retention app failed")
+		}
+		return app, append([]string{cmd.Name()}, args...), nil
+	case "instrument":
+		inst := newInstrument
+		if inst.TickSize, err = decimal.Parse(tickSize); err != nil {
+			return nil, nil, errors.Wrap(err, "parse tick size failed")
+		}
+		if inst.Multiplier, err = decimal.Parse(multiplier); err != nil {
+			return nil, nil, errors.Wrap(err, "parse multiplier failed")
+		}
+		if inst.ActiveFrom, err = instrument.ParseDate(activeFrom); err != nil {
+			return nil, nil, errors.Wrap(err, "parse active from failed")
+		}
+		if inst.ActiveTo, err = instrument.ParseDate(activeTo); err != nil {
+			return nil, nil, errors.Wrap(err, "parse active to failed")
+		}
+		app, err = apps.NewInstrumentApp(
+			cfg.DBFromEnv(),
+			cfg.NewInstrumentCfg(inst),
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new instrument app failed")
+		}
+		return app, append([]string{cmd.Name()}, args...), nil
 	default:
 		return nil, nil, fmt.Errorf("unknown command: %s", cmd.Name())
 	}
 }
 
+// commandName returns the name of the top-level command, so that a
+// command group can be run by a single app given the subcommand as its first argument.
+func commandName(cmd *cobra.Command) string {
+	for cmd.HasParent() && cmd.Parent() != rootCmd {
+		cmd = cmd.Parent()
+	}
+	return cmd.Name()
+}
+
+// parsePriceRange parses the --price-range flag of the form min:max, where either bound may be omitted.
+func parsePriceRange() (minPrice, maxPrice *decimal.Decimal, err error) {
+	if priceRange == "" {
+		return nil, nil, nil
+	}
+	bounds := strings.Split(priceRange, ":")
+	if len(bounds) != 2 {
+		return nil, nil, errors.Errorf("price range %q must be of the form min:max", priceRange)
+	}
+	prices := make([]*decimal.Decimal, len(bounds))
+	for i, bound := range bounds {
+		if bound == "" {
+			continue
+		}
+		price, err := decimal.Parse(bound)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse price failed")
+		}
+		prices[i] = &price
+	}
+	return prices[0], prices[1], nil
+}
+
+// isHistoryQuery returns true if the query command should query the position history over a range of time.
+func isHistoryQuery(cmd *cobra.Command) bool {
+	return cmd.Flags().Changed("from") || cmd.Flags().Changed("to")
+}
+
+// parseTimeRange parses the --from and --to flags, either of which may be omitted.
+func parseTimeRange() (fromTime, toTime time.Time, err error) {
+	if from != "" {
+		if fromTime, err = timeexpr.Parse(from); err != nil {
+			return time.Time{}, time.Time{}, errors.Wrap(err, "parse from timestamp failed")
+		}
+	}
+	if to != "" {
+		if toTime, err = timeexpr.Parse(to); err != nil {
+			return time.Time{}, time.Time{}, errors.Wrap(err, "parse to timestamp failed")
+		}
+	}
+	return fromTime, toTime, nil
+}
+
 func runCmd(cmd *cobra.Command, args []string) error {
 	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
+	if err := internal.LoadConfig(cmd); err != nil {
+		return errors.Wrap(err, "load config failed")
+	}
 	if err := chainedCheck(
 		ctx,
 		envCheck,
@@ -136,6 +1011,9 @@ func envCheck(ctx context.Context) error {
 		return errors.Wrap(err, "validate env failed")
 	}
 	log.SetLogger(internal.LogLevel)
+	if err := timeexpr.SetLocation(internal.Timezone); err != nil {
+		return errors.Wrap(err, "set timezone failed")
+	}
 	return nil
 }
 
@@ -153,6 +1031,10 @@ func init() {
 	err := internal.RegisterCommandFlags(rootCmd, []*internal.Flag{
 		&internal.EnvFlag,
 		&internal.LogLevelFlag,
+		&internal.TimezoneFlag,
+		&internal.StoreFlag,
+		&internal.DataDirFlag,
+		&internal.ConfigFlag,
 
 		&internal.HealthPortFlag,
 		&internal.PortFlag,
@@ -172,10 +1054,146 @@ func init() {
 		logger.Fatalln(err)
 	}
 
+	for _, cmd := range []*cobra.Command{barCmd, barsCmd} {
+		cmd.Flags().DurationVar(&interval, "interval", time.Minute, "The width of each bar, e.g. 1m or 1h.")
+	}
+	barsCmd.Flags().StringVar(&from, "from", "", "Only include bars starting at or after this time.")
+	barsCmd.Flags().StringVar(&to, "to", "", "Only include bars starting before this time (default now).")
+	queryCmd.Flags().StringVar(&asOf, "as-of", "", "Query the position as it was known at this time, before any later corrections.")
+	queryCmd.Flags().StringVar(&from, "from", "", "Query the position history from this time.")
+	queryCmd.Flags().StringVar(&to, "to", "", "Query the position history up to, but not including, this time (default now).")
+	queryCmd.Flags().DurationVar(&every, "every", 0, "Resample the position history to the last position in each interval, e.g. 1h.")
+	queryCmd.Flags().StringVar(&format, "format", string(output.Table), "The format to write the position history in: table, json or csv.")
+	queryCmd.Flags().StringVar(&outputPath, "output", "", "The file to write the position history to (default stdout).")
+	tradesCmd.Flags().StringVar(&from, "from", "", "Only include trades at or after this time.")
+	tradesCmd.Flags().StringVar(&to, "to", "", "Only include trades before this time (default now).")
+	tradesCmd.Flags().StringVar(&minSize, "min-size", "", "Only include trades of at least this absolute size, e.g. 0.5.")
+	tradesCmd.Flags().StringVar(&priceRange, "price-range", "", "Only include trades priced within this inclusive range, e.g. 100:200, 100: or :200.")
+	tradesCmd.Flags().Int64Var(&afterID, "after", 0, "List the page of trades following the trade with this ID.")
+	tradesCmd.Flags().Int64Var(&limit, "limit", 100, "The maximum number of trades to list, or 0 for no limit.")
+	tradesCmd.Flags().StringVar(&format, "format", string(output.Table), "The format to write the trades in: table, json or csv.")
+	tradesCmd.Flags().StringVar(&outputPath, "output", "", "The file to write the trades to (default stdout).")
+	explainCmd.Flags().Int64Var(&accountID, "account", 0, "Explain the position of a single account.")
+	explainCmd.Flags().Int64Var(&portfolioID, "portfolio", 0, "Explain the position aggregated over a portfolio (default all accounts).")
+	explainCmd.Flags().StringVar(&format, "format", string(output.Table), "The format to write the trades in: table, json or csv.")
+	explainCmd.Flags().StringVar(&outputPath, "output", "", "The file to write the trades to (default stdout).")
+	verifyCmd.Flags().BoolVar(&verifyAll, "all", false, "Verify the positions of every instrument with trades or positions.")
+	verifyCmd.Flags().StringVar(&format, "format", string(output.Table), "The format to write any drift in: table, json or csv.")
+	verifyCmd.Flags().StringVar(&outputPath, "output", "", "The file to write any drift to (default stdout).")
+	whatifCmd.Flags().StringArrayVar(&whatifTrades, "trade", nil, "A hypothetical trade of the form size@price[@time], where time is a time expression (default now). May be repeated.")
+	whatifCmd.Flags().Int64Var(&accountID, "account", 0, "The account to simulate the trades for.")
+	whatifCmd.Flags().StringVar(&mark, "mark", "", "The price to mark positions at (default the price of the latest trade).")
+	whatifCmd.Flags().StringVar(&format, "format", string(output.Table), "The format to write the outcomes in: table, json or csv.")
+	whatifCmd.Flags().StringVar(&outputPath, "output", "", "The file to write the outcomes to (default stdout).")
+	if err := whatifCmd.MarkFlagRequired("trade"); err != nil {
+		logger.Fatalln(err)
+	}
+	diffCmd.Flags().StringSliceVar(&instrumentRefs, "instruments", nil, "The instruments to compare, e.g. AAPL,MSFT (default all instruments).")
+	diffCmd.Flags().StringVar(&against, "against", "", "A snapshot saved in the json or csv format to compare the current positions at the timestamp against, or - for stdin.")
+	diffCmd.Flags().Int64Var(&accountID, "account", 0, "Compare the positions of a single account.")
+	diffCmd.Flags().Int64Var(&portfolioID, "portfolio", 0, "Compare the positions aggregated over a portfolio (default all accounts).")
+	diffCmd.Flags().StringVar(&format, "format", string(output.Table), "The format to write the changes in: table, json or csv.")
+	diffCmd.Flags().StringVar(&outputPath, "output", "", "The file to write the changes to (default stdout).")
+	statsCmd.Flags().StringVar(&from, "from", "", "Summarise from this time (default the first trade).")
+	statsCmd.Flags().StringVar(&to, "to", "", "Summarise up to, but not including, this time (default now).")
+	statsCmd.Flags().StringVar(&by, "by", string(repo.Day), "The period to summarise over: day, week or month.")
+	statsCmd.Flags().StringVar(&format, "format", string(output.Table), "The format to write the stats in: table, json or csv.")
+	statsCmd.Flags().StringVar(&outputPath, "output", "", "The file to write the stats to (default stdout).")
+	compactCmd.Flags().StringVar(&before, "before", "", "Drop positions superseded before this time (default now).")
+	archiveCmd.Flags().StringVar(&before, "before", "", "Archive trades and positions before this time, but never within an instrument's retention period (default each retention policy).")
+	archiveCmd.Flags().StringVar(&archiveDir, "dir", "archive", "The directory to write archives to.")
+	serveCmd.Flags().StringVar(&serveInput, "input", "", "The file of trades to ingest, one JSON object per line, which is followed as it is appended to.")
+	serveCmd.Flags().DurationVar(&commitInterval, "commit-interval", time.Second, "How often to commit the offset of the trades ingested.")
+	serveCmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "How long to drain the trades in flight when shutting down, before stopping immediately.")
+	serveCmd.Flags().DurationVar(&allowedLateness, "allowed-lateness", 0, "How far behind the latest trade in an instrument a trade may arrive and still be reordered into its positions, which are written once the latest trade is that far past them.")
+	serveCmd.Flags().StringVar(&latePolicy, "late-policy", string(position.RebuildLate), "How to handle trades later than the allowed lateness: rebuild the positions from them, or reject them to the late output.")
+	serveCmd.Flags().StringVar(&lateOutput, "late-output", "", "The file to append trades rejected as late to, one JSON object per line (default the input file with a .late suffix).")
+	if err := serveCmd.MarkFlagRequired("input"); err != nil {
+		logger.Fatalln(err)
+	}
+	for _, cmd := range []*cobra.Command{positionCmd, archiveCmd, restoreCmd, serveCmd} {
+		cmd.Flags().DurationVar(&lockTimeout, "lock-timeout", 0, "How long to wait for another process writing the instrument's positions to finish: 0 fails immediately, and a negative duration waits indefinitely.")
+	}
+	locksCmd.Flags().StringVar(&format, "format", string(output.Table), "The format to write the locks in: table, json or csv.")
+	locksCmd.Flags().StringVar(&outputPath, "output", "", "The file to write the locks to (default stdout).")
+	snapshotCmd.Flags().Int64Var(&accountID, "account", 0, "List the positions of a single account.")
+	snapshotCmd.Flags().Int64Var(&portfolioID, "portfolio", 0, "List the positions aggregated over a portfolio (default all accounts).")
+	snapshotCmd.Flags().BoolVar(&excludeFlat, "exclude-flat", false, "Exclude instruments with a flat position.")
+	snapshotCmd.Flags().StringVar(&format, "format", string(output.Table), "The format to write the positions in: table, json or csv.")
+	snapshotCmd.Flags().StringVar(&outputPath, "output", "", "The file to write the positions to (default stdout).")
+
+	tradeCmd.Flags().Int64SliceVar(&accountIDs, "accounts", []int64{0}, "The accounts to book the random trades to.")
+	queryCmd.Flags().Int64Var(&accountID, "account", 0, "Query the position of a single account.")
+	queryCmd.Flags().Int64Var(&portfolioID, "portfolio", 0, "Query the position aggregated over a portfolio (default all accounts).")
+
+	instrumentAddCmd.Flags().Int64Var(&newInstrument.ID, "id", 0, "The instrument ID (default assigned automatically).")
+	instrumentAddCmd.Flags().StringVar(&newInstrument.ISIN, "isin", "", "The ISIN of the instrument.")
+	instrumentAddCmd.Flags().StringVar(&newInstrument.CUSIP, "cusip", "", "The CUSIP of the instrument.")
+	instrumentAddCmd.Flags().StringVar(&newInstrument.AssetClass, "asset-class", "", "The asset class of the instrument, e.g. equity.")
+	instrumentAddCmd.Flags().StringVar(&newInstrument.Currency, "currency", "", "The ISO 4217 currency the instrument is priced in.")
+	instrumentAddCmd.Flags().Int64Var(&newInstrument.LotSize, "lot-size", instrument.DefaultLotSize, "The lot size of the instrument.")
+	instrumentAddCmd.Flags().StringVar(&tickSize, "tick-size", instrument.DefaultTickSize.String(), "The tick size of the instrument.")
+	instrumentAddCmd.Flags().StringVar(&multiplier, "multiplier", instrument.DefaultMultiplier.String(), "The contract multiplier of the instrument.")
+	instrumentAddCmd.Flags().Int32Var(&newInstrument.QuantityScale, "quantity-scale", 0, "The number of decimal places that trade sizes in the instrument may be given to, e.g. 8 for bitcoin.")
+	instrumentAddCmd.Flags().StringVar(&activeFrom, "active-from", "", "The date or time the instrument is active from.")
+	instrumentAddCmd.Flags().StringVar(&activeTo, "active-to", "", "The date or time the instrument is active to.")
+	for _, name := range []string{"asset-class", "currency"} {
+		if err := instrumentAddCmd.MarkFlagRequired(name); err != nil {
+			logger.Fatalln(err)
+		}
+	}
+
+	migrateUpCmd.Flags().IntVar(&migrateLimit, "limit", 0, "The maximum number of migrations to apply (default all).")
+	migrateDownCmd.Flags().IntVar(&migrateLimit, "limit", 0, "The maximum number of migrations to roll back (default 1).")
+	migrateDownCmd.Flags().BoolVar(&migrateAll, "all", false, "Roll back every applied migration.")
+	migrateCmd.AddCommand(
+		migrateUpCmd,
+		migrateDownCmd,
+		migrateStatusCmd,
+		migrateRedoCmd,
+	)
+
+	instrumentCmd.AddCommand(
+		instrumentAddCmd,
+		instrumentListCmd,
+		instrumentShowCmd,
+		instrumentImportCmd,
+	)
+
+	retentionCmd.AddCommand(
+		retentionSetCmd,
+		retentionRemoveCmd,
+		retentionListCmd,
+	)
+
+	portfolioCmd.AddCommand(
+		portfolioCreateCmd,
+		portfolioAssignCmd,
+		portfolioListCmd,
+	)
+
 	rootCmd.AddCommand(
 		tradeCmd,
 		positionCmd,
 		queryCmd,
+		tradesCmd,
+		explainCmd,
+		verifyCmd,
+		whatifCmd,
+		statsCmd,
+		diffCmd,
+		snapshotCmd,
+		compactCmd,
+		barCmd,
+		barsCmd,
+		portfolioCmd,
+		instrumentCmd,
+		migrateCmd,
+		retentionCmd,
+		archiveCmd,
+		restoreCmd,
+		locksCmd,
+		serveCmd,
 	)
 }
 
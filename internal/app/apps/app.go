@@ -6,7 +6,15 @@ package apps
 
 import (
 	"context"
+	"io"
+	"os"
+	"strconv"
 
+	"tradetracker/internal/pkg/pubsub"
+	"tradetracker/internal/pkg/trade"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,6 +24,23 @@ var logger logrus.FieldLogger = logrus.StandardLogger()
 type AppCfg interface {
 	TradeAppCfg
 	PositionAppCfg
+	BarAppCfg
+	BarQueryAppCfg
+	PortfolioAppCfg
+	InstrumentAppCfg
+	SnapshotAppCfg
+	TradeQueryAppCfg
+	ExplainAppCfg
+	VerifyAppCfg
+	WhatIfAppCfg
+	StatsAppCfg
+	DiffAppCfg
+	CompactAppCfg
+	MigrateAppCfg
+	ArchiveAppCfg
+	RetentionAppCfg
+	LocksAppCfg
+	ServeAppCfg
 	// ... add more here to configure additional apps
 }
 
@@ -23,3 +48,89 @@ type AppCfg interface {
 type App interface {
 	Run(ctx context.Context, args []string) error
 }
+
+// publishTrades sends the trade data from the source across the stream for it to be processed,
+// closing the trade topic once the source is exhausted, and exits if it fails.
+func publishTrades(ctx context.Context, tradeSource trade.Source, stream pubsub.PublisherSubscriber) {
+	if err := sendTrades(ctx, tradeSource, stream); err != nil {
+		logger.Fatalln(err)
+	}
+}
+
+// sendTrades sends the trade data from the source across the stream for it to be processed,
+// closing the trade topic once the source is exhausted or it fails. Trades from a source with offsets
+// carry the offset just past them, for the offset to be committed once they have been processed.
+func sendTrades(ctx context.Context, tradeSource trade.Source, stream pubsub.PublisherSubscriber) (err error) {
+	defer func() {
+		if closeErr := stream.Close(ctx, pubsub.TradeTopic); closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "close trade stream failed")
+		}
+	}()
+	for {
+		tr, err := tradeSource.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "next trade failed")
+		}
+		msg := pubsub.Message{
+			Topic: pubsub.TradeTopic,
+			Value: tr,
+		}
+		if source, ok := tradeSource.(trade.OffsetSource); ok {
+			msg.Offset = source.Offset()
+		}
+		if err := stream.Publish(msg); err != nil {
+			return errors.Wrap(err, "publish trade failed")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// openOutput opens the file at the path for writing query results to,
+// or stdout if the path is empty or "-".
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "create output file failed")
+	}
+	return f, nil
+}
+
+// parseInstrumentIDs parses instruments given by ID, as they must be for stores with no instrument reference data.
+func parseInstrumentIDs(args []string) ([]int64, error) {
+	instrumentIDs := make([]int64, len(args))
+	for i, arg := range args {
+		var err error
+		if instrumentIDs[i], err = strconv.ParseInt(arg, 10, 64); err != nil {
+			return nil, errors.Wrapf(err, "instrument %q must be given by ID with this store", arg)
+		}
+	}
+	return instrumentIDs, nil
+}
+
+// instrumentFromID returns an instrument with only the ID given by the argument,
+// for stores with no instrument reference data.
+func instrumentFromID(arg string) (*models.Instrument, error) {
+	instrumentIDs, err := parseInstrumentIDs([]string{arg})
+	if err != nil {
+		return nil, err
+	}
+	return &models.Instrument{ID: instrumentIDs[0]}, nil
+}
@@ -22,6 +22,7 @@ func TestPositionApp(t *testing.T) {
 	}
 	t.Run("TestPosition", testPosition)
 	t.Run("TestPositionSuppliedExample", testPositionSuppliedExample)
+	t.Run("TestPositionAccounts", testPositionAccounts)
 }
 
 type positionAppTest struct {
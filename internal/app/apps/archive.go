@@ -0,0 +1,172 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/retention"
+	"tradetracker/internal/pkg/validate"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ArchiveAppCfg configures an ArchiveApp.
+type ArchiveAppCfg interface {
+	ApplyArchiveApp(*ArchiveApp) error
+}
+
+// ArchiveApp is the application responsible for archiving old trades and positions out of the database
+// into the Dir directory, and for restoring them. Trades and positions are archived before the Before time,
+// but never within the retention period of an instrument's retention policy. If Before is zero,
+// only instruments with a retention policy are archived, up to the start of their retention period.
+// Each instrument is locked while it is archived or restored, as for the PositionApp.
+type ArchiveApp struct {
+	DB          *sql.DB `validate:"required"`
+	Dir         string
+	Before      time.Time
+	LockTimeout time.Duration
+}
+
+// NewArchiveApp creates a new ArchiveApp.
+func NewArchiveApp(cfgs ...ArchiveAppCfg) (*ArchiveApp, error) {
+	app := &ArchiveApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyArchiveApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply ArchiveApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate ArchiveApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app. The first argument is the action to perform, which is one of:
+//
+//   archive [instrument...]
+//   restore dir...
+func (app *ArchiveApp) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing action argument")
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	switch args[0] {
+	case "archive":
+		return app.archive(ctx, r, args[1:])
+	case "restore":
+		return app.restore(ctx, r, args[1:])
+	default:
+		return fmt.Errorf("unknown archive action: %s", args[0])
+	}
+}
+
+// archive archives the given instruments, or every instrument if none are given.
+func (app *ArchiveApp) archive(ctx context.Context, r *repo.Repo, refs []string) error {
+	if app.Dir == "" {
+		return errors.New("missing archive directory")
+	}
+	policies, err := r.ReadRetentionPolicies(ctx)
+	if err != nil {
+		return errors.Wrap(err, "read retention policies failed")
+	}
+	byInstrument := make(map[int64]*models.RetentionPolicy, len(policies))
+	for _, policy := range policies {
+		byInstrument[policy.InstrumentID] = policy
+	}
+	instruments := instrument.NewRegistry(r)
+	var instrumentIDs []int64
+	switch {
+	case len(refs) > 0:
+		// resolve the instruments from their IDs, symbols or ISINs
+		resolved, err := instruments.ResolveAll(ctx, refs)
+		if err != nil {
+			return errors.Wrap(err, "resolve instruments failed")
+		}
+		for _, inst := range resolved {
+			instrumentIDs = append(instrumentIDs, inst.ID)
+		}
+	case app.Before.IsZero():
+		for _, policy := range policies {
+			instrumentIDs = append(instrumentIDs, policy.InstrumentID)
+		}
+	default:
+		if instrumentIDs, err = r.ReadInstrumentIDs(ctx); err != nil {
+			return errors.Wrap(err, "read instrument IDs failed")
+		}
+	}
+	now := time.Now()
+	for _, instrumentID := range instrumentIDs {
+		fields := logrus.Fields{
+			"instrument_id": instrumentID,
+			"symbol":        instruments.Symbol(ctx, instrumentID),
+		}
+		cutoff := retention.Cutoff(byInstrument[instrumentID], app.Before, now)
+		if cutoff.IsZero() {
+			logger.WithFields(fields).Info("no retention policy, so nothing to archive")
+			continue
+		}
+		fields["before"] = cutoff.UTC()
+		lock, err := lockInstrument(ctx, r, instrumentID, "archive", app.LockTimeout)
+		if err != nil {
+			return errors.Wrapf(err, "lock instrument %d failed", instrumentID)
+		}
+		manifest, path, err := retention.Archive(ctx, r, app.Dir, instrumentID, cutoff)
+		unlockInstrument(lock, instrumentID)
+		if err != nil {
+			return errors.Wrapf(err, "archive instrument %d failed", instrumentID)
+		}
+		if manifest == nil {
+			logger.WithFields(fields).Info("nothing to archive")
+			continue
+		}
+		fields["archive_id"] = manifest.ArchiveID
+		fields["path"] = path
+		for _, file := range manifest.Files {
+			fields[file.Name] = file.Rows
+		}
+		logger.WithFields(fields).Info("archived")
+	}
+	return nil
+}
+
+// restore restores the archives in the given directories, in order.
+func (app *ArchiveApp) restore(ctx context.Context, r *repo.Repo, dirs []string) error {
+	if len(dirs) < 1 {
+		return errors.New("missing archive directory argument")
+	}
+	for _, dir := range dirs {
+		manifest, err := retention.ReadManifest(dir)
+		if err != nil {
+			return errors.Wrapf(err, "read manifest of %s failed", dir)
+		}
+		instrumentID := manifest.InstrumentID
+		lock, err := lockInstrument(ctx, r, instrumentID, "restore", app.LockTimeout)
+		if err != nil {
+			return errors.Wrapf(err, "lock instrument %d failed", instrumentID)
+		}
+		manifest, err = retention.Restore(ctx, r, dir)
+		unlockInstrument(lock, instrumentID)
+		if err != nil {
+			return errors.Wrapf(err, "restore %s failed", dir)
+		}
+		fields := logrus.Fields{
+			"archive_id":    manifest.ArchiveID,
+			"instrument_id": manifest.InstrumentID,
+			"before":        manifest.Before,
+		}
+		for _, file := range manifest.Files {
+			fields[file.Name] = file.Rows
+		}
+		logger.WithFields(fields).Info("restored")
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"tradetracker/internal/pkg/bar"
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/pubsub"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/trade"
+	"tradetracker/internal/pkg/validate"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// BarAppCfg configures a BarApp.
+type BarAppCfg interface {
+	ApplyBarApp(*BarApp) error
+}
+
+// BarApp is the application responsible for generating OHLCV bars from trade data.
+type BarApp struct {
+	DB       *sql.DB       `validate:"required"`
+	Interval time.Duration `validate:"required,min=1s"`
+}
+
+// NewBarApp creates a new BarApp.
+func NewBarApp(cfgs ...BarAppCfg) (*BarApp, error) {
+	app := &BarApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyBarApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply BarApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate BarApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app.
+func (app *BarApp) Run(ctx context.Context, args []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// parse the arguments
+	if len(args) < 1 {
+		return errors.New("missing instrument argument")
+	}
+	intervalSeconds := int64(app.Interval / time.Second)
+	// set up the repository to interact with trades and bars in the database
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	// resolve the instrument from its ID, symbol or ISIN
+	instruments := instrument.NewRegistry(r)
+	inst, err := instruments.Resolve(ctx, args[0])
+	if err != nil {
+		return errors.Wrap(err, "resolve instrument failed")
+	}
+	instrumentID := inst.ID
+	// create a dummy pubsub stream
+	stream := pubsub.NewMemoryPubSub()
+	// create a trade source to read trade data from the repo
+	tradeSource := trade.NewRepoSource(r, instrumentID, time.Time{}) // reads all trades, for purposes of this demo
+	if err := tradeSource.Prepare(ctx); err != nil {
+		return errors.Wrap(err, "prepare trade source failed")
+	}
+	processor, err := bar.NewProcessor(
+		bar.WithRepo(r),
+		bar.WithSubscriber(stream),
+		bar.WithInstruments(instruments),
+		bar.WithBuilder(
+			bar.NewIntervalBuilder(intervalSeconds, instrumentID),
+		),
+	)
+	if err != nil {
+		return errors.Wrap(err, "new bar processor failed")
+	}
+	// delete bars for the instrument and interval so they can be regenerated
+	n, err := r.DeleteBars(ctx, instrumentID, intervalSeconds)
+	if err != nil {
+		return errors.Wrap(err, "delete bars failed")
+	}
+	logger.Infof("deleted %d bars", n)
+	// send the trade data across the stream for it to be processed
+	go publishTrades(ctx, tradeSource, stream)
+	// process the trade data
+	return errors.Wrap(processor.Process(ctx), "process bars failed")
+}
+
+// BarQueryAppCfg configures a BarQueryApp.
+type BarQueryAppCfg interface {
+	ApplyBarQueryApp(*BarQueryApp) error
+}
+
+// BarQueryApp is the application responsible for querying OHLCV bars.
+type BarQueryApp struct {
+	DB       *sql.DB       `validate:"required"`
+	Interval time.Duration `validate:"required,min=1s"`
+	From     time.Time
+	To       time.Time
+}
+
+// NewBarQueryApp creates a new BarQueryApp.
+func NewBarQueryApp(cfgs ...BarQueryAppCfg) (*BarQueryApp, error) {
+	app := &BarQueryApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyBarQueryApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply BarQueryApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate BarQueryApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app.
+func (app *BarQueryApp) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing instrument argument")
+	}
+	to := app.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	// resolve the instrument from its ID, symbol or ISIN
+	inst, err := instrument.NewRegistry(r).Resolve(ctx, args[0])
+	if err != nil {
+		return errors.Wrap(err, "resolve instrument failed")
+	}
+	bars, err := r.ReadBars(ctx, inst.ID, int64(app.Interval/time.Second), app.From, to)
+	if err != nil {
+		return errors.Wrap(err, "read bars failed")
+	}
+	for _, b := range bars {
+		logger.WithFields(logrus.Fields{
+			"instrument_id": b.InstrumentID,
+			"symbol":        inst.Symbol,
+			"open":          b.Open,
+			"high":          b.High,
+			"low":           b.Low,
+			"close":         b.Close,
+			"volume":        b.Volume,
+			"vwap":          b.VWAP,
+			"trade_count":   b.TradeCount,
+			"timestamp":     b.Timestamp,
+		}).Info("bar found")
+	}
+	logger.Infof("found %d bars", len(bars))
+	return nil
+}
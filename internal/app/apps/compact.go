@@ -0,0 +1,61 @@
+package apps
+
+import (
+	"context"
+	"time"
+
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/validate"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// CompactAppCfg configures a CompactApp.
+type CompactAppCfg interface {
+	ApplyCompactApp(*CompactApp) error
+}
+
+// CompactApp is the application responsible for compacting the file store.
+// It drops the positions superseded before the Before time, or now if it is zero,
+// after which they can no longer be queried as known before that time.
+type CompactApp struct {
+	DataDir string `validate:"required"`
+	Before  time.Time
+}
+
+// NewCompactApp creates a new CompactApp.
+func NewCompactApp(cfgs ...CompactAppCfg) (*CompactApp, error) {
+	app := &CompactApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyCompactApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply CompactApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate CompactApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app.
+func (app *CompactApp) Run(ctx context.Context, args []string) error {
+	before := app.Before
+	if before.IsZero() {
+		before = time.Now()
+	}
+	r, err := repo.OpenFileRepo(app.DataDir)
+	if err != nil {
+		return errors.Wrap(err, "open file repo failed")
+	}
+	defer r.Close()
+	dropped, err := r.Compact(ctx, before)
+	if err != nil {
+		return errors.Wrap(err, "compact failed")
+	}
+	logger.WithFields(logrus.Fields{
+		"before":  before.UTC(),
+		"dropped": dropped,
+	}).Info("compacted superseded positions")
+	return errors.Wrap(r.Close(), "close file repo failed")
+}
@@ -0,0 +1,164 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"time"
+
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/output"
+	"tradetracker/internal/pkg/position"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/timeexpr"
+	"tradetracker/internal/pkg/validate"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DiffAppCfg configures a DiffApp.
+type DiffAppCfg interface {
+	ApplyDiffApp(*DiffApp) error
+}
+
+// DiffApp is the application responsible for reporting how positions have changed, either between
+// two timestamps, or between a snapshot saved before a rebuild and the current positions at the same timestamp.
+// Like the SnapshotApp, the positions are for a single account if one is set, otherwise they are
+// aggregated over a portfolio, or over all accounts if no portfolio is set.
+// Only the given instruments are compared, or every instrument if none are given.
+type DiffApp struct {
+	DB          *sql.DB `validate:"required"`
+	AccountID   *int64
+	PortfolioID int64
+	Instruments []string
+	Against     string // the path of a saved snapshot to compare against, or - for stdin
+	Format      output.Format
+	Output      string
+}
+
+// NewDiffApp creates a new DiffApp.
+func NewDiffApp(cfgs ...DiffAppCfg) (*DiffApp, error) {
+	app := &DiffApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyDiffApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply DiffApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate DiffApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app.
+func (app *DiffApp) Run(ctx context.Context, args []string) error {
+	timestamps := make([]time.Time, len(args))
+	for i, arg := range args {
+		var err error
+		if timestamps[i], err = timeexpr.Parse(arg); err != nil {
+			return errors.Wrap(err, "parse timestamp failed")
+		}
+	}
+	switch {
+	case app.Against != "" && len(timestamps) != 1:
+		return errors.New("diff against a snapshot requires exactly one timestamp")
+	case app.Against == "" && len(timestamps) != 2:
+		return errors.New("diff requires exactly two timestamps")
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	var before []*models.Position
+	if app.Against != "" {
+		var in io.Reader = os.Stdin
+		if app.Against != "-" {
+			f, err := os.Open(app.Against)
+			if err != nil {
+				return errors.Wrap(err, "open file failed")
+			}
+			defer f.Close()
+			in = f
+		}
+		if before, err = position.ReadSnapshot(in); err != nil {
+			return errors.Wrap(err, "read saved snapshot failed")
+		}
+	} else if before, err = r.ReadSnapshot(ctx, app.AccountID, app.PortfolioID, timestamps[0], false); err != nil {
+		return errors.Wrap(err, "read snapshot failed")
+	}
+	after, err := r.ReadSnapshot(ctx, app.AccountID, app.PortfolioID, timestamps[len(timestamps)-1], false)
+	if err != nil {
+		return errors.Wrap(err, "read snapshot failed")
+	}
+	if len(app.Instruments) > 0 {
+		// resolve the instruments from their IDs, symbols or ISINs
+		instruments := instrument.NewRegistry(r)
+		include := make(map[int64]bool, len(app.Instruments))
+		for _, ref := range app.Instruments {
+			inst, err := instruments.Resolve(ctx, ref)
+			if err != nil {
+				return errors.Wrap(err, "resolve instrument failed")
+			}
+			include[inst.ID] = true
+		}
+		before = filterInstruments(before, include)
+		after = filterInstruments(after, include)
+	}
+	instruments, err := r.ReadInstruments(ctx)
+	if err != nil {
+		return errors.Wrap(err, "read instruments failed")
+	}
+	symbols := make(map[int64]string, len(instruments))
+	for _, inst := range instruments {
+		symbols[inst.ID] = inst.Symbol
+	}
+	out, err := openOutput(app.Output)
+	if err != nil {
+		return errors.Wrap(err, "open output failed")
+	}
+	defer out.Close()
+	format := app.Format
+	if format == "" {
+		format = output.Table
+	}
+	w, err := output.NewWriter(out, format, "instrument_id", "symbol", "before", "after", "change")
+	if err != nil {
+		return errors.Wrap(err, "new output writer failed")
+	}
+	changes := position.Diff(before, after)
+	for _, change := range changes {
+		beforeSize, afterSize := decimal.Zero, decimal.Zero
+		if change.Before != nil {
+			beforeSize = change.Before.Size
+		}
+		if change.After != nil {
+			afterSize = change.After.Size
+		}
+		if err := w.Write(change.InstrumentID, symbols[change.InstrumentID], beforeSize, afterSize, change.Size()); err != nil {
+			return errors.Wrap(err, "write change failed")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "flush output failed")
+	}
+	logger.WithFields(logrus.Fields{
+		"changed":   len(changes),
+		"timestamp": timestamps[len(timestamps)-1],
+	}).Info("diffed positions")
+	return nil
+}
+
+// filterInstruments returns the positions in the included instruments.
+func filterInstruments(positions []*models.Position, include map[int64]bool) []*models.Position {
+	var filtered []*models.Position
+	for _, pos := range positions {
+		if include[pos.InstrumentID] {
+			filtered = append(filtered, pos)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,127 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/output"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/timeexpr"
+	"tradetracker/internal/pkg/validate"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ExplainAppCfg configures an ExplainApp.
+type ExplainAppCfg interface {
+	ApplyExplainApp(*ExplainApp) error
+}
+
+// ExplainApp is the application responsible for explaining a position by the trades which produced it.
+// Like the QueryApp, the position is for a single account if one is set, otherwise it is
+// aggregated over a portfolio, or over all accounts if no portfolio is set.
+type ExplainApp struct {
+	DB          *sql.DB `validate:"required"`
+	AccountID   *int64
+	PortfolioID int64
+	Format      output.Format
+	Output      string
+}
+
+// NewExplainApp creates a new ExplainApp.
+func NewExplainApp(cfgs ...ExplainAppCfg) (*ExplainApp, error) {
+	app := &ExplainApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyExplainApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply ExplainApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate ExplainApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app.
+func (app *ExplainApp) Run(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New("missing instrument or timestamp argument")
+	}
+	timestamp, err := timeexpr.Parse(args[1])
+	if err != nil {
+		return errors.Wrap(err, "parse timestamp failed")
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	// resolve the instrument from its ID, symbol or ISIN
+	inst, err := instrument.NewRegistry(r).Resolve(ctx, args[0])
+	if err != nil {
+		return errors.Wrap(err, "resolve instrument failed")
+	}
+	var pos *models.Position
+	fields := logrus.Fields{
+		"instrument_id": inst.ID,
+		"symbol":        inst.Symbol,
+	}
+	if app.AccountID != nil {
+		pos, err = r.ReadPosition(ctx, inst.ID, *app.AccountID, timestamp, time.Time{})
+		if err != nil {
+			return errors.Wrap(err, "read position failed")
+		}
+		fields["account_id"] = pos.AccountID
+		fields["trade_ids"] = pos.TradeIDs
+	} else {
+		pos, err = r.ReadPortfolioPosition(ctx, inst.ID, app.PortfolioID, timestamp, time.Time{})
+		if err != nil {
+			return errors.Wrap(err, "read portfolio position failed")
+		}
+		fields["portfolio_id"] = app.PortfolioID
+	}
+	fields["size"] = pos.Size
+	fields["timestamp"] = pos.Timestamp
+	logger.WithFields(fields).Info("position found")
+	trades, err := r.ReadPositionTrades(ctx, inst.ID, app.AccountID, app.PortfolioID, timestamp)
+	if err != nil {
+		return errors.Wrap(err, "read position trades failed")
+	}
+	out, err := openOutput(app.Output)
+	if err != nil {
+		return errors.Wrap(err, "open output failed")
+	}
+	defer out.Close()
+	format := app.Format
+	if format == "" {
+		format = output.Table
+	}
+	w, err := output.NewWriter(out, format,
+		"id", "account_id", "size", "price", "timestamp", "created_at", "running_size",
+	)
+	if err != nil {
+		return errors.Wrap(err, "new output writer failed")
+	}
+	running := decimal.Zero
+	for _, tr := range trades {
+		running = running.Add(tr.Size)
+		if err := w.Write(tr.ID, tr.AccountID, tr.Size, tr.Price, tr.Timestamp.UTC(), tr.CreatedAt, running); err != nil {
+			return errors.Wrap(err, "write trade failed")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "flush output failed")
+	}
+	// positions built before their lineage was recorded have no trades to account for them
+	if !running.Equal(pos.Size) {
+		logger.WithFields(logrus.Fields{
+			"size":         pos.Size,
+			"running_size": running,
+		}).Warn("trades do not account for the position")
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/validate"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// InstrumentAppCfg configures an InstrumentApp.
+type InstrumentAppCfg interface {
+	ApplyInstrumentApp(*InstrumentApp) error
+}
+
+// InstrumentApp is the application responsible for managing instrument reference data.
+type InstrumentApp struct {
+	DB *sql.DB `validate:"required"`
+	// Instrument holds the reference data for an instrument to add, other than its symbol.
+	Instrument models.Instrument
+}
+
+// NewInstrumentApp creates a new InstrumentApp.
+func NewInstrumentApp(cfgs ...InstrumentAppCfg) (*InstrumentApp, error) {
+	app := &InstrumentApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyInstrumentApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply InstrumentApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate InstrumentApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app. The first argument is the action to perform, which is one of:
+//
+//   add symbol
+//   list
+//   show instrument
+//   import file
+func (app *InstrumentApp) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing action argument")
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	switch args[0] {
+	case "add":
+		return app.add(ctx, r, args[1:])
+	case "list":
+		return app.list(ctx, r)
+	case "show":
+		return app.show(ctx, r, args[1:])
+	case "import":
+		return app.importCSV(ctx, r, args[1:])
+	default:
+		return fmt.Errorf("unknown instrument action: %s", args[0])
+	}
+}
+
+func (app *InstrumentApp) add(ctx context.Context, r repo.InstrumentRepo, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing symbol argument")
+	}
+	inst := app.Instrument
+	inst.Symbol = args[0]
+	if err := instrument.Validate(&inst); err != nil {
+		return errors.Wrap(err, "validate instrument failed")
+	}
+	id, err := r.CreateInstrument(ctx, &inst)
+	if err != nil {
+		return errors.Wrap(err, "create instrument failed")
+	}
+	inst.ID = int64(id)
+	logInstrument(&inst).Info("added instrument")
+	return nil
+}
+
+func (app *InstrumentApp) list(ctx context.Context, r repo.InstrumentRepo) error {
+	instruments, err := r.ReadInstruments(ctx)
+	if err != nil {
+		return errors.Wrap(err, "read instruments failed")
+	}
+	for _, inst := range instruments {
+		logInstrument(inst).Info("instrument found")
+	}
+	return nil
+}
+
+func (app *InstrumentApp) show(ctx context.Context, r repo.InstrumentRepo, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing instrument argument")
+	}
+	inst, err := instrument.NewRegistry(r).Resolve(ctx, args[0])
+	if err != nil {
+		return errors.Wrap(err, "resolve instrument failed")
+	}
+	if inst.Symbol == "" {
+		return errors.Wrapf(instrument.ErrUnknownInstrument, "instrument %d", inst.ID)
+	}
+	logInstrument(inst).Info("instrument found")
+	return nil
+}
+
+func (app *InstrumentApp) importCSV(ctx context.Context, r repo.InstrumentRepo, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing file argument")
+	}
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return errors.Wrap(err, "open file failed")
+		}
+		defer f.Close()
+		in = f
+	}
+	instruments, err := instrument.ReadCSV(in)
+	if err != nil {
+		return errors.Wrap(err, "read instruments failed")
+	}
+	if err := r.UpsertInstruments(ctx, instruments); err != nil {
+		return errors.Wrap(err, "upsert instruments failed")
+	}
+	for _, inst := range instruments {
+		logInstrument(inst).Info("imported instrument")
+	}
+	logger.Infof("imported %d instruments", len(instruments))
+	return nil
+}
+
+func logInstrument(inst *models.Instrument) logrus.FieldLogger {
+	return logger.WithFields(logrus.Fields{
+		"id":             inst.ID,
+		"symbol":         inst.Symbol,
+		"isin":           inst.ISIN,
+		"cusip":          inst.CUSIP,
+		"asset_class":    inst.AssetClass,
+		"currency":       inst.Currency,
+		"lot_size":       inst.LotSize,
+		"tick_size":      inst.TickSize,
+		"multiplier":     inst.Multiplier,
+		"quantity_scale": inst.QuantityScale,
+		"active_from":    inst.ActiveFrom,
+		"active_to":      inst.ActiveTo,
+	})
+}
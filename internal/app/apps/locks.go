@@ -0,0 +1,123 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/output"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/validate"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// LocksAppCfg configures a LocksApp.
+type LocksAppCfg interface {
+	ApplyLocksApp(*LocksApp) error
+}
+
+// LocksApp is the application responsible for showing which processes hold the locks on instruments
+// taken while writing their positions.
+type LocksApp struct {
+	DB     *sql.DB `validate:"required"`
+	Format output.Format
+	Output string
+}
+
+// NewLocksApp creates a new LocksApp.
+func NewLocksApp(cfgs ...LocksAppCfg) (*LocksApp, error) {
+	app := &LocksApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyLocksApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply LocksApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate LocksApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app.
+func (app *LocksApp) Run(ctx context.Context, args []string) error {
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	locks, err := r.ReadLocks(ctx)
+	if err != nil {
+		return errors.Wrap(err, "read locks failed")
+	}
+	instruments := instrument.NewRegistry(r)
+	out, err := openOutput(app.Output)
+	if err != nil {
+		return errors.Wrap(err, "open output failed")
+	}
+	defer out.Close()
+	format := app.Format
+	if format == "" {
+		format = output.Table
+	}
+	w, err := output.NewWriter(out, format, "instrument_id", "symbol", "pid", "holder", "user", "client_addr", "since")
+	if err != nil {
+		return errors.Wrap(err, "new output writer failed")
+	}
+	for _, lock := range locks {
+		if err := w.Write(
+			lock.InstrumentID, instruments.Symbol(ctx, lock.InstrumentID), lock.PID, lock.Holder, lock.User, lock.ClientAddr, lock.Since.UTC(),
+		); err != nil {
+			return errors.Wrap(err, "write lock failed")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "flush output failed")
+	}
+	logger.Infof("found %d locks", len(locks))
+	return nil
+}
+
+// lockHolder describes this process as the holder of an instrument lock taken for the action,
+// so that the locks command can show who holds it.
+func lockHolder(action string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("tradetracker %s (%s pid %d)", action, host, os.Getpid())
+}
+
+// lockInstrument takes the lock on the instrument for the action, waiting up to the timeout for another process
+// to release it. If it is not released in time, the error says which process holds it.
+func lockInstrument(
+	ctx context.Context, r *repo.Repo, instrumentID int64, action string, timeout time.Duration,
+) (*repo.InstrumentLock, error) {
+	lock, err := r.LockInstrument(ctx, instrumentID, lockHolder(action), timeout)
+	if !errors.Is(err, repo.ErrLocked) {
+		return lock, err
+	}
+	locks, lerr := r.ReadLocks(ctx)
+	if lerr != nil {
+		return nil, err
+	}
+	for _, held := range locks {
+		if held.InstrumentID == instrumentID {
+			return nil, errors.Wrapf(err, "held by %s (backend pid %d) since %s", held.Holder, held.PID, held.Since.UTC().Format(time.RFC3339))
+		}
+	}
+	return nil, err
+}
+
+// unlockInstrument releases the lock on the instrument, logging rather than returning any error,
+// as the lock is released when the connection closes regardless.
+func unlockInstrument(lock *repo.InstrumentLock, instrumentID int64) {
+	if err := lock.Unlock(); err != nil {
+		logger.WithFields(logrus.Fields{
+			"instrument_id": instrumentID,
+		}).WithError(err).Warn("unlock instrument failed")
+	}
+}
@@ -0,0 +1,123 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"tradetracker/internal/pkg/db"
+	"tradetracker/internal/pkg/validate"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// MigrateAppCfg configures a MigrateApp.
+type MigrateAppCfg interface {
+	ApplyMigrateApp(*MigrateApp) error
+}
+
+// MigrateApp is the application responsible for migrating the database with the migrations embedded in the binary.
+// Limit is the maximum number of migrations to apply or roll back; if it is zero, every pending migration is
+// applied but only the latest is rolled back, unless All is set to roll back every migration.
+type MigrateApp struct {
+	DB    *sql.DB `validate:"required"`
+	Limit int     `validate:"min=0"`
+	All   bool
+}
+
+// NewMigrateApp creates a new MigrateApp.
+func NewMigrateApp(cfgs ...MigrateAppCfg) (*MigrateApp, error) {
+	app := &MigrateApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyMigrateApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply MigrateApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate MigrateApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app, given the action as the first argument:
+//   up
+//   down
+//   status
+//   redo
+func (app *MigrateApp) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing action argument")
+	}
+	m, err := db.NewMigrator(app.DB)
+	if err != nil {
+		return errors.Wrap(err, "new migrator failed")
+	}
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx, app.Limit)
+		logMigrations(applied, "applied migration")
+		if err != nil {
+			return errors.Wrap(err, "migrate up failed")
+		}
+		logger.Infof("applied %d migrations", len(applied))
+		return nil
+	case "down":
+		limit := app.Limit
+		if limit == 0 && !app.All {
+			limit = 1
+		}
+		rolledBack, err := m.Down(ctx, limit)
+		logMigrations(rolledBack, "rolled back migration")
+		if err != nil {
+			return errors.Wrap(err, "migrate down failed")
+		}
+		logger.Infof("rolled back %d migrations", len(rolledBack))
+		return nil
+	case "redo":
+		id, err := m.Redo(ctx)
+		if err != nil {
+			return errors.Wrap(err, "redo migration failed")
+		}
+		logger.WithField("id", id).Info("redid migration")
+		return nil
+	case "status":
+		return app.status(ctx, m)
+	default:
+		return fmt.Errorf("unknown migrate action: %s", args[0])
+	}
+}
+
+func (app *MigrateApp) status(ctx context.Context, m *db.Migrator) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return errors.Wrap(err, "read migration status failed")
+	}
+	pending := 0
+	for _, status := range statuses {
+		fields := logrus.Fields{
+			"id": status.ID,
+		}
+		switch {
+		case status.AppliedAt.IsZero():
+			fields["status"] = "pending"
+			pending++
+		case status.Migration == nil:
+			fields["status"] = "unknown"
+			fields["applied_at"] = status.AppliedAt
+		default:
+			fields["status"] = "applied"
+			fields["applied_at"] = status.AppliedAt
+		}
+		logger.WithFields(fields).Info("migration")
+	}
+	logger.Infof("%d migrations pending", pending)
+	return nil
+}
+
+// logMigrations logs the ID of each migration with the message.
+func logMigrations(ids []string, msg string) {
+	for _, id := range ids {
+		logger.WithField("id", id).Info(msg)
+	}
+}
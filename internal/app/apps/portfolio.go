@@ -0,0 +1,131 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/validate"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// PortfolioAppCfg configures a PortfolioApp.
+type PortfolioAppCfg interface {
+	ApplyPortfolioApp(*PortfolioApp) error
+}
+
+// PortfolioApp is the application responsible for managing the hierarchy of portfolios that accounts are grouped into.
+type PortfolioApp struct {
+	DB *sql.DB `validate:"required"`
+}
+
+// NewPortfolioApp creates a new PortfolioApp.
+func NewPortfolioApp(cfgs ...PortfolioAppCfg) (*PortfolioApp, error) {
+	app := &PortfolioApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyPortfolioApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply PortfolioApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate PortfolioApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app. The first argument is the action to perform, which is one of:
+//
+//   create name [parentID]
+//   assign portfolioID accountID...
+//   list
+func (app *PortfolioApp) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing action argument")
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	switch args[0] {
+	case "create":
+		return app.create(ctx, r, args[1:])
+	case "assign":
+		return app.assign(ctx, r, args[1:])
+	case "list":
+		return app.list(ctx, r)
+	default:
+		return fmt.Errorf("unknown portfolio action: %s", args[0])
+	}
+}
+
+func (app *PortfolioApp) create(ctx context.Context, r repo.PortfolioRepo, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing name argument")
+	}
+	portfolio := &models.Portfolio{
+		Name: args[0],
+	}
+	if len(args) > 1 {
+		parentID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "parse parent ID failed")
+		}
+		portfolio.ParentID = parentID
+	}
+	id, err := r.CreatePortfolio(ctx, portfolio)
+	if err != nil {
+		return errors.Wrap(err, "create portfolio failed")
+	}
+	logger.WithFields(logrus.Fields{
+		"id":        id,
+		"name":      portfolio.Name,
+		"parent_id": portfolio.ParentID,
+	}).Info("added portfolio")
+	return nil
+}
+
+func (app *PortfolioApp) assign(ctx context.Context, r repo.PortfolioRepo, args []string) error {
+	if len(args) < 2 {
+		return errors.New("requires a portfolio ID and at least one account ID")
+	}
+	portfolioID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "parse portfolio ID failed")
+	}
+	accountIDs := make([]int64, len(args)-1)
+	for i := range accountIDs {
+		accountIDs[i], err = strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "parse account ID failed")
+		}
+	}
+	if err := r.AddPortfolioAccounts(ctx, portfolioID, accountIDs); err != nil {
+		return errors.Wrap(err, "add portfolio accounts failed")
+	}
+	logger.WithFields(logrus.Fields{
+		"portfolio_id": portfolioID,
+		"account_ids":  accountIDs,
+	}).Info("assigned accounts")
+	return nil
+}
+
+func (app *PortfolioApp) list(ctx context.Context, r repo.PortfolioRepo) error {
+	portfolios, err := r.ReadPortfolios(ctx)
+	if err != nil {
+		return errors.Wrap(err, "read portfolios failed")
+	}
+	for _, p := range portfolios {
+		logger.WithFields(logrus.Fields{
+			"id":          p.ID,
+			"name":        p.Name,
+			"parent_id":   p.ParentID,
+			"account_ids": p.AccountIDs,
+		}).Info("portfolio found")
+	}
+	return nil
+}
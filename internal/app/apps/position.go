@@ -3,27 +3,38 @@ package apps
 import (
 	"context"
 	"database/sql"
-	"io"
-	"strconv"
 	"time"
 
+	"tradetracker/internal/pkg/instrument"
 	"tradetracker/internal/pkg/position"
 	"tradetracker/internal/pkg/pubsub"
 	"tradetracker/internal/pkg/repo"
 	"tradetracker/internal/pkg/trade"
 	"tradetracker/internal/pkg/validate"
+	"tradetracker/pkg/models"
 
 	"github.com/pkg/errors"
 )
 
+// positionBuildRepo reads trades and stores the positions built from them.
+type positionBuildRepo interface {
+	repo.TradeRepo
+	repo.PositionRepo
+}
+
 // PositionAppCfg configures a PositionApp.
 type PositionAppCfg interface {
 	ApplyPositionApp(*PositionApp) error
 }
 
 // PositionApp is the demo application responsible for carrying out CLI commands.
+// If DataDir is set, the trades and positions are in the file store in that directory rather than the database.
+// Otherwise the instrument is locked while its positions are rebuilt, waiting up to LockTimeout for any other
+// process writing them to finish; a zero LockTimeout fails fast, and a negative one waits indefinitely.
 type PositionApp struct {
-	DB *sql.DB `validate:"required"`
+	DB          *sql.DB `validate:"required_without=DataDir"`
+	DataDir     string
+	LockTimeout time.Duration
 }
 
 // NewPositionApp creates a new PositionApp.
@@ -46,17 +57,53 @@ func (app *PositionApp) Run(ctx context.Context, args []string) error {
 	defer cancel()
 	// parse the arguments
 	if len(args) < 1 {
-		return errors.New("missing instrument ID argument")
+		return errors.New("missing instrument argument")
 	}
-	instrumentID, err := strconv.ParseInt(args[0], 10, 64)
-	if err != nil {
-		return errors.Wrap(err, "parse instrument ID failed")
+	if app.DataDir != "" {
+		inst, err := instrumentFromID(args[0])
+		if err != nil {
+			return errors.Wrap(err, "parse instrument failed")
+		}
+		r, err := repo.OpenFileRepo(app.DataDir)
+		if err != nil {
+			return errors.Wrap(err, "open file repo failed")
+		}
+		defer r.Close()
+		if err := app.buildPositions(ctx, r, nil, inst.ID, nil); err != nil {
+			return err
+		}
+		return errors.Wrap(r.Close(), "close file repo failed")
 	}
 	// set up the repository to interact with trades and positions in the database
 	r, err := repo.NewRepo(repo.WithDB(app.DB))
 	if err != nil {
 		return errors.Wrap(err, "new repo failed")
 	}
+	// resolve the instrument from its ID, symbol or ISIN
+	instruments := instrument.NewRegistry(r)
+	inst, err := instruments.Resolve(ctx, args[0])
+	if err != nil {
+		return errors.Wrap(err, "resolve instrument failed")
+	}
+	// hold the instrument lock while the positions are rebuilt, so that concurrent rebuilds cannot interleave
+	lock, err := lockInstrument(ctx, r, inst.ID, "position", app.LockTimeout)
+	if err != nil {
+		return errors.Wrap(err, "lock instrument failed")
+	}
+	defer unlockInstrument(lock, inst.ID)
+	// archived trades are stood in for by seed positions, which the positions are built on
+	seeds, err := r.ReadSeedPositions(ctx, inst.ID)
+	if err != nil {
+		return errors.Wrap(err, "read seed positions failed")
+	}
+	return app.buildPositions(ctx, r, instruments, inst.ID, seeds)
+}
+
+// buildPositions supersedes the current positions in the instrument and builds them again from its trades
+// and any seed positions, logging their symbols if there is instrument reference data.
+func (app *PositionApp) buildPositions(
+	ctx context.Context, r positionBuildRepo, instruments *instrument.Registry, instrumentID int64, seeds []*models.Position,
+) error {
 	// create a dummy pubsub stream
 	stream := pubsub.NewMemoryPubSub()
 	// create a trade source to read trade data from the repo
@@ -64,50 +111,29 @@ func (app *PositionApp) Run(ctx context.Context, args []string) error {
 	if err := tradeSource.Prepare(ctx); err != nil {
 		return errors.Wrap(err, "prepare trade source failed")
 	}
-	processor, err := position.NewProcessor(
+	cfgs := []position.Cfg{
 		position.WithRepo(r),
 		position.WithSubscriber(stream),
 		position.WithBuilder(
-			position.NewBinnedBuilder(1, instrumentID),
+			position.NewBinnedBuilder(1, instrumentID, position.WithSeed(seeds...)),
 		),
-	)
+	}
+	if instruments != nil {
+		cfgs = append(cfgs, position.WithInstruments(instruments))
+	}
+	processor, err := position.NewProcessor(cfgs...)
 	if err != nil {
 		return errors.Wrap(err, "new position processor failed")
 	}
-	// delete positions for the instrument from the date given
-	n, err := r.DeletePositions(ctx, instrumentID)
+	// supersede the current positions for the instrument, keeping them to query as previously known;
+	// seed positions are not superseded
+	n, err := r.SupersedePositions(ctx, instrumentID)
 	if err != nil {
-		return errors.Wrap(err, "delete positions failed")
+		return errors.Wrap(err, "supersede positions failed")
 	}
-	logger.Infof("deleted %d positions", n)
+	logger.Infof("superseded %d positions", n)
 	// send the trade data across the stream for it to be processed
-	go func() {
-		defer func() {
-			if err := stream.Close(ctx, pubsub.TradeTopic); err != nil {
-				logger.Fatalln(errors.Wrap(err, "close trade stream failed"))
-			}
-		}()
-		for {
-			tr, err := tradeSource.Next()
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			if err != nil {
-				logger.Fatalln(errors.Wrap(err, "next trade failed"))
-			}
-			if err := stream.Publish(pubsub.Message{
-				Topic: pubsub.TradeTopic,
-				Value: tr,
-			}); err != nil {
-				logger.Fatalln(errors.Wrap(err, "publish trade failed"))
-			}
-			select {
-			case <-ctx.Done():
-				return
-			default:
-			}
-		}
-	}()
+	go publishTrades(ctx, tradeSource, stream)
 	// process the trade data
 	return errors.Wrap(processor.Process(ctx), "process positions failed")
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"testing"
 	"time"
+	"tradetracker/pkg/decimal"
 	"tradetracker/pkg/models"
 
 	"github.com/pkg/errors"
@@ -22,7 +23,7 @@ func testPosition(t *testing.T) {
 			for i := 0; i < 5; i++ {
 				_, err := db.Exec(`
 					INSERT INTO trades (instrument_id, size, price, timestamp)
-					VALUES ($1::int, $2::int, $3::numeric, to_timestamp($4::bigint) AT TIME ZONE 'UTC')			
+					VALUES ($1::int, $2::int, $3::numeric, to_timestamp($4::bigint))			
 				`, 1, 10, 100.0, nowCpy)
 				if err != nil {
 					return errors.Wrap(err, "insert trade failed")
@@ -48,7 +49,7 @@ func testPosition(t *testing.T) {
 				))
 				require.Equal(t, i+1, position.ID, fmt.Sprintf("idx %d", i))
 				require.Equal(t, int64(1), position.InstrumentID, fmt.Sprintf("idx %d", i))
-				require.Equal(t, 10*(i+1), position.Size, fmt.Sprintf("idx %d", i))
+				require.Equal(t, decimal.NewFromInt(10*(i+1)), position.Size, fmt.Sprintf("idx %d", i))
 				require.Equal(t, now.Unix()+(i*10), position.Timestamp.Unix(), fmt.Sprintf("idx %d", i))
 				i++
 			}
@@ -68,7 +69,7 @@ func testPositionSuppliedExample(t *testing.T) {
 		for i := 0; i < len(instrumentIDs); i++ {
 			_, err := db.Exec(`
 				INSERT INTO trades (instrument_id, size, price, timestamp)
-				VALUES ($1::int, $2::int, $3::numeric, to_timestamp($4::bigint) AT TIME ZONE 'UTC')			
+				VALUES ($1::int, $2::int, $3::numeric, to_timestamp($4::bigint))			
 			`, instrumentIDs[i], sizes[i], prices[i], timestamps[i])
 			if err != nil {
 				return errors.Wrap(err, "insert trade failed")
@@ -100,7 +101,7 @@ func testPositionSuppliedExample(t *testing.T) {
 					))
 					require.Equal(t, i+1, position.ID, fmt.Sprintf("idx %d", i))
 					require.Equal(t, instrumentIDs[idxs[i]], position.InstrumentID, fmt.Sprintf("idx %d", i))
-					require.Equal(t, size, position.Size, fmt.Sprintf("idx %d", i))
+					require.Equal(t, decimal.NewFromInt(size), position.Size, fmt.Sprintf("idx %d", i))
 					require.Equal(t, timestamps[idxs[i]], position.Timestamp.Unix(), fmt.Sprintf("idx %d", i))
 					i++
 				}
@@ -133,7 +134,7 @@ func testPositionSuppliedExample(t *testing.T) {
 					))
 					require.Equal(t, i+1, position.ID, fmt.Sprintf("idx %d", i))
 					require.Equal(t, instrumentIDs[idxs[i]], position.InstrumentID, fmt.Sprintf("idx %d", i))
-					require.Equal(t, size, position.Size, fmt.Sprintf("idx %d", i))
+					require.Equal(t, decimal.NewFromInt(size), position.Size, fmt.Sprintf("idx %d", i))
 					require.Equal(t, timestamps[idxs[i]], position.Timestamp.Unix(), fmt.Sprintf("idx %d", i))
 					i++
 				}
@@ -143,3 +144,42 @@ func testPositionSuppliedExample(t *testing.T) {
 		).run(t)
 	})
 }
+
+func testPositionAccounts(t *testing.T) {
+	t.Parallel()
+	accountIDs := []int64{1, 2, 1, 2}
+	sizes := []int64{100, 50, -30, 25}
+	timestamps := []int64{1650896178, 1650896179, 1650896180, 1650896181}
+	newPositionAppTest(
+		withArgs([]string{"1"}),
+		withFixtures(func(db *sql.DB) error {
+			for i := 0; i < len(accountIDs); i++ {
+				_, err := db.Exec(`
+					INSERT INTO trades (instrument_id, account_id, size, price, timestamp)
+					VALUES (1, $1::bigint, $2::int, 10.0, to_timestamp($3::bigint))
+				`, accountIDs[i], sizes[i], timestamps[i])
+				if err != nil {
+					return errors.Wrap(err, "insert trade failed")
+				}
+			}
+			return nil
+		}),
+		withExpectations(func(db *sql.DB) error {
+			rows, err := db.Query("SELECT account_id, size, timestamp FROM positions ORDER BY id")
+			require.NoError(t, err)
+			expectedSizes := []int64{100, 50, 70, 75}
+			i := 0
+			for rows.Next() {
+				var position models.Position
+				require.NoError(t, rows.Scan(&position.AccountID, &position.Size, &position.Timestamp))
+				require.Equal(t, accountIDs[i], position.AccountID, fmt.Sprintf("idx %d", i))
+				require.Equal(t, decimal.NewFromInt(expectedSizes[i]), position.Size, fmt.Sprintf("idx %d", i))
+				require.Equal(t, timestamps[i], position.Timestamp.Unix(), fmt.Sprintf("idx %d", i))
+				i++
+			}
+			require.NoError(t, rows.Err())
+			require.Equal(t, len(accountIDs), i)
+			return nil
+		}),
+	).run(t)
+}
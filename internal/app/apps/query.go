@@ -3,11 +3,15 @@ package apps
 import (
 	"context"
 	"database/sql"
-	"strconv"
 	"time"
 
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/output"
+	"tradetracker/internal/pkg/position"
 	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/timeexpr"
 	"tradetracker/internal/pkg/validate"
+	"tradetracker/pkg/models"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -19,8 +23,23 @@ type QueryAppCfg interface {
 }
 
 // QueryApp is the demo application responsible for carrying out CLI commands.
+// It queries the position of a single account if one is set, otherwise the position
+// aggregated over a portfolio, or over all accounts if no portfolio is set.
+// If AsOf is set, the position is as it was known at that time, before any later corrections.
+// If History is set, it writes every change in position within the time range instead,
+// optionally resampled to the last position in each interval.
+// If DataDir is set, the positions are queried from the file store in that directory rather than the database.
 type QueryApp struct {
-	DB *sql.DB `validate:"required"`
+	DB          *sql.DB `validate:"required_without=DataDir"`
+	DataDir     string
+	AccountID   *int64
+	PortfolioID int64
+	AsOf        time.Time
+	History     bool
+	From, To    time.Time
+	Interval    time.Duration `validate:"omitempty,min=1s"`
+	Format      output.Format
+	Output      string
 }
 
 // NewQueryApp creates a new QueryApp.
@@ -40,31 +59,124 @@ func NewQueryApp(cfgs ...QueryAppCfg) (*QueryApp, error) {
 // Run runs the app.
 func (app *QueryApp) Run(ctx context.Context, args []string) error {
 	if len(args) < 1 {
-		return errors.New("missing instrument ID argument")
-	}
-	instrumentID, err := strconv.ParseInt(args[0], 10, 64)
-	if err != nil {
-		return errors.Wrap(err, "parse instrument ID failed")
+		return errors.New("missing instrument argument")
 	}
+	var err error
 	timestamp := time.Now()
 	if len(args) > 1 {
-		timestamp, err = time.Parse(time.RFC3339, args[1])
+		timestamp, err = timeexpr.Parse(args[1])
 		if err != nil {
 			return errors.Wrap(err, "parse timestamp failed")
 		}
 	}
-	r, err := repo.NewRepo(repo.WithDB(app.DB))
-	if err != nil {
-		return errors.Wrap(err, "new repo failed")
+	var r repo.PositionRepo
+	var inst *models.Instrument
+	if app.DataDir != "" {
+		if inst, err = instrumentFromID(args[0]); err != nil {
+			return errors.Wrap(err, "parse instrument failed")
+		}
+		fileRepo, err := repo.OpenFileRepo(app.DataDir)
+		if err != nil {
+			return errors.Wrap(err, "open file repo failed")
+		}
+		defer fileRepo.Close()
+		r = fileRepo
+	} else {
+		dbRepo, err := repo.NewRepo(repo.WithDB(app.DB))
+		if err != nil {
+			return errors.Wrap(err, "new repo failed")
+		}
+		// resolve the instrument from its ID, symbol or ISIN
+		if inst, err = instrument.NewRegistry(dbRepo).Resolve(ctx, args[0]); err != nil {
+			return errors.Wrap(err, "resolve instrument failed")
+		}
+		r = dbRepo
+	}
+	instrumentID := inst.ID
+	if app.History {
+		return app.writeHistory(ctx, r, inst)
 	}
-	pos, err := r.ReadPosition(ctx, instrumentID, timestamp)
+	if app.AccountID != nil {
+		pos, err := r.ReadPosition(ctx, instrumentID, *app.AccountID, timestamp, app.AsOf)
+		if err != nil {
+			return errors.Wrap(err, "read position failed")
+		}
+		logger.WithFields(app.asOfFields(logrus.Fields{
+			"instrument_id": pos.InstrumentID,
+			"symbol":        inst.Symbol,
+			"account_id":    pos.AccountID,
+			"size":          pos.Size,
+			"timestamp":     pos.Timestamp,
+		})).Info("position found")
+		return nil
+	}
+	pos, err := r.ReadPortfolioPosition(ctx, instrumentID, app.PortfolioID, timestamp, app.AsOf)
 	if err != nil {
-		return errors.Wrap(err, "read position failed")
+		return errors.Wrap(err, "read portfolio position failed")
 	}
-	logger.WithFields(logrus.Fields{
+	logger.WithFields(app.asOfFields(logrus.Fields{
 		"instrument_id": pos.InstrumentID,
+		"symbol":        inst.Symbol,
+		"portfolio_id":  app.PortfolioID,
 		"size":          pos.Size,
 		"timestamp":     pos.Timestamp,
-	}).Info("position found")
+	})).Info("position found")
 	return nil
 }
+
+// asOfFields adds the as of time to the log fields, if one is set.
+func (app *QueryApp) asOfFields(fields logrus.Fields) logrus.Fields {
+	if !app.AsOf.IsZero() {
+		fields["as_of"] = app.AsOf
+	}
+	return fields
+}
+
+// writeHistory writes the position history of the instrument to the output in the configured format.
+func (app *QueryApp) writeHistory(ctx context.Context, r repo.PositionRepo, inst *models.Instrument) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	to := app.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	positions, err := r.ReadPositionHistory(ctx, inst.ID, app.AccountID, app.PortfolioID, app.From, to)
+	if err != nil {
+		return errors.Wrap(err, "read position history failed")
+	}
+	errCh := make(chan error, 1)
+	if app.Interval > 0 {
+		resampled := make(chan *models.Position)
+		go func(in <-chan *models.Position) {
+			errCh <- position.Resample(ctx, app.Interval, in, resampled)
+		}(positions)
+		positions = resampled
+	} else {
+		errCh <- nil
+	}
+	out, err := openOutput(app.Output)
+	if err != nil {
+		return errors.Wrap(err, "open output failed")
+	}
+	defer out.Close()
+	format := app.Format
+	if format == "" {
+		format = output.Table
+	}
+	w, err := output.NewWriter(out, format, "instrument_id", "symbol", "size", "timestamp")
+	if err != nil {
+		return errors.Wrap(err, "new output writer failed")
+	}
+	for pos := range positions {
+		if err := w.Write(pos.InstrumentID, inst.Symbol, pos.Size, pos.Timestamp.UTC()); err != nil {
+			// stop reading and resampling, and wait for the resampler to return
+			cancel()
+			<-errCh
+			return errors.Wrap(err, "write position failed")
+		}
+	}
+	if err := <-errCh; err != nil {
+		return errors.Wrap(err, "resample failed")
+	}
+	return errors.Wrap(w.Flush(), "flush output failed")
+}
@@ -0,0 +1,150 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/retention"
+	"tradetracker/internal/pkg/validate"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// RetentionAppCfg configures a RetentionApp.
+type RetentionAppCfg interface {
+	ApplyRetentionApp(*RetentionApp) error
+}
+
+// RetentionApp is the application responsible for managing how long the trades and positions in each instrument
+// are kept in the database before they may be archived.
+type RetentionApp struct {
+	DB *sql.DB `validate:"required"`
+}
+
+// NewRetentionApp creates a new RetentionApp.
+func NewRetentionApp(cfgs ...RetentionAppCfg) (*RetentionApp, error) {
+	app := &RetentionApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyRetentionApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply RetentionApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate RetentionApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app. The first argument is the action to perform, which is one of:
+//
+//   set instrument retention
+//   remove instrument
+//   list
+func (app *RetentionApp) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing action argument")
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	instruments := instrument.NewRegistry(r)
+	switch args[0] {
+	case "set":
+		return app.set(ctx, r, instruments, args[1:])
+	case "remove":
+		return app.remove(ctx, r, instruments, args[1:])
+	case "list":
+		return app.list(ctx, r, instruments)
+	default:
+		return fmt.Errorf("unknown retention action: %s", args[0])
+	}
+}
+
+func (app *RetentionApp) set(ctx context.Context, r repo.RetentionRepo, instruments *instrument.Registry, args []string) error {
+	if len(args) < 2 {
+		return errors.New("requires an instrument and a retention period")
+	}
+	inst, err := instruments.Resolve(ctx, args[0])
+	if err != nil {
+		return errors.Wrap(err, "resolve instrument failed")
+	}
+	retain, err := retention.ParseRetention(args[1])
+	if err != nil {
+		return errors.Wrap(err, "parse retention failed")
+	}
+	if err := r.SetRetentionPolicy(ctx, &models.RetentionPolicy{
+		InstrumentID: inst.ID,
+		Retain:       retain,
+	}); err != nil {
+		return errors.Wrap(err, "set retention policy failed")
+	}
+	logger.WithFields(logrus.Fields{
+		"instrument_id": inst.ID,
+		"symbol":        inst.Symbol,
+		"retain":        retain,
+	}).Info("set retention policy")
+	return nil
+}
+
+func (app *RetentionApp) remove(ctx context.Context, r repo.RetentionRepo, instruments *instrument.Registry, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing instrument argument")
+	}
+	inst, err := instruments.Resolve(ctx, args[0])
+	if err != nil {
+		return errors.Wrap(err, "resolve instrument failed")
+	}
+	removed, err := r.DeleteRetentionPolicy(ctx, inst.ID)
+	if err != nil {
+		return errors.Wrap(err, "delete retention policy failed")
+	}
+	if !removed {
+		return errors.Errorf("instrument %d has no retention policy", inst.ID)
+	}
+	logger.WithFields(logrus.Fields{
+		"instrument_id": inst.ID,
+		"symbol":        inst.Symbol,
+	}).Info("removed retention policy")
+	return nil
+}
+
+// list logs the retention policies and the archives made.
+func (app *RetentionApp) list(ctx context.Context, r repo.RetentionRepo, instruments *instrument.Registry) error {
+	policies, err := r.ReadRetentionPolicies(ctx)
+	if err != nil {
+		return errors.Wrap(err, "read retention policies failed")
+	}
+	for _, policy := range policies {
+		logger.WithFields(logrus.Fields{
+			"instrument_id": policy.InstrumentID,
+			"symbol":        instruments.Symbol(ctx, policy.InstrumentID),
+			"retain":        policy.Retain,
+		}).Info("retention policy found")
+	}
+	archives, err := r.ReadArchives(ctx, 0)
+	if err != nil {
+		return errors.Wrap(err, "read archives failed")
+	}
+	for _, archive := range archives {
+		fields := logrus.Fields{
+			"id":            archive.ID,
+			"instrument_id": archive.InstrumentID,
+			"symbol":        instruments.Symbol(ctx, archive.InstrumentID),
+			"before":        archive.Before,
+			"archived_at":   archive.ArchivedAt,
+			"trades":        archive.Trades,
+			"positions":     archive.Positions,
+		}
+		if !archive.RestoredAt.IsZero() {
+			fields["restored_at"] = archive.RestoredAt
+		}
+		logger.WithFields(fields).Info("archive found")
+	}
+	return nil
+}
@@ -0,0 +1,399 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"tradetracker/internal/pkg/api"
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/position"
+	"tradetracker/internal/pkg/pubsub"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/trade"
+	"tradetracker/internal/pkg/validate"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ServeAppCfg configures a ServeApp.
+type ServeAppCfg interface {
+	ApplyServeApp(*ServeApp) error
+}
+
+// ServeApp is the long-running application which ingests trades from the Input file as it is appended to, builds the
+// positions of each instrument traded as the trades are stored, and serves queries for positions on Port and health
+// checks on HealthPort. The offset of the trades processed is committed every CommitInterval. Trades up to
+// AllowedLateness behind the latest trade in their instrument are reordered into its positions, and trades later than
+// that are handled by the LatePolicy: rebuilding the positions from them, or rejecting them to LateOutput, leaving the
+// positions as they are until they are next built. Each instrument is locked while its positions are built, waiting up
+// to LockTimeout for any other process writing them to finish. On SIGINT or SIGTERM it stops ingesting, drains the
+// trades in flight, writes the positions built from them and commits their offset before exiting, stopping immediately
+// if this takes longer than ShutdownTimeout or on a second signal. On SIGHUP it reads instrument reference data from
+// the repo again and calls Reload, if set, to reload the configuration which can change while running.
+type ServeApp struct {
+	DB              *sql.DB `validate:"required"`
+	Input           string  `validate:"required"`
+	Port            int     `validate:"min=1,max=65535"`
+	HealthPort      int     `validate:"min=1,max=65535,nefield=Port"`
+	MaxGoroutines   int     `validate:"min=1"`
+	LockTimeout     time.Duration
+	CommitInterval  time.Duration       `validate:"min=1ms"`
+	ShutdownTimeout time.Duration       `validate:"min=1ms"`
+	AllowedLateness time.Duration       `validate:"min=0"`
+	LatePolicy      position.LatePolicy `validate:"oneof=rebuild reject"`
+	LateOutput      string
+	Reload          func(ctx context.Context) error
+}
+
+// NewServeApp creates a new ServeApp.
+func NewServeApp(cfgs ...ServeAppCfg) (*ServeApp, error) {
+	app := &ServeApp{
+		CommitInterval:  time.Second,
+		ShutdownTimeout: 30 * time.Second,
+		LatePolicy:      position.RebuildLate,
+	}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyServeApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply ServeApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate ServeApp failed")
+	}
+	if app.LateOutput == "" {
+		app.LateOutput = app.Input + ".late"
+	}
+	return app, nil
+}
+
+// Run runs the app until it is signalled to shut down, or fails.
+func (app *ServeApp) Run(ctx context.Context, _ []string) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	// the context is only cancelled to stop immediately, as the trades in flight are drained by stopping the source
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	instruments := instrument.NewRegistry(r)
+	// follow the input file from the offset last committed
+	source := trade.NewFileSource(app.Input)
+	if err := source.Prepare(ctx); err != nil {
+		return errors.Wrap(err, "prepare trade source failed")
+	}
+	defer source.Close()
+	offsets := &offsetCommitter{source: source, processed: source.Offset(), committed: source.Offset()}
+	// serve queries and health checks
+	health := api.NewHealth(app.MaxGoroutines)
+	healthMux := http.NewServeMux()
+	healthMux.Handle("/healthz", health)
+	servers := []*http.Server{
+		{Addr: fmt.Sprintf(":%d", app.Port), Handler: api.NewHandler(r, instruments)},
+		{Addr: fmt.Sprintf(":%d", app.HealthPort), Handler: healthMux},
+	}
+	serverErr := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- errors.Wrapf(err, "listen on %s failed", srv.Addr)
+			}
+		}(srv)
+	}
+	// store the trades and build positions from them as they are ingested
+	stream := pubsub.NewMemoryPubSub()
+	builders := &liveBuilders{
+		repo:        r,
+		lockTimeout: app.LockTimeout,
+		cfgs:        []position.LiveCfg{position.WithLiveLateness(app.AllowedLateness)},
+		builders:    make(map[int64]*position.Live),
+		locks:       make(map[int64]*repo.InstrumentLock),
+	}
+	var late *lateWriter
+	if app.LatePolicy == position.RejectLateTrades {
+		if late, err = newLateWriter(app.LateOutput, stream); err != nil {
+			return errors.Wrap(err, "open late trade output failed")
+		}
+		builders.cfgs = append(builders.cfgs, position.WithLiveLateHandler(position.RejectLate(stream)))
+	}
+	processor, err := trade.NewProcessor(
+		trade.WithRepo(r),
+		trade.WithSubscriber(stream),
+		trade.WithInstruments(instruments),
+		trade.WithAck(func(m pubsub.Message, stored *models.Trade) error {
+			// the offset is processed once the trade is stored, as its positions are rebuilt on restart,
+			// and trades ingested again before it was committed are skipped rather than stored twice
+			offsets.process(m.Offset)
+			if stored == nil {
+				return nil
+			}
+			return builders.add(ctx, stored)
+		}),
+	)
+	if err != nil {
+		return errors.Wrap(err, "new trade processor failed")
+	}
+	// errors publishing trades are returned rather than exiting, so that the trades in flight are drained
+	published := make(chan error, 1)
+	go func() {
+		published <- sendTrades(ctx, source, stream)
+	}()
+	processed := make(chan error, 1)
+	go func() {
+		processed <- processor.Process(ctx)
+	}()
+	logger.WithFields(logrus.Fields{
+		"input":       app.Input,
+		"offset":      source.Offset(),
+		"port":        app.Port,
+		"health_port": app.HealthPort,
+	}).Info("serving")
+
+	ticker := time.NewTicker(app.CommitInterval)
+	defer ticker.Stop()
+	var runErr error
+	processDone, publishDone := false, false
+loop:
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				app.reload(ctx, instruments)
+				continue
+			}
+			logger.WithField("signal", sig.String()).Info("shutting down")
+			break loop
+		case err := <-serverErr:
+			runErr = err
+			break loop
+		case err := <-published:
+			publishDone = true
+			if err != nil {
+				runErr = errors.Wrap(err, "publish trades failed")
+				break loop
+			}
+		case err := <-processed:
+			processDone = true
+			if err == nil && !publishDone {
+				// the trade stream is only closed once publishing has stopped, which is the cause
+				publishDone = true
+				if err = <-published; err != nil {
+					runErr = errors.Wrap(err, "publish trades failed")
+					break loop
+				}
+			}
+			if err == nil {
+				err = errors.New("trade stream closed")
+			}
+			runErr = errors.Wrap(err, "process trades failed")
+			break loop
+		case <-ctx.Done():
+			runErr = errors.Wrap(ctx.Err(), "context cancelled")
+			break loop
+		case <-ticker.C:
+			if err := offsets.commit(); err != nil {
+				logger.WithError(err).Warn("commit offset failed")
+			}
+		}
+	}
+
+	// fail health checks and stop ingesting, then drain the trades in flight,
+	// stopping immediately on a second signal or if draining takes too long
+	health.Drain()
+	source.Stop()
+	drained := make(chan struct{})
+	defer close(drained)
+	go func() {
+		timer := time.NewTimer(app.ShutdownTimeout)
+		defer timer.Stop()
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGHUP {
+					continue
+				}
+				logger.WithField("signal", sig.String()).Warn("stopping immediately")
+			case <-timer.C:
+				logger.Warnf("stopping immediately after %s", app.ShutdownTimeout)
+			case <-drained:
+				return
+			}
+			cancel()
+			return
+		}
+	}()
+	if !processDone {
+		if err := <-processed; err != nil && runErr == nil {
+			runErr = errors.Wrap(err, "process trades failed")
+		}
+	}
+	// write the positions built from the trades drained, and release the instrument locks
+	if err := builders.stop(); err != nil && runErr == nil {
+		runErr = errors.Wrap(err, "stop building positions failed")
+	}
+	if late != nil {
+		if err := late.close(ctx, stream); err != nil && runErr == nil {
+			runErr = errors.Wrap(err, "close late trade output failed")
+		}
+	}
+	if err := offsets.commit(); err != nil && runErr == nil {
+		runErr = errors.Wrap(err, "commit offset failed")
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), app.ShutdownTimeout)
+	defer shutdownCancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil && runErr == nil {
+			runErr = errors.Wrapf(err, "shut down server on %s failed", srv.Addr)
+		}
+	}
+	logger.WithField("offset", offsets.committed).Info("shut down")
+	return runErr
+}
+
+// reload reloads the configuration and the instrument reference data,
+// logging rather than returning any error so that the app keeps running.
+func (app *ServeApp) reload(ctx context.Context, instruments *instrument.Registry) {
+	instruments.Reset()
+	if app.Reload == nil {
+		return
+	}
+	if err := app.Reload(ctx); err != nil {
+		logger.WithError(err).Error("reload config failed")
+		return
+	}
+	logger.Info("reloaded config")
+}
+
+// offsetCommitter commits the offset of the trades processed to their source.
+type offsetCommitter struct {
+	source trade.OffsetSource
+
+	mu                   sync.Mutex
+	processed, committed int64
+}
+
+// process records that the trades before the offset have been processed.
+func (c *offsetCommitter) process(offset int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.processed = offset
+}
+
+// commit commits the offset of the trades processed, if it has moved on since it was last committed.
+func (c *offsetCommitter) commit() error {
+	c.mu.Lock()
+	processed := c.processed
+	c.mu.Unlock()
+	if processed == c.committed {
+		return nil
+	}
+	if err := c.source.Commit(processed); err != nil {
+		return err
+	}
+	c.committed = processed
+	return nil
+}
+
+// liveBuilders builds the positions of each instrument traded, holding its lock while doing so.
+// Positions are built again from every stored trade when an instrument is first traded,
+// so that they include any trades stored before a previous process stopped building them.
+type liveBuilders struct {
+	repo        *repo.Repo
+	lockTimeout time.Duration
+	cfgs        []position.LiveCfg
+	builders    map[int64]*position.Live
+	locks       map[int64]*repo.InstrumentLock
+}
+
+// add builds the positions following from a stored trade.
+func (b *liveBuilders) add(ctx context.Context, tr *models.Trade) error {
+	if live, ok := b.builders[tr.InstrumentID]; ok {
+		return errors.Wrap(live.Add(ctx, tr), "add trade failed")
+	}
+	lock, err := lockInstrument(ctx, b.repo, tr.InstrumentID, "serve", b.lockTimeout)
+	if err != nil {
+		return errors.Wrap(err, "lock instrument failed")
+	}
+	b.locks[tr.InstrumentID] = lock
+	// archived trades are stood in for by seed positions, which the positions are built on
+	seeds, err := b.repo.ReadSeedPositions(ctx, tr.InstrumentID)
+	if err != nil {
+		return errors.Wrap(err, "read seed positions failed")
+	}
+	live := position.NewLive(b.repo, b.repo, tr.InstrumentID, b.cfgs...)
+	b.builders[tr.InstrumentID] = live
+	return errors.Wrap(live.Start(ctx, seeds...), "start building positions failed")
+}
+
+// stop stops building positions, waiting for those built to be written, and releases the instrument locks.
+func (b *liveBuilders) stop() error {
+	var firstErr error
+	for instrumentID, live := range b.builders {
+		if err := live.Stop(); err != nil {
+			logger.WithFields(logrus.Fields{
+				"instrument_id": instrumentID,
+			}).WithError(err).Error("stop building positions failed")
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	for instrumentID, lock := range b.locks {
+		unlockInstrument(lock, instrumentID)
+	}
+	return firstErr
+}
+
+// lateWriter appends the trades rejected as late to a file, one JSON object per line, for them to be inspected.
+// They have been stored, so they are included in the positions when these are next built.
+type lateWriter struct {
+	f    *os.File
+	done chan error
+}
+
+// newLateWriter opens the file and writes the trades published on the late trade topic of the stream to it,
+// until the topic is closed. Trades which cannot be written are logged, so that rejecting them never blocks.
+func newLateWriter(path string, stream pubsub.Subscriber) (*lateWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file failed")
+	}
+	w := &lateWriter{f: f, done: make(chan error, 1)}
+	go func() {
+		w.done <- stream.Subscribe(context.Background(), pubsub.LateTradeTopic, func(m pubsub.Message) error {
+			b, err := json.Marshal(m.Value)
+			if err == nil {
+				_, err = w.f.Write(append(b, '\n'))
+			}
+			if err != nil {
+				logger.WithField("path", path).WithError(err).Error("write late trade failed")
+			}
+			return nil
+		})
+	}()
+	return w, nil
+}
+
+// close closes the late trade topic once the trades rejected have been written, and then the file.
+func (w *lateWriter) close(ctx context.Context, stream pubsub.Closer) error {
+	err := stream.Close(ctx, pubsub.LateTradeTopic)
+	if subErr := <-w.done; err == nil {
+		err = subErr
+	}
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
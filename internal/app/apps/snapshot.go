@@ -0,0 +1,117 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"tradetracker/internal/pkg/output"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/timeexpr"
+	"tradetracker/internal/pkg/validate"
+	"tradetracker/pkg/decimal"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// SnapshotAppCfg configures a SnapshotApp.
+type SnapshotAppCfg interface {
+	ApplySnapshotApp(*SnapshotApp) error
+}
+
+// SnapshotApp is the application responsible for listing the position in every instrument at a given time.
+// Like the QueryApp, the positions are for a single account if one is set, otherwise they are
+// aggregated over a portfolio, or over all accounts if no portfolio is set.
+type SnapshotApp struct {
+	DB          *sql.DB `validate:"required"`
+	AccountID   *int64
+	PortfolioID int64
+	ExcludeFlat bool
+	Format      output.Format
+	Output      string
+}
+
+// NewSnapshotApp creates a new SnapshotApp.
+func NewSnapshotApp(cfgs ...SnapshotAppCfg) (*SnapshotApp, error) {
+	app := &SnapshotApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplySnapshotApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply SnapshotApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate SnapshotApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app.
+func (app *SnapshotApp) Run(ctx context.Context, args []string) error {
+	var err error
+	timestamp := time.Now()
+	if len(args) > 0 {
+		timestamp, err = timeexpr.Parse(args[0])
+		if err != nil {
+			return errors.Wrap(err, "parse timestamp failed")
+		}
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	positions, err := r.ReadSnapshot(ctx, app.AccountID, app.PortfolioID, timestamp, app.ExcludeFlat)
+	if err != nil {
+		return errors.Wrap(err, "read snapshot failed")
+	}
+	instruments, err := r.ReadInstruments(ctx)
+	if err != nil {
+		return errors.Wrap(err, "read instruments failed")
+	}
+	symbols := make(map[int64]string, len(instruments))
+	for _, instrument := range instruments {
+		symbols[instrument.ID] = instrument.Symbol
+	}
+	out, err := openOutput(app.Output)
+	if err != nil {
+		return errors.Wrap(err, "open output failed")
+	}
+	defer out.Close()
+	format := app.Format
+	if format == "" {
+		format = output.Table
+	}
+	w, err := output.NewWriter(out, format, "instrument_id", "symbol", "size", "timestamp")
+	if err != nil {
+		return errors.Wrap(err, "new output writer failed")
+	}
+	long, short := decimal.Zero, decimal.Zero
+	for _, pos := range positions {
+		if pos.Size.Sign() > 0 {
+			long = long.Add(pos.Size)
+		} else {
+			short = short.Add(pos.Size)
+		}
+		if err := w.Write(pos.InstrumentID, symbols[pos.InstrumentID], pos.Size, pos.Timestamp.UTC()); err != nil {
+			return errors.Wrap(err, "write position failed")
+		}
+	}
+	// totals are only written inline in a table, to keep the other formats one row per instrument
+	if format == output.Table {
+		if err := w.Write(nil, "TOTAL", long.Add(short), timestamp.UTC()); err != nil {
+			return errors.Wrap(err, "write totals failed")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "flush output failed")
+	}
+	logger.WithFields(logrus.Fields{
+		"instruments": len(positions),
+		"long":        long,
+		"short":       short,
+		"net":         long.Add(short),
+		"gross":       long.Sub(short),
+		"timestamp":   timestamp,
+	}).Info("snapshot totals")
+	return nil
+}
@@ -0,0 +1,97 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/output"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/validate"
+
+	"github.com/pkg/errors"
+)
+
+// StatsAppCfg configures a StatsApp.
+type StatsAppCfg interface {
+	ApplyStatsApp(*StatsApp) error
+}
+
+// StatsApp is the application responsible for summarising the trading activity and position
+// in an instrument over each day, week or month within a range of time.
+type StatsApp struct {
+	DB     *sql.DB     `validate:"required"`
+	Period repo.Period `validate:"required"`
+	From   time.Time
+	To     time.Time
+	Format output.Format
+	Output string
+}
+
+// NewStatsApp creates a new StatsApp.
+func NewStatsApp(cfgs ...StatsAppCfg) (*StatsApp, error) {
+	app := &StatsApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyStatsApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply StatsApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate StatsApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app.
+func (app *StatsApp) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing instrument argument")
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	// resolve the instrument from its ID, symbol or ISIN
+	inst, err := instrument.NewRegistry(r).Resolve(ctx, args[0])
+	if err != nil {
+		return errors.Wrap(err, "resolve instrument failed")
+	}
+	to := app.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	stats, err := r.ReadStats(ctx, inst.ID, app.Period, app.From, to)
+	if err != nil {
+		return errors.Wrap(err, "read stats failed")
+	}
+	out, err := openOutput(app.Output)
+	if err != nil {
+		return errors.Wrap(err, "open output failed")
+	}
+	defer out.Close()
+	format := app.Format
+	if format == "" {
+		format = output.Table
+	}
+	w, err := output.NewWriter(out, format,
+		"period", "instrument_id", "symbol", "trades", "gross_volume", "net_volume", "notional", "turnover",
+		"largest_trade", "max_position", "min_position", "avg_position", "flat", "long", "short",
+	)
+	if err != nil {
+		return errors.Wrap(err, "new output writer failed")
+	}
+	for _, s := range stats {
+		if err := w.Write(
+			s.Period.UTC(), s.InstrumentID, inst.Symbol, s.TradeCount, s.GrossVolume, s.NetVolume, s.Notional, s.Turnover,
+			s.LargestTrade, s.MaxPosition, s.MinPosition, s.AvgPosition,
+			s.Flat.Round(time.Second).String(), s.Long.Round(time.Second).String(), s.Short.Round(time.Second).String(),
+		); err != nil {
+			return errors.Wrap(err, "write stats failed")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "flush output failed")
+	}
+	return nil
+}
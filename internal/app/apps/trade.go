@@ -3,16 +3,18 @@ package apps
 import (
 	"context"
 	"database/sql"
-	"io"
 	"strconv"
 	"time"
 
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/position"
 	"tradetracker/internal/pkg/pubsub"
 	"tradetracker/internal/pkg/repo"
 	"tradetracker/internal/pkg/trade"
 	"tradetracker/internal/pkg/validate"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 // TradeAppCfg configures a TradeApp.
@@ -21,13 +23,21 @@ type TradeAppCfg interface {
 }
 
 // TradeApp is the demo application responsible for carrying out CLI commands.
+// If DataDir is set, the trades are stored in the file store in that directory rather than the database.
+// If Memory is set, the trades are stored in memory instead, and the positions they produce are built
+// and logged before they are lost.
 type TradeApp struct {
-	DB *sql.DB `validate:"required"`
+	DB         *sql.DB `validate:"required_without_all=Memory DataDir"`
+	AccountIDs []int64 `validate:"min=1"`
+	Memory     bool
+	DataDir    string
 }
 
 // NewTradeApp creates a new TradeApp.
 func NewTradeApp(cfgs ...TradeAppCfg) (*TradeApp, error) {
-	app := &TradeApp{}
+	app := &TradeApp{
+		AccountIDs: []int64{0},
+	}
 	for _, cfg := range cfgs {
 		if err := cfg.ApplyTradeApp(app); err != nil {
 			return nil, errors.Wrap(err, "apply TradeApp cfg failed")
@@ -51,22 +61,35 @@ func (app *TradeApp) Run(ctx context.Context, args []string) error {
 	if err != nil {
 		return errors.Wrap(err, "parse instrument ID failed")
 	}
-	instrumentIDs := make([]int64, len(args)-1)
-	for i := range args {
-		if i == 0 {
-			continue
-		}
-		instrumentID, err := strconv.ParseInt(args[i], 10, 64)
-		if err != nil {
-			return errors.Wrap(err, "parse instrument ID failed")
-		}
-		instrumentIDs[i-1] = instrumentID
+	switch {
+	case app.Memory:
+		return app.runInMemory(ctx, num, args[1:])
+	case app.DataDir != "":
+		return app.runInFiles(ctx, num, args[1:])
 	}
 	// set up the repository to interact with trades and positions in the database
 	r, err := repo.NewRepo(repo.WithDB(app.DB))
 	if err != nil {
 		return errors.Wrap(err, "new repo failed")
 	}
+	// resolve the instruments from their IDs, symbols or ISINs
+	instruments := instrument.NewRegistry(r)
+	insts, err := instruments.ResolveAll(ctx, args[1:])
+	if err != nil {
+		return errors.Wrap(err, "resolve instruments failed")
+	}
+	instrumentIDs := make([]int64, len(insts))
+	for i, inst := range insts {
+		instrumentIDs[i] = inst.ID
+	}
+	return app.generateTrades(ctx, r, instruments, num, instrumentIDs)
+}
+
+// generateTrades generates random trades in the instruments and processes them into the repo,
+// checking them against the instrument reference data if there is any.
+func (app *TradeApp) generateTrades(
+	ctx context.Context, r repo.TradeRepo, instruments *instrument.Registry, num int64, instrumentIDs []int64,
+) error {
 	// create a dummy pubsub stream
 	stream := pubsub.NewMemoryPubSub()
 	// create a trade source to generate random trade data
@@ -74,46 +97,91 @@ func (app *TradeApp) Run(ctx context.Context, args []string) error {
 		num,
 		time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC), // trades generated from Jan 1, 2000 until now
 		instrumentIDs,
+		app.AccountIDs,
 	)
 	if err := tradeSource.Prepare(ctx); err != nil {
 		return errors.Wrap(err, "prepare trade source failed")
 	}
 	// create a trade processor to process the trade data coming in on the stream
-	processor, err := trade.NewProcessor(
+	cfgs := []trade.Cfg{
 		trade.WithRepo(r),
 		trade.WithSubscriber(stream),
-	)
+	}
+	if instruments != nil {
+		cfgs = append(cfgs, trade.WithInstruments(instruments))
+	}
+	processor, err := trade.NewProcessor(cfgs...)
 	if err != nil {
 		return errors.Wrap(err, "new trade processor failed")
 	}
 	// send the random trade data across the stream for it to be processed
-	go func() {
-		defer func() {
-			if err := stream.Close(ctx, pubsub.TradeTopic); err != nil {
-				logger.Fatalln(errors.Wrap(err, "close trade stream failed"))
-			}
-		}()
-		for {
-			tr, err := tradeSource.Next()
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			if err != nil {
-				logger.Fatalln(errors.Wrap(err, "next trade failed"))
-			}
-			if err := stream.Publish(pubsub.Message{
-				Topic: pubsub.TradeTopic,
-				Value: tr,
-			}); err != nil {
-				logger.Fatalln(errors.Wrap(err, "publish trade failed"))
-			}
-			select {
-			case <-ctx.Done():
-				return
-			default:
-			}
-		}
-	}()
+	go publishTrades(ctx, tradeSource, stream)
 	// process the trade data
 	return errors.Wrap(processor.Process(ctx), "process trades failed")
 }
+
+// runInFiles generates trades in the given instruments into the file store. The file store has no
+// instrument reference data, so the instruments must be given by ID and the trades are not checked against them.
+func (app *TradeApp) runInFiles(ctx context.Context, num int64, instrumentArgs []string) error {
+	instrumentIDs, err := parseInstrumentIDs(instrumentArgs)
+	if err != nil {
+		return errors.Wrap(err, "parse instrument IDs failed")
+	}
+	r, err := repo.OpenFileRepo(app.DataDir)
+	if err != nil {
+		return errors.Wrap(err, "open file repo failed")
+	}
+	defer r.Close()
+	if err := app.generateTrades(ctx, r, nil, num, instrumentIDs); err != nil {
+		return err
+	}
+	return errors.Wrap(r.Close(), "close file repo failed")
+}
+
+// runInMemory generates trades in the given instruments into an in-memory repo, then builds the positions
+// of each instrument from them. The in-memory repo has no instrument reference data, so the instruments must
+// be given by ID and the trades are not checked against them.
+func (app *TradeApp) runInMemory(ctx context.Context, num int64, instrumentArgs []string) error {
+	instrumentIDs, err := parseInstrumentIDs(instrumentArgs)
+	if err != nil {
+		return errors.Wrap(err, "parse instrument IDs failed")
+	}
+	r := repo.NewMemoryRepo()
+	if err := app.generateTrades(ctx, r, nil, num, instrumentIDs); err != nil {
+		return err
+	}
+	// build the positions of each instrument, as the position command would from the database
+	for _, instrumentID := range instrumentIDs {
+		stream := pubsub.NewMemoryPubSub()
+		tradeSource := trade.NewRepoSource(r, instrumentID, time.Time{})
+		if err := tradeSource.Prepare(ctx); err != nil {
+			return errors.Wrap(err, "prepare trade source failed")
+		}
+		processor, err := position.NewProcessor(
+			position.WithRepo(r),
+			position.WithSubscriber(stream),
+			position.WithBuilder(
+				position.NewBinnedBuilder(1, instrumentID),
+			),
+		)
+		if err != nil {
+			return errors.Wrap(err, "new position processor failed")
+		}
+		go publishTrades(ctx, tradeSource, stream)
+		if err := processor.Process(ctx); err != nil {
+			return errors.Wrap(err, "process positions failed")
+		}
+	}
+	positions, err := r.ReadSnapshot(ctx, nil, 0, time.Now(), false)
+	if err != nil {
+		return errors.Wrap(err, "read snapshot failed")
+	}
+	for _, pos := range positions {
+		logger.WithFields(logrus.Fields{
+			"instrument_id": pos.InstrumentID,
+			"size":          pos.Size,
+			"timestamp":     pos.Timestamp,
+		}).Info("position")
+	}
+	return nil
+}
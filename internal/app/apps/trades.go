@@ -0,0 +1,100 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/output"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/validate"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TradeQueryAppCfg configures a TradeQueryApp.
+type TradeQueryAppCfg interface {
+	ApplyTradeQueryApp(*TradeQueryApp) error
+}
+
+// TradeQueryApp is the application responsible for listing trades.
+// The instrument of the filter is set from the command arguments.
+type TradeQueryApp struct {
+	DB     *sql.DB `validate:"required"`
+	Filter repo.TradeFilter
+	Format output.Format
+	Output string
+}
+
+// NewTradeQueryApp creates a new TradeQueryApp.
+func NewTradeQueryApp(cfgs ...TradeQueryAppCfg) (*TradeQueryApp, error) {
+	app := &TradeQueryApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyTradeQueryApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply TradeQueryApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate TradeQueryApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app.
+func (app *TradeQueryApp) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing instrument argument")
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	// resolve the instrument from its ID, symbol or ISIN
+	inst, err := instrument.NewRegistry(r).Resolve(ctx, args[0])
+	if err != nil {
+		return errors.Wrap(err, "resolve instrument failed")
+	}
+	filter := app.Filter
+	filter.InstrumentID = inst.ID
+	if filter.To.IsZero() {
+		filter.To = time.Now()
+	}
+	trades, err := r.ListTrades(ctx, filter)
+	if err != nil {
+		return errors.Wrap(err, "list trades failed")
+	}
+	out, err := openOutput(app.Output)
+	if err != nil {
+		return errors.Wrap(err, "open output failed")
+	}
+	defer out.Close()
+	format := app.Format
+	if format == "" {
+		format = output.Table
+	}
+	w, err := output.NewWriter(out, format,
+		"id", "instrument_id", "symbol", "account_id", "size", "price", "timestamp", "created_at",
+	)
+	if err != nil {
+		return errors.Wrap(err, "new output writer failed")
+	}
+	for _, tr := range trades {
+		if err := w.Write(
+			tr.ID, tr.InstrumentID, inst.Symbol, tr.AccountID, tr.Size, tr.Price, tr.Timestamp.UTC(), tr.CreatedAt,
+		); err != nil {
+			return errors.Wrap(err, "write trade failed")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "flush output failed")
+	}
+	// a full page may be followed by more trades, which can be listed from the last trade onwards
+	if filter.Limit > 0 && int64(len(trades)) == filter.Limit {
+		logger.WithFields(logrus.Fields{
+			"after": trades[len(trades)-1].ID,
+		}).Info("more trades may follow")
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/output"
+	"tradetracker/internal/pkg/position"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/validate"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// VerifyAppCfg configures a VerifyApp.
+type VerifyAppCfg interface {
+	ApplyVerifyApp(*VerifyApp) error
+}
+
+// VerifyApp is the application responsible for verifying that the stored positions still match the trades
+// they were built from. It rebuilds the positions of an instrument, or of every instrument if All is set,
+// in memory and writes any drift from the stored positions to the output.
+// It fails with position.ErrDrift if any drift is found.
+type VerifyApp struct {
+	DB     *sql.DB `validate:"required"`
+	All    bool
+	Format output.Format
+	Output string
+}
+
+// NewVerifyApp creates a new VerifyApp.
+func NewVerifyApp(cfgs ...VerifyAppCfg) (*VerifyApp, error) {
+	app := &VerifyApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyVerifyApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply VerifyApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate VerifyApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app.
+func (app *VerifyApp) Run(ctx context.Context, args []string) error {
+	if !app.All && len(args) < 1 {
+		return errors.New("missing instrument argument")
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	instruments := instrument.NewRegistry(r)
+	var instrumentIDs []int64
+	if app.All {
+		if instrumentIDs, err = r.ReadInstrumentIDs(ctx); err != nil {
+			return errors.Wrap(err, "read instrument IDs failed")
+		}
+	} else {
+		// resolve the instrument from its ID, symbol or ISIN
+		inst, err := instruments.Resolve(ctx, args[0])
+		if err != nil {
+			return errors.Wrap(err, "resolve instrument failed")
+		}
+		instrumentIDs = []int64{inst.ID}
+	}
+	out, err := openOutput(app.Output)
+	if err != nil {
+		return errors.Wrap(err, "open output failed")
+	}
+	defer out.Close()
+	format := app.Format
+	if format == "" {
+		format = output.Table
+	}
+	w, err := output.NewWriter(out, format,
+		"instrument_id", "symbol", "account_id", "timestamp", "kind", "expected_size", "actual_size",
+	)
+	if err != nil {
+		return errors.Wrap(err, "new output writer failed")
+	}
+	var drifted int
+	for _, instrumentID := range instrumentIDs {
+		drift, err := app.verify(ctx, r, instrumentID)
+		if err != nil {
+			return errors.Wrapf(err, "verify instrument %d failed", instrumentID)
+		}
+		symbol := instruments.Symbol(ctx, instrumentID)
+		for _, d := range drift {
+			var expected, actual interface{}
+			if d.Expected != nil {
+				expected = d.Expected.Size
+			}
+			if d.Actual != nil {
+				actual = d.Actual.Size
+			}
+			if err := w.Write(
+				instrumentID, symbol, d.AccountID(), d.Timestamp().UTC(), string(d.Kind), expected, actual,
+			); err != nil {
+				return errors.Wrap(err, "write drift failed")
+			}
+		}
+		drifted += len(drift)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "flush output failed")
+	}
+	if drifted > 0 {
+		return errors.Wrapf(position.ErrDrift, "found %d drifted positions", drifted)
+	}
+	return nil
+}
+
+// verify rebuilds the positions of an instrument from its trades and compares them with the stored positions.
+func (app *VerifyApp) verify(ctx context.Context, r *repo.Repo, instrumentID int64) ([]*position.Drift, error) {
+	trades, err := r.ReadTrades(ctx, instrumentID, time.Time{})
+	if err != nil {
+		return nil, errors.Wrap(err, "read trades failed")
+	}
+	// archived trades are stood in for by seed positions, which are stored positions in their own right
+	seeds, err := r.ReadSeedPositions(ctx, instrumentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "read seed positions failed")
+	}
+	replayed, err := position.Replay(ctx, position.NewBinnedBuilder(1, instrumentID, position.WithSeed(seeds...)), trades)
+	if err != nil {
+		return nil, errors.Wrap(err, "replay trades failed")
+	}
+	expected := append(seeds, replayed...)
+	actual, err := r.ReadPositions(ctx, instrumentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "read positions failed")
+	}
+	drift := position.Compare(expected, actual)
+	logger.WithFields(logrus.Fields{
+		"instrument_id": instrumentID,
+		"expected":      len(expected),
+		"actual":        len(actual),
+		"drift":         len(drift),
+	}).Info("verified positions")
+	return drift, nil
+}
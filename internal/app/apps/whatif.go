@@ -0,0 +1,146 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/output"
+	"tradetracker/internal/pkg/position"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/validate"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// WhatIfAppCfg configures a WhatIfApp.
+type WhatIfAppCfg interface {
+	ApplyWhatIfApp(*WhatIfApp) error
+}
+
+// WhatIfApp is the application responsible for simulating the outcome of hypothetical trades on the position
+// of an account, without storing anything. Trades are given in the form size@price[@time].
+// Outcomes are marked at the mark price if one is set, otherwise at the price of the latest trade.
+type WhatIfApp struct {
+	DB        *sql.DB `validate:"required"`
+	AccountID int64
+	Trades    []string `validate:"min=1"`
+	Mark      *decimal.Decimal
+	Format    output.Format
+	Output    string
+}
+
+// NewWhatIfApp creates a new WhatIfApp.
+func NewWhatIfApp(cfgs ...WhatIfAppCfg) (*WhatIfApp, error) {
+	app := &WhatIfApp{}
+	for _, cfg := range cfgs {
+		if err := cfg.ApplyWhatIfApp(app); err != nil {
+			return nil, errors.Wrap(err, "apply WhatIfApp cfg failed")
+		}
+	}
+	if err := validate.Validate().Struct(app); err != nil {
+		return nil, errors.Wrap(err, "validate WhatIfApp failed")
+	}
+	return app, nil
+}
+
+// Run runs the app.
+func (app *WhatIfApp) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("missing instrument argument")
+	}
+	r, err := repo.NewRepo(repo.WithDB(app.DB))
+	if err != nil {
+		return errors.Wrap(err, "new repo failed")
+	}
+	// resolve the instrument from its ID, symbol or ISIN
+	inst, err := instrument.NewRegistry(r).Resolve(ctx, args[0])
+	if err != nil {
+		return errors.Wrap(err, "resolve instrument failed")
+	}
+	now := time.Now()
+	hypothetical := make([]*models.Trade, len(app.Trades))
+	for i, s := range app.Trades {
+		if hypothetical[i], err = position.ParseTrade(s, inst.ID, app.AccountID, now); err != nil {
+			return errors.Wrap(err, "parse trade failed")
+		}
+	}
+	// the seed positions stand in for any archived trades
+	seeds, err := r.ReadSeedPositions(ctx, inst.ID)
+	if err != nil {
+		return errors.Wrap(err, "read seed positions failed")
+	}
+	tradeCh, err := r.ReadTrades(ctx, inst.ID, time.Time{})
+	if err != nil {
+		return errors.Wrap(err, "read trades failed")
+	}
+	var trades []*models.Trade
+	for tr := range tradeCh {
+		trades = append(trades, tr)
+	}
+	mark := app.markPrice(trades, hypothetical)
+	before, after, err := position.WhatIf(ctx, inst.ID, app.AccountID, seeds, trades, hypothetical, mark)
+	if err != nil {
+		return errors.Wrap(err, "simulate trades failed")
+	}
+	out, err := openOutput(app.Output)
+	if err != nil {
+		return errors.Wrap(err, "open output failed")
+	}
+	defer out.Close()
+	format := app.Format
+	if format == "" {
+		format = output.Table
+	}
+	w, err := output.NewWriter(out, format,
+		"scenario", "instrument_id", "symbol", "account_id", "size", "cost_basis", "realised_pnl", "unrealised_pnl", "mark",
+	)
+	if err != nil {
+		return errors.Wrap(err, "new output writer failed")
+	}
+	for _, scenario := range []struct {
+		name    string
+		outcome *position.Outcome
+	}{
+		{"before", before},
+		{"after", after},
+	} {
+		if err := w.Write(
+			scenario.name, inst.ID, inst.Symbol, app.AccountID, scenario.outcome.Position.Size,
+			scenario.outcome.CostBasis, scenario.outcome.RealisedPnL, scenario.outcome.UnrealisedPnL, mark,
+		); err != nil {
+			return errors.Wrap(err, "write outcome failed")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "flush output failed")
+	}
+	logger.WithFields(logrus.Fields{
+		"instrument_id": inst.ID,
+		"account_id":    app.AccountID,
+		"trades":        len(hypothetical),
+		"size_change":   after.Position.Size.Sub(before.Position.Size),
+	}).Info("simulated hypothetical trades")
+	return nil
+}
+
+// markPrice returns the mark price if one is set, otherwise the price of the latest trade.
+func (app *WhatIfApp) markPrice(trades, hypothetical []*models.Trade) decimal.Decimal {
+	if app.Mark != nil {
+		return *app.Mark
+	}
+	var latest *models.Trade
+	for _, tr := range append(append([]*models.Trade{}, trades...), hypothetical...) {
+		if latest == nil || !tr.Timestamp.Before(latest.Timestamp) {
+			latest = tr
+		}
+	}
+	if latest == nil {
+		return decimal.Zero
+	}
+	return latest.Price
+}
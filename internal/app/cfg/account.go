@@ -0,0 +1,110 @@
+package cfg
+
+import (
+	"tradetracker/internal/app/apps"
+
+	"github.com/pkg/errors"
+)
+
+// AccountCfg configures the accounts an app operates on.
+type AccountCfg struct {
+	accountIDs []int64
+}
+
+// NewAccountCfg creates a new AccountCfg.
+func NewAccountCfg(accountIDs ...int64) *AccountCfg {
+	return &AccountCfg{
+		accountIDs: accountIDs,
+	}
+}
+
+// ApplyTradeApp applies the AccountCfg to a TradeApp.
+func (cfg AccountCfg) ApplyTradeApp(app *apps.TradeApp) error {
+	app.AccountIDs = cfg.accountIDs
+	return nil
+}
+
+// ApplyQueryApp applies the AccountCfg to a QueryApp.
+func (cfg AccountCfg) ApplyQueryApp(app *apps.QueryApp) error {
+	if len(cfg.accountIDs) != 1 {
+		return errors.New("query requires exactly one account")
+	}
+	accountID := cfg.accountIDs[0]
+	app.AccountID = &accountID
+	return nil
+}
+
+// ApplySnapshotApp applies the AccountCfg to a SnapshotApp.
+func (cfg AccountCfg) ApplySnapshotApp(app *apps.SnapshotApp) error {
+	if len(cfg.accountIDs) != 1 {
+		return errors.New("snapshot requires exactly one account")
+	}
+	accountID := cfg.accountIDs[0]
+	app.AccountID = &accountID
+	return nil
+}
+
+// ApplyExplainApp applies the AccountCfg to an ExplainApp.
+func (cfg AccountCfg) ApplyExplainApp(app *apps.ExplainApp) error {
+	if len(cfg.accountIDs) != 1 {
+		return errors.New("explain requires exactly one account")
+	}
+	accountID := cfg.accountIDs[0]
+	app.AccountID = &accountID
+	return nil
+}
+
+// ApplyWhatIfApp applies the AccountCfg to a WhatIfApp.
+func (cfg AccountCfg) ApplyWhatIfApp(app *apps.WhatIfApp) error {
+	if len(cfg.accountIDs) != 1 {
+		return errors.New("whatif requires exactly one account")
+	}
+	app.AccountID = cfg.accountIDs[0]
+	return nil
+}
+
+// ApplyDiffApp applies the AccountCfg to a DiffApp.
+func (cfg AccountCfg) ApplyDiffApp(app *apps.DiffApp) error {
+	if len(cfg.accountIDs) != 1 {
+		return errors.New("diff requires exactly one account")
+	}
+	accountID := cfg.accountIDs[0]
+	app.AccountID = &accountID
+	return nil
+}
+
+// PortfolioCfg configures the portfolio an app aggregates over.
+type PortfolioCfg struct {
+	portfolioID int64
+}
+
+// NewPortfolioCfg creates a new PortfolioCfg.
+func NewPortfolioCfg(portfolioID int64) *PortfolioCfg {
+	return &PortfolioCfg{
+		portfolioID: portfolioID,
+	}
+}
+
+// ApplyQueryApp applies the PortfolioCfg to a QueryApp.
+func (cfg PortfolioCfg) ApplyQueryApp(app *apps.QueryApp) error {
+	app.PortfolioID = cfg.portfolioID
+	return nil
+}
+
+// ApplySnapshotApp applies the PortfolioCfg to a SnapshotApp.
+func (cfg PortfolioCfg) ApplySnapshotApp(app *apps.SnapshotApp) error {
+	app.PortfolioID = cfg.portfolioID
+	return nil
+}
+
+// ApplyExplainApp applies the PortfolioCfg to an ExplainApp.
+func (cfg PortfolioCfg) ApplyExplainApp(app *apps.ExplainApp) error {
+	app.PortfolioID = cfg.portfolioID
+	return nil
+}
+
+// ApplyDiffApp applies the PortfolioCfg to a DiffApp.
+func (cfg PortfolioCfg) ApplyDiffApp(app *apps.DiffApp) error {
+	app.PortfolioID = cfg.portfolioID
+	return nil
+}
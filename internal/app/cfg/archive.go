@@ -0,0 +1,28 @@
+package cfg
+
+import (
+	"time"
+
+	"tradetracker/internal/app/apps"
+)
+
+// ArchiveCfg configures the directory an app keeps archives in, and the time it archives before.
+type ArchiveCfg struct {
+	dir    string
+	before time.Time
+}
+
+// NewArchiveCfg creates a new ArchiveCfg. A zero time archives only the instruments with a retention policy.
+func NewArchiveCfg(dir string, before time.Time) *ArchiveCfg {
+	return &ArchiveCfg{
+		dir:    dir,
+		before: before,
+	}
+}
+
+// ApplyArchiveApp applies the ArchiveCfg to an ArchiveApp.
+func (cfg ArchiveCfg) ApplyArchiveApp(app *apps.ArchiveApp) error {
+	app.Dir = cfg.dir
+	app.Before = cfg.before
+	return nil
+}
@@ -0,0 +1,25 @@
+package cfg
+
+import (
+	"time"
+
+	"tradetracker/internal/app/apps"
+)
+
+// CompactCfg configures the time an app compacts positions superseded before.
+type CompactCfg struct {
+	before time.Time
+}
+
+// NewCompactCfg creates a new CompactCfg. A zero time compacts every superseded position.
+func NewCompactCfg(before time.Time) *CompactCfg {
+	return &CompactCfg{
+		before: before,
+	}
+}
+
+// ApplyCompactApp applies the CompactCfg to a CompactApp.
+func (cfg CompactCfg) ApplyCompactApp(app *apps.CompactApp) error {
+	app.Before = cfg.before
+	return nil
+}
@@ -93,3 +93,163 @@ func (cfg DBCfg) ApplyQueryApp(app *apps.QueryApp) error {
 	app.DB = dbConn
 	return nil
 }
+
+// ApplyBarApp applies the DBCfg to a BarApp.
+func (cfg DBCfg) ApplyBarApp(app *apps.BarApp) error {
+	dbConn, err := getDBConn("bar", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyBarQueryApp applies the DBCfg to a BarQueryApp.
+func (cfg DBCfg) ApplyBarQueryApp(app *apps.BarQueryApp) error {
+	dbConn, err := getDBConn("bars", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyPortfolioApp applies the DBCfg to a PortfolioApp.
+func (cfg DBCfg) ApplyPortfolioApp(app *apps.PortfolioApp) error {
+	dbConn, err := getDBConn("portfolio", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyInstrumentApp applies the DBCfg to an InstrumentApp.
+func (cfg DBCfg) ApplyInstrumentApp(app *apps.InstrumentApp) error {
+	dbConn, err := getDBConn("instrument", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplySnapshotApp applies the DBCfg to a SnapshotApp.
+func (cfg DBCfg) ApplySnapshotApp(app *apps.SnapshotApp) error {
+	dbConn, err := getDBConn("snapshot", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyTradeQueryApp applies the DBCfg to a TradeQueryApp.
+func (cfg DBCfg) ApplyTradeQueryApp(app *apps.TradeQueryApp) error {
+	dbConn, err := getDBConn("trades", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyExplainApp applies the DBCfg to an ExplainApp.
+func (cfg DBCfg) ApplyExplainApp(app *apps.ExplainApp) error {
+	dbConn, err := getDBConn("explain", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyVerifyApp applies the DBCfg to a VerifyApp.
+func (cfg DBCfg) ApplyVerifyApp(app *apps.VerifyApp) error {
+	dbConn, err := getDBConn("verify", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyDiffApp applies the DBCfg to a DiffApp.
+func (cfg DBCfg) ApplyDiffApp(app *apps.DiffApp) error {
+	dbConn, err := getDBConn("diff", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyStatsApp applies the DBCfg to a StatsApp.
+func (cfg DBCfg) ApplyStatsApp(app *apps.StatsApp) error {
+	dbConn, err := getDBConn("stats", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyWhatIfApp applies the DBCfg to a WhatIfApp.
+func (cfg DBCfg) ApplyWhatIfApp(app *apps.WhatIfApp) error {
+	dbConn, err := getDBConn("whatif", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyMigrateApp applies the DBCfg to a MigrateApp.
+func (cfg DBCfg) ApplyMigrateApp(app *apps.MigrateApp) error {
+	dbConn, err := getDBConn("migrate", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyArchiveApp applies the DBCfg to an ArchiveApp.
+func (cfg DBCfg) ApplyArchiveApp(app *apps.ArchiveApp) error {
+	dbConn, err := getDBConn("archive", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyRetentionApp applies the DBCfg to a RetentionApp.
+func (cfg DBCfg) ApplyRetentionApp(app *apps.RetentionApp) error {
+	dbConn, err := getDBConn("retention", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyLocksApp applies the DBCfg to a LocksApp.
+func (cfg DBCfg) ApplyLocksApp(app *apps.LocksApp) error {
+	dbConn, err := getDBConn("locks", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
+
+// ApplyServeApp applies the DBCfg to a ServeApp.
+func (cfg DBCfg) ApplyServeApp(app *apps.ServeApp) error {
+	dbConn, err := getDBConn("serve", cfg.host, cfg.port, cfg.dbName, cfg.user, cfg.password)
+	if err != nil {
+		return errors.Wrap(err, "get db conn failed")
+	}
+	app.DB = dbConn
+	return nil
+}
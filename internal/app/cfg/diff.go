@@ -0,0 +1,25 @@
+package cfg
+
+import "tradetracker/internal/app/apps"
+
+// DiffCfg configures which instruments an app compares positions in, and the saved snapshot it compares against.
+type DiffCfg struct {
+	instruments []string
+	against     string
+}
+
+// NewDiffCfg creates a new DiffCfg. No instruments compares every instrument,
+// and an empty path compares positions between two timestamps rather than against a saved snapshot.
+func NewDiffCfg(instruments []string, against string) *DiffCfg {
+	return &DiffCfg{
+		instruments: instruments,
+		against:     against,
+	}
+}
+
+// ApplyDiffApp applies the DiffCfg to a DiffApp.
+func (cfg DiffCfg) ApplyDiffApp(app *apps.DiffApp) error {
+	app.Instruments = cfg.instruments
+	app.Against = cfg.against
+	return nil
+}
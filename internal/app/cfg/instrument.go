@@ -0,0 +1,24 @@
+package cfg
+
+import (
+	"tradetracker/internal/app/apps"
+	"tradetracker/pkg/models"
+)
+
+// InstrumentCfg configures the instrument reference data an app operates on.
+type InstrumentCfg struct {
+	instrument models.Instrument
+}
+
+// NewInstrumentCfg creates a new InstrumentCfg.
+func NewInstrumentCfg(instrument models.Instrument) *InstrumentCfg {
+	return &InstrumentCfg{
+		instrument: instrument,
+	}
+}
+
+// ApplyInstrumentApp applies the InstrumentCfg to an InstrumentApp.
+func (cfg InstrumentCfg) ApplyInstrumentApp(app *apps.InstrumentApp) error {
+	app.Instrument = cfg.instrument
+	return nil
+}
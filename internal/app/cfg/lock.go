@@ -0,0 +1,38 @@
+package cfg
+
+import (
+	"time"
+
+	"tradetracker/internal/app/apps"
+)
+
+// LockCfg configures how long an app waits for another process to release the lock on an instrument.
+type LockCfg struct {
+	timeout time.Duration
+}
+
+// NewLockCfg creates a new LockCfg. A zero timeout fails fast if the instrument is locked,
+// and a negative timeout waits indefinitely.
+func NewLockCfg(timeout time.Duration) *LockCfg {
+	return &LockCfg{
+		timeout: timeout,
+	}
+}
+
+// ApplyPositionApp applies the LockCfg to a PositionApp.
+func (cfg LockCfg) ApplyPositionApp(app *apps.PositionApp) error {
+	app.LockTimeout = cfg.timeout
+	return nil
+}
+
+// ApplyArchiveApp applies the LockCfg to an ArchiveApp.
+func (cfg LockCfg) ApplyArchiveApp(app *apps.ArchiveApp) error {
+	app.LockTimeout = cfg.timeout
+	return nil
+}
+
+// ApplyServeApp applies the LockCfg to a ServeApp.
+func (cfg LockCfg) ApplyServeApp(app *apps.ServeApp) error {
+	app.LockTimeout = cfg.timeout
+	return nil
+}
@@ -0,0 +1,25 @@
+package cfg
+
+import "tradetracker/internal/app/apps"
+
+// MigrateCfg configures how many migrations an app applies or rolls back.
+type MigrateCfg struct {
+	limit int
+	all   bool
+}
+
+// NewMigrateCfg creates a new MigrateCfg. A zero limit uses the default of the action,
+// unless all is set to roll back every migration.
+func NewMigrateCfg(limit int, all bool) *MigrateCfg {
+	return &MigrateCfg{
+		limit: limit,
+		all:   all,
+	}
+}
+
+// ApplyMigrateApp applies the MigrateCfg to a MigrateApp.
+func (cfg MigrateCfg) ApplyMigrateApp(app *apps.MigrateApp) error {
+	app.Limit = cfg.limit
+	app.All = cfg.all
+	return nil
+}
@@ -0,0 +1,84 @@
+package cfg
+
+import (
+	"tradetracker/internal/app/apps"
+	"tradetracker/internal/pkg/output"
+)
+
+// OutputCfg configures the format an app writes its results in, and the file it writes them to.
+// An empty path writes to stdout.
+type OutputCfg struct {
+	format output.Format
+	path   string
+}
+
+// NewOutputCfg creates a new OutputCfg.
+func NewOutputCfg(format output.Format, path string) *OutputCfg {
+	return &OutputCfg{
+		format: format,
+		path:   path,
+	}
+}
+
+// ApplyQueryApp applies the OutputCfg to a QueryApp.
+func (cfg OutputCfg) ApplyQueryApp(app *apps.QueryApp) error {
+	app.Format = cfg.format
+	app.Output = cfg.path
+	return nil
+}
+
+// ApplySnapshotApp applies the OutputCfg to a SnapshotApp.
+func (cfg OutputCfg) ApplySnapshotApp(app *apps.SnapshotApp) error {
+	app.Format = cfg.format
+	app.Output = cfg.path
+	return nil
+}
+
+// ApplyTradeQueryApp applies the OutputCfg to a TradeQueryApp.
+func (cfg OutputCfg) ApplyTradeQueryApp(app *apps.TradeQueryApp) error {
+	app.Format = cfg.format
+	app.Output = cfg.path
+	return nil
+}
+
+// ApplyExplainApp applies the OutputCfg to an ExplainApp.
+func (cfg OutputCfg) ApplyExplainApp(app *apps.ExplainApp) error {
+	app.Format = cfg.format
+	app.Output = cfg.path
+	return nil
+}
+
+// ApplyVerifyApp applies the OutputCfg to a VerifyApp.
+func (cfg OutputCfg) ApplyVerifyApp(app *apps.VerifyApp) error {
+	app.Format = cfg.format
+	app.Output = cfg.path
+	return nil
+}
+
+// ApplyWhatIfApp applies the OutputCfg to a WhatIfApp.
+func (cfg OutputCfg) ApplyWhatIfApp(app *apps.WhatIfApp) error {
+	app.Format = cfg.format
+	app.Output = cfg.path
+	return nil
+}
+
+// ApplyStatsApp applies the OutputCfg to a StatsApp.
+func (cfg OutputCfg) ApplyStatsApp(app *apps.StatsApp) error {
+	app.Format = cfg.format
+	app.Output = cfg.path
+	return nil
+}
+
+// ApplyDiffApp applies the OutputCfg to a DiffApp.
+func (cfg OutputCfg) ApplyDiffApp(app *apps.DiffApp) error {
+	app.Format = cfg.format
+	app.Output = cfg.path
+	return nil
+}
+
+// ApplyLocksApp applies the OutputCfg to a LocksApp.
+func (cfg OutputCfg) ApplyLocksApp(app *apps.LocksApp) error {
+	app.Format = cfg.format
+	app.Output = cfg.path
+	return nil
+}
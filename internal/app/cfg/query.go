@@ -0,0 +1,115 @@
+package cfg
+
+import (
+	"time"
+
+	"tradetracker/internal/app/apps"
+
+	"github.com/pkg/errors"
+)
+
+// IntervalCfg configures the width of the time intervals an app aggregates over.
+type IntervalCfg struct {
+	interval time.Duration
+}
+
+// NewIntervalCfg creates a new IntervalCfg.
+func NewIntervalCfg(interval time.Duration) *IntervalCfg {
+	return &IntervalCfg{
+		interval: interval,
+	}
+}
+
+// barInterval checks that the interval is a positive whole number of seconds, as bars are stored by their
+// width in seconds.
+func (cfg IntervalCfg) barInterval() error {
+	if cfg.interval <= 0 || cfg.interval%time.Second != 0 {
+		return errors.Errorf("bar interval must be a positive whole number of seconds, got %s", cfg.interval)
+	}
+	return nil
+}
+
+// ApplyBarApp applies the IntervalCfg to a BarApp.
+func (cfg IntervalCfg) ApplyBarApp(app *apps.BarApp) error {
+	if err := cfg.barInterval(); err != nil {
+		return err
+	}
+	app.Interval = cfg.interval
+	return nil
+}
+
+// ApplyBarQueryApp applies the IntervalCfg to a BarQueryApp.
+func (cfg IntervalCfg) ApplyBarQueryApp(app *apps.BarQueryApp) error {
+	if err := cfg.barInterval(); err != nil {
+		return err
+	}
+	app.Interval = cfg.interval
+	return nil
+}
+
+// TimeRangeCfg configures the range of time an app queries over.
+// A zero from time is unbounded, and a zero to time defaults to now.
+type TimeRangeCfg struct {
+	from, to time.Time
+}
+
+// NewTimeRangeCfg creates a new TimeRangeCfg.
+func NewTimeRangeCfg(from, to time.Time) *TimeRangeCfg {
+	return &TimeRangeCfg{
+		from: from,
+		to:   to,
+	}
+}
+
+// ApplyBarQueryApp applies the TimeRangeCfg to a BarQueryApp.
+func (cfg TimeRangeCfg) ApplyBarQueryApp(app *apps.BarQueryApp) error {
+	app.From = cfg.from
+	app.To = cfg.to
+	return nil
+}
+
+// ApplyQueryApp applies the IntervalCfg to a QueryApp, resampling the position history to the interval.
+func (cfg IntervalCfg) ApplyQueryApp(app *apps.QueryApp) error {
+	app.Interval = cfg.interval
+	return nil
+}
+
+// ApplyQueryApp applies the TimeRangeCfg to a QueryApp, so that it queries the position history over the range.
+func (cfg TimeRangeCfg) ApplyQueryApp(app *apps.QueryApp) error {
+	app.History = true
+	app.From = cfg.from
+	app.To = cfg.to
+	return nil
+}
+
+// ApplyTradeQueryApp applies the TimeRangeCfg to a TradeQueryApp.
+func (cfg TimeRangeCfg) ApplyTradeQueryApp(app *apps.TradeQueryApp) error {
+	app.Filter.From = cfg.from
+	app.Filter.To = cfg.to
+	return nil
+}
+
+// ApplyStatsApp applies the TimeRangeCfg to a StatsApp.
+func (cfg TimeRangeCfg) ApplyStatsApp(app *apps.StatsApp) error {
+	app.From = cfg.from
+	app.To = cfg.to
+	return nil
+}
+
+// AsOfCfg configures the system time an app queries as of, to see the data as it was known at that time.
+type AsOfCfg struct {
+	asOf time.Time
+}
+
+// NewAsOfCfg creates a new AsOfCfg.
+func NewAsOfCfg(asOf time.Time) *AsOfCfg {
+	return &AsOfCfg{
+		asOf: asOf,
+	}
+}
+
+// ApplyQueryApp applies the AsOfCfg to a QueryApp.
+func (cfg AsOfCfg) ApplyQueryApp(app *apps.QueryApp) error {
+	app.AsOf = cfg.asOf
+	return nil
+}
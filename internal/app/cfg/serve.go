@@ -0,0 +1,91 @@
+package cfg
+
+import (
+	"context"
+	"time"
+
+	"tradetracker/internal"
+	"tradetracker/internal/app/apps"
+	"tradetracker/internal/pkg/position"
+)
+
+// ServeCfg configures the file an app ingests trades from, how often it commits their offset,
+// how long it takes to shut down, and how it reloads its configuration.
+type ServeCfg struct {
+	input                           string
+	commitInterval, shutdownTimeout time.Duration
+	reload                          func(context.Context) error
+}
+
+// NewServeCfg creates a new ServeCfg. The reload function may be nil if there is nothing to reload.
+func NewServeCfg(
+	input string, commitInterval, shutdownTimeout time.Duration, reload func(context.Context) error,
+) *ServeCfg {
+	return &ServeCfg{
+		input:           input,
+		commitInterval:  commitInterval,
+		shutdownTimeout: shutdownTimeout,
+		reload:          reload,
+	}
+}
+
+// ApplyServeApp applies the ServeCfg to a ServeApp.
+func (cfg ServeCfg) ApplyServeApp(app *apps.ServeApp) error {
+	app.Input = cfg.input
+	app.CommitInterval = cfg.commitInterval
+	app.ShutdownTimeout = cfg.shutdownTimeout
+	app.Reload = cfg.reload
+	return nil
+}
+
+// LateCfg configures how far behind the latest trade trades may arrive and still be reordered,
+// how trades later than that are handled, and where trades rejected as late are written.
+type LateCfg struct {
+	allowedLateness time.Duration
+	policy          position.LatePolicy
+	output          string
+}
+
+// NewLateCfg creates a new LateCfg. If the output is empty, rejected trades are written alongside the input.
+func NewLateCfg(allowedLateness time.Duration, policy position.LatePolicy, output string) *LateCfg {
+	return &LateCfg{
+		allowedLateness: allowedLateness,
+		policy:          policy,
+		output:          output,
+	}
+}
+
+// ApplyServeApp applies the LateCfg to a ServeApp.
+func (cfg LateCfg) ApplyServeApp(app *apps.ServeApp) error {
+	app.AllowedLateness = cfg.allowedLateness
+	app.LatePolicy = cfg.policy
+	app.LateOutput = cfg.output
+	return nil
+}
+
+// ServerCfg configures the ports an app serves on, and the number of goroutines beyond which it is unhealthy.
+type ServerCfg struct {
+	port, healthPort, maxGoroutines int
+}
+
+// NewServerCfg creates a new ServerCfg.
+func NewServerCfg(port, healthPort, maxGoroutines int) *ServerCfg {
+	return &ServerCfg{
+		port:          port,
+		healthPort:    healthPort,
+		maxGoroutines: maxGoroutines,
+	}
+}
+
+// ServerFromEnv creates a new ServerCfg from the current environment.
+func ServerFromEnv() *ServerCfg {
+	return NewServerCfg(internal.Port, internal.HealthPort, internal.MaxGoroutines)
+}
+
+// ApplyServeApp applies the ServerCfg to a ServeApp.
+func (cfg ServerCfg) ApplyServeApp(app *apps.ServeApp) error {
+	app.Port = cfg.port
+	app.HealthPort = cfg.healthPort
+	app.MaxGoroutines = cfg.maxGoroutines
+	return nil
+}
@@ -0,0 +1,21 @@
+package cfg
+
+import "tradetracker/internal/app/apps"
+
+// SnapshotCfg configures which positions a snapshot includes.
+type SnapshotCfg struct {
+	excludeFlat bool
+}
+
+// NewSnapshotCfg creates a new SnapshotCfg.
+func NewSnapshotCfg(excludeFlat bool) *SnapshotCfg {
+	return &SnapshotCfg{
+		excludeFlat: excludeFlat,
+	}
+}
+
+// ApplySnapshotApp applies the SnapshotCfg to a SnapshotApp.
+func (cfg SnapshotCfg) ApplySnapshotApp(app *apps.SnapshotApp) error {
+	app.ExcludeFlat = cfg.excludeFlat
+	return nil
+}
@@ -0,0 +1,24 @@
+package cfg
+
+import (
+	"tradetracker/internal/app/apps"
+	"tradetracker/internal/pkg/repo"
+)
+
+// StatsCfg configures the periods an app aggregates stats over.
+type StatsCfg struct {
+	period repo.Period
+}
+
+// NewStatsCfg creates a new StatsCfg.
+func NewStatsCfg(period repo.Period) *StatsCfg {
+	return &StatsCfg{
+		period: period,
+	}
+}
+
+// ApplyStatsApp applies the StatsCfg to a StatsApp.
+func (cfg StatsCfg) ApplyStatsApp(app *apps.StatsApp) error {
+	app.Period = cfg.period
+	return nil
+}
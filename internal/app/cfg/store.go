@@ -0,0 +1,83 @@
+package cfg
+
+import (
+	"tradetracker/internal"
+	"tradetracker/internal/app/apps"
+
+	"github.com/pkg/errors"
+)
+
+// StoreCfg configures where an app stores its data.
+// The memory store is not persisted, so it is only useful for demos.
+type StoreCfg struct {
+	store, dataDir string
+}
+
+// NewStoreCfg creates a new StoreCfg. The data directory is only used by the file store.
+func NewStoreCfg(store, dataDir string) *StoreCfg {
+	return &StoreCfg{
+		store:   store,
+		dataDir: dataDir,
+	}
+}
+
+// StoreFromEnv creates a new StoreCfg from the current environment.
+func StoreFromEnv() *StoreCfg {
+	return NewStoreCfg(internal.Store, internal.DataDir)
+}
+
+// ApplyTradeApp applies the StoreCfg to a TradeApp.
+func (cfg StoreCfg) ApplyTradeApp(app *apps.TradeApp) error {
+	switch cfg.store {
+	case internal.PostgresStore:
+	case internal.MemoryStore:
+		app.Memory = true
+	case internal.FileStore:
+		app.DataDir = cfg.dataDir
+	default:
+		return errors.Errorf("unknown store %q, should be one of: postgres, memory, file", cfg.store)
+	}
+	return nil
+}
+
+// ApplyPositionApp applies the StoreCfg to a PositionApp.
+func (cfg StoreCfg) ApplyPositionApp(app *apps.PositionApp) error {
+	dataDir, err := cfg.persistentDataDir()
+	if err != nil {
+		return err
+	}
+	app.DataDir = dataDir
+	return nil
+}
+
+// ApplyQueryApp applies the StoreCfg to a QueryApp.
+func (cfg StoreCfg) ApplyQueryApp(app *apps.QueryApp) error {
+	dataDir, err := cfg.persistentDataDir()
+	if err != nil {
+		return err
+	}
+	app.DataDir = dataDir
+	return nil
+}
+
+// ApplyCompactApp applies the StoreCfg to a CompactApp.
+func (cfg StoreCfg) ApplyCompactApp(app *apps.CompactApp) error {
+	if cfg.store != internal.FileStore {
+		return errors.Errorf("store %q cannot be compacted, only the file store can", cfg.store)
+	}
+	app.DataDir = cfg.dataDir
+	return nil
+}
+
+// persistentDataDir returns the data directory if the file store is used, or empty if the postgres store is used.
+// The memory store is not persisted, so there is nothing to read from it in a later command.
+func (cfg StoreCfg) persistentDataDir() (string, error) {
+	switch cfg.store {
+	case internal.PostgresStore:
+		return "", nil
+	case internal.FileStore:
+		return cfg.dataDir, nil
+	default:
+		return "", errors.Errorf("store %q is not supported, should be one of: postgres, file", cfg.store)
+	}
+}
@@ -0,0 +1,43 @@
+package cfg
+
+import (
+	"tradetracker/internal/app/apps"
+	"tradetracker/pkg/decimal"
+
+	"github.com/pkg/errors"
+)
+
+// TradeFilterCfg configures which trades an app lists, and how they are paginated.
+type TradeFilterCfg struct {
+	minSize            decimal.Decimal
+	minPrice, maxPrice *decimal.Decimal
+	afterID, limit     int64
+}
+
+// NewTradeFilterCfg creates a new TradeFilterCfg. A nil min or max price is unbounded,
+// and a zero limit lists all trades.
+func NewTradeFilterCfg(minSize decimal.Decimal, minPrice, maxPrice *decimal.Decimal, afterID, limit int64) *TradeFilterCfg {
+	return &TradeFilterCfg{
+		minSize:  minSize,
+		minPrice: minPrice,
+		maxPrice: maxPrice,
+		afterID:  afterID,
+		limit:    limit,
+	}
+}
+
+// ApplyTradeQueryApp applies the TradeFilterCfg to a TradeQueryApp.
+func (cfg TradeFilterCfg) ApplyTradeQueryApp(app *apps.TradeQueryApp) error {
+	if cfg.minSize.Sign() < 0 || cfg.limit < 0 {
+		return errors.New("min size and limit must not be negative")
+	}
+	if cfg.minPrice != nil && cfg.maxPrice != nil && cfg.minPrice.Cmp(*cfg.maxPrice) > 0 {
+		return errors.New("min price must not exceed max price")
+	}
+	app.Filter.MinSize = cfg.minSize
+	app.Filter.MinPrice = cfg.minPrice
+	app.Filter.MaxPrice = cfg.maxPrice
+	app.Filter.AfterID = cfg.afterID
+	app.Filter.Limit = cfg.limit
+	return nil
+}
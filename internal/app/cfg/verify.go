@@ -0,0 +1,21 @@
+package cfg
+
+import "tradetracker/internal/app/apps"
+
+// VerifyCfg configures which instruments an app verifies.
+type VerifyCfg struct {
+	all bool
+}
+
+// NewVerifyCfg creates a new VerifyCfg.
+func NewVerifyCfg(all bool) *VerifyCfg {
+	return &VerifyCfg{
+		all: all,
+	}
+}
+
+// ApplyVerifyApp applies the VerifyCfg to a VerifyApp.
+func (cfg VerifyCfg) ApplyVerifyApp(app *apps.VerifyApp) error {
+	app.All = cfg.all
+	return nil
+}
@@ -0,0 +1,27 @@
+package cfg
+
+import (
+	"tradetracker/internal/app/apps"
+	"tradetracker/pkg/decimal"
+)
+
+// WhatIfCfg configures the hypothetical trades an app simulates, and the price to mark them at.
+type WhatIfCfg struct {
+	trades []string
+	mark   *decimal.Decimal
+}
+
+// NewWhatIfCfg creates a new WhatIfCfg. A nil mark price marks at the price of the latest trade.
+func NewWhatIfCfg(trades []string, mark *decimal.Decimal) *WhatIfCfg {
+	return &WhatIfCfg{
+		trades: trades,
+		mark:   mark,
+	}
+}
+
+// ApplyWhatIfApp applies the WhatIfCfg to a WhatIfApp.
+func (cfg WhatIfCfg) ApplyWhatIfApp(app *apps.WhatIfApp) error {
+	app.Trades = cfg.trades
+	app.Mark = cfg.mark
+	return nil
+}
@@ -26,6 +26,15 @@ const (
 	ProdEnv = "prod"
 )
 
+const (
+	// PostgresStore is a string indicating that data is stored in the postgres database.
+	PostgresStore = "postgres"
+	// MemoryStore is a string indicating that data is stored in memory, and lost when the command exits.
+	MemoryStore = "memory"
+	// FileStore is a string indicating that data is stored in append-only files in the data directory.
+	FileStore = "file"
+)
+
 // Flag describes a piece of application configuration.
 type Flag struct {
 	Name         string
@@ -46,6 +55,26 @@ var (
 		Usage: "Sets the log level and should be one of: debug, info, warn, error.",
 		Value: &LogLevel,
 	}
+	TimezoneFlag = Flag{
+		Name:  "timezone",
+		Usage: "The IANA time zone, e.g. Europe/London, that dates and times without an explicit offset are interpreted in.",
+		Value: &Timezone,
+	}
+	StoreFlag = Flag{
+		Name:  "store",
+		Usage: "Where trades and positions are stored and should be one of: postgres, memory, file.",
+		Value: &Store,
+	}
+	DataDirFlag = Flag{
+		Name:  "data_dir",
+		Usage: "The directory the file store keeps its data in.",
+		Value: &DataDir,
+	}
+	ConfigFlag = Flag{
+		Name:  "config",
+		Usage: "A YAML, JSON or TOML file of configuration, used for any setting not given by a flag or the environment.",
+		Value: &Config,
+	}
 
 	HealthPortFlag = Flag{
 		Name:  "health_port",
@@ -54,7 +83,7 @@ var (
 	}
 	PortFlag = Flag{
 		Name:  "port",
-		Usage: "The port the gRPC server should listen on.",
+		Usage: "The port the query API should listen on.",
 		Value: &Port,
 	}
 
@@ -106,6 +135,10 @@ var (
 var (
 	Env      string
 	LogLevel string
+	Timezone string
+	Store    string
+	DataDir  string
+	Config   string
 
 	HealthPort int
 	Port       int
@@ -156,6 +189,10 @@ func init() {
 
 	setDefault(&EnvFlag, "local")
 	setDefault(&LogLevelFlag, "debug")
+	setDefault(&TimezoneFlag, "UTC")
+	setDefault(&StoreFlag, PostgresStore)
+	setDefault(&DataDirFlag, "data")
+	setDefault(&ConfigFlag, "")
 
 	setDefault(&HealthPortFlag, 8080)
 	setDefault(&PortFlag, 8081)
@@ -172,8 +209,12 @@ func init() {
 	setDefault(&MaxPGOpenConnFlag, 80)
 }
 
+// registeredFlags are the flags registered with cobra, which LoadConfig reads from the config file.
+var registeredFlags []*Flag
+
 // RegisterCommandFlags registers the given flags with cobra.
 func RegisterCommandFlags(cmd *cobra.Command, flags []*Flag) error {
+	registeredFlags = append(registeredFlags, flags...)
 	for _, flag := range flags {
 		switch defaultVal := flag.defaultValue.(type) {
 		case string:
@@ -195,6 +236,41 @@ func RegisterCommandFlags(cmd *cobra.Command, flags []*Flag) error {
 	return nil
 }
 
+// LoadConfig reads the config file, if one is given, and sets each of the given flags, or every registered
+// flag if none are given, which was not given on the command line of cmd from it. The environment takes
+// precedence over the config file. It may be called again with the flags which can be changed while running
+// to reload the config file, e.g. after it has changed, leaving the other settings as they are.
+func LoadConfig(cmd *cobra.Command, flags ...*Flag) error {
+	if Config == "" {
+		return nil
+	}
+	viper.SetConfigFile(Config)
+	if err := viper.ReadInConfig(); err != nil {
+		return errors.Wrap(err, "read config file failed")
+	}
+	if len(flags) == 0 {
+		flags = registeredFlags
+	}
+	for _, flag := range flags {
+		if flag == &ConfigFlag || cmd.Flags().Changed(flag.Name) {
+			continue
+		}
+		switch v := flag.Value.(type) {
+		case *string:
+			*v = viper.GetString(flag.Name)
+		case *[]string:
+			*v = viper.GetStringSlice(flag.Name)
+		case *int:
+			*v = viper.GetInt(flag.Name)
+		case *bool:
+			*v = viper.GetBool(flag.Name)
+		default:
+			return fmt.Errorf("unsupported flag type %T for flag %s", v, spew.Sdump(flag))
+		}
+	}
+	return nil
+}
+
 func normaliseEnvString(env string) (string, error) {
 	normalised := strings.ToLower(env)
 	// permit long form spellings
@@ -221,5 +297,8 @@ func ValidateEnv() error {
 	if err != nil {
 		return err
 	}
+	if Store != PostgresStore && Store != MemoryStore && Store != FileStore {
+		return errors.New("Invalid store: " + Store)
+	}
 	return nil
 }
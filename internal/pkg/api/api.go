@@ -0,0 +1,196 @@
+// Package api serves queries for positions over HTTP, responding with JSON.
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/timeexpr"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var logger logrus.FieldLogger = logrus.StandardLogger()
+
+// errBadRequest indicates that a query parameter is invalid.
+var errBadRequest = errors.New("bad request")
+
+// Resolver resolves an instrument from its ID, symbol or ISIN.
+type Resolver interface {
+	Resolve(ctx context.Context, ref string) (*models.Instrument, error)
+}
+
+// Position is a position in an instrument, labelled with the instrument's symbol.
+type Position struct {
+	*models.Position
+	Symbol string `json:"symbol,omitempty"`
+}
+
+// NewHandler creates a handler serving the queries:
+//
+//   GET /positions/{instrument}?at=&account=&portfolio=&as_of=
+//     The position in an instrument at a time (default now), of an account, or aggregated over a portfolio
+//     or all accounts, optionally as it was known at an earlier time.
+//   GET /snapshot?at=&account=&portfolio=&exclude_flat=
+//     The position in every instrument at a time (default now), of an account, a portfolio or all accounts.
+//
+// Times are parsed as time expressions, as given on the command line.
+func NewHandler(positions repo.PositionRepo, instruments Resolver) http.Handler {
+	h := &handler{
+		positions:   positions,
+		instruments: instruments,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/positions/", h.serve(h.position))
+	mux.HandleFunc("/snapshot", h.serve(h.snapshot))
+	return mux
+}
+
+type handler struct {
+	positions   repo.PositionRepo
+	instruments Resolver
+}
+
+// serve wraps a query, writing its result as JSON or its error with the corresponding status code.
+func (h *handler) serve(query func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, errorBody(errors.Errorf("method %s not allowed", req.Method)))
+			return
+		}
+		res, err := query(req)
+		if err != nil {
+			status := statusOf(err)
+			if status == http.StatusInternalServerError {
+				logger.WithField("path", req.URL.Path).WithError(err).Error("query failed")
+			}
+			writeJSON(w, status, errorBody(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (h *handler) position(req *http.Request) (interface{}, error) {
+	ref := strings.TrimPrefix(req.URL.Path, "/positions/")
+	if ref == "" || strings.Contains(ref, "/") {
+		return nil, errors.Wrap(errBadRequest, "path must be /positions/{instrument}")
+	}
+	q := req.URL.Query()
+	at, err := parseTime(q.Get("at"), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	asOf, err := parseTime(q.Get("as_of"), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	accountID, portfolioID, err := parseOwner(q.Get("account"), q.Get("portfolio"))
+	if err != nil {
+		return nil, err
+	}
+	inst, err := h.instruments.Resolve(req.Context(), ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve instrument failed")
+	}
+	var pos *models.Position
+	if accountID != nil {
+		pos, err = h.positions.ReadPosition(req.Context(), inst.ID, *accountID, at, asOf)
+	} else {
+		pos, err = h.positions.ReadPortfolioPosition(req.Context(), inst.ID, portfolioID, at, asOf)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read position failed")
+	}
+	return &Position{Position: pos, Symbol: inst.Symbol}, nil
+}
+
+func (h *handler) snapshot(req *http.Request) (interface{}, error) {
+	q := req.URL.Query()
+	at, err := parseTime(q.Get("at"), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	accountID, portfolioID, err := parseOwner(q.Get("account"), q.Get("portfolio"))
+	if err != nil {
+		return nil, err
+	}
+	excludeFlat := false
+	if s := q.Get("exclude_flat"); s != "" {
+		if excludeFlat, err = strconv.ParseBool(s); err != nil {
+			return nil, errors.Wrapf(errBadRequest, "exclude_flat %q is not a boolean", s)
+		}
+	}
+	positions, err := h.positions.ReadSnapshot(req.Context(), accountID, portfolioID, at, excludeFlat)
+	if err != nil {
+		return nil, errors.Wrap(err, "read snapshot failed")
+	}
+	if positions == nil {
+		positions = []*models.Position{}
+	}
+	return positions, nil
+}
+
+// parseTime parses a time expression, or returns the default if it is empty.
+func parseTime(expr string, def time.Time) (time.Time, error) {
+	if expr == "" {
+		return def, nil
+	}
+	t, err := timeexpr.Parse(expr)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(errBadRequest, "time %q: %s", expr, err)
+	}
+	return t, nil
+}
+
+// parseOwner parses the account or portfolio whose positions are queried, which are mutually exclusive.
+func parseOwner(account, portfolio string) (accountID *int64, portfolioID int64, err error) {
+	if account != "" && portfolio != "" {
+		return nil, 0, errors.Wrap(errBadRequest, "account and portfolio are mutually exclusive")
+	}
+	if account != "" {
+		id, err := strconv.ParseInt(account, 10, 64)
+		if err != nil {
+			return nil, 0, errors.Wrapf(errBadRequest, "account %q is not an ID", account)
+		}
+		return &id, 0, nil
+	}
+	if portfolio != "" {
+		if portfolioID, err = strconv.ParseInt(portfolio, 10, 64); err != nil {
+			return nil, 0, errors.Wrapf(errBadRequest, "portfolio %q is not an ID", portfolio)
+		}
+	}
+	return nil, portfolioID, nil
+}
+
+// statusOf returns the status code of the response to a query which failed with the error.
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, errBadRequest), errors.Is(err, instrument.ErrAmbiguousInstrument):
+		return http.StatusBadRequest
+	case errors.Is(err, instrument.ErrUnknownInstrument), errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func errorBody(err error) map[string]string {
+	return map[string]string{"error": err.Error()}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.WithError(err).Warn("write response failed")
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/internal/pkg/timeexpr"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type resolver map[string]*models.Instrument
+
+func (r resolver) Resolve(_ context.Context, ref string) (*models.Instrument, error) {
+	if inst, ok := r[ref]; ok {
+		return inst, nil
+	}
+	return nil, errors.Wrapf(instrument.ErrUnknownInstrument, "%q", ref)
+}
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemoryRepo()
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, pos := range []*models.Position{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Timestamp: ts},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(-4), Timestamp: ts},
+	} {
+		_, err := r.CreatePosition(ctx, pos)
+		require.NoError(t, err)
+	}
+	h := NewHandler(r, resolver{"AAPL": {ID: 1, Symbol: "AAPL"}})
+	get := func(target string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var body interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		if m, ok := body.(map[string]interface{}); ok {
+			return w.Code, m
+		}
+		return w.Code, map[string]interface{}{"positions": body}
+	}
+
+	code, body := get("/positions/AAPL")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "6", body["size"])
+	require.Equal(t, "AAPL", body["symbol"])
+
+	code, body = get("/positions/AAPL?account=1&at=2022-01-01T00:00:00Z")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "10", body["size"])
+
+	code, body = get("/snapshot?account=2")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, body["positions"], 1)
+
+	code, _ = get("/positions/MSFT")
+	require.Equal(t, http.StatusNotFound, code)
+	code, _ = get("/positions/AAPL?account=1&at=2021-01-01T00:00:00Z")
+	require.Equal(t, http.StatusNotFound, code)
+	code, body = get("/positions/AAPL?account=1&portfolio=1")
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, body["error"], "mutually exclusive")
+	code, _ = get("/snapshot?at=yesterday-ish")
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestHandlerReload(t *testing.T) {
+	// the timezone is reloaded on SIGHUP while queries are served, which is checked when run with -race
+	t.Cleanup(func() { require.NoError(t, timeexpr.SetLocation("UTC")) })
+	h := NewHandler(repo.NewMemoryRepo(), resolver{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/snapshot?at=2022-01-01", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("unexpected status %d", w.Code)
+				}
+			}
+		}()
+	}
+	for _, name := range []string{"Europe/London", "America/New_York", "UTC"} {
+		require.NoError(t, timeexpr.SetLocation(name))
+	}
+	wg.Wait()
+}
+
+func TestHealth(t *testing.T) {
+	check := func(h *Health) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return w.Code
+	}
+	h := NewHealth(1 << 20)
+	require.Equal(t, http.StatusOK, check(h))
+	h.Drain()
+	require.Equal(t, http.StatusServiceUnavailable, check(h))
+	require.Equal(t, http.StatusServiceUnavailable, check(NewHealth(0)))
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+)
+
+// Health serves health checks, which fail if there are more goroutines than allowed,
+// or once the process has begun to shut down so that it is taken out of service.
+type Health struct {
+	maxGoroutines int
+	draining      int32
+}
+
+// NewHealth creates a new Health, which fails if more than maxGoroutines are running.
+func NewHealth(maxGoroutines int) *Health {
+	return &Health{
+		maxGoroutines: maxGoroutines,
+	}
+}
+
+// Drain marks the process as shutting down, failing later health checks.
+func (h *Health) Drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+// ServeHTTP serves a health check.
+func (h *Health) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	if atomic.LoadInt32(&h.draining) == 1 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+		return
+	}
+	if n := runtime.NumGoroutine(); n > h.maxGoroutines {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"status": fmt.Sprintf("%d goroutines exceeds the maximum of %d", n, h.maxGoroutines),
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
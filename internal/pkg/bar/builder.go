@@ -0,0 +1,114 @@
+package bar
+
+import (
+	"context"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// Builder is used to build bars from trades.
+type Builder interface {
+	Build(ctx context.Context, in <-chan *models.Trade, out chan<- *models.Bar) error
+}
+
+// IntervalBuilder builds OHLCV bars from the trades that occur within fixed-width intervals.
+type IntervalBuilder struct {
+	intervalSeconds, instrumentID int64
+}
+
+// NewIntervalBuilder creates a new IntervalBuilder.
+func NewIntervalBuilder(intervalSeconds, instrumentID int64) *IntervalBuilder {
+	return &IntervalBuilder{
+		intervalSeconds: intervalSeconds,
+		instrumentID:    instrumentID,
+	}
+}
+
+// Build aggregates trades within time windows of intervalSeconds to produce bars.
+// Intervals are aligned to the unix epoch, and intervals without any trades do not produce a bar.
+// It assumes that the trades are for a given instrument and are sorted by timestamp; if not, an error is returned.
+func (b *IntervalBuilder) Build(ctx context.Context, in <-chan *models.Trade, out chan<- *models.Bar) error {
+	defer close(out)
+	if b.intervalSeconds <= 0 {
+		return errors.Wrapf(ErrInvalidInterval, "interval must be positive, got %d seconds", b.intervalSeconds)
+	}
+	var bar *models.Bar
+	var notional decimal.Decimal
+	var last time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "context cancelled")
+		case trade, ok := <-in:
+			if !ok {
+				if bar != nil {
+					out <- finalise(bar, notional)
+				}
+				return nil
+			}
+			if trade.InstrumentID != b.instrumentID {
+				return ErrInstrumentMismatch
+			}
+			if trade.Timestamp.Before(last) {
+				return errors.Wrapf(
+					ErrNotSorted,
+					"trade timestamp %s is before previous trade timestamp %s",
+					trade.Timestamp.Format(time.RFC3339Nano),
+					last.Format(time.RFC3339Nano),
+				)
+			}
+			last = trade.Timestamp
+			start := b.intervalStart(trade.Timestamp)
+			if bar != nil && !start.Equal(bar.Timestamp) {
+				out <- finalise(bar, notional)
+				bar = nil
+			}
+			if bar == nil {
+				bar = &models.Bar{
+					InstrumentID:    b.instrumentID,
+					IntervalSeconds: b.intervalSeconds,
+					Open:            trade.Price,
+					High:            trade.Price,
+					Low:             trade.Price,
+					Timestamp:       start,
+				}
+				notional = decimal.Zero
+			}
+			volume := trade.Size.Abs()
+			if trade.Price.Cmp(bar.High) > 0 {
+				bar.High = trade.Price
+			}
+			if trade.Price.Cmp(bar.Low) < 0 {
+				bar.Low = trade.Price
+			}
+			bar.Close = trade.Price
+			bar.Volume = bar.Volume.Add(volume)
+			bar.TradeCount++
+			notional = notional.Add(trade.Price.Mul(volume))
+		}
+	}
+}
+
+// intervalStart returns the start of the interval containing the timestamp.
+func (b *IntervalBuilder) intervalStart(timestamp time.Time) time.Time {
+	secs := timestamp.Unix()
+	start := secs - secs%b.intervalSeconds
+	if secs < 0 && secs%b.intervalSeconds != 0 {
+		start -= b.intervalSeconds
+	}
+	return time.Unix(start, 0).UTC()
+}
+
+// finalise computes the volume-weighted average price of the bar from the traded notional,
+// rounded to the price scale.
+func finalise(bar *models.Bar, notional decimal.Decimal) *models.Bar {
+	if bar.Volume.Sign() > 0 {
+		bar.VWAP = notional.Div(bar.Volume, decimal.PriceScale)
+	} else {
+		bar.VWAP = bar.Close
+	}
+	return bar
+}
@@ -0,0 +1,142 @@
+package bar
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+type tst struct {
+	intervalSeconds int64
+	instrumentID    int64
+	trades          []*models.Trade
+	bars            []*models.Bar
+}
+
+var tsts []tst = []tst{
+	{
+		intervalSeconds: 60,
+		instrumentID:    1,
+		trades: []*models.Trade{
+			{
+				InstrumentID: 1,
+				Size:         decimal.NewFromInt(10),
+				Price:        decimal.NewFromInt(10),
+				Timestamp:    time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC),
+			},
+			{
+				InstrumentID: 1,
+				Size:         decimal.NewFromInt(-20),
+				Price:        decimal.NewFromInt(13),
+				Timestamp:    time.Date(2022, 1, 1, 0, 0, 30, 0, time.UTC),
+			},
+			{
+				InstrumentID: 1,
+				Size:         decimal.NewFromInt(10),
+				Price:        decimal.NewFromInt(8),
+				Timestamp:    time.Date(2022, 1, 1, 0, 0, 59, 0, time.UTC),
+			},
+			{
+				InstrumentID: 1,
+				Size:         decimal.NewFromInt(5),
+				Price:        decimal.NewFromInt(9),
+				Timestamp:    time.Date(2022, 1, 1, 0, 3, 0, 0, time.UTC),
+			},
+		},
+		bars: []*models.Bar{
+			{
+				InstrumentID:    1,
+				IntervalSeconds: 60,
+				Open:            decimal.NewFromInt(10),
+				High:            decimal.NewFromInt(13),
+				Low:             decimal.NewFromInt(8),
+				Close:           decimal.NewFromInt(8),
+				Volume:          decimal.NewFromInt(40),
+				VWAP:            decimal.NewFromInt(11),
+				TradeCount:      3,
+				Timestamp:       time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			{
+				InstrumentID:    1,
+				IntervalSeconds: 60,
+				Open:            decimal.NewFromInt(9),
+				High:            decimal.NewFromInt(9),
+				Low:             decimal.NewFromInt(9),
+				Close:           decimal.NewFromInt(9),
+				Volume:          decimal.NewFromInt(5),
+				VWAP:            decimal.NewFromInt(9),
+				TradeCount:      1,
+				Timestamp:       time.Date(2022, 1, 1, 0, 3, 0, 0, time.UTC),
+			},
+		},
+	},
+}
+
+func TestBuilder(t *testing.T) {
+	ctx := context.Background()
+	for i := range tsts {
+		j := i
+		t.Run(fmt.Sprintf("test_%d", j), func(t *testing.T) {
+			tradesCh := make(chan *models.Trade)
+			barsCh := make(chan *models.Bar)
+			go func() {
+				require.NoError(t,
+					NewIntervalBuilder(
+						tsts[j].intervalSeconds,
+						tsts[j].instrumentID,
+					).Build(ctx, tradesCh, barsCh),
+				)
+			}()
+			var actualBars []*models.Bar
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for bar := range barsCh {
+					actualBars = append(actualBars, bar)
+				}
+			}()
+			go func() {
+				defer close(tradesCh)
+				defer wg.Done()
+				for _, trade := range tsts[j].trades {
+					tradesCh <- trade
+				}
+			}()
+			wg.Wait()
+			require.Len(t, actualBars, len(tsts[j].bars))
+			for idx := range tsts[j].bars {
+				require.Equal(t, tsts[j].bars[idx], actualBars[idx], fmt.Sprintf("idx %d", idx))
+			}
+		})
+	}
+}
+
+func TestBuilderNotSorted(t *testing.T) {
+	tradesCh := make(chan *models.Trade, 2)
+	barsCh := make(chan *models.Bar, 2)
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(1), Timestamp: time.Date(2022, 1, 1, 0, 0, 2, 0, time.UTC)}
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(1), Timestamp: time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)}
+	close(tradesCh)
+	err := NewIntervalBuilder(60, 1).Build(context.Background(), tradesCh, barsCh)
+	require.ErrorIs(t, err, ErrNotSorted)
+}
+
+func TestBuilderFractional(t *testing.T) {
+	tradesCh := make(chan *models.Trade, 2)
+	barsCh := make(chan *models.Bar, 1)
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.MustParse("0.5"), Price: decimal.NewFromInt(30000), Timestamp: time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)}
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.MustParse("-0.25"), Price: decimal.NewFromInt(30300), Timestamp: time.Date(2022, 1, 1, 0, 0, 2, 0, time.UTC)}
+	close(tradesCh)
+	err := NewIntervalBuilder(60, 1).Build(context.Background(), tradesCh, barsCh)
+	require.NoError(t, err)
+	bar := <-barsCh
+	require.Equal(t, "0.75", bar.Volume.String())
+	require.True(t, decimal.NewFromInt(30100).Equal(bar.VWAP), bar.VWAP.String())
+}
@@ -0,0 +1,12 @@
+package bar
+
+import "github.com/pkg/errors"
+
+// ErrInstrumentMismatch indicates that the trade instrument does not match the expected value.
+var ErrInstrumentMismatch error = errors.New("instrument mismatch")
+
+// ErrNotSorted indicates that the trades are not sorted by timestamp.
+var ErrNotSorted error = errors.New("not sorted")
+
+// ErrInvalidInterval indicates that the bar interval is not a positive number of seconds.
+var ErrInvalidInterval error = errors.New("invalid interval")
@@ -0,0 +1,123 @@
+// Package bar implements functionality for aggregating trades into OHLCV bars.
+package bar
+
+import (
+	"context"
+	"sync"
+	"tradetracker/internal/pkg/instrument"
+	"tradetracker/internal/pkg/pubsub"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var logger logrus.FieldLogger = logrus.StandardLogger()
+
+// Processor aggregates trades from a pub-sub system to build bars and stores them in a repository.
+type Processor struct {
+	repo        repo.BarRepo
+	sub         pubsub.Subscriber
+	builder     Builder
+	instruments *instrument.Registry
+}
+
+// Cfg is a configuration function for Processor.
+type Cfg func(*Processor) error
+
+// NewProcessor creates a new Processor.
+func NewProcessor(cfgs ...Cfg) (*Processor, error) {
+	c := &Processor{}
+	for _, cfg := range cfgs {
+		if err := cfg(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// WithRepo sets the repo for the Processor.
+func WithRepo(r repo.BarRepo) Cfg {
+	return func(c *Processor) error {
+		c.repo = r
+		return nil
+	}
+}
+
+// WithSubscriber sets the trade source for the Processor.
+func WithSubscriber(source pubsub.Subscriber) Cfg {
+	return func(c *Processor) error {
+		c.sub = source
+		return nil
+	}
+}
+
+// WithBuilder sets the bar builder for the Processor.
+func WithBuilder(builder Builder) Cfg {
+	return func(c *Processor) error {
+		c.builder = builder
+		return nil
+	}
+}
+
+// WithInstruments sets the instrument reference data used to label the bars created with their symbol.
+func WithInstruments(instruments *instrument.Registry) Cfg {
+	return func(c *Processor) error {
+		c.instruments = instruments
+		return nil
+	}
+}
+
+// Process consumes trade messages from the trade source and uses them to build bars.
+func (t *Processor) Process(ctx context.Context) error {
+	tradeCh := make(chan *models.Trade)
+	barCh := make(chan *models.Bar)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := t.builder.Build(ctx, tradeCh, barCh); err != nil {
+			logger.Fatalln(errors.Wrap(err, "build bars failed"))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for bar := range barCh {
+			id, err := t.repo.CreateBar(ctx, bar)
+			if err != nil {
+				logger.Fatalln(errors.Wrap(err, "create bar failed"))
+			}
+			fields := logrus.Fields{
+				"id":            id,
+				"instrument_id": bar.InstrumentID,
+				"open":          bar.Open,
+				"high":          bar.High,
+				"low":           bar.Low,
+				"close":         bar.Close,
+				"volume":        bar.Volume,
+				"vwap":          bar.VWAP,
+				"trade_count":   bar.TradeCount,
+				"timestamp":     bar.Timestamp,
+			}
+			if t.instruments != nil {
+				fields["symbol"] = t.instruments.Symbol(ctx, bar.InstrumentID)
+			}
+			logger.WithFields(fields).Info("added bar")
+		}
+	}()
+	err := t.sub.Subscribe(ctx, pubsub.TradeTopic, func(m pubsub.Message) error {
+		trade, ok := m.Value.(*models.Trade)
+		if !ok {
+			return errors.New("could not assert message as trade")
+		}
+		tradeCh <- trade
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "subscribe failed")
+	}
+	close(tradeCh)
+	wg.Wait()
+	return nil
+}
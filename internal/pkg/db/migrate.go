@@ -0,0 +1,336 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Migrations embeds the database migrations, so that they can be applied by the binary.
+//go:embed migrations/*.sql
+var Migrations embed.FS
+
+const (
+	// migrationsDir is the directory of the embedded migrations.
+	migrationsDir = "migrations"
+	// migrationTable is the table recording which migrations have been applied, as used by sql-migrate.
+	migrationTable = "migrations"
+	// migrationLockKey is the key of the advisory lock held while migrating, so that concurrent deploys do not race.
+	// It is the ASCII encoding of "migrate".
+	migrationLockKey int64 = 0x6d696772617465
+)
+
+// Migration is a database migration, read from a file in the sql-migrate format:
+// the statements to apply it follow a "-- +migrate Up" line, and those to roll it back a "-- +migrate Down" line.
+// Either line may be followed by "notransaction" to run the statements outside of a transaction.
+type Migration struct {
+	ID                                 string
+	Up, Down                           string
+	UpNoTransaction, DownNoTransaction bool
+}
+
+// MigrationStatus is the status of a migration. A migration which has been applied but is not known
+// to this binary, e.g. because it was applied by a newer version, has no Migration.
+type MigrationStatus struct {
+	ID        string
+	Migration *Migration
+	AppliedAt time.Time // zero if the migration is pending
+}
+
+// ReadMigrations reads the migrations in the directory of the file system, ordered by ID.
+func ReadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read migrations directory failed")
+	}
+	var migrations []*Migration
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrap(err, "read migration failed")
+		}
+		migration, err := ParseMigration(entry.Name(), string(b))
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse migration %s failed", entry.Name())
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].ID < migrations[j].ID
+	})
+	return migrations, nil
+}
+
+// ParseMigration parses the migration with the given ID from its source.
+func ParseMigration(id, src string) (*Migration, error) {
+	migration := &Migration{ID: id}
+	var up, down strings.Builder
+	var section *strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "--" || fields[1] != "+migrate" {
+			if section != nil {
+				section.WriteString(line)
+				section.WriteString("\n")
+			}
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, errors.Errorf("missing migration direction: %q", line)
+		}
+		noTransaction := len(fields) > 3 && fields[3] == "notransaction"
+		switch fields[2] {
+		case "Up":
+			section = &up
+			migration.UpNoTransaction = noTransaction
+		case "Down":
+			section = &down
+			migration.DownNoTransaction = noTransaction
+		case "StatementBegin", "StatementEnd":
+			// statements are not split, so there is nothing to mark
+		default:
+			return nil, errors.Errorf("unknown migration command: %q", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "scan migration failed")
+	}
+	migration.Up = strings.TrimSpace(up.String())
+	migration.Down = strings.TrimSpace(down.String())
+	if migration.Up == "" {
+		return nil, errors.New("migration has no up statements")
+	}
+	return migration, nil
+}
+
+// Migrator applies and rolls back migrations against a database, recording them in the migrations table.
+// Each run holds an advisory lock, so that migrators in other processes wait rather than race.
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+}
+
+// NewMigrator creates a new Migrator of the given migrations, or the embedded migrations if none are given.
+func NewMigrator(db *sql.DB, migrations ...*Migration) (*Migrator, error) {
+	if len(migrations) == 0 {
+		var err error
+		if migrations, err = ReadMigrations(Migrations, migrationsDir); err != nil {
+			return nil, errors.Wrap(err, "read embedded migrations failed")
+		}
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Status returns the status of every migration, ordered by ID.
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	var statuses []*MigrationStatus
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		statuses, err = m.status(ctx, conn)
+		return err
+	})
+	return statuses, err
+}
+
+// Up applies up to max pending migrations in order, or all of them if max is not positive,
+// and returns the IDs of those applied.
+func (m *Migrator) Up(ctx context.Context, max int) ([]string, error) {
+	var applied []string
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		applied, err = m.up(ctx, conn, max)
+		return err
+	})
+	return applied, err
+}
+
+// Down rolls back up to max applied migrations, latest first, or all of them if max is not positive,
+// and returns the IDs of those rolled back.
+func (m *Migrator) Down(ctx context.Context, max int) ([]string, error) {
+	var rolledBack []string
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		rolledBack, err = m.down(ctx, conn, max)
+		return err
+	})
+	return rolledBack, err
+}
+
+// Redo rolls back the latest applied migration and applies it again, and returns its ID.
+func (m *Migrator) Redo(ctx context.Context) (string, error) {
+	var id string
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		rolledBack, err := m.down(ctx, conn, 1)
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			return errors.New("no migrations have been applied")
+		}
+		id = rolledBack[0]
+		_, err = m.up(ctx, conn, 1)
+		return err
+	})
+	return id, err
+}
+
+// locked runs the function on a single connection while holding the migration lock,
+// creating the migrations table if it does not exist.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not get connection")
+	}
+	defer conn.Close()
+	// advisory locks are held by the session, so the lock must be taken and released on the same connection
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return errors.Wrap(err, "could not take migration lock")
+	}
+	defer func() {
+		// the lock is released when the session ends if this fails, e.g. because the context is done
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	}()
+	if _, err := conn.ExecContext(ctx,
+		"CREATE TABLE IF NOT EXISTS "+migrationTable+" (id text PRIMARY KEY, applied_at timestamp with time zone)",
+	); err != nil {
+		return errors.Wrap(err, "could not create migrations table")
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) ([]*MigrationStatus, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT id, applied_at FROM "+migrationTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read applied migrations")
+	}
+	defer rows.Close()
+	byID := make(map[string]*MigrationStatus)
+	var statuses []*MigrationStatus
+	for _, migration := range m.migrations {
+		status := &MigrationStatus{ID: migration.ID, Migration: migration}
+		byID[migration.ID] = status
+		statuses = append(statuses, status)
+	}
+	for rows.Next() {
+		var id string
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&id, &appliedAt); err != nil {
+			return nil, errors.Wrap(err, "could not scan applied migration")
+		}
+		status, ok := byID[id]
+		if !ok {
+			status = &MigrationStatus{ID: id}
+			statuses = append(statuses, status)
+		}
+		status.AppliedAt = appliedAt.Time
+		if status.AppliedAt.IsZero() {
+			// sql-migrate always records the time, but a row is what marks a migration as applied
+			status.AppliedAt = time.Unix(0, 0).UTC()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not read applied migrations")
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+	return statuses, nil
+}
+
+func (m *Migrator) up(ctx context.Context, conn *sql.Conn, max int) ([]string, error) {
+	statuses, err := m.status(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var applied []string
+	for _, status := range statuses {
+		if max > 0 && len(applied) >= max {
+			break
+		}
+		if !status.AppliedAt.IsZero() {
+			continue
+		}
+		migration := status.Migration
+		if err := m.exec(ctx, conn, migration.Up, migration.UpNoTransaction,
+			"INSERT INTO "+migrationTable+" (id, applied_at) VALUES ($1, now())", migration.ID,
+		); err != nil {
+			return applied, errors.Wrapf(err, "could not apply migration %s", migration.ID)
+		}
+		applied = append(applied, migration.ID)
+	}
+	return applied, nil
+}
+
+func (m *Migrator) down(ctx context.Context, conn *sql.Conn, max int) ([]string, error) {
+	statuses, err := m.status(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var rolledBack []string
+	for i := len(statuses) - 1; i >= 0; i-- {
+		if max > 0 && len(rolledBack) >= max {
+			break
+		}
+		status := statuses[i]
+		if status.AppliedAt.IsZero() {
+			continue
+		}
+		migration := status.Migration
+		if migration == nil {
+			return rolledBack, errors.Errorf("could not roll back migration %s: it is not known to this version", status.ID)
+		}
+		if err := m.exec(ctx, conn, migration.Down, migration.DownNoTransaction,
+			"DELETE FROM "+migrationTable+" WHERE id = $1", migration.ID,
+		); err != nil {
+			return rolledBack, errors.Wrapf(err, "could not roll back migration %s", migration.ID)
+		}
+		rolledBack = append(rolledBack, migration.ID)
+	}
+	return rolledBack, nil
+}
+
+// exec runs the statements of a migration and then records it with the given query,
+// together in a transaction unless noTransaction is set.
+func (m *Migrator) exec(ctx context.Context, conn *sql.Conn, statements string, noTransaction bool, record string, id string) error {
+	if noTransaction {
+		if statements != "" {
+			if _, err := conn.ExecContext(ctx, statements); err != nil {
+				return errors.Wrap(err, "exec failed")
+			}
+		}
+		_, err := conn.ExecContext(ctx, record, id)
+		return errors.Wrap(err, "record migration failed")
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin transaction failed")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if statements != "" {
+		if _, err := tx.ExecContext(ctx, statements); err != nil {
+			return errors.Wrap(err, "exec failed")
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, id); err != nil {
+		return errors.Wrap(err, "record migration failed")
+	}
+	return errors.Wrap(tx.Commit(), "commit failed")
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMigration(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	tests := map[string]struct {
+		src       string
+		migration *Migration
+		err       bool
+	}{
+		"up and down": {
+			src: "-- +migrate Up\nCREATE TABLE a (id int);\n\n-- +migrate Down\nDROP TABLE a;\n",
+			migration: &Migration{
+				ID:   "0001_a.sql",
+				Up:   "CREATE TABLE a (id int);",
+				Down: "DROP TABLE a;",
+			},
+		},
+		"no transaction": {
+			src: "-- +migrate Up notransaction\n-- +migrate StatementBegin\nCREATE INDEX CONCURRENTLY a_id ON a (id);\n-- +migrate StatementEnd\n-- +migrate Down\n",
+			migration: &Migration{
+				ID:              "0001_a.sql",
+				Up:              "CREATE INDEX CONCURRENTLY a_id ON a (id);",
+				UpNoTransaction: true,
+			},
+		},
+		"no up": {
+			src: "-- +migrate Down\nDROP TABLE a;\n",
+			err: true,
+		},
+		"unknown command": {
+			src: "-- +migrate Sideways\n",
+			err: true,
+		},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			migration, err := ParseMigration("0001_a.sql", test.src)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.migration, migration)
+		})
+	}
+}
+
+func TestReadMigrations(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	migrations, err := ReadMigrations(Migrations, migrationsDir)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	require.Equal(t, "0001_trades.sql", migrations[0].ID)
+	for i := 1; i < len(migrations); i++ {
+		require.Less(t, migrations[i-1].ID, migrations[i].ID)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	migrations := []*Migration{
+		{ID: "0001_a.sql", Up: "CREATE TABLE a (id int);", Down: "DROP TABLE a;"},
+		{ID: "0002_b.sql", Up: "CREATE TABLE b (id int);", Down: "DROP TABLE b;"},
+		{ID: "0003_c.sql", Up: "CREATE TABLE c (id int);", Down: "DROP TABLE c;"},
+	}
+	appliedAt := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	// expectLocked sets up the expectations of taking the lock and reading which migrations are applied
+	expectLocked := func(mock sqlmock.Sqlmock, applied ...string) {
+		mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).
+			WithArgs(migrationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS migrations")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		rows := sqlmock.NewRows([]string{"id", "applied_at"})
+		for _, id := range applied {
+			rows.AddRow(id, appliedAt)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, applied_at FROM migrations")).WillReturnRows(rows)
+	}
+	expectUnlocked := func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).
+			WithArgs(migrationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	expectMigration := func(mock sqlmock.Sqlmock, statements, record, id string) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(statements)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(record)).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	const insert = "INSERT INTO migrations (id, applied_at) VALUES ($1, now())"
+	const remove = "DELETE FROM migrations WHERE id = $1"
+
+	t.Run("Up", func(t *testing.T) {
+		t.Parallel()
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+		m, err := NewMigrator(db, migrations...)
+		require.NoError(t, err)
+		expectLocked(mock, "0001_a.sql")
+		expectMigration(mock, migrations[1].Up, insert, "0002_b.sql")
+		expectMigration(mock, migrations[2].Up, insert, "0003_c.sql")
+		expectUnlocked(mock)
+		applied, err := m.Up(context.Background(), 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"0002_b.sql", "0003_c.sql"}, applied)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("Down", func(t *testing.T) {
+		t.Parallel()
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+		m, err := NewMigrator(db, migrations...)
+		require.NoError(t, err)
+		expectLocked(mock, "0001_a.sql", "0002_b.sql")
+		expectMigration(mock, migrations[1].Down, remove, "0002_b.sql")
+		expectUnlocked(mock)
+		rolledBack, err := m.Down(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, []string{"0002_b.sql"}, rolledBack)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("Redo", func(t *testing.T) {
+		t.Parallel()
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+		m, err := NewMigrator(db, migrations...)
+		require.NoError(t, err)
+		expectLocked(mock, "0001_a.sql")
+		expectMigration(mock, migrations[0].Down, remove, "0001_a.sql")
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, applied_at FROM migrations")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "applied_at"}))
+		expectMigration(mock, migrations[0].Up, insert, "0001_a.sql")
+		expectUnlocked(mock)
+		id, err := m.Redo(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "0001_a.sql", id)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("Status", func(t *testing.T) {
+		t.Parallel()
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+		m, err := NewMigrator(db, migrations...)
+		require.NoError(t, err)
+		expectLocked(mock, "0001_a.sql", "0004_unknown.sql")
+		expectUnlocked(mock)
+		statuses, err := m.Status(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, []*MigrationStatus{
+			{ID: "0001_a.sql", Migration: migrations[0], AppliedAt: appliedAt},
+			{ID: "0002_b.sql", Migration: migrations[1]},
+			{ID: "0003_c.sql", Migration: migrations[2]},
+			{ID: "0004_unknown.sql", AppliedAt: appliedAt},
+		}, statuses)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("DownUnknown", func(t *testing.T) {
+		t.Parallel()
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+		m, err := NewMigrator(db, migrations...)
+		require.NoError(t, err)
+		expectLocked(mock, "0001_a.sql", "0004_unknown.sql")
+		expectUnlocked(mock)
+		_, err = m.Down(context.Background(), 1)
+		require.Error(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,18 @@
+-- +migrate Up
+CREATE TABLE bars (
+    id serial PRIMARY KEY,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    instrument_id bigint NOT NULL,
+    interval_seconds bigint NOT NULL,
+    open numeric NOT NULL,
+    high numeric NOT NULL,
+    low numeric NOT NULL,
+    close numeric NOT NULL,
+    volume bigint NOT NULL,
+    vwap numeric NOT NULL,
+    trade_count bigint NOT NULL,
+    timestamp timestamp without time zone NOT NULL
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS bars;
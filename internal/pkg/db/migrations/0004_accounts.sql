@@ -0,0 +1,22 @@
+-- +migrate Up
+ALTER TABLE trades ADD COLUMN account_id bigint NOT NULL DEFAULT 0;
+ALTER TABLE positions ADD COLUMN account_id bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE portfolios (
+    id serial PRIMARY KEY,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name text NOT NULL UNIQUE,
+    parent_id integer REFERENCES portfolios (id)
+);
+
+CREATE TABLE portfolio_accounts (
+    portfolio_id integer NOT NULL REFERENCES portfolios (id) ON DELETE CASCADE,
+    account_id bigint NOT NULL,
+    PRIMARY KEY (portfolio_id, account_id)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS portfolio_accounts;
+DROP TABLE IF EXISTS portfolios;
+ALTER TABLE positions DROP COLUMN IF EXISTS account_id;
+ALTER TABLE trades DROP COLUMN IF EXISTS account_id;
@@ -0,0 +1,18 @@
+-- +migrate Up
+CREATE TABLE instruments (
+    id serial PRIMARY KEY,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    symbol text NOT NULL UNIQUE,
+    isin text UNIQUE,
+    cusip text UNIQUE,
+    asset_class text NOT NULL,
+    currency char(3) NOT NULL,
+    lot_size bigint NOT NULL DEFAULT 1,
+    tick_size numeric NOT NULL DEFAULT 0.01,
+    multiplier numeric NOT NULL DEFAULT 1,
+    active_from timestamp without time zone,
+    active_to timestamp without time zone
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS instruments;
@@ -0,0 +1,10 @@
+-- +migrate Up
+ALTER TABLE trades ALTER COLUMN created_at SET DEFAULT (now() AT TIME ZONE 'UTC');
+ALTER TABLE positions ALTER COLUMN created_at SET DEFAULT (now() AT TIME ZONE 'UTC');
+ALTER TABLE positions ADD COLUMN superseded_at timestamp;
+
+-- +migrate Down
+DELETE FROM positions WHERE superseded_at IS NOT NULL;
+ALTER TABLE positions DROP COLUMN IF EXISTS superseded_at;
+ALTER TABLE positions ALTER COLUMN created_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE trades ALTER COLUMN created_at SET DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE positions ADD COLUMN trade_ids bigint[] NOT NULL DEFAULT '{}';
+
+-- +migrate Down
+ALTER TABLE positions DROP COLUMN IF EXISTS trade_ids;
@@ -0,0 +1,9 @@
+-- +migrate Up
+CREATE INDEX trades_instrument_timestamp_idx ON trades (instrument_id, timestamp, id);
+CREATE INDEX positions_instrument_account_timestamp_idx ON positions (instrument_id, account_id, timestamp DESC, id DESC);
+CREATE INDEX positions_current_idx ON positions (instrument_id, timestamp) WHERE superseded_at IS NULL;
+
+-- +migrate Down
+DROP INDEX IF EXISTS positions_current_idx;
+DROP INDEX IF EXISTS positions_instrument_account_timestamp_idx;
+DROP INDEX IF EXISTS trades_instrument_timestamp_idx;
@@ -0,0 +1,125 @@
+-- +migrate Up
+-- +migrate StatementBegin
+-- ensure_month_partition creates the partition of the parent table holding the month of the timestamp,
+-- if it does not already exist, and returns its name. Rows written before the partition existed were
+-- routed to the default partition, so they are moved into the new partition before it is attached.
+CREATE FUNCTION ensure_month_partition(parent text, ts timestamp) RETURNS text
+LANGUAGE plpgsql
+SET search_path = public
+AS $$
+DECLARE
+    month_start timestamp := date_trunc('month', ts);
+    month_end timestamp := date_trunc('month', ts) + interval '1 month';
+    partition_name text := parent || '_' || to_char(ts, 'YYYY_MM');
+BEGIN
+    -- concurrent writers wait for the first to create the partition, rather than racing it
+    PERFORM pg_advisory_xact_lock(hashtext(partition_name));
+    IF to_regclass(partition_name) IS NOT NULL THEN
+        RETURN partition_name;
+    END IF;
+    EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS)', partition_name, parent);
+    EXECUTE format(
+        'WITH moved AS (DELETE FROM %I WHERE timestamp >= %L AND timestamp < %L RETURNING *) INSERT INTO %I SELECT * FROM moved',
+        parent || '_default', month_start, month_end, partition_name
+    );
+    EXECUTE format(
+        'ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)',
+        parent, partition_name, month_start, month_end
+    );
+    RETURN partition_name;
+END;
+$$;
+-- +migrate StatementEnd
+
+ALTER TABLE trades RENAME TO trades_unpartitioned;
+ALTER TABLE trades_unpartitioned RENAME CONSTRAINT trades_pkey TO trades_unpartitioned_pkey;
+DROP INDEX trades_instrument_timestamp_idx;
+ALTER SEQUENCE trades_id_seq OWNED BY NONE;
+CREATE TABLE trades (
+    id integer NOT NULL DEFAULT nextval('trades_id_seq'),
+    created_at timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+    instrument_id bigint NOT NULL,
+    size bigint NOT NULL,
+    price numeric NOT NULL,
+    timestamp timestamp without time zone NOT NULL,
+    account_id bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+ALTER SEQUENCE trades_id_seq OWNED BY trades.id;
+CREATE TABLE trades_default PARTITION OF trades DEFAULT;
+CREATE INDEX trades_instrument_timestamp_idx ON trades (instrument_id, timestamp, id);
+SELECT ensure_month_partition('trades', month)
+FROM (SELECT DISTINCT date_trunc('month', timestamp) AS month FROM trades_unpartitioned) AS months;
+INSERT INTO trades (id, created_at, instrument_id, size, price, timestamp, account_id)
+SELECT id, created_at, instrument_id, size, price, timestamp, account_id FROM trades_unpartitioned;
+DROP TABLE trades_unpartitioned;
+
+ALTER TABLE positions RENAME TO positions_unpartitioned;
+ALTER TABLE positions_unpartitioned RENAME CONSTRAINT positions_pkey TO positions_unpartitioned_pkey;
+DROP INDEX positions_instrument_account_timestamp_idx;
+DROP INDEX positions_current_idx;
+ALTER SEQUENCE positions_id_seq OWNED BY NONE;
+CREATE TABLE positions (
+    id integer NOT NULL DEFAULT nextval('positions_id_seq'),
+    created_at timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+    instrument_id bigint NOT NULL,
+    size bigint NOT NULL,
+    timestamp timestamp without time zone NOT NULL,
+    account_id bigint NOT NULL DEFAULT 0,
+    superseded_at timestamp,
+    trade_ids bigint[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+ALTER SEQUENCE positions_id_seq OWNED BY positions.id;
+CREATE TABLE positions_default PARTITION OF positions DEFAULT;
+CREATE INDEX positions_instrument_account_timestamp_idx ON positions (instrument_id, account_id, timestamp DESC, id DESC);
+CREATE INDEX positions_current_idx ON positions (instrument_id, timestamp) WHERE superseded_at IS NULL;
+SELECT ensure_month_partition('positions', month)
+FROM (SELECT DISTINCT date_trunc('month', timestamp) AS month FROM positions_unpartitioned) AS months;
+INSERT INTO positions (id, created_at, instrument_id, size, timestamp, account_id, superseded_at, trade_ids)
+SELECT id, created_at, instrument_id, size, timestamp, account_id, superseded_at, trade_ids FROM positions_unpartitioned;
+DROP TABLE positions_unpartitioned;
+
+-- +migrate Down
+ALTER TABLE positions RENAME TO positions_partitioned;
+ALTER TABLE positions_partitioned RENAME CONSTRAINT positions_pkey TO positions_partitioned_pkey;
+DROP INDEX positions_instrument_account_timestamp_idx;
+DROP INDEX positions_current_idx;
+ALTER SEQUENCE positions_id_seq OWNED BY NONE;
+CREATE TABLE positions (
+    id integer PRIMARY KEY DEFAULT nextval('positions_id_seq'),
+    created_at timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+    instrument_id bigint NOT NULL,
+    size bigint NOT NULL,
+    timestamp timestamp without time zone NOT NULL,
+    account_id bigint NOT NULL DEFAULT 0,
+    superseded_at timestamp,
+    trade_ids bigint[] NOT NULL DEFAULT '{}'
+);
+ALTER SEQUENCE positions_id_seq OWNED BY positions.id;
+INSERT INTO positions (id, created_at, instrument_id, size, timestamp, account_id, superseded_at, trade_ids)
+SELECT id, created_at, instrument_id, size, timestamp, account_id, superseded_at, trade_ids FROM positions_partitioned;
+DROP TABLE positions_partitioned;
+CREATE INDEX positions_instrument_account_timestamp_idx ON positions (instrument_id, account_id, timestamp DESC, id DESC);
+CREATE INDEX positions_current_idx ON positions (instrument_id, timestamp) WHERE superseded_at IS NULL;
+
+ALTER TABLE trades RENAME TO trades_partitioned;
+ALTER TABLE trades_partitioned RENAME CONSTRAINT trades_pkey TO trades_partitioned_pkey;
+DROP INDEX trades_instrument_timestamp_idx;
+ALTER SEQUENCE trades_id_seq OWNED BY NONE;
+CREATE TABLE trades (
+    id integer PRIMARY KEY DEFAULT nextval('trades_id_seq'),
+    created_at timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+    instrument_id bigint NOT NULL,
+    size bigint NOT NULL,
+    price numeric NOT NULL,
+    timestamp timestamp without time zone NOT NULL,
+    account_id bigint NOT NULL DEFAULT 0
+);
+ALTER SEQUENCE trades_id_seq OWNED BY trades.id;
+INSERT INTO trades (id, created_at, instrument_id, size, price, timestamp, account_id)
+SELECT id, created_at, instrument_id, size, price, timestamp, account_id FROM trades_partitioned;
+DROP TABLE trades_partitioned;
+CREATE INDEX trades_instrument_timestamp_idx ON trades (instrument_id, timestamp, id);
+
+DROP FUNCTION IF EXISTS ensure_month_partition(text, timestamp);
@@ -0,0 +1,24 @@
+-- +migrate Up
+CREATE TABLE retention_policies (
+    instrument_id bigint PRIMARY KEY,
+    created_at timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+    retain_seconds bigint NOT NULL CHECK (retain_seconds > 0)
+);
+
+CREATE TABLE archives (
+    id serial PRIMARY KEY,
+    instrument_id bigint NOT NULL,
+    archived_before timestamp NOT NULL,
+    archived_at timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+    trades bigint NOT NULL DEFAULT 0,
+    positions bigint NOT NULL DEFAULT 0,
+    restored_at timestamp
+);
+
+-- seed positions stand in for the archived history of an account, so that positions can be rebuilt from them
+ALTER TABLE positions ADD COLUMN seed boolean NOT NULL DEFAULT false;
+
+-- +migrate Down
+ALTER TABLE positions DROP COLUMN IF EXISTS seed;
+DROP TABLE IF EXISTS archives;
+DROP TABLE IF EXISTS retention_policies;
@@ -0,0 +1,221 @@
+-- +migrate Up
+-- timestamps are stored as timestamptz, to the microsecond, rather than as UTC timestamps truncated by the writers
+-- to the second. The existing values are UTC, so they are converted AT TIME ZONE 'UTC'.
+DROP FUNCTION IF EXISTS ensure_month_partition(text, timestamp);
+-- +migrate StatementBegin
+-- ensure_month_partition creates the partition of the parent table holding the UTC month of the timestamp,
+-- if it does not already exist, and returns its name. Rows written before the partition existed were
+-- routed to the default partition, so they are moved into the new partition before it is attached.
+CREATE FUNCTION ensure_month_partition(parent text, ts timestamptz) RETURNS text
+LANGUAGE plpgsql
+SET search_path = public
+AS $$
+DECLARE
+    month_start timestamptz := date_trunc('month', ts AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+    month_end timestamptz := (date_trunc('month', ts AT TIME ZONE 'UTC') + interval '1 month') AT TIME ZONE 'UTC';
+    partition_name text := parent || '_' || to_char(ts AT TIME ZONE 'UTC', 'YYYY_MM');
+BEGIN
+    -- concurrent writers wait for the first to create the partition, rather than racing it
+    PERFORM pg_advisory_xact_lock(hashtext(partition_name));
+    IF to_regclass(partition_name) IS NOT NULL THEN
+        RETURN partition_name;
+    END IF;
+    EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS)', partition_name, parent);
+    EXECUTE format(
+        'WITH moved AS (DELETE FROM %I WHERE timestamp >= %L AND timestamp < %L RETURNING *) INSERT INTO %I SELECT * FROM moved',
+        parent || '_default', month_start, month_end, partition_name
+    );
+    EXECUTE format(
+        'ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)',
+        parent, partition_name, month_start, month_end
+    );
+    RETURN partition_name;
+END;
+$$;
+-- +migrate StatementEnd
+
+-- the type of a partition key cannot be altered, so the partitioned tables are copied out and recreated,
+-- dropping their month partitions with them so that the new partitions can take their names
+CREATE TABLE trades_timestamp AS SELECT * FROM trades;
+ALTER SEQUENCE trades_id_seq OWNED BY NONE;
+DROP TABLE trades;
+CREATE TABLE trades (
+    id integer NOT NULL DEFAULT nextval('trades_id_seq'),
+    created_at timestamptz NOT NULL DEFAULT now(),
+    instrument_id bigint NOT NULL,
+    size bigint NOT NULL,
+    price numeric NOT NULL,
+    timestamp timestamptz NOT NULL,
+    account_id bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+ALTER SEQUENCE trades_id_seq OWNED BY trades.id;
+CREATE TABLE trades_default PARTITION OF trades DEFAULT;
+CREATE INDEX trades_instrument_timestamp_idx ON trades (instrument_id, timestamp, id);
+SELECT ensure_month_partition('trades', month AT TIME ZONE 'UTC')
+FROM (SELECT DISTINCT date_trunc('month', timestamp) AS month FROM trades_timestamp) AS months;
+INSERT INTO trades (id, created_at, instrument_id, size, price, timestamp, account_id)
+SELECT id, created_at AT TIME ZONE 'UTC', instrument_id, size, price, timestamp AT TIME ZONE 'UTC', account_id
+FROM trades_timestamp;
+DROP TABLE trades_timestamp;
+
+CREATE TABLE positions_timestamp AS SELECT * FROM positions;
+ALTER SEQUENCE positions_id_seq OWNED BY NONE;
+DROP TABLE positions;
+CREATE TABLE positions (
+    id integer NOT NULL DEFAULT nextval('positions_id_seq'),
+    created_at timestamptz NOT NULL DEFAULT now(),
+    instrument_id bigint NOT NULL,
+    size bigint NOT NULL,
+    timestamp timestamptz NOT NULL,
+    account_id bigint NOT NULL DEFAULT 0,
+    superseded_at timestamptz,
+    trade_ids bigint[] NOT NULL DEFAULT '{}',
+    seed boolean NOT NULL DEFAULT false,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+ALTER SEQUENCE positions_id_seq OWNED BY positions.id;
+CREATE TABLE positions_default PARTITION OF positions DEFAULT;
+CREATE INDEX positions_instrument_account_timestamp_idx ON positions (instrument_id, account_id, timestamp DESC, id DESC);
+CREATE INDEX positions_current_idx ON positions (instrument_id, timestamp) WHERE superseded_at IS NULL;
+SELECT ensure_month_partition('positions', month AT TIME ZONE 'UTC')
+FROM (SELECT DISTINCT date_trunc('month', timestamp) AS month FROM positions_timestamp) AS months;
+INSERT INTO positions (id, created_at, instrument_id, size, timestamp, account_id, superseded_at, trade_ids, seed)
+SELECT id, created_at AT TIME ZONE 'UTC', instrument_id, size, timestamp AT TIME ZONE 'UTC', account_id,
+    superseded_at AT TIME ZONE 'UTC', trade_ids, seed
+FROM positions_timestamp;
+DROP TABLE positions_timestamp;
+
+ALTER TABLE bars
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at SET DEFAULT now(),
+    ALTER COLUMN timestamp TYPE timestamptz USING timestamp AT TIME ZONE 'UTC';
+ALTER TABLE instruments
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at SET DEFAULT now(),
+    ALTER COLUMN active_from TYPE timestamptz USING active_from AT TIME ZONE 'UTC',
+    ALTER COLUMN active_to TYPE timestamptz USING active_to AT TIME ZONE 'UTC';
+ALTER TABLE portfolios
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at SET DEFAULT now();
+ALTER TABLE retention_policies
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at SET DEFAULT now();
+ALTER TABLE archives
+    ALTER COLUMN archived_before TYPE timestamptz USING archived_before AT TIME ZONE 'UTC',
+    ALTER COLUMN archived_at DROP DEFAULT,
+    ALTER COLUMN archived_at TYPE timestamptz USING archived_at AT TIME ZONE 'UTC',
+    ALTER COLUMN archived_at SET DEFAULT now(),
+    ALTER COLUMN restored_at TYPE timestamptz USING restored_at AT TIME ZONE 'UTC';
+
+-- +migrate Down
+ALTER TABLE archives
+    ALTER COLUMN archived_before TYPE timestamp USING archived_before AT TIME ZONE 'UTC',
+    ALTER COLUMN archived_at DROP DEFAULT,
+    ALTER COLUMN archived_at TYPE timestamp USING archived_at AT TIME ZONE 'UTC',
+    ALTER COLUMN archived_at SET DEFAULT (now() AT TIME ZONE 'UTC'),
+    ALTER COLUMN restored_at TYPE timestamp USING restored_at AT TIME ZONE 'UTC';
+ALTER TABLE retention_policies
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamp USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at SET DEFAULT (now() AT TIME ZONE 'UTC');
+ALTER TABLE portfolios
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamp USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE instruments
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamp USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at SET DEFAULT CURRENT_TIMESTAMP,
+    ALTER COLUMN active_from TYPE timestamp USING active_from AT TIME ZONE 'UTC',
+    ALTER COLUMN active_to TYPE timestamp USING active_to AT TIME ZONE 'UTC';
+ALTER TABLE bars
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamp USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at SET DEFAULT CURRENT_TIMESTAMP,
+    ALTER COLUMN timestamp TYPE timestamp USING timestamp AT TIME ZONE 'UTC';
+
+DROP FUNCTION IF EXISTS ensure_month_partition(text, timestamptz);
+-- +migrate StatementBegin
+CREATE FUNCTION ensure_month_partition(parent text, ts timestamp) RETURNS text
+LANGUAGE plpgsql
+SET search_path = public
+AS $$
+DECLARE
+    month_start timestamp := date_trunc('month', ts);
+    month_end timestamp := date_trunc('month', ts) + interval '1 month';
+    partition_name text := parent || '_' || to_char(ts, 'YYYY_MM');
+BEGIN
+    -- concurrent writers wait for the first to create the partition, rather than racing it
+    PERFORM pg_advisory_xact_lock(hashtext(partition_name));
+    IF to_regclass(partition_name) IS NOT NULL THEN
+        RETURN partition_name;
+    END IF;
+    EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS)', partition_name, parent);
+    EXECUTE format(
+        'WITH moved AS (DELETE FROM %I WHERE timestamp >= %L AND timestamp < %L RETURNING *) INSERT INTO %I SELECT * FROM moved',
+        parent || '_default', month_start, month_end, partition_name
+    );
+    EXECUTE format(
+        'ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)',
+        parent, partition_name, month_start, month_end
+    );
+    RETURN partition_name;
+END;
+$$;
+-- +migrate StatementEnd
+
+-- timestamps written with sub-second precision keep it, as timestamp is also stored to the microsecond
+CREATE TABLE positions_timestamptz AS SELECT * FROM positions;
+ALTER SEQUENCE positions_id_seq OWNED BY NONE;
+DROP TABLE positions;
+CREATE TABLE positions (
+    id integer NOT NULL DEFAULT nextval('positions_id_seq'),
+    created_at timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+    instrument_id bigint NOT NULL,
+    size bigint NOT NULL,
+    timestamp timestamp without time zone NOT NULL,
+    account_id bigint NOT NULL DEFAULT 0,
+    superseded_at timestamp,
+    trade_ids bigint[] NOT NULL DEFAULT '{}',
+    seed boolean NOT NULL DEFAULT false,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+ALTER SEQUENCE positions_id_seq OWNED BY positions.id;
+CREATE TABLE positions_default PARTITION OF positions DEFAULT;
+CREATE INDEX positions_instrument_account_timestamp_idx ON positions (instrument_id, account_id, timestamp DESC, id DESC);
+CREATE INDEX positions_current_idx ON positions (instrument_id, timestamp) WHERE superseded_at IS NULL;
+SELECT ensure_month_partition('positions', month)
+FROM (SELECT DISTINCT date_trunc('month', timestamp AT TIME ZONE 'UTC') AS month FROM positions_timestamptz) AS months;
+INSERT INTO positions (id, created_at, instrument_id, size, timestamp, account_id, superseded_at, trade_ids, seed)
+SELECT id, created_at AT TIME ZONE 'UTC', instrument_id, size, timestamp AT TIME ZONE 'UTC', account_id,
+    superseded_at AT TIME ZONE 'UTC', trade_ids, seed
+FROM positions_timestamptz;
+DROP TABLE positions_timestamptz;
+
+CREATE TABLE trades_timestamptz AS SELECT * FROM trades;
+ALTER SEQUENCE trades_id_seq OWNED BY NONE;
+DROP TABLE trades;
+CREATE TABLE trades (
+    id integer NOT NULL DEFAULT nextval('trades_id_seq'),
+    created_at timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+    instrument_id bigint NOT NULL,
+    size bigint NOT NULL,
+    price numeric NOT NULL,
+    timestamp timestamp without time zone NOT NULL,
+    account_id bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+ALTER SEQUENCE trades_id_seq OWNED BY trades.id;
+CREATE TABLE trades_default PARTITION OF trades DEFAULT;
+CREATE INDEX trades_instrument_timestamp_idx ON trades (instrument_id, timestamp, id);
+SELECT ensure_month_partition('trades', month)
+FROM (SELECT DISTINCT date_trunc('month', timestamp AT TIME ZONE 'UTC') AS month FROM trades_timestamptz) AS months;
+INSERT INTO trades (id, created_at, instrument_id, size, price, timestamp, account_id)
+SELECT id, created_at AT TIME ZONE 'UTC', instrument_id, size, price, timestamp AT TIME ZONE 'UTC', account_id
+FROM trades_timestamptz;
+DROP TABLE trades_timestamptz;
@@ -0,0 +1,27 @@
+-- +migrate Up
+-- sizes and volumes are stored exactly as numeric, so that fractional quantities such as 0.015 BTC can be traded
+ALTER TABLE trades ALTER COLUMN size TYPE numeric;
+ALTER TABLE positions ALTER COLUMN size TYPE numeric;
+ALTER TABLE bars ALTER COLUMN volume TYPE numeric;
+
+-- quantity_scale is the number of decimal places that trade sizes in the instrument may be given to
+ALTER TABLE instruments ADD COLUMN quantity_scale integer NOT NULL DEFAULT 0
+    CHECK (quantity_scale >= 0 AND quantity_scale <= 18);
+
+-- +migrate Down
+-- +migrate StatementBegin
+-- fractional quantities cannot be stored as bigint, so they must be removed before rolling back
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM trades WHERE size <> trunc(size))
+        OR EXISTS (SELECT 1 FROM positions WHERE size <> trunc(size))
+        OR EXISTS (SELECT 1 FROM bars WHERE volume <> trunc(volume)) THEN
+        RAISE EXCEPTION 'cannot roll back while fractional quantities are stored';
+    END IF;
+END;
+$$;
+-- +migrate StatementEnd
+ALTER TABLE instruments DROP COLUMN IF EXISTS quantity_scale;
+ALTER TABLE bars ALTER COLUMN volume TYPE bigint;
+ALTER TABLE positions ALTER COLUMN size TYPE bigint;
+ALTER TABLE trades ALTER COLUMN size TYPE bigint;
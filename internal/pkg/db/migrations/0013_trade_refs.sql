@@ -0,0 +1,10 @@
+-- +migrate Up
+-- ref identifies a trade in its source, such as a client trade ID, so that a trade ingested again after a
+-- restart is not stored twice. The index includes the timestamp as unique indexes on a partitioned table
+-- must include its partition key, which is the same when a trade is ingested again.
+ALTER TABLE trades ADD COLUMN ref text;
+CREATE UNIQUE INDEX trades_ref_idx ON trades (ref, timestamp);
+
+-- +migrate Down
+DROP INDEX IF EXISTS trades_ref_idx;
+ALTER TABLE trades DROP COLUMN IF EXISTS ref;
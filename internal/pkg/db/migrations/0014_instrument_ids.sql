@@ -0,0 +1,8 @@
+-- +migrate Up
+-- instrument IDs are bigint, as the instrument IDs referring to them are, so that any int64 ID can be given
+ALTER TABLE instruments ALTER COLUMN id TYPE bigint;
+ALTER SEQUENCE instruments_id_seq AS bigint;
+
+-- +migrate Down
+ALTER SEQUENCE instruments_id_seq AS integer;
+ALTER TABLE instruments ALTER COLUMN id TYPE integer;
@@ -0,0 +1,10 @@
+-- +migrate Up
+-- IDs are not unique keys of the partitioned tables, as unique indexes must include the partition key.
+-- They are unique as they are drawn from the sequences, and restored IDs are checked against these indexes,
+-- which also serve lookups by ID such as the keyset cursor of list_trades.
+CREATE INDEX trades_id_idx ON trades (id);
+CREATE INDEX positions_id_idx ON positions (id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS positions_id_idx;
+DROP INDEX IF EXISTS trades_id_idx;
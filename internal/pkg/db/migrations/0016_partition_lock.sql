@@ -0,0 +1,68 @@
+-- +migrate Up
+-- instrument locks are keyed by the instrument ID as a single bigint, so the partition lock moves to the
+-- two-key advisory locks, where it cannot clash with them
+-- +migrate StatementBegin
+-- ensure_month_partition creates the partition of the parent table holding the UTC month of the timestamp,
+-- if it does not already exist, and returns its name. Rows written before the partition existed were
+-- routed to the default partition, so they are moved into the new partition before it is attached.
+CREATE OR REPLACE FUNCTION ensure_month_partition(parent text, ts timestamptz) RETURNS text
+LANGUAGE plpgsql
+SET search_path = public
+AS $$
+DECLARE
+    month_start timestamptz := date_trunc('month', ts AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+    month_end timestamptz := (date_trunc('month', ts AT TIME ZONE 'UTC') + interval '1 month') AT TIME ZONE 'UTC';
+    partition_name text := parent || '_' || to_char(ts AT TIME ZONE 'UTC', 'YYYY_MM');
+BEGIN
+    -- concurrent writers wait for the first to create the partition, rather than racing it. The lock has two keys,
+    -- the first being the ASCII encoding of "part", as single bigint keys are taken by the instrument locks
+    PERFORM pg_advisory_xact_lock(1885434484, hashtext(partition_name));
+    IF to_regclass(partition_name) IS NOT NULL THEN
+        RETURN partition_name;
+    END IF;
+    EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS)', partition_name, parent);
+    EXECUTE format(
+        'WITH moved AS (DELETE FROM %I WHERE timestamp >= %L AND timestamp < %L RETURNING *) INSERT INTO %I SELECT * FROM moved',
+        parent || '_default', month_start, month_end, partition_name
+    );
+    EXECUTE format(
+        'ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)',
+        parent, partition_name, month_start, month_end
+    );
+    RETURN partition_name;
+END;
+$$;
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+-- ensure_month_partition creates the partition of the parent table holding the UTC month of the timestamp,
+-- if it does not already exist, and returns its name. Rows written before the partition existed were
+-- routed to the default partition, so they are moved into the new partition before it is attached.
+CREATE OR REPLACE FUNCTION ensure_month_partition(parent text, ts timestamptz) RETURNS text
+LANGUAGE plpgsql
+SET search_path = public
+AS $$
+DECLARE
+    month_start timestamptz := date_trunc('month', ts AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+    month_end timestamptz := (date_trunc('month', ts AT TIME ZONE 'UTC') + interval '1 month') AT TIME ZONE 'UTC';
+    partition_name text := parent || '_' || to_char(ts AT TIME ZONE 'UTC', 'YYYY_MM');
+BEGIN
+    -- concurrent writers wait for the first to create the partition, rather than racing it
+    PERFORM pg_advisory_xact_lock(hashtext(partition_name));
+    IF to_regclass(partition_name) IS NOT NULL THEN
+        RETURN partition_name;
+    END IF;
+    EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS)', partition_name, parent);
+    EXECUTE format(
+        'WITH moved AS (DELETE FROM %I WHERE timestamp >= %L AND timestamp < %L RETURNING *) INSERT INTO %I SELECT * FROM moved',
+        parent || '_default', month_start, month_end, partition_name
+    );
+    EXECUTE format(
+        'ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)',
+        parent, partition_name, month_start, month_end
+    );
+    RETURN partition_name;
+END;
+$$;
+-- +migrate StatementEnd
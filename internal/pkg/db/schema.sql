@@ -16,10 +16,173 @@ SET xmloption = content;
 SET client_min_messages = warning;
 SET row_security = off;
 
+--
+-- Name: ensure_month_partition(text, timestamp with time zone); Type: FUNCTION; Schema: public; Owner: tradetracker
+--
+
+CREATE FUNCTION public.ensure_month_partition(parent text, ts timestamp with time zone) RETURNS text
+    LANGUAGE plpgsql
+    SET search_path TO 'public'
+    AS $$
+DECLARE
+    month_start timestamptz := date_trunc('month', ts AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+    month_end timestamptz := (date_trunc('month', ts AT TIME ZONE 'UTC') + interval '1 month') AT TIME ZONE 'UTC';
+    partition_name text := parent || '_' || to_char(ts AT TIME ZONE 'UTC', 'YYYY_MM');
+BEGIN
+    -- concurrent writers wait for the first to create the partition, rather than racing it. The lock has two keys,
+    -- the first being the ASCII encoding of "part", as single bigint keys are taken by the instrument locks
+    PERFORM pg_advisory_xact_lock(1885434484, hashtext(partition_name));
+    IF to_regclass(partition_name) IS NOT NULL THEN
+        RETURN partition_name;
+    END IF;
+    EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS)', partition_name, parent);
+    EXECUTE format(
+        'WITH moved AS (DELETE FROM %I WHERE timestamp >= %L AND timestamp < %L RETURNING *) INSERT INTO %I SELECT * FROM moved',
+        parent || '_default', month_start, month_end, partition_name
+    );
+    EXECUTE format(
+        'ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)',
+        parent, partition_name, month_start, month_end
+    );
+    RETURN partition_name;
+END;
+$$;
+
+
+ALTER FUNCTION public.ensure_month_partition(parent text, ts timestamp with time zone) OWNER TO tradetracker;
+
 SET default_tablespace = '';
 
 SET default_table_access_method = heap;
 
+--
+-- Name: archives; Type: TABLE; Schema: public; Owner: tradetracker
+--
+
+CREATE TABLE public.archives (
+    id integer NOT NULL,
+    instrument_id bigint NOT NULL,
+    archived_before timestamp with time zone NOT NULL,
+    archived_at timestamp with time zone DEFAULT now() NOT NULL,
+    trades bigint DEFAULT 0 NOT NULL,
+    positions bigint DEFAULT 0 NOT NULL,
+    restored_at timestamp with time zone
+);
+
+
+ALTER TABLE public.archives OWNER TO tradetracker;
+
+--
+-- Name: archives_id_seq; Type: SEQUENCE; Schema: public; Owner: tradetracker
+--
+
+CREATE SEQUENCE public.archives_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.archives_id_seq OWNER TO tradetracker;
+
+--
+-- Name: archives_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: tradetracker
+--
+
+ALTER SEQUENCE public.archives_id_seq OWNED BY public.archives.id;
+
+
+--
+-- Name: bars; Type: TABLE; Schema: public; Owner: tradetracker
+--
+
+CREATE TABLE public.bars (
+    id integer NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    instrument_id bigint NOT NULL,
+    interval_seconds bigint NOT NULL,
+    open numeric NOT NULL,
+    high numeric NOT NULL,
+    low numeric NOT NULL,
+    close numeric NOT NULL,
+    volume numeric NOT NULL,
+    vwap numeric NOT NULL,
+    trade_count bigint NOT NULL,
+    "timestamp" timestamp with time zone NOT NULL
+);
+
+
+ALTER TABLE public.bars OWNER TO tradetracker;
+
+--
+-- Name: bars_id_seq; Type: SEQUENCE; Schema: public; Owner: tradetracker
+--
+
+CREATE SEQUENCE public.bars_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.bars_id_seq OWNER TO tradetracker;
+
+--
+-- Name: bars_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: tradetracker
+--
+
+ALTER SEQUENCE public.bars_id_seq OWNED BY public.bars.id;
+
+
+--
+-- Name: instruments; Type: TABLE; Schema: public; Owner: tradetracker
+--
+
+CREATE TABLE public.instruments (
+    id bigint NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    symbol text NOT NULL,
+    isin text,
+    cusip text,
+    asset_class text NOT NULL,
+    currency character(3) NOT NULL,
+    lot_size bigint DEFAULT 1 NOT NULL,
+    tick_size numeric DEFAULT 0.01 NOT NULL,
+    multiplier numeric DEFAULT 1 NOT NULL,
+    quantity_scale integer DEFAULT 0 NOT NULL,
+    active_from timestamp with time zone,
+    active_to timestamp with time zone,
+    CONSTRAINT instruments_quantity_scale_check CHECK (((quantity_scale >= 0) AND (quantity_scale <= 18)))
+);
+
+
+ALTER TABLE public.instruments OWNER TO tradetracker;
+
+--
+-- Name: instruments_id_seq; Type: SEQUENCE; Schema: public; Owner: tradetracker
+--
+
+CREATE SEQUENCE public.instruments_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.instruments_id_seq OWNER TO tradetracker;
+
+--
+-- Name: instruments_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: tradetracker
+--
+
+ALTER SEQUENCE public.instruments_id_seq OWNED BY public.instruments.id;
+
+
 --
 -- Name: migrations; Type: TABLE; Schema: public; Owner: tradetracker
 --
@@ -32,21 +195,83 @@ CREATE TABLE public.migrations (
 
 ALTER TABLE public.migrations OWNER TO tradetracker;
 
+--
+-- Name: portfolio_accounts; Type: TABLE; Schema: public; Owner: tradetracker
+--
+
+CREATE TABLE public.portfolio_accounts (
+    portfolio_id integer NOT NULL,
+    account_id bigint NOT NULL
+);
+
+
+ALTER TABLE public.portfolio_accounts OWNER TO tradetracker;
+
+--
+-- Name: portfolios; Type: TABLE; Schema: public; Owner: tradetracker
+--
+
+CREATE TABLE public.portfolios (
+    id integer NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    name text NOT NULL,
+    parent_id integer
+);
+
+
+ALTER TABLE public.portfolios OWNER TO tradetracker;
+
+--
+-- Name: portfolios_id_seq; Type: SEQUENCE; Schema: public; Owner: tradetracker
+--
+
+CREATE SEQUENCE public.portfolios_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.portfolios_id_seq OWNER TO tradetracker;
+
+--
+-- Name: portfolios_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: tradetracker
+--
+
+ALTER SEQUENCE public.portfolios_id_seq OWNED BY public.portfolios.id;
+
+
 --
 -- Name: positions; Type: TABLE; Schema: public; Owner: tradetracker
 --
 
 CREATE TABLE public.positions (
     id integer NOT NULL,
-    created_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
     instrument_id bigint NOT NULL,
-    size bigint NOT NULL,
-    "timestamp" timestamp without time zone NOT NULL
-);
+    size numeric NOT NULL,
+    "timestamp" timestamp with time zone NOT NULL,
+    account_id bigint DEFAULT 0 NOT NULL,
+    superseded_at timestamp with time zone,
+    trade_ids bigint[] DEFAULT '{}'::bigint[] NOT NULL,
+    seed boolean DEFAULT false NOT NULL
+)
+PARTITION BY RANGE ("timestamp");
 
 
 ALTER TABLE public.positions OWNER TO tradetracker;
 
+--
+-- Name: positions_default; Type: TABLE; Schema: public; Owner: tradetracker
+--
+
+CREATE TABLE public.positions_default PARTITION OF public.positions DEFAULT;
+
+
+ALTER TABLE public.positions_default OWNER TO tradetracker;
+
 --
 -- Name: positions_id_seq; Type: SEQUENCE; Schema: public; Owner: tradetracker
 --
@@ -69,22 +294,48 @@ ALTER TABLE public.positions_id_seq OWNER TO tradetracker;
 ALTER SEQUENCE public.positions_id_seq OWNED BY public.positions.id;
 
 
+--
+-- Name: retention_policies; Type: TABLE; Schema: public; Owner: tradetracker
+--
+
+CREATE TABLE public.retention_policies (
+    instrument_id bigint NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    retain_seconds bigint NOT NULL,
+    CONSTRAINT retention_policies_retain_seconds_check CHECK ((retain_seconds > 0))
+);
+
+
+ALTER TABLE public.retention_policies OWNER TO tradetracker;
+
 --
 -- Name: trades; Type: TABLE; Schema: public; Owner: tradetracker
 --
 
 CREATE TABLE public.trades (
     id integer NOT NULL,
-    created_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
     instrument_id bigint NOT NULL,
-    size bigint NOT NULL,
+    size numeric NOT NULL,
     price numeric NOT NULL,
-    "timestamp" timestamp without time zone NOT NULL
-);
+    "timestamp" timestamp with time zone NOT NULL,
+    account_id bigint DEFAULT 0 NOT NULL,
+    ref text
+)
+PARTITION BY RANGE ("timestamp");
 
 
 ALTER TABLE public.trades OWNER TO tradetracker;
 
+--
+-- Name: trades_default; Type: TABLE; Schema: public; Owner: tradetracker
+--
+
+CREATE TABLE public.trades_default PARTITION OF public.trades DEFAULT;
+
+
+ALTER TABLE public.trades_default OWNER TO tradetracker;
+
 --
 -- Name: trades_id_seq; Type: SEQUENCE; Schema: public; Owner: tradetracker
 --
@@ -107,6 +358,34 @@ ALTER TABLE public.trades_id_seq OWNER TO tradetracker;
 ALTER SEQUENCE public.trades_id_seq OWNED BY public.trades.id;
 
 
+--
+-- Name: archives id; Type: DEFAULT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.archives ALTER COLUMN id SET DEFAULT nextval('public.archives_id_seq'::regclass);
+
+
+--
+-- Name: bars id; Type: DEFAULT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.bars ALTER COLUMN id SET DEFAULT nextval('public.bars_id_seq'::regclass);
+
+
+--
+-- Name: instruments id; Type: DEFAULT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.instruments ALTER COLUMN id SET DEFAULT nextval('public.instruments_id_seq'::regclass);
+
+
+--
+-- Name: portfolios id; Type: DEFAULT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.portfolios ALTER COLUMN id SET DEFAULT nextval('public.portfolios_id_seq'::regclass);
+
+
 --
 -- Name: positions id; Type: DEFAULT; Schema: public; Owner: tradetracker
 --
@@ -121,6 +400,54 @@ ALTER TABLE ONLY public.positions ALTER COLUMN id SET DEFAULT nextval('public.po
 ALTER TABLE ONLY public.trades ALTER COLUMN id SET DEFAULT nextval('public.trades_id_seq'::regclass);
 
 
+--
+-- Name: archives archives_pkey; Type: CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.archives
+    ADD CONSTRAINT archives_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: bars bars_pkey; Type: CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.bars
+    ADD CONSTRAINT bars_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: instruments instruments_cusip_key; Type: CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.instruments
+    ADD CONSTRAINT instruments_cusip_key UNIQUE (cusip);
+
+
+--
+-- Name: instruments instruments_isin_key; Type: CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.instruments
+    ADD CONSTRAINT instruments_isin_key UNIQUE (isin);
+
+
+--
+-- Name: instruments instruments_pkey; Type: CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.instruments
+    ADD CONSTRAINT instruments_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: instruments instruments_symbol_key; Type: CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.instruments
+    ADD CONSTRAINT instruments_symbol_key UNIQUE (symbol);
+
+
 --
 -- Name: migrations migrations_pkey; Type: CONSTRAINT; Schema: public; Owner: tradetracker
 --
@@ -129,20 +456,110 @@ ALTER TABLE ONLY public.migrations
     ADD CONSTRAINT migrations_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: portfolio_accounts portfolio_accounts_pkey; Type: CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.portfolio_accounts
+    ADD CONSTRAINT portfolio_accounts_pkey PRIMARY KEY (portfolio_id, account_id);
+
+
+--
+-- Name: portfolios portfolios_name_key; Type: CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.portfolios
+    ADD CONSTRAINT portfolios_name_key UNIQUE (name);
+
+
+--
+-- Name: portfolios portfolios_pkey; Type: CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.portfolios
+    ADD CONSTRAINT portfolios_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: positions positions_pkey; Type: CONSTRAINT; Schema: public; Owner: tradetracker
 --
 
-ALTER TABLE ONLY public.positions
-    ADD CONSTRAINT positions_pkey PRIMARY KEY (id);
+ALTER TABLE public.positions
+    ADD CONSTRAINT positions_pkey PRIMARY KEY (id, "timestamp");
+
+
+--
+-- Name: retention_policies retention_policies_pkey; Type: CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.retention_policies
+    ADD CONSTRAINT retention_policies_pkey PRIMARY KEY (instrument_id);
 
 
 --
 -- Name: trades trades_pkey; Type: CONSTRAINT; Schema: public; Owner: tradetracker
 --
 
-ALTER TABLE ONLY public.trades
-    ADD CONSTRAINT trades_pkey PRIMARY KEY (id);
+ALTER TABLE public.trades
+    ADD CONSTRAINT trades_pkey PRIMARY KEY (id, "timestamp");
+
+
+--
+-- Name: positions_current_idx; Type: INDEX; Schema: public; Owner: tradetracker
+--
+
+CREATE INDEX positions_current_idx ON public.positions USING btree (instrument_id, "timestamp") WHERE (superseded_at IS NULL);
+
+
+--
+-- Name: positions_id_idx; Type: INDEX; Schema: public; Owner: tradetracker
+--
+
+CREATE INDEX positions_id_idx ON public.positions USING btree (id);
+
+
+--
+-- Name: positions_instrument_account_timestamp_idx; Type: INDEX; Schema: public; Owner: tradetracker
+--
+
+CREATE INDEX positions_instrument_account_timestamp_idx ON public.positions USING btree (instrument_id, account_id, "timestamp" DESC, id DESC);
+
+
+--
+-- Name: trades_id_idx; Type: INDEX; Schema: public; Owner: tradetracker
+--
+
+CREATE INDEX trades_id_idx ON public.trades USING btree (id);
+
+
+--
+-- Name: trades_instrument_timestamp_idx; Type: INDEX; Schema: public; Owner: tradetracker
+--
+
+CREATE INDEX trades_instrument_timestamp_idx ON public.trades USING btree (instrument_id, "timestamp", id);
+
+
+--
+-- Name: trades_ref_idx; Type: INDEX; Schema: public; Owner: tradetracker
+--
+
+CREATE UNIQUE INDEX trades_ref_idx ON public.trades USING btree (ref, "timestamp");
+
+
+--
+-- Name: portfolio_accounts portfolio_accounts_portfolio_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.portfolio_accounts
+    ADD CONSTRAINT portfolio_accounts_portfolio_id_fkey FOREIGN KEY (portfolio_id) REFERENCES public.portfolios(id) ON DELETE CASCADE;
+
+
+--
+-- Name: portfolios portfolios_parent_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: tradetracker
+--
+
+ALTER TABLE ONLY public.portfolios
+    ADD CONSTRAINT portfolios_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES public.portfolios(id);
 
 
 --
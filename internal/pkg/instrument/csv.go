@@ -0,0 +1,142 @@
+package instrument
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"tradetracker/internal/pkg/timeexpr"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// CSV column names. Only symbol, asset_class and currency are required;
+// the remaining columns may be omitted from the header or left empty to use their defaults.
+const (
+	colID         = "id"
+	colSymbol     = "symbol"
+	colISIN       = "isin"
+	colCUSIP      = "cusip"
+	colAssetClass = "asset_class"
+	colCurrency   = "currency"
+	colLotSize    = "lot_size"
+	colTickSize   = "tick_size"
+	colMultiplier = "multiplier"
+	colQtyScale   = "quantity_scale"
+	colActiveFrom = "active_from"
+	colActiveTo   = "active_to"
+)
+
+// Defaults for optional instrument fields.
+const DefaultLotSize int64 = 1
+
+// Defaults for optional instrument fields which are decimals, and so cannot be constants.
+var (
+	DefaultTickSize   = decimal.New(1, 2)
+	DefaultMultiplier = decimal.NewFromInt(1)
+)
+
+// ReadCSV reads and validates instrument reference data from CSV with a header row.
+// Active dates may be given either as RFC3339 timestamps or as dates.
+func ReadCSV(r io.Reader) ([]*models.Instrument, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "read header failed")
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{colSymbol, colAssetClass, colCurrency} {
+		if _, ok := cols[required]; !ok {
+			return nil, errors.Wrapf(ErrInvalidInstrument, "missing %s column", required)
+		}
+	}
+	var instruments []*models.Instrument
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "read line %d failed", line)
+		}
+		get := func(col string) string {
+			if i, ok := cols[col]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		instrument, err := parseRecord(get)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse line %d failed", line)
+		}
+		if err := Validate(instrument); err != nil {
+			return nil, errors.Wrapf(err, "validate line %d failed", line)
+		}
+		instruments = append(instruments, instrument)
+	}
+	return instruments, nil
+}
+
+func parseRecord(get func(string) string) (*models.Instrument, error) {
+	instrument := &models.Instrument{
+		Symbol:     get(colSymbol),
+		ISIN:       get(colISIN),
+		CUSIP:      get(colCUSIP),
+		AssetClass: get(colAssetClass),
+		Currency:   strings.ToUpper(get(colCurrency)),
+		LotSize:    DefaultLotSize,
+		TickSize:   DefaultTickSize,
+		Multiplier: DefaultMultiplier,
+	}
+	var err error
+	if s := get(colID); s != "" {
+		if instrument.ID, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, errors.Wrap(err, "parse id failed")
+		}
+	}
+	if s := get(colLotSize); s != "" {
+		if instrument.LotSize, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, errors.Wrap(err, "parse lot size failed")
+		}
+	}
+	if s := get(colTickSize); s != "" {
+		if instrument.TickSize, err = decimal.Parse(s); err != nil {
+			return nil, errors.Wrap(err, "parse tick size failed")
+		}
+	}
+	if s := get(colMultiplier); s != "" {
+		if instrument.Multiplier, err = decimal.Parse(s); err != nil {
+			return nil, errors.Wrap(err, "parse multiplier failed")
+		}
+	}
+	if s := get(colQtyScale); s != "" {
+		scale, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse quantity scale failed")
+		}
+		instrument.QuantityScale = int32(scale)
+	}
+	if instrument.ActiveFrom, err = ParseDate(get(colActiveFrom)); err != nil {
+		return nil, errors.Wrap(err, "parse active from failed")
+	}
+	if instrument.ActiveTo, err = ParseDate(get(colActiveTo)); err != nil {
+		return nil, errors.Wrap(err, "parse active to failed")
+	}
+	return instrument, nil
+}
+
+// ParseDate parses a date, timestamp or other time expression. An empty string is the zero time.
+func ParseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := timeexpr.Parse(s)
+	return t, errors.Wrap(err, "parse date failed")
+}
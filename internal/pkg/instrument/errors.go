@@ -0,0 +1,18 @@
+package instrument
+
+import "github.com/pkg/errors"
+
+// ErrUnknownInstrument indicates that there is no reference data for an instrument.
+var ErrUnknownInstrument error = errors.New("unknown instrument")
+
+// ErrInactiveInstrument indicates that an instrument is not active at a given time.
+var ErrInactiveInstrument error = errors.New("inactive instrument")
+
+// ErrInvalidInstrument indicates that instrument reference data is invalid.
+var ErrInvalidInstrument error = errors.New("invalid instrument")
+
+// ErrAmbiguousInstrument indicates that an instrument reference matches more than one instrument.
+var ErrAmbiguousInstrument error = errors.New("ambiguous instrument")
+
+// ErrInvalidQuantity indicates that a trade size has more decimal places than its instrument allows.
+var ErrInvalidQuantity error = errors.New("invalid quantity")
@@ -0,0 +1,190 @@
+// Package instrument implements functionality for interacting with instrument reference data.
+package instrument
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+var currencyRegexp = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// MaxQuantityScale is the largest number of decimal places that trade sizes may be given to.
+const MaxQuantityScale int32 = 18
+
+// Validate returns an error wrapping ErrInvalidInstrument if the instrument reference data is invalid.
+func Validate(instrument *models.Instrument) error {
+	switch {
+	case instrument.Symbol == "":
+		return errors.Wrap(ErrInvalidInstrument, "symbol is required")
+	case instrument.AssetClass == "":
+		return errors.Wrap(ErrInvalidInstrument, "asset class is required")
+	case !currencyRegexp.MatchString(instrument.Currency):
+		return errors.Wrapf(ErrInvalidInstrument, "currency %q is not an ISO 4217 code", instrument.Currency)
+	case instrument.LotSize <= 0:
+		return errors.Wrap(ErrInvalidInstrument, "lot size must be positive")
+	case instrument.TickSize.Sign() <= 0:
+		return errors.Wrap(ErrInvalidInstrument, "tick size must be positive")
+	case instrument.Multiplier.Sign() <= 0:
+		return errors.Wrap(ErrInvalidInstrument, "multiplier must be positive")
+	case instrument.QuantityScale < 0 || instrument.QuantityScale > MaxQuantityScale:
+		return errors.Wrapf(ErrInvalidInstrument, "quantity scale must be between 0 and %d", MaxQuantityScale)
+	case !instrument.ActiveFrom.IsZero() && !instrument.ActiveTo.IsZero() && !instrument.ActiveTo.After(instrument.ActiveFrom):
+		return errors.Wrap(ErrInvalidInstrument, "active to must be after active from")
+	}
+	return nil
+}
+
+// Active reports whether the instrument is active at the given time.
+// An instrument is active from its active from time up to and including its active to time.
+func Active(instrument *models.Instrument, at time.Time) bool {
+	if !instrument.ActiveFrom.IsZero() && at.Before(instrument.ActiveFrom) {
+		return false
+	}
+	if !instrument.ActiveTo.IsZero() && at.After(instrument.ActiveTo) {
+		return false
+	}
+	return true
+}
+
+// Registry looks up instrument reference data, caching it to avoid repeated reads from the repo.
+type Registry struct {
+	repo  repo.InstrumentRepo
+	mu    sync.Mutex
+	cache map[int64]*models.Instrument
+}
+
+// NewRegistry creates a new Registry.
+func NewRegistry(r repo.InstrumentRepo) *Registry {
+	return &Registry{
+		repo:  r,
+		cache: make(map[int64]*models.Instrument),
+	}
+}
+
+// Lookup returns the instrument with the given ID, or an error wrapping ErrUnknownInstrument if there is none.
+func (r *Registry) Lookup(ctx context.Context, instrumentID int64) (*models.Instrument, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if instrument, ok := r.cache[instrumentID]; ok {
+		return instrument, nil
+	}
+	// unknown instruments are not cached, as they may be created later
+	instrument, err := r.repo.ReadInstrument(ctx, instrumentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Wrapf(ErrUnknownInstrument, "instrument %d", instrumentID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read instrument failed")
+	}
+	r.cache[instrumentID] = instrument
+	return instrument, nil
+}
+
+// Reset clears the cached reference data, so that it is read from the repo again.
+func (r *Registry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = make(map[int64]*models.Instrument)
+}
+
+// Check returns an error if the instrument is unknown or is not active at the given time.
+func (r *Registry) Check(ctx context.Context, instrumentID int64, at time.Time) error {
+	instrument, err := r.Lookup(ctx, instrumentID)
+	if err != nil {
+		return err
+	}
+	if !Active(instrument, at) {
+		return errors.Wrapf(ErrInactiveInstrument, "instrument %d (%s) at %s", instrumentID, instrument.Symbol, at.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CheckTrade returns an error if the instrument of the trade is unknown or is not active at the time of the trade,
+// or an error wrapping ErrInvalidQuantity if the size of the trade has more decimal places than the quantity
+// scale of the instrument.
+func (r *Registry) CheckTrade(ctx context.Context, trade *models.Trade) error {
+	if err := r.Check(ctx, trade.InstrumentID, trade.Timestamp); err != nil {
+		return err
+	}
+	instrument, err := r.Lookup(ctx, trade.InstrumentID)
+	if err != nil {
+		return err
+	}
+	if !trade.Size.Round(instrument.QuantityScale).Equal(trade.Size) {
+		return errors.Wrapf(
+			ErrInvalidQuantity, "size %s of instrument %d (%s) exceeds quantity scale %d",
+			trade.Size, trade.InstrumentID, instrument.Symbol, instrument.QuantityScale,
+		)
+	}
+	return nil
+}
+
+// Resolve returns the instrument identified by the reference, which may be an instrument ID,
+// a symbol or an ISIN. It returns an error wrapping ErrAmbiguousInstrument if the reference
+// matches more than one instrument, or ErrUnknownInstrument if it matches none.
+// A numeric reference which matches no instrument resolves to an instrument with just that ID,
+// so that trades and positions recorded without reference data can still be addressed.
+func (r *Registry) Resolve(ctx context.Context, ref string) (*models.Instrument, error) {
+	instruments, err := r.repo.ResolveInstruments(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve instruments failed")
+	}
+	switch len(instruments) {
+	case 0:
+		if instrumentID, err := strconv.ParseInt(ref, 10, 64); err == nil {
+			return &models.Instrument{ID: instrumentID}, nil
+		}
+		return nil, errors.Wrapf(ErrUnknownInstrument, "%q", ref)
+	case 1:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.cache[instruments[0].ID] = instruments[0]
+		return instruments[0], nil
+	default:
+		matches := make([]string, len(instruments))
+		for i, instrument := range instruments {
+			matches[i] = Label(instrument)
+		}
+		return nil, errors.Wrapf(ErrAmbiguousInstrument, "%q matches %s", ref, strings.Join(matches, ", "))
+	}
+}
+
+// ResolveAll resolves each of the references to an instrument.
+func (r *Registry) ResolveAll(ctx context.Context, refs []string) ([]*models.Instrument, error) {
+	instruments := make([]*models.Instrument, len(refs))
+	for i, ref := range refs {
+		instrument, err := r.Resolve(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		instruments[i] = instrument
+	}
+	return instruments, nil
+}
+
+// Symbol returns the symbol of the instrument with the given ID, or an empty string if it is unknown.
+func (r *Registry) Symbol(ctx context.Context, instrumentID int64) string {
+	instrument, err := r.Lookup(ctx, instrumentID)
+	if err != nil {
+		return ""
+	}
+	return instrument.Symbol
+}
+
+// Label returns a human readable label for the instrument including its ID and symbol.
+func Label(instrument *models.Instrument) string {
+	if instrument.Symbol == "" {
+		return strconv.FormatInt(instrument.ID, 10)
+	}
+	return fmt.Sprintf("%d (%s)", instrument.ID, instrument.Symbol)
+}
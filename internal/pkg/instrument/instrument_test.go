@@ -0,0 +1,143 @@
+package instrument
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestActive(t *testing.T) {
+	instrument := &models.Instrument{
+		ActiveFrom: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		ActiveTo:   time.Date(2022, 12, 31, 0, 0, 0, 0, time.UTC),
+	}
+	require.False(t, Active(instrument, time.Date(2021, 12, 31, 23, 59, 59, 0, time.UTC)))
+	require.True(t, Active(instrument, instrument.ActiveFrom))
+	require.True(t, Active(instrument, time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)))
+	require.True(t, Active(instrument, instrument.ActiveTo))
+	require.False(t, Active(instrument, time.Date(2022, 12, 31, 0, 0, 1, 0, time.UTC)))
+	require.True(t, Active(&models.Instrument{}, time.Time{}))
+}
+
+func TestReadCSV(t *testing.T) {
+	instruments, err := ReadCSV(strings.NewReader(
+		"id,symbol,isin,asset_class,currency,lot_size,tick_size,quantity_scale,active_from\n" +
+			"123,ACME,US0000000001,equity,usd,100,0.05,,2022-01-01\n" +
+			",BTCUSD,,crypto,USD,,,8,\n",
+	))
+	require.NoError(t, err)
+	require.Len(t, instruments, 2)
+	require.Equal(t, &models.Instrument{
+		ID:         123,
+		Symbol:     "ACME",
+		ISIN:       "US0000000001",
+		AssetClass: "equity",
+		Currency:   "USD",
+		LotSize:    100,
+		TickSize:   decimal.MustParse("0.05"),
+		Multiplier: DefaultMultiplier,
+		ActiveFrom: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, instruments[0])
+	require.Equal(t, int64(0), instruments[1].ID)
+	require.Equal(t, DefaultLotSize, instruments[1].LotSize)
+	require.Equal(t, DefaultTickSize, instruments[1].TickSize)
+	require.Equal(t, int32(8), instruments[1].QuantityScale)
+}
+
+func TestReadCSVInvalid(t *testing.T) {
+	_, err := ReadCSV(strings.NewReader("symbol,currency\nACME,USD\n"))
+	require.ErrorIs(t, err, ErrInvalidInstrument)
+	_, err = ReadCSV(strings.NewReader("symbol,asset_class,currency\nACME,equity,dollars\n"))
+	require.ErrorIs(t, err, ErrInvalidInstrument)
+	_, err = ReadCSV(strings.NewReader("symbol,asset_class,currency,quantity_scale\nBTCUSD,crypto,USD,19\n"))
+	require.ErrorIs(t, err, ErrInvalidInstrument)
+}
+
+type resolveRepo struct {
+	repo.InstrumentRepo
+	instruments []*models.Instrument
+}
+
+func (r *resolveRepo) ResolveInstruments(ctx context.Context, ref string) ([]*models.Instrument, error) {
+	var matches []*models.Instrument
+	for _, instrument := range r.instruments {
+		if strings.EqualFold(instrument.Symbol, ref) || instrument.ISIN == strings.ToUpper(ref) {
+			matches = append(matches, instrument)
+		}
+	}
+	return matches, nil
+}
+
+func (r *resolveRepo) ReadInstrument(ctx context.Context, instrumentID int64) (*models.Instrument, error) {
+	for _, instrument := range r.instruments {
+		if instrument.ID == instrumentID {
+			return instrument, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	registry := NewRegistry(&resolveRepo{instruments: []*models.Instrument{
+		{ID: 1, Symbol: "ACME", ISIN: "US0000000001"},
+		{ID: 2, Symbol: "US0000000001"},
+	}})
+	instrument, err := registry.Resolve(ctx, "acme")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), instrument.ID)
+	require.Equal(t, "ACME", registry.Symbol(ctx, 1))
+
+	instrument, err = registry.Resolve(ctx, "123")
+	require.NoError(t, err)
+	require.Equal(t, int64(123), instrument.ID)
+
+	_, err = registry.Resolve(ctx, "NOPE")
+	require.True(t, errors.Is(err, ErrUnknownInstrument))
+
+	_, err = registry.Resolve(ctx, "US0000000001")
+	require.True(t, errors.Is(err, ErrAmbiguousInstrument))
+}
+
+func TestRegistryReset(t *testing.T) {
+	ctx := context.Background()
+	r := &resolveRepo{}
+	registry := NewRegistry(r)
+	_, err := registry.Lookup(ctx, 1)
+	require.ErrorIs(t, err, ErrUnknownInstrument)
+
+	// an instrument created after a miss is found, and its reference data is cached until reset
+	r.instruments = []*models.Instrument{{ID: 1, Symbol: "ACME"}}
+	require.Equal(t, "ACME", registry.Symbol(ctx, 1))
+	r.instruments = []*models.Instrument{{ID: 1, Symbol: "ACME2"}}
+	require.Equal(t, "ACME", registry.Symbol(ctx, 1))
+	registry.Reset()
+	require.Equal(t, "ACME2", registry.Symbol(ctx, 1))
+}
+
+func TestCheckTrade(t *testing.T) {
+	ctx := context.Background()
+	registry := NewRegistry(&resolveRepo{instruments: []*models.Instrument{
+		{ID: 1, Symbol: "ACME"},
+		{ID: 2, Symbol: "BTCUSD", QuantityScale: 8},
+	}})
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, registry.CheckTrade(ctx, &models.Trade{InstrumentID: 1, Size: decimal.MustParse("-100.00"), Timestamp: ts}))
+	require.NoError(t, registry.CheckTrade(ctx, &models.Trade{InstrumentID: 2, Size: decimal.MustParse("0.00012345"), Timestamp: ts}))
+
+	err := registry.CheckTrade(ctx, &models.Trade{InstrumentID: 1, Size: decimal.MustParse("0.5"), Timestamp: ts})
+	require.ErrorIs(t, err, ErrInvalidQuantity)
+	err = registry.CheckTrade(ctx, &models.Trade{InstrumentID: 2, Size: decimal.MustParse("0.000000001"), Timestamp: ts})
+	require.ErrorIs(t, err, ErrInvalidQuantity)
+	err = registry.CheckTrade(ctx, &models.Trade{InstrumentID: 3, Size: decimal.NewFromInt(1), Timestamp: ts})
+	require.ErrorIs(t, err, ErrUnknownInstrument)
+}
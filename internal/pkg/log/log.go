@@ -8,13 +8,12 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// SetLogger sets the default logger's level.
+// SetLogger sets the default logger's level. It may be called again to change the level while logging.
 func SetLogger(level string) {
-	logrus.SetLevel(logrus.ErrorLevel)
 	customFormatter := new(logrus.TextFormatter)
 	customFormatter.TimestampFormat = time.RFC3339
-	logrus.SetFormatter(customFormatter)
 	customFormatter.FullTimestamp = true
+	logrus.SetFormatter(customFormatter)
 	switch strings.ToLower(level) {
 	case "trace":
 		logrus.SetLevel(logrus.TraceLevel)
@@ -24,8 +23,6 @@ func SetLogger(level string) {
 		logrus.SetLevel(logrus.InfoLevel)
 	case "warn":
 		logrus.SetLevel(logrus.WarnLevel)
-	case "error":
-		logrus.SetLevel(logrus.ErrorLevel)
 	default:
 		logrus.SetLevel(logrus.ErrorLevel)
 	}
@@ -0,0 +1,9 @@
+package output
+
+import "github.com/pkg/errors"
+
+// ErrUnknownFormat indicates that an output format is not supported.
+var ErrUnknownFormat error = errors.New("unknown format")
+
+// ErrColumnMismatch indicates that a row does not have a value for each column.
+var ErrColumnMismatch error = errors.New("column mismatch")
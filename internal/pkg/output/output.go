@@ -0,0 +1,171 @@
+// Package output writes the rows returned by queries as a table, JSON lines or CSV.
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Format is an output format.
+type Format string
+
+// These are the supported output formats.
+const (
+	Table Format = "table"
+	JSON  Format = "json"
+	CSV   Format = "csv"
+)
+
+// Formats lists the supported output formats.
+var Formats = []Format{Table, JSON, CSV}
+
+// ParseFormat parses the name of an output format.
+func ParseFormat(name string) (Format, error) {
+	for _, format := range Formats {
+		if strings.EqualFold(name, string(format)) {
+			return format, nil
+		}
+	}
+	return "", errors.Wrapf(ErrUnknownFormat, "%q", name)
+}
+
+// Writer writes rows of values, one for each of its columns.
+type Writer interface {
+	Write(values ...interface{}) error
+	Flush() error
+}
+
+// NewWriter creates a Writer for the given format and columns, writing any header immediately.
+func NewWriter(w io.Writer, format Format, columns ...string) (Writer, error) {
+	switch format {
+	case Table:
+		tw := &tableWriter{
+			columns: columns,
+			w:       tabwriter.NewWriter(w, 0, 0, 2, ' ', 0),
+		}
+		header := make([]string, len(columns))
+		for i, column := range columns {
+			header[i] = strings.ToUpper(column)
+		}
+		if err := tw.writeRow(header); err != nil {
+			return nil, errors.Wrap(err, "write header failed")
+		}
+		return tw, nil
+	case JSON:
+		return &jsonWriter{columns: columns, w: w}, nil
+	case CSV:
+		cw := &csvWriter{columns: columns, w: csv.NewWriter(w)}
+		if err := cw.w.Write(columns); err != nil {
+			return nil, errors.Wrap(err, "write header failed")
+		}
+		return cw, nil
+	default:
+		return nil, errors.Wrapf(ErrUnknownFormat, "%q", format)
+	}
+}
+
+type tableWriter struct {
+	columns []string
+	w       *tabwriter.Writer
+}
+
+func (tw *tableWriter) Write(values ...interface{}) error {
+	if len(values) != len(tw.columns) {
+		return errors.Wrapf(ErrColumnMismatch, "got %d values for %d columns", len(values), len(tw.columns))
+	}
+	return tw.writeRow(formatValues(values))
+}
+
+func (tw *tableWriter) writeRow(fields []string) error {
+	if _, err := fmt.Fprintln(tw.w, strings.Join(fields, "\t")); err != nil {
+		return errors.Wrap(err, "write row failed")
+	}
+	return nil
+}
+
+func (tw *tableWriter) Flush() error {
+	return errors.Wrap(tw.w.Flush(), "flush failed")
+}
+
+type jsonWriter struct {
+	columns []string
+	w       io.Writer
+}
+
+// Write writes the values as a JSON object on its own line, keeping the keys in column order.
+func (jw *jsonWriter) Write(values ...interface{}) error {
+	if len(values) != len(jw.columns) {
+		return errors.Wrapf(ErrColumnMismatch, "got %d values for %d columns", len(values), len(jw.columns))
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range jw.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return errors.Wrap(err, "marshal key failed")
+		}
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return errors.Wrapf(err, "marshal %s failed", column)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	if _, err := jw.w.Write(buf.Bytes()); err != nil {
+		return errors.Wrap(err, "write row failed")
+	}
+	return nil
+}
+
+func (jw *jsonWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	columns []string
+	w       *csv.Writer
+}
+
+func (cw *csvWriter) Write(values ...interface{}) error {
+	if len(values) != len(cw.columns) {
+		return errors.Wrapf(ErrColumnMismatch, "got %d values for %d columns", len(values), len(cw.columns))
+	}
+	return errors.Wrap(cw.w.Write(formatValues(values)), "write row failed")
+}
+
+func (cw *csvWriter) Flush() error {
+	cw.w.Flush()
+	return errors.Wrap(cw.w.Error(), "flush failed")
+}
+
+// formatValues formats values as text for the table and CSV formats.
+func formatValues(values []interface{}) []string {
+	fields := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+			fields[i] = ""
+		case time.Time:
+			fields[i] = v.Format(time.RFC3339Nano)
+		case float64:
+			fields[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			fields[i] = fmt.Sprint(v)
+		}
+	}
+	return fields
+}
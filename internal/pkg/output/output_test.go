@@ -0,0 +1,52 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	timestamp := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	tsts := []struct {
+		format Format
+		want   string
+	}{
+		{
+			format: Table,
+			want: "INSTRUMENT_ID  SIZE  PRICE  TIMESTAMP\n" +
+				"1              -5    1.5    2022-01-01T00:00:00Z\n",
+		},
+		{
+			format: JSON,
+			want:   `{"instrument_id":1,"size":-5,"price":1.5,"timestamp":"2022-01-01T00:00:00Z"}` + "\n",
+		},
+		{
+			format: CSV,
+			want: "instrument_id,size,price,timestamp\n" +
+				"1,-5,1.5,2022-01-01T00:00:00Z\n",
+		},
+	}
+	for _, tst := range tsts {
+		t.Run(string(tst.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, tst.format, "instrument_id", "size", "price", "timestamp")
+			require.NoError(t, err)
+			require.NoError(t, w.Write(int64(1), int64(-5), 1.5, timestamp))
+			require.True(t, errors.Is(w.Write(int64(1)), ErrColumnMismatch))
+			require.NoError(t, w.Flush())
+			require.Equal(t, tst.want, buf.String())
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("CSV")
+	require.NoError(t, err)
+	require.Equal(t, CSV, format)
+	_, err = ParseFormat("xml")
+	require.True(t, errors.Is(err, ErrUnknownFormat))
+}
@@ -1,8 +1,10 @@
 package position
 
 import (
+	"container/heap"
 	"context"
 	"time"
+	"tradetracker/pkg/decimal"
 	"tradetracker/pkg/models"
 
 	"github.com/pkg/errors"
@@ -13,53 +15,169 @@ type Builder interface {
 	Build(ctx context.Context, in <-chan *models.Trade, out chan<- *models.Position) error
 }
 
+// LateHandler handles a trade which arrives later than the allowed lateness of a builder.
+type LateHandler func(trade *models.Trade) error
+
+// BuilderCfg is a configuration function for BinnedBuilder.
+type BuilderCfg func(*BinnedBuilder)
+
+// WithAllowedLateness sets how far behind the latest trade seen a trade may arrive and still be
+// reordered into the positions built. Trades are buffered until the watermark passes them.
+func WithAllowedLateness(lateness time.Duration) BuilderCfg {
+	return func(b *BinnedBuilder) {
+		b.allowedLateness = lateness
+	}
+}
+
+// WithLateHandler sets the handler for trades which arrive behind the watermark.
+// If no handler is set, such trades cause Build to fail with ErrNotSorted.
+func WithLateHandler(handler LateHandler) BuilderCfg {
+	return func(b *BinnedBuilder) {
+		b.lateHandler = handler
+	}
+}
+
+// WithSeed sets the positions of each account to continue building from,
+// e.g. when rebuilding part of the position history.
+func WithSeed(seeds ...*models.Position) BuilderCfg {
+	return func(b *BinnedBuilder) {
+		b.seeds = seeds
+	}
+}
+
 // BinnedBuilder builds positions from trades that occur within the a fixed-width bin.
 type BinnedBuilder struct {
 	binWidthSeconds, instrumentID int64
+	allowedLateness               time.Duration
+	lateHandler                   LateHandler
+	seeds                         []*models.Position
 }
 
 // NewBinnedBuilder creates a new BinnedBuilder.
-func NewBinnedBuilder(binWidthSeconds, instrumentID int64) *BinnedBuilder {
-	return &BinnedBuilder{
+func NewBinnedBuilder(binWidthSeconds, instrumentID int64, cfgs ...BuilderCfg) *BinnedBuilder {
+	b := &BinnedBuilder{
 		binWidthSeconds: binWidthSeconds,
 		instrumentID:    instrumentID,
 	}
+	for _, cfg := range cfgs {
+		cfg(b)
+	}
+	return b
 }
 
 // Build aggregates trades within time windows of binSize seconds to produce positions.
-// It assumes that the trades are for a given instrument and are sorted by timestamp; if not, and error is returned.
+// It assumes that the trades are for a given instrument; if not, an error is returned.
+// Positions are built separately for each account that the trades are booked to.
+// Trades may arrive out of order by up to the allowed lateness, which defaults to zero. Trades
+// are buffered and released in timestamp order once the watermark, the latest trade timestamp
+// seen less the allowed lateness, has passed them. Trades behind the watermark are passed to the
+// late handler, or if there is none an error is returned.
 // NOTE: for now, no actual bin aggregation is implemented, but this is included for demo purposes
 func (p *BinnedBuilder) Build(ctx context.Context, in <-chan *models.Trade, out chan<- *models.Position) error {
 	defer close(out)
-	lastPos := &models.Position{
-		InstrumentID: p.instrumentID,
+	lastPos := make(map[int64]*models.Position)
+	var watermark time.Time
+	for _, seed := range p.seeds {
+		if seed.InstrumentID != p.instrumentID {
+			return ErrInstrumentMismatch
+		}
+		lastPos[seed.AccountID] = seed
+		if seed.Timestamp.After(watermark) {
+			watermark = seed.Timestamp
+		}
 	}
+	pending := &tradeHeap{}
+	release := func(all bool) {
+		for pending.Len() > 0 && (all || !(*pending)[0].trade.Timestamp.After(watermark)) {
+			trade := heap.Pop(pending).(*pendingTrade).trade
+			size := decimal.Zero
+			if last, ok := lastPos[trade.AccountID]; ok {
+				size = last.Size
+			}
+			pos := &models.Position{
+				InstrumentID: p.instrumentID,
+				AccountID:    trade.AccountID,
+				Size:         size.Add(trade.Size),
+				Timestamp:    trade.Timestamp,
+			}
+			// record the lineage of the position, for trades which have been stored
+			if trade.ID != 0 {
+				pos.TradeIDs = []int64{trade.ID}
+			}
+			out <- pos
+			lastPos[trade.AccountID] = pos
+		}
+	}
+	var seq int64
 	for {
 		select {
 		case <-ctx.Done():
 			return errors.Wrap(ctx.Err(), "context cancelled")
 		case trade, ok := <-in:
 			if !ok {
+				release(true)
 				return nil
 			}
-			if trade.InstrumentID != lastPos.InstrumentID {
+			if trade.InstrumentID != p.instrumentID {
 				return ErrInstrumentMismatch
 			}
-			if trade.Timestamp.Unix() < lastPos.Timestamp.Unix() {
-				return errors.Wrapf(
-					ErrNotSorted,
-					"trade timestamp %s is before position timestamp %s",
-					trade.Timestamp.Format(time.RFC3339),
-					lastPos.Timestamp.Format(time.RFC3339),
-				)
+			if trade.Timestamp.Before(watermark) {
+				if p.lateHandler == nil {
+					return errors.Wrapf(
+						ErrNotSorted,
+						"trade timestamp %s is before watermark %s",
+						trade.Timestamp.Format(time.RFC3339Nano),
+						watermark.Format(time.RFC3339Nano),
+					)
+				}
+				if err := p.lateHandler(trade); err != nil {
+					return errors.Wrap(err, "handle late trade failed")
+				}
+				continue
 			}
-			pos := &models.Position{
-				InstrumentID: lastPos.InstrumentID,
-				Size:         lastPos.Size + trade.Size,
-				Timestamp:    trade.Timestamp,
+			heap.Push(pending, &pendingTrade{trade: trade, seq: seq})
+			seq++
+			if wm := trade.Timestamp.Add(-p.allowedLateness); wm.After(watermark) {
+				watermark = wm
 			}
-			out <- pos
-			lastPos = pos
+			release(false)
 		}
 	}
 }
+
+// pendingTrade is a trade buffered by a builder until the watermark passes it.
+// The sequence number keeps trades with equal timestamps which have not been stored in arrival order.
+type pendingTrade struct {
+	trade *models.Trade
+	seq   int64
+}
+
+// tradeHeap is a min-heap of pending trades ordered by timestamp, then by ID if both trades have been stored,
+// as they are read from the repo, and then by arrival.
+type tradeHeap []*pendingTrade
+
+func (h tradeHeap) Len() int { return len(h) }
+
+func (h tradeHeap) Less(i, j int) bool {
+	a, b := h[i].trade, h[j].trade
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
+	}
+	if a.ID != 0 && b.ID != 0 && a.ID != b.ID {
+		return a.ID < b.ID
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h tradeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *tradeHeap) Push(x interface{}) { *h = append(*h, x.(*pendingTrade)) }
+
+func (h *tradeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return x
+}
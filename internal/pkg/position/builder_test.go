@@ -6,6 +6,7 @@ import (
 	"sync"
 	"testing"
 	"time"
+	"tradetracker/pkg/decimal"
 	"tradetracker/pkg/models"
 
 	"github.com/stretchr/testify/require"
@@ -25,34 +26,34 @@ var tsts []tst = []tst{
 		trades: []*models.Trade{
 			{
 				InstrumentID: 1,
-				Size:         1,
+				Size:         decimal.NewFromInt(1),
 				Timestamp:    time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC),
 			},
 			{
 				InstrumentID: 1,
-				Size:         1,
+				Size:         decimal.NewFromInt(1),
 				Timestamp:    time.Date(2022, 1, 1, 0, 0, 2, 0, time.UTC),
 			},
 			{
 				InstrumentID: 1,
-				Size:         1,
+				Size:         decimal.NewFromInt(1),
 				Timestamp:    time.Date(2022, 1, 1, 0, 0, 3, 0, time.UTC),
 			},
 		},
 		positions: []*models.Position{
 			{
 				InstrumentID: 1,
-				Size:         1,
+				Size:         decimal.NewFromInt(1),
 				Timestamp:    time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC),
 			},
 			{
 				InstrumentID: 1,
-				Size:         2,
+				Size:         decimal.NewFromInt(2),
 				Timestamp:    time.Date(2022, 1, 1, 0, 0, 2, 0, time.UTC),
 			},
 			{
 				InstrumentID: 1,
-				Size:         3,
+				Size:         decimal.NewFromInt(3),
 				Timestamp:    time.Date(2022, 1, 1, 0, 0, 3, 0, time.UTC),
 			},
 		},
@@ -100,3 +101,178 @@ func TestBuilder(t *testing.T) {
 		})
 	}
 }
+
+func TestBuilderAllowedLateness(t *testing.T) {
+	ts := func(sec int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, sec, 0, time.UTC)
+	}
+	trades := []*models.Trade{
+		{InstrumentID: 1, Size: decimal.NewFromInt(1), Timestamp: ts(2)},
+		{InstrumentID: 1, Size: decimal.NewFromInt(2), Timestamp: ts(1)}, // within lateness, reordered
+		{InstrumentID: 1, Size: decimal.NewFromInt(4), Timestamp: ts(10)},
+		{InstrumentID: 1, Size: decimal.NewFromInt(8), Timestamp: ts(3)}, // behind the watermark of 5s
+		{InstrumentID: 1, Size: decimal.NewFromInt(16), Timestamp: ts(9)},
+	}
+	var late []*models.Trade
+	tradesCh := make(chan *models.Trade, len(trades))
+	positionsCh := make(chan *models.Position, len(trades))
+	for _, trade := range trades {
+		tradesCh <- trade
+	}
+	close(tradesCh)
+	err := NewBinnedBuilder(1, 1,
+		WithAllowedLateness(5*time.Second),
+		WithLateHandler(func(trade *models.Trade) error {
+			late = append(late, trade)
+			return nil
+		}),
+	).Build(context.Background(), tradesCh, positionsCh)
+	require.NoError(t, err)
+	var actual []*models.Position
+	for pos := range positionsCh {
+		actual = append(actual, pos)
+	}
+	expected := []*models.Position{
+		{InstrumentID: 1, Size: decimal.NewFromInt(2), Timestamp: ts(1)},
+		{InstrumentID: 1, Size: decimal.NewFromInt(3), Timestamp: ts(2)},
+		{InstrumentID: 1, Size: decimal.NewFromInt(19), Timestamp: ts(9)},
+		{InstrumentID: 1, Size: decimal.NewFromInt(23), Timestamp: ts(10)},
+	}
+	require.Equal(t, expected, actual)
+	require.Equal(t, []*models.Trade{trades[3]}, late)
+}
+
+func TestBuilderNotSorted(t *testing.T) {
+	tradesCh := make(chan *models.Trade, 2)
+	positionsCh := make(chan *models.Position, 2)
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.NewFromInt(1), Timestamp: time.Date(2022, 1, 1, 0, 0, 2, 0, time.UTC)}
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.NewFromInt(1), Timestamp: time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)}
+	close(tradesCh)
+	err := NewBinnedBuilder(1, 1).Build(context.Background(), tradesCh, positionsCh)
+	require.ErrorIs(t, err, ErrNotSorted)
+}
+
+func TestBuilderSubSecond(t *testing.T) {
+	ts := func(micros int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, 1, micros*1000, time.UTC)
+	}
+	// trades are ordered to the microsecond, and trades at the same time by ID
+	trades := []*models.Trade{
+		{ID: 3, InstrumentID: 1, Size: decimal.NewFromInt(1), Timestamp: ts(2)},
+		{ID: 2, InstrumentID: 1, Size: decimal.NewFromInt(2), Timestamp: ts(1)},
+		{ID: 1, InstrumentID: 1, Size: decimal.NewFromInt(4), Timestamp: ts(2)},
+		{InstrumentID: 1, Size: decimal.NewFromInt(8), Timestamp: ts(2)},
+		{InstrumentID: 1, Size: decimal.NewFromInt(16), Timestamp: ts(2)},
+	}
+	tradesCh := make(chan *models.Trade, len(trades))
+	positionsCh := make(chan *models.Position, len(trades))
+	for _, trade := range trades {
+		tradesCh <- trade
+	}
+	close(tradesCh)
+	err := NewBinnedBuilder(1, 1, WithAllowedLateness(time.Second)).Build(context.Background(), tradesCh, positionsCh)
+	require.NoError(t, err)
+	var sizes []string
+	for pos := range positionsCh {
+		sizes = append(sizes, pos.Size.String())
+	}
+	require.Equal(t, []string{"2", "6", "7", "15", "31"}, sizes)
+
+	tradesCh = make(chan *models.Trade, 2)
+	positionsCh = make(chan *models.Position, 2)
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.NewFromInt(1), Timestamp: ts(2)}
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.NewFromInt(1), Timestamp: ts(1)}
+	close(tradesCh)
+	err = NewBinnedBuilder(1, 1).Build(context.Background(), tradesCh, positionsCh)
+	require.ErrorIs(t, err, ErrNotSorted)
+}
+
+func TestBuilderSeed(t *testing.T) {
+	tradesCh := make(chan *models.Trade, 1)
+	positionsCh := make(chan *models.Position, 1)
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.NewFromInt(5), Timestamp: time.Date(2022, 1, 1, 0, 0, 2, 0, time.UTC)}
+	close(tradesCh)
+	err := NewBinnedBuilder(1, 1, WithSeed(&models.Position{
+		InstrumentID: 1,
+		Size:         decimal.NewFromInt(10),
+		Timestamp:    time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC),
+	})).Build(context.Background(), tradesCh, positionsCh)
+	require.NoError(t, err)
+	pos := <-positionsCh
+	require.Equal(t, decimal.NewFromInt(15), pos.Size)
+}
+
+func TestBuilderAccounts(t *testing.T) {
+	ts := func(sec int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, sec, 0, time.UTC)
+	}
+	trades := []*models.Trade{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Timestamp: ts(1)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(5), Timestamp: ts(2)},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(-3), Timestamp: ts(3)},
+	}
+	tradesCh := make(chan *models.Trade, len(trades))
+	positionsCh := make(chan *models.Position, len(trades))
+	for _, trade := range trades {
+		tradesCh <- trade
+	}
+	close(tradesCh)
+	err := NewBinnedBuilder(1, 1, WithSeed(&models.Position{
+		InstrumentID: 1,
+		AccountID:    2,
+		Size:         decimal.NewFromInt(100),
+	})).Build(context.Background(), tradesCh, positionsCh)
+	require.NoError(t, err)
+	var actual []*models.Position
+	for pos := range positionsCh {
+		actual = append(actual, pos)
+	}
+	expected := []*models.Position{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Timestamp: ts(1)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(105), Timestamp: ts(2)},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(7), Timestamp: ts(3)},
+	}
+	require.Equal(t, expected, actual)
+}
+
+func TestBuilderLineage(t *testing.T) {
+	ts := func(sec int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, sec, 0, time.UTC)
+	}
+	trades := []*models.Trade{
+		{ID: 7, InstrumentID: 1, Size: decimal.NewFromInt(10), Timestamp: ts(1)},
+		{ID: 8, InstrumentID: 1, Size: decimal.NewFromInt(-3), Timestamp: ts(2)},
+	}
+	tradesCh := make(chan *models.Trade, len(trades))
+	positionsCh := make(chan *models.Position, len(trades))
+	for _, trade := range trades {
+		tradesCh <- trade
+	}
+	close(tradesCh)
+	require.NoError(t, NewBinnedBuilder(1, 1).Build(context.Background(), tradesCh, positionsCh))
+	var actual []*models.Position
+	for pos := range positionsCh {
+		actual = append(actual, pos)
+	}
+	expected := []*models.Position{
+		{InstrumentID: 1, Size: decimal.NewFromInt(10), Timestamp: ts(1), TradeIDs: []int64{7}},
+		{InstrumentID: 1, Size: decimal.NewFromInt(7), Timestamp: ts(2), TradeIDs: []int64{8}},
+	}
+	require.Equal(t, expected, actual)
+}
+
+func TestBuilderFractional(t *testing.T) {
+	tradesCh := make(chan *models.Trade, 3)
+	positionsCh := make(chan *models.Position, 3)
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.MustParse("0.1"), Timestamp: time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)}
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.MustParse("0.2"), Timestamp: time.Date(2022, 1, 1, 0, 0, 2, 0, time.UTC)}
+	tradesCh <- &models.Trade{InstrumentID: 1, Size: decimal.MustParse("-0.30000001"), Timestamp: time.Date(2022, 1, 1, 0, 0, 3, 0, time.UTC)}
+	close(tradesCh)
+	err := NewBinnedBuilder(1, 1).Build(context.Background(), tradesCh, positionsCh)
+	require.NoError(t, err)
+	var sizes []string
+	for pos := range positionsCh {
+		sizes = append(sizes, pos.Size.String())
+	}
+	require.Equal(t, []string{"0.1", "0.3", "-0.00000001"}, sizes)
+}
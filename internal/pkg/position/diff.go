@@ -0,0 +1,150 @@
+package position
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// Change is a change in the position of an instrument between two snapshots.
+// Before is nil if the instrument had no position in the first snapshot, and After is nil
+// if it has no position in the second.
+type Change struct {
+	InstrumentID int64
+	Before       *models.Position
+	After        *models.Position
+}
+
+// Size returns the change in the size of the position.
+func (c *Change) Size() decimal.Decimal {
+	return size(c.After).Sub(size(c.Before))
+}
+
+func size(pos *models.Position) decimal.Decimal {
+	if pos == nil {
+		return decimal.Zero
+	}
+	return pos.Size
+}
+
+// Diff compares two snapshots of positions with one position per instrument, returning the changes
+// in the instruments whose position size differs, ordered by instrument ID.
+// An instrument missing from a snapshot is treated as flat.
+func Diff(before, after []*models.Position) []*Change {
+	changes := make(map[int64]*Change)
+	change := func(instrumentID int64) *Change {
+		c, ok := changes[instrumentID]
+		if !ok {
+			c = &Change{InstrumentID: instrumentID}
+			changes[instrumentID] = c
+		}
+		return c
+	}
+	for _, pos := range before {
+		change(pos.InstrumentID).Before = pos
+	}
+	for _, pos := range after {
+		change(pos.InstrumentID).After = pos
+	}
+	var diff []*Change
+	for _, c := range changes {
+		if !c.Size().IsZero() {
+			diff = append(diff, c)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return diff[i].InstrumentID < diff[j].InstrumentID
+	})
+	return diff
+}
+
+// ReadSnapshot reads a snapshot of positions saved by the snapshot command in the JSON or CSV format.
+// Only the instrument_id, size and timestamp of each position are read.
+func ReadSnapshot(r io.Reader) ([]*models.Position, error) {
+	br := bufio.NewReader(r)
+	// JSON lines are told apart from CSV by the first non-space character
+	for {
+		b, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read failed")
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		if err := br.UnreadByte(); err != nil {
+			return nil, errors.Wrap(err, "unread failed")
+		}
+		if b == '{' {
+			return readSnapshotJSON(br)
+		}
+		return readSnapshotCSV(br)
+	}
+}
+
+func readSnapshotJSON(r io.Reader) ([]*models.Position, error) {
+	var positions []*models.Position
+	dec := json.NewDecoder(r)
+	for {
+		var pos models.Position
+		err := dec.Decode(&pos)
+		if errors.Is(err, io.EOF) {
+			return positions, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidSnapshot, err.Error())
+		}
+		if pos.InstrumentID == 0 {
+			return nil, errors.Wrapf(ErrInvalidSnapshot, "position %d has no instrument_id", len(positions)+1)
+		}
+		positions = append(positions, &pos)
+	}
+}
+
+func readSnapshotCSV(r io.Reader) ([]*models.Position, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSnapshot, err.Error())
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[name] = i
+	}
+	for _, name := range []string{"instrument_id", "size", "timestamp"} {
+		if _, ok := cols[name]; !ok {
+			return nil, errors.Wrapf(ErrInvalidSnapshot, "missing %s column", name)
+		}
+	}
+	var positions []*models.Position
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return positions, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidSnapshot, err.Error())
+		}
+		var pos models.Position
+		if pos.InstrumentID, err = strconv.ParseInt(record[cols["instrument_id"]], 10, 64); err != nil {
+			return nil, errors.Wrap(ErrInvalidSnapshot, err.Error())
+		}
+		if pos.Size, err = decimal.Parse(record[cols["size"]]); err != nil {
+			return nil, errors.Wrap(ErrInvalidSnapshot, err.Error())
+		}
+		if pos.Timestamp, err = time.Parse(time.RFC3339, record[cols["timestamp"]]); err != nil {
+			return nil, errors.Wrap(ErrInvalidSnapshot, err.Error())
+		}
+		positions = append(positions, &pos)
+	}
+}
@@ -0,0 +1,65 @@
+package position
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := []*models.Position{
+		{InstrumentID: 3, Size: decimal.NewFromInt(5), Timestamp: ts},
+		{InstrumentID: 1, Size: decimal.NewFromInt(10), Timestamp: ts},
+		{InstrumentID: 2, Size: decimal.NewFromInt(7), Timestamp: ts},
+	}
+	after := []*models.Position{
+		{InstrumentID: 1, Size: decimal.NewFromInt(12), Timestamp: ts},
+		{InstrumentID: 2, Size: decimal.NewFromInt(7), Timestamp: ts},
+		{InstrumentID: 4, Size: decimal.NewFromInt(-2), Timestamp: ts},
+	}
+	diff := Diff(before, after)
+	require.Equal(t, []*Change{
+		{InstrumentID: 1, Before: before[1], After: after[0]},
+		{InstrumentID: 3, Before: before[0]},
+		{InstrumentID: 4, After: after[2]},
+	}, diff)
+	require.Equal(t, decimal.NewFromInt(2), diff[0].Size())
+	require.Equal(t, decimal.NewFromInt(-5), diff[1].Size())
+	require.Equal(t, decimal.NewFromInt(-2), diff[2].Size())
+	require.Empty(t, Diff(before, before))
+}
+
+func TestReadSnapshot(t *testing.T) {
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	expected := []*models.Position{
+		{InstrumentID: 1, Size: decimal.NewFromInt(10), Timestamp: ts},
+		{InstrumentID: 2, Size: decimal.NewFromInt(-3), Timestamp: ts},
+	}
+
+	positions, err := ReadSnapshot(strings.NewReader(`
+{"instrument_id":1,"symbol":"AAPL","size":10,"timestamp":"2022-01-01T00:00:00Z"}
+{"instrument_id":2,"symbol":"MSFT","size":-3,"timestamp":"2022-01-01T00:00:00Z"}
+`))
+	require.NoError(t, err)
+	require.Equal(t, expected, positions)
+
+	positions, err = ReadSnapshot(strings.NewReader(
+		"instrument_id,symbol,size,timestamp\n1,AAPL,10,2022-01-01T00:00:00Z\n2,MSFT,-3,2022-01-01T00:00:00Z\n",
+	))
+	require.NoError(t, err)
+	require.Equal(t, expected, positions)
+
+	for _, s := range []string{
+		`{"symbol":"AAPL","size":10}`,
+		"symbol,size\nAAPL,10\n",
+		"instrument_id,size,timestamp\n1,x,2022-01-01T00:00:00Z\n",
+	} {
+		_, err := ReadSnapshot(strings.NewReader(s))
+		require.ErrorIs(t, err, ErrInvalidSnapshot, s)
+	}
+}
@@ -7,3 +7,12 @@ var ErrInstrumentMismatch error = errors.New("instrument mismatch")
 
 // ErrNotSorted indicates that the trades are not sorted by timestamp.
 var ErrNotSorted error = errors.New("not sorted")
+
+// ErrDrift indicates that stored positions do not match the positions rebuilt from trades.
+var ErrDrift error = errors.New("positions drifted")
+
+// ErrInvalidSnapshot indicates that a saved snapshot of positions cannot be read.
+var ErrInvalidSnapshot error = errors.New("invalid snapshot")
+
+// ErrUnknownLatePolicy indicates that a late policy is not supported.
+var ErrUnknownLatePolicy error = errors.New("unknown late policy")
@@ -0,0 +1,153 @@
+package position
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"tradetracker/internal/pkg/pubsub"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// LatePolicy is how trades which arrive later than the allowed lateness are handled.
+type LatePolicy string
+
+// These are the supported late policies.
+const (
+	// RebuildLate rebuilds the positions from a late trade onwards.
+	RebuildLate LatePolicy = "rebuild"
+	// RejectLateTrades rejects late trades with RejectLate, leaving the positions as they are.
+	RejectLateTrades LatePolicy = "reject"
+)
+
+// LatePolicies lists the supported late policies.
+var LatePolicies = []LatePolicy{RebuildLate, RejectLateTrades}
+
+// ParseLatePolicy parses the name of a late policy.
+func ParseLatePolicy(name string) (LatePolicy, error) {
+	for _, policy := range LatePolicies {
+		if strings.EqualFold(name, string(policy)) {
+			return policy, nil
+		}
+	}
+	return "", errors.Wrapf(ErrUnknownLatePolicy, "%q", name)
+}
+
+// RejectLate returns a LateHandler which publishes late trades on the late trade topic,
+// so that they can be inspected or reprocessed elsewhere.
+func RejectLate(pub pubsub.Publisher) LateHandler {
+	return func(trade *models.Trade) error {
+		logger.WithFields(logrus.Fields{
+			"instrument_id": trade.InstrumentID,
+			"size":          trade.Size,
+			"timestamp":     trade.Timestamp,
+		}).Warn("rejected late trade")
+		return errors.Wrap(pub.Publish(pubsub.Message{
+			Topic: pubsub.LateTradeTopic,
+			Value: trade,
+		}), "publish late trade failed")
+	}
+}
+
+// Rebuilder records late trades so that the part of the position history they affect can be rebuilt.
+// The late trades are expected to have been persisted to the trade repo by the time Rebuild is called.
+type Rebuilder struct {
+	trades                        repo.TradeRepo
+	positions                     repo.PositionRepo
+	binWidthSeconds, instrumentID int64
+
+	mu      sync.Mutex
+	from    time.Time
+	pending bool
+}
+
+// NewRebuilder creates a new Rebuilder.
+func NewRebuilder(trades repo.TradeRepo, positions repo.PositionRepo, binWidthSeconds, instrumentID int64) *Rebuilder {
+	return &Rebuilder{
+		trades:          trades,
+		positions:       positions,
+		binWidthSeconds: binWidthSeconds,
+		instrumentID:    instrumentID,
+	}
+}
+
+// Handle is a LateHandler which records the earliest late trade seen since the last rebuild.
+func (r *Rebuilder) Handle(trade *models.Trade) error {
+	if trade.InstrumentID != r.instrumentID {
+		return ErrInstrumentMismatch
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.pending || trade.Timestamp.Before(r.from) {
+		r.from = trade.Timestamp
+	}
+	r.pending = true
+	return nil
+}
+
+// Rebuild regenerates positions from the earliest late trade seen onwards, and returns the number
+// of positions created. It does nothing if no late trades have been seen since the last rebuild.
+func (r *Rebuilder) Rebuild(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	from, pending := r.from, r.pending
+	r.from, r.pending = time.Time{}, false
+	r.mu.Unlock()
+	if !pending {
+		return 0, nil
+	}
+	from = from.UTC().Truncate(repo.TimestampPrecision)
+	n, err := r.positions.SupersedePositionsFrom(ctx, r.instrumentID, from)
+	if err != nil {
+		return 0, errors.Wrap(err, "supersede positions failed")
+	}
+	logger.WithFields(logrus.Fields{
+		"instrument_id": r.instrumentID,
+		"from":          from,
+	}).Infof("superseded %d positions for rebuild", n)
+	// the positions are rebuilt from the trades at or after from, on the last positions of each account before it
+	before := from.Add(-repo.TimestampPrecision)
+	seeds, err := r.positions.ReadAccountPositions(ctx, r.instrumentID, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "read seed positions failed")
+	}
+	// reading and building are cancelled if creating a position fails, and waited for before returning
+	buildCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tradeCh, err := r.trades.ReadTrades(buildCtx, r.instrumentID, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "read trades failed")
+	}
+	positionCh := make(chan *models.Position)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- NewBinnedBuilder(r.binWidthSeconds, r.instrumentID, WithSeed(seeds...)).Build(buildCtx, tradeCh, positionCh)
+	}()
+	created := 0
+	var createErr error
+	for pos := range positionCh {
+		if createErr != nil {
+			continue
+		}
+		if _, err := r.positions.CreatePosition(ctx, pos); err != nil {
+			createErr = errors.Wrap(err, "create position failed")
+			cancel()
+			continue
+		}
+		created++
+	}
+	buildErr := <-errCh
+	// the trade reader stops once the context is cancelled, closing the channel
+	for range tradeCh {
+	}
+	if createErr != nil {
+		return created, createErr
+	}
+	if buildErr != nil {
+		return created, errors.Wrap(buildErr, "build positions failed")
+	}
+	return created, nil
+}
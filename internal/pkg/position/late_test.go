@@ -0,0 +1,128 @@
+package position
+
+import (
+	"context"
+	"testing"
+	"time"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebuilderSubsecond(t *testing.T) {
+	ctx := context.Background()
+	ts := func(ms int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, 0, ms*int(time.Millisecond), time.UTC)
+	}
+	r := repo.NewMemoryRepo()
+	store := func(size int64, ms int) *models.Trade {
+		trade := &models.Trade{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(size), Timestamp: ts(ms)}
+		_, err := r.CreateTrade(ctx, trade)
+		require.NoError(t, err)
+		return trade
+	}
+	for _, pos := range []*models.Position{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Timestamp: ts(200)},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(15), Timestamp: ts(500)},
+	} {
+		_, err := r.CreatePosition(ctx, pos)
+		require.NoError(t, err)
+	}
+	store(10, 200)
+	store(5, 500)
+
+	// a late trade less than a second after the previous one rebuilds only the positions from it onwards
+	rebuilder := NewRebuilder(r, r, 1, 1)
+	require.NoError(t, rebuilder.Handle(store(2, 400)))
+	n, err := rebuilder.Rebuild(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	positions, err := r.ReadPositions(ctx, 1)
+	require.NoError(t, err)
+	var sizes []string
+	for _, pos := range positions {
+		sizes = append(sizes, pos.Size.String()+"@"+pos.Timestamp.Format("05.000"))
+	}
+	require.Equal(t, []string{"10@00.200", "12@00.400", "17@00.500"}, sizes)
+}
+
+// failingRepo fails to create positions, and records when the trades it reads have all been sent or abandoned.
+type failingRepo struct {
+	*repo.MemoryRepo
+	read chan struct{}
+}
+
+func (r *failingRepo) ReadTrades(ctx context.Context, instrumentID int64, after time.Time) (<-chan *models.Trade, error) {
+	in, err := r.MemoryRepo.ReadTrades(ctx, instrumentID, after)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *models.Trade)
+	go func() {
+		defer close(r.read)
+		defer close(out)
+		for trade := range in {
+			select {
+			case out <- trade:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (r *failingRepo) CreatePosition(context.Context, *models.Position) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestRebuilderCreateFailure(t *testing.T) {
+	ctx := context.Background()
+	ts := func(sec int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, sec, 0, time.UTC)
+	}
+	r := &failingRepo{MemoryRepo: repo.NewMemoryRepo(), read: make(chan struct{})}
+	for sec := 1; sec <= 5; sec++ {
+		_, err := r.CreateTrade(ctx, &models.Trade{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(1), Timestamp: ts(sec)})
+		require.NoError(t, err)
+	}
+
+	// the trades are no longer read once creating a position fails
+	rebuilder := NewRebuilder(r, r, 1, 1)
+	require.NoError(t, rebuilder.Handle(&models.Trade{InstrumentID: 1, Timestamp: ts(1)}))
+	_, err := rebuilder.Rebuild(ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "disk full")
+	select {
+	case <-r.read:
+	case <-time.After(time.Second):
+		t.Fatal("trades are still being read")
+	}
+}
+
+func TestLiveCreateFailure(t *testing.T) {
+	ctx := context.Background()
+	ts := func(sec int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, sec, 0, time.UTC)
+	}
+	r := &failingRepo{MemoryRepo: repo.NewMemoryRepo(), read: make(chan struct{})}
+	for sec := 1; sec <= 20; sec++ {
+		_, err := r.CreateTrade(ctx, &models.Trade{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(1), Timestamp: ts(sec)})
+		require.NoError(t, err)
+	}
+
+	// the trades are no longer read once creating a position fails
+	live := NewLive(r, r, 1)
+	err := live.Start(ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "disk full")
+	select {
+	case <-r.read:
+	case <-time.After(time.Second):
+		t.Fatal("trades are still being read")
+	}
+}
@@ -0,0 +1,205 @@
+package position
+
+import (
+	"context"
+	"time"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Live builds the positions of an instrument from its trades as they are stored, for a long-running process.
+// It starts by building the positions again from every stored trade, then builds on from each trade added.
+// Trades added up to the allowed lateness behind the latest trade seen are reordered into the positions built.
+// A trade added later than that is given to the late handler if one is set, or otherwise is rebuilt from,
+// as a Rebuilder does for late trades. It is not safe for concurrent use.
+type Live struct {
+	trades          repo.TradeRepo
+	positions       repo.PositionRepo
+	instrumentID    int64
+	rebuilder       *Rebuilder
+	allowedLateness time.Duration
+	lateHandler     LateHandler
+
+	watermark time.Time
+	in        chan *models.Trade
+	done      chan error
+	running   context.Context
+	cancel    context.CancelFunc
+}
+
+// LiveCfg is a configuration function for Live.
+type LiveCfg func(*Live)
+
+// WithLiveLateness sets how far behind the latest trade seen a trade may be added and still be reordered
+// into the positions built. The positions are written once the latest trade seen is that far past them.
+func WithLiveLateness(lateness time.Duration) LiveCfg {
+	return func(l *Live) {
+		l.allowedLateness = lateness
+	}
+}
+
+// WithLiveLateHandler sets the handler for trades added later than the allowed lateness, e.g. RejectLate.
+// If no handler is set, the positions are rebuilt from such trades.
+func WithLiveLateHandler(handler LateHandler) LiveCfg {
+	return func(l *Live) {
+		l.lateHandler = handler
+	}
+}
+
+// NewLive creates a new Live.
+func NewLive(trades repo.TradeRepo, positions repo.PositionRepo, instrumentID int64, cfgs ...LiveCfg) *Live {
+	l := &Live{
+		trades:       trades,
+		positions:    positions,
+		instrumentID: instrumentID,
+		rebuilder:    NewRebuilder(trades, positions, 1, instrumentID),
+	}
+	for _, cfg := range cfgs {
+		cfg(l)
+	}
+	return l
+}
+
+// Start supersedes the current positions of the instrument and builds them again from the seed positions
+// and every stored trade, then waits for trades to be added. Seed positions are not superseded.
+func (l *Live) Start(ctx context.Context, seeds ...*models.Position) error {
+	n, err := l.positions.SupersedePositions(ctx, l.instrumentID)
+	if err != nil {
+		return errors.Wrap(err, "supersede positions failed")
+	}
+	logger.WithFields(logrus.Fields{
+		"instrument_id": l.instrumentID,
+	}).Infof("superseded %d positions", n)
+	// reading is cancelled if building stops, and waited for before returning
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tradeCh, err := l.trades.ReadTrades(readCtx, l.instrumentID, time.Time{})
+	if err != nil {
+		return errors.Wrap(err, "read trades failed")
+	}
+	l.start(ctx, seeds)
+	for trade := range tradeCh {
+		if err := l.send(trade); err != nil {
+			cancel()
+			// the trade reader stops once the context is cancelled, closing the channel
+			for range tradeCh {
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Add builds the positions following from a trade which has been stored. If the trade is later than the
+// allowed lateness, it is given to the late handler, or otherwise building is stopped while the positions
+// from the trade onwards are rebuilt, then carries on.
+func (l *Live) Add(ctx context.Context, trade *models.Trade) error {
+	if trade.InstrumentID != l.instrumentID {
+		return ErrInstrumentMismatch
+	}
+	if !trade.Timestamp.Before(l.watermark.Add(-l.allowedLateness)) {
+		return l.send(trade)
+	}
+	if l.lateHandler != nil {
+		return errors.Wrap(l.lateHandler(trade), "handle late trade failed")
+	}
+	if err := l.Stop(); err != nil {
+		return errors.Wrap(err, "stop building failed")
+	}
+	if err := l.rebuilder.Handle(trade); err != nil {
+		return errors.Wrap(err, "handle late trade failed")
+	}
+	n, err := l.rebuilder.Rebuild(ctx)
+	if err != nil {
+		return errors.Wrap(err, "rebuild positions failed")
+	}
+	logger.WithFields(logrus.Fields{
+		"instrument_id": l.instrumentID,
+		"timestamp":     trade.Timestamp,
+	}).Infof("rebuilt %d positions after late trade", n)
+	seeds, err := l.positions.ReadAccountPositions(ctx, l.instrumentID, l.watermark)
+	if err != nil {
+		return errors.Wrap(err, "read seed positions failed")
+	}
+	l.start(ctx, seeds)
+	return nil
+}
+
+// Stop stops building, waiting for the positions built so far to be written. Any trades held back
+// by the builder are flushed as positions first. It may be called more than once.
+func (l *Live) Stop() error {
+	if l.in == nil {
+		return nil
+	}
+	close(l.in)
+	l.in = nil
+	err := <-l.done
+	l.cancel()
+	return err
+}
+
+// start starts building on from the seed positions, writing the positions built to the repo.
+// If writing a position fails, building is cancelled, and the error is returned by Stop.
+func (l *Live) start(ctx context.Context, seeds []*models.Position) {
+	l.running, l.cancel = context.WithCancel(ctx)
+	l.in = make(chan *models.Trade)
+	l.done = make(chan error, 1)
+	for _, seed := range seeds {
+		if seed.Timestamp.After(l.watermark) {
+			l.watermark = seed.Timestamp
+		}
+	}
+	positionCh := make(chan *models.Position)
+	buildErr := make(chan error, 1)
+	go func(ctx context.Context, in <-chan *models.Trade) {
+		builder := NewBinnedBuilder(1, l.instrumentID, WithSeed(seeds...), WithAllowedLateness(l.allowedLateness))
+		buildErr <- builder.Build(ctx, in, positionCh)
+	}(l.running, l.in)
+	go func(ctx context.Context, cancel context.CancelFunc, done chan<- error) {
+		var err error
+		for pos := range positionCh {
+			if err != nil {
+				continue
+			}
+			id, cerr := l.positions.CreatePosition(ctx, pos)
+			if cerr != nil {
+				err = errors.Wrap(cerr, "create position failed")
+				cancel()
+				continue
+			}
+			logger.WithFields(logrus.Fields{
+				"id":            id,
+				"instrument_id": pos.InstrumentID,
+				"account_id":    pos.AccountID,
+				"size":          pos.Size,
+				"timestamp":     pos.Timestamp,
+			}).Info("added position")
+		}
+		if berr := <-buildErr; err == nil && berr != nil {
+			err = errors.Wrap(berr, "build positions failed")
+		}
+		done <- err
+	}(l.running, l.cancel, l.done)
+}
+
+// send sends a trade to the builder, returning the error which stopped it if it has stopped.
+func (l *Live) send(trade *models.Trade) error {
+	if l.in == nil {
+		return errors.New("live builder is stopped")
+	}
+	select {
+	case l.in <- trade:
+		if trade.Timestamp.After(l.watermark) {
+			l.watermark = trade.Timestamp
+		}
+		return nil
+	case <-l.running.Done():
+		if err := l.Stop(); err != nil {
+			return err
+		}
+		return errors.New("live builder is stopped")
+	}
+}
@@ -0,0 +1,97 @@
+package position
+
+import (
+	"context"
+	"testing"
+	"time"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLive(t *testing.T) {
+	ctx := context.Background()
+	ts := func(sec int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, sec, 0, time.UTC)
+	}
+	r := repo.NewMemoryRepo()
+	store := func(size int64, sec int) *models.Trade {
+		trade := &models.Trade{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(size), Timestamp: ts(sec)}
+		id, err := r.CreateTrade(ctx, trade)
+		require.NoError(t, err)
+		trade.ID = int64(id)
+		return trade
+	}
+	size := func(sec int) string {
+		pos, err := r.ReadPosition(ctx, 1, 1, ts(sec), time.Time{})
+		require.NoError(t, err)
+		return pos.Size.String()
+	}
+
+	// the positions are built again from the trades stored before starting
+	store(10, 1)
+	store(5, 3)
+	live := NewLive(r, r, 1)
+	require.NoError(t, live.Start(ctx))
+
+	// trades added in order are built on
+	require.NoError(t, live.Add(ctx, store(1, 4)))
+	// a late trade rebuilds the positions from it onwards
+	require.NoError(t, live.Add(ctx, store(2, 2)))
+	require.NoError(t, live.Add(ctx, store(1, 5)))
+	require.NoError(t, live.Stop())
+	require.NoError(t, live.Stop())
+
+	require.Equal(t, "10", size(1))
+	require.Equal(t, "12", size(2))
+	require.Equal(t, "17", size(3))
+	require.Equal(t, "18", size(4))
+	require.Equal(t, "19", size(5))
+
+	require.ErrorIs(t, live.Add(ctx, &models.Trade{InstrumentID: 2, Timestamp: ts(6)}), ErrInstrumentMismatch)
+}
+
+func TestLiveLateness(t *testing.T) {
+	ctx := context.Background()
+	ts := func(sec int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, sec, 0, time.UTC)
+	}
+	r := repo.NewMemoryRepo()
+	store := func(size int64, sec int) *models.Trade {
+		trade := &models.Trade{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(size), Timestamp: ts(sec)}
+		id, err := r.CreateTrade(ctx, trade)
+		require.NoError(t, err)
+		trade.ID = int64(id)
+		return trade
+	}
+	var rejected []*models.Trade
+	live := NewLive(r, r, 1, WithLiveLateness(2*time.Second), WithLiveLateHandler(func(trade *models.Trade) error {
+		rejected = append(rejected, trade)
+		return nil
+	}))
+	require.NoError(t, live.Start(ctx))
+
+	// a trade within the allowed lateness is reordered, and one later than that is handled as late
+	require.NoError(t, live.Add(ctx, store(1, 1)))
+	require.NoError(t, live.Add(ctx, store(1, 4)))
+	require.NoError(t, live.Add(ctx, store(2, 3)))
+	late := store(5, 1)
+	require.NoError(t, live.Add(ctx, late))
+	require.NoError(t, live.Stop())
+	require.Equal(t, []*models.Trade{late}, rejected)
+
+	positions, err := r.ReadPositions(ctx, 1)
+	require.NoError(t, err)
+	var sizes []string
+	for _, pos := range positions {
+		sizes = append(sizes, pos.Size.String())
+	}
+	require.Equal(t, []string{"1", "3", "4"}, sizes)
+
+	_, err = ParseLatePolicy("Reject")
+	require.NoError(t, err)
+	_, err = ParseLatePolicy("drop")
+	require.ErrorIs(t, err, ErrUnknownLatePolicy)
+}
@@ -4,6 +4,7 @@ package position
 import (
 	"context"
 	"sync"
+	"tradetracker/internal/pkg/instrument"
 	"tradetracker/internal/pkg/pubsub"
 	"tradetracker/internal/pkg/repo"
 	"tradetracker/pkg/models"
@@ -16,9 +17,10 @@ var logger logrus.FieldLogger = logrus.StandardLogger()
 
 // Processor aggregates trades from a pub-sub system to build positions and stores them in a repository.
 type Processor struct {
-	repo    repo.PositionRepo
-	sub     pubsub.Subscriber
-	builder Builder
+	repo        repo.PositionRepo
+	sub         pubsub.Subscriber
+	builder     Builder
+	instruments *instrument.Registry
 }
 
 // Cfg is a configuration function for Processor.
@@ -59,6 +61,14 @@ func WithBuilder(builder Builder) Cfg {
 	}
 }
 
+// WithInstruments sets the instrument reference data used to label the positions created with their symbol.
+func WithInstruments(instruments *instrument.Registry) Cfg {
+	return func(c *Processor) error {
+		c.instruments = instruments
+		return nil
+	}
+}
+
 // Process consumes trade messages from the trade source and uses them to build positions.
 func (t *Processor) Process(ctx context.Context) error {
 	tradeCh := make(chan *models.Trade)
@@ -78,12 +88,17 @@ func (t *Processor) Process(ctx context.Context) error {
 			if err != nil {
 				logger.Fatalln(errors.Wrap(err, "create position failed"))
 			}
-			logger.WithFields(logrus.Fields{
+			fields := logrus.Fields{
 				"id":            id,
 				"instrument_id": pos.InstrumentID,
+				"account_id":    pos.AccountID,
 				"size":          pos.Size,
 				"timestamp":     pos.Timestamp,
-			}).Info("added position")
+			}
+			if t.instruments != nil {
+				fields["symbol"] = t.instruments.Symbol(ctx, pos.InstrumentID)
+			}
+			logger.WithFields(fields).Info("added position")
 		}
 	}()
 	err := t.sub.Subscribe(ctx, pubsub.TradeTopic, func(m pubsub.Message) error {
@@ -0,0 +1,59 @@
+package position
+
+import (
+	"context"
+	"time"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// Resample reads positions sorted by timestamp from in, and sends the last position in each
+// interval of the given width to out, timestamped at the start of the interval.
+// Intervals in which the position does not change are skipped. It returns when the context is cancelled,
+// even if out is not being read.
+func Resample(ctx context.Context, every time.Duration, in <-chan *models.Position, out chan<- *models.Position) error {
+	defer close(out)
+	if every <= 0 {
+		return errors.Errorf("resample interval must be positive, got %s", every)
+	}
+	send := func(pos *models.Position) error {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "context cancelled")
+		case out <- pos:
+			return nil
+		}
+	}
+	var last *models.Position
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "context cancelled")
+		case pos, ok := <-in:
+			if !ok {
+				if last != nil {
+					return send(last)
+				}
+				return nil
+			}
+			start := pos.Timestamp.UTC().Truncate(every)
+			if last != nil && start.Before(last.Timestamp) {
+				return errors.Wrapf(
+					ErrNotSorted,
+					"position timestamp %s is before previous interval %s",
+					pos.Timestamp.Format(time.RFC3339Nano),
+					last.Timestamp.Format(time.RFC3339Nano),
+				)
+			}
+			if last != nil && !start.Equal(last.Timestamp) {
+				if err := send(last); err != nil {
+					return err
+				}
+			}
+			resampled := *pos
+			resampled.Timestamp = start
+			last = &resampled
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package position
+
+import (
+	"context"
+	"testing"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResample(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	in := make(chan *models.Position)
+	out := make(chan *models.Position)
+	go func() {
+		defer close(in)
+		for _, pos := range []*models.Position{
+			{InstrumentID: 1, Size: decimal.NewFromInt(1), Timestamp: start.Add(10 * time.Minute)},
+			{InstrumentID: 1, Size: decimal.NewFromInt(3), Timestamp: start.Add(50 * time.Minute)},
+			{InstrumentID: 1, Size: decimal.NewFromInt(2), Timestamp: start.Add(3*time.Hour + time.Minute)},
+		} {
+			in <- pos
+		}
+	}()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Resample(context.Background(), time.Hour, in, out)
+	}()
+	var positions []*models.Position
+	for pos := range out {
+		positions = append(positions, pos)
+	}
+	require.NoError(t, <-errCh)
+	require.Equal(t, []*models.Position{
+		{InstrumentID: 1, Size: decimal.NewFromInt(3), Timestamp: start},
+		{InstrumentID: 1, Size: decimal.NewFromInt(2), Timestamp: start.Add(3 * time.Hour)},
+	}, positions)
+}
+
+func TestResampleCancel(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	in := make(chan *models.Position, 2)
+	in <- &models.Position{InstrumentID: 1, Size: decimal.NewFromInt(1), Timestamp: start}
+	in <- &models.Position{InstrumentID: 1, Size: decimal.NewFromInt(2), Timestamp: start.Add(time.Hour)}
+	// nothing reads out, so the resampler is blocked sending until the context is cancelled
+	out := make(chan *models.Position)
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Resample(ctx, time.Hour, in, out)
+	}()
+	cancel()
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("resample did not return after the context was cancelled")
+	}
+}
@@ -0,0 +1,108 @@
+package position
+
+import (
+	"context"
+	"time"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// DriftKind describes how a stored position differs from the position rebuilt from trades.
+type DriftKind string
+
+// These are the kinds of drift.
+const (
+	// DriftMismatch indicates that the stored position has a different size to the rebuilt position.
+	DriftMismatch DriftKind = "mismatch"
+	// DriftMissing indicates that a rebuilt position has not been stored.
+	DriftMissing DriftKind = "missing"
+	// DriftExtra indicates that a stored position cannot be rebuilt from the trades.
+	DriftExtra DriftKind = "extra"
+)
+
+// Drift is a difference between the stored positions and the positions rebuilt from trades.
+// Expected is nil for extra positions, and Actual is nil for missing positions.
+type Drift struct {
+	Kind     DriftKind
+	Expected *models.Position
+	Actual   *models.Position
+}
+
+// Replay builds positions from trades in memory, without storing them.
+func Replay(ctx context.Context, builder Builder, in <-chan *models.Trade) ([]*models.Position, error) {
+	out := make(chan *models.Position)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- builder.Build(ctx, in, out)
+	}()
+	var positions []*models.Position
+	for pos := range out {
+		positions = append(positions, pos)
+	}
+	if err := <-errCh; err != nil {
+		return nil, errors.Wrap(err, "build positions failed")
+	}
+	return positions, nil
+}
+
+// Compare compares the expected positions with the actual positions row by row, returning any drift between them.
+// Both must be sorted by timestamp. Positions are matched by account, timestamp and their order within the timestamp,
+// as there may be several positions for an account at the same time.
+func Compare(expected, actual []*models.Position) []*Drift {
+	type key struct {
+		accountID int64
+		timestamp int64
+		seq       int
+	}
+	keys := func(positions []*models.Position) []key {
+		seqs := make(map[key]int)
+		ks := make([]key, len(positions))
+		for i, pos := range positions {
+			first := key{accountID: pos.AccountID, timestamp: pos.Timestamp.UnixNano()}
+			ks[i] = first
+			ks[i].seq = seqs[first]
+			seqs[first]++
+		}
+		return ks
+	}
+	actualByKey := make(map[key]*models.Position, len(actual))
+	actualKeys := keys(actual)
+	for i, k := range actualKeys {
+		actualByKey[k] = actual[i]
+	}
+	var drift []*Drift
+	matched := make(map[key]bool, len(expected))
+	for i, k := range keys(expected) {
+		pos, ok := actualByKey[k]
+		switch {
+		case !ok:
+			drift = append(drift, &Drift{Kind: DriftMissing, Expected: expected[i]})
+		case !pos.Size.Equal(expected[i].Size):
+			drift = append(drift, &Drift{Kind: DriftMismatch, Expected: expected[i], Actual: pos})
+		}
+		matched[k] = true
+	}
+	for i, k := range actualKeys {
+		if !matched[k] {
+			drift = append(drift, &Drift{Kind: DriftExtra, Actual: actual[i]})
+		}
+	}
+	return drift
+}
+
+// Timestamp returns the timestamp of the drifted position.
+func (d *Drift) Timestamp() time.Time {
+	if d.Expected != nil {
+		return d.Expected.Timestamp
+	}
+	return d.Actual.Timestamp
+}
+
+// AccountID returns the account of the drifted position.
+func (d *Drift) AccountID() int64 {
+	if d.Expected != nil {
+		return d.Expected.AccountID
+	}
+	return d.Actual.AccountID
+}
@@ -0,0 +1,49 @@
+package position
+
+import (
+	"context"
+	"testing"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	ts := func(sec int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, sec, 0, time.UTC)
+	}
+	expected := []*models.Position{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Timestamp: ts(1)},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(12), Timestamp: ts(1)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(5), Timestamp: ts(2)},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(7), Timestamp: ts(3)},
+	}
+	actual := []*models.Position{
+		{ID: 1, InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Timestamp: ts(1)},
+		{ID: 2, InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(13), Timestamp: ts(1)},
+		{ID: 3, InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(7), Timestamp: ts(3)},
+		{ID: 4, InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(7), Timestamp: ts(4)},
+	}
+	require.Equal(t, []*Drift{
+		{Kind: DriftMismatch, Expected: expected[1], Actual: actual[1]},
+		{Kind: DriftMissing, Expected: expected[2]},
+		{Kind: DriftExtra, Actual: actual[3]},
+	}, Compare(expected, actual))
+	require.Empty(t, Compare(expected, expected))
+}
+
+func TestReplay(t *testing.T) {
+	ts := time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)
+	in := make(chan *models.Trade, 2)
+	in <- &models.Trade{InstrumentID: 1, Size: decimal.NewFromInt(10), Timestamp: ts}
+	in <- &models.Trade{InstrumentID: 1, Size: decimal.NewFromInt(-4), Timestamp: ts}
+	close(in)
+	positions, err := Replay(context.Background(), NewBinnedBuilder(1, 1), in)
+	require.NoError(t, err)
+	require.Equal(t, []*models.Position{
+		{InstrumentID: 1, Size: decimal.NewFromInt(10), Timestamp: ts},
+		{InstrumentID: 1, Size: decimal.NewFromInt(6), Timestamp: ts},
+	}, positions)
+}
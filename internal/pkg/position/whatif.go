@@ -0,0 +1,166 @@
+package position
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"tradetracker/internal/pkg/timeexpr"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// Outcome is the position of an account in an instrument after a sequence of trades,
+// along with its cost basis and profit and loss (PnL), using the average cost method.
+type Outcome struct {
+	Position      *models.Position
+	CostBasis     decimal.Decimal // the average price of the open position, rounded to the price scale
+	RealisedPnL   decimal.Decimal // the PnL of the trades which reduced the position
+	UnrealisedPnL decimal.Decimal // the PnL of the open position, marked at the mark price
+}
+
+// ParseTrade parses a hypothetical trade of the form size@price[@time], where the time is a time expression
+// relative to now, and defaults to now.
+func ParseTrade(s string, instrumentID, accountID int64, now time.Time) (*models.Trade, error) {
+	parts := strings.Split(s, "@")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, errors.Errorf("trade %q must be of the form size@price[@time]", s)
+	}
+	size, err := decimal.Parse(parts[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "parse size failed")
+	}
+	if size.IsZero() {
+		return nil, errors.Errorf("trade %q must have a non-zero size", s)
+	}
+	price, err := decimal.Parse(parts[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "parse price failed")
+	}
+	timestamp := now
+	if len(parts) == 3 {
+		if timestamp, err = timeexpr.ParseAt(parts[2], now, timeexpr.Location()); err != nil {
+			return nil, errors.Wrap(err, "parse time failed")
+		}
+	}
+	return &models.Trade{
+		InstrumentID: instrumentID,
+		AccountID:    accountID,
+		Size:         size,
+		Price:        price,
+		Timestamp:    timestamp,
+	}, nil
+}
+
+// WhatIf simulates the outcome of the hypothetical trades on the position of an account in an instrument
+// without storing anything. The existing trades of the account are replayed through a builder in memory,
+// before and after merging in the hypothetical trades, and both outcomes are marked at the mark price.
+// The replay starts from the seed position of the account, if any, which stands in for its archived trades.
+// The cost of the archived trades is not kept, so the seed position is taken to have been opened at the
+// mark price, and the PnL only covers the trades since the archive.
+func WhatIf(
+	ctx context.Context, instrumentID, accountID int64, seeds []*models.Position, trades, hypothetical []*models.Trade,
+	mark decimal.Decimal,
+) (before, after *Outcome, err error) {
+	var seed *models.Position
+	for _, s := range seeds {
+		if s.InstrumentID == instrumentID && s.AccountID == accountID {
+			seed = s
+		}
+	}
+	if seed != nil {
+		for _, trade := range hypothetical {
+			if !trade.Timestamp.After(seed.Timestamp) {
+				return nil, nil, errors.Errorf(
+					"trade at %s is not after the archived trades, which end at %s",
+					trade.Timestamp.Format(time.RFC3339), seed.Timestamp.Format(time.RFC3339),
+				)
+			}
+		}
+	}
+	var existing []*models.Trade
+	for _, trade := range trades {
+		if trade.AccountID == accountID {
+			existing = append(existing, trade)
+		}
+	}
+	merged := make([]*models.Trade, 0, len(existing)+len(hypothetical))
+	merged = append(merged, existing...)
+	merged = append(merged, hypothetical...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Timestamp.Before(merged[j].Timestamp)
+	})
+	if before, err = simulate(ctx, instrumentID, accountID, seed, existing, mark); err != nil {
+		return nil, nil, errors.Wrap(err, "simulate existing trades failed")
+	}
+	if after, err = simulate(ctx, instrumentID, accountID, seed, merged, mark); err != nil {
+		return nil, nil, errors.Wrap(err, "simulate hypothetical trades failed")
+	}
+	return before, after, nil
+}
+
+// simulate replays the trades, which must be sorted by timestamp, from the seed position, if any, to find the outcome.
+func simulate(
+	ctx context.Context, instrumentID, accountID int64, seed *models.Position, trades []*models.Trade, mark decimal.Decimal,
+) (*Outcome, error) {
+	in := make(chan *models.Trade, len(trades))
+	for _, trade := range trades {
+		in <- trade
+	}
+	close(in)
+	var cfgs []BuilderCfg
+	if seed != nil {
+		cfgs = append(cfgs, WithSeed(seed))
+	}
+	positions, err := Replay(ctx, NewBinnedBuilder(1, instrumentID, cfgs...), in)
+	if err != nil {
+		return nil, errors.Wrap(err, "replay trades failed")
+	}
+	outcome := &Outcome{
+		Position: &models.Position{
+			InstrumentID: instrumentID,
+			AccountID:    accountID,
+		},
+	}
+	size := decimal.Zero
+	if seed != nil {
+		outcome.Position = seed
+		size = seed.Size
+		if !size.IsZero() {
+			outcome.CostBasis = mark
+		}
+	}
+	if len(positions) > 0 {
+		outcome.Position = positions[len(positions)-1]
+	}
+	for _, trade := range trades {
+		switch {
+		case size.IsZero() || size.Sign() == trade.Size.Sign():
+			// the trade opens or increases the position
+			outcome.CostBasis = outcome.CostBasis.Mul(size.Abs()).Add(trade.Price.Mul(trade.Size.Abs())).
+				Div(size.Abs().Add(trade.Size.Abs()), decimal.PriceScale)
+		default:
+			// the trade reduces, closes or reverses the position
+			closed := trade.Size.Abs()
+			if size.Abs().Cmp(closed) < 0 {
+				closed = size.Abs()
+			}
+			pnl := trade.Price.Sub(outcome.CostBasis).Mul(closed)
+			if size.Sign() < 0 {
+				pnl = pnl.Neg()
+			}
+			outcome.RealisedPnL = outcome.RealisedPnL.Add(pnl)
+			if trade.Size.Abs().Cmp(size.Abs()) > 0 {
+				outcome.CostBasis = trade.Price
+			}
+		}
+		size = size.Add(trade.Size)
+		if size.IsZero() {
+			outcome.CostBasis = decimal.Zero
+		}
+	}
+	outcome.UnrealisedPnL = mark.Sub(outcome.CostBasis).Mul(size)
+	return outcome, nil
+}
@@ -0,0 +1,94 @@
+package position
+
+import (
+	"context"
+	"testing"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrade(t *testing.T) {
+	now := time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)
+	trade, err := ParseTrade("-10@101.5", 1, 2, now)
+	require.NoError(t, err)
+	require.Equal(t, &models.Trade{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(-10), Price: decimal.MustParse("101.5"), Timestamp: now}, trade)
+
+	trade, err = ParseTrade("5@99@2022-01-01T12:00:00Z", 1, 2, now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC), trade.Timestamp)
+
+	for _, s := range []string{"10", "0@1", "x@1", "1@x", "1@1@noon"} {
+		_, err := ParseTrade(s, 1, 2, now)
+		require.Error(t, err, s)
+	}
+}
+
+func TestWhatIf(t *testing.T) {
+	ts := func(sec int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, sec, 0, time.UTC)
+	}
+	trades := []*models.Trade{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Price: decimal.NewFromInt(100), Timestamp: ts(1)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(50), Price: decimal.NewFromInt(90), Timestamp: ts(2)},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Price: decimal.NewFromInt(110), Timestamp: ts(3)},
+	}
+	hypothetical := []*models.Trade{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(-25), Price: decimal.NewFromInt(120), Timestamp: ts(4)},
+	}
+	before, after, err := WhatIf(context.Background(), 1, 1, nil, trades, hypothetical, decimal.NewFromInt(120))
+	require.NoError(t, err)
+	require.Equal(t, &Outcome{
+		Position:      &models.Position{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(20), Timestamp: ts(3)},
+		CostBasis:     decimal.NewFromInt(105),
+		UnrealisedPnL: decimal.NewFromInt(300),
+	}, before)
+	require.Equal(t, &Outcome{
+		Position:    &models.Position{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(-5), Timestamp: ts(4)},
+		CostBasis:   decimal.NewFromInt(120),
+		RealisedPnL: decimal.NewFromInt(300),
+	}, after)
+}
+
+func TestWhatIfSeed(t *testing.T) {
+	ts := func(sec int) time.Time {
+		return time.Date(2022, 1, 1, 0, 0, sec, 0, time.UTC)
+	}
+	// the seed stands in for archived trades of account 1 and 2
+	seeds := []*models.Position{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Timestamp: ts(1)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(50), Timestamp: ts(1)},
+	}
+	trades := []*models.Trade{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Price: decimal.NewFromInt(110), Timestamp: ts(3)},
+	}
+	hypothetical := []*models.Trade{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(-25), Price: decimal.NewFromInt(120), Timestamp: ts(4)},
+	}
+	before, after, err := WhatIf(context.Background(), 1, 1, seeds, trades, hypothetical, decimal.NewFromInt(100))
+	require.NoError(t, err)
+	require.Equal(t, &Outcome{
+		Position:      &models.Position{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(20), Timestamp: ts(3)},
+		CostBasis:     decimal.NewFromInt(105),
+		UnrealisedPnL: decimal.NewFromInt(-100),
+	}, before)
+	require.Equal(t, &Outcome{
+		Position:      &models.Position{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(-5), Timestamp: ts(4)},
+		CostBasis:     decimal.NewFromInt(120),
+		RealisedPnL:   decimal.NewFromInt(300),
+		UnrealisedPnL: decimal.NewFromInt(100),
+	}, after)
+
+	// without trades since the archive, the outcome is the seed position
+	before, _, err = WhatIf(context.Background(), 1, 1, seeds, nil, hypothetical, decimal.NewFromInt(100))
+	require.NoError(t, err)
+	require.Equal(t, seeds[0], before.Position)
+	require.Equal(t, decimal.NewFromInt(100), before.CostBasis)
+
+	// hypothetical trades cannot precede the archived trades
+	hypothetical[0].Timestamp = ts(1)
+	_, _, err = WhatIf(context.Background(), 1, 1, seeds, trades, hypothetical, decimal.NewFromInt(100))
+	require.Error(t, err)
+}
@@ -36,47 +36,60 @@ type PublisherSubscriber interface {
 type Handler func(m Message) error
 
 // Message describes the message topic and payload.
+// Offset is the position of the message in the source it was read from, if the source has one,
+// which is committed once the message has been processed so that a restarted consumer resumes after it.
 type Message struct {
-	Topic Topic
-	Value interface{}
+	Topic  Topic
+	Value  interface{}
+	Offset int64
 }
 
 // MemoryPubSub is a simple in-memory PubSub implementation.
 // Note that this naïve implementation only supports one consumer per topic.
 type MemoryPubSub struct {
-	topics map[Topic]chan Message
-	mu     sync.Mutex
+	topics     map[Topic]chan Message
+	subscribed map[Topic]bool
+	closed     map[Topic]bool
+	mu         sync.Mutex
 }
 
 // NewMemoryPubSub creates a new MemoryPubSub.
 func NewMemoryPubSub() *MemoryPubSub {
 	return &MemoryPubSub{
-		topics: make(map[Topic]chan Message),
+		topics:     make(map[Topic]chan Message),
+		subscribed: make(map[Topic]bool),
+		closed:     make(map[Topic]bool),
 	}
 }
 
-// Publish publishes a message on a topic.
-// It returns an error if the topic is closed.
+// Publish publishes a message on a topic, blocking until it is received by the topic's consumer,
+// which may subscribe after it is published. It returns an error if the topic is closed.
 func (s *MemoryPubSub) Publish(msg Message) error {
-	if _, ok := s.topics[msg.Topic]; !ok {
+	s.mu.Lock()
+	if s.closed[msg.Topic] {
+		s.mu.Unlock()
 		return ErrTopicClosed
 	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.topics[msg.Topic] <- msg
+	ch := s.topic(msg.Topic)
+	s.mu.Unlock()
+	ch <- msg
 	return nil
 }
 
 // Subscribe subscribes to messages on a topic.
 // It blocks until the topic is closed or the context is cancelled.
 func (s *MemoryPubSub) Subscribe(ctx context.Context, topic Topic, handler Handler) error {
-	if _, ok := s.topics[topic]; ok {
+	s.mu.Lock()
+	if s.subscribed[topic] {
+		s.mu.Unlock()
 		return ErrTopicAlreadySubscribed
 	}
-	s.topics[topic] = make(chan Message)
+	s.subscribed[topic] = true
+	ch := s.topic(topic)
+	s.mu.Unlock()
 	for {
 		select {
-		case c, ok := <-s.topics[topic]:
+		case c, ok := <-ch:
 			if !ok {
 				return nil
 			}
@@ -89,13 +102,25 @@ func (s *MemoryPubSub) Subscribe(ctx context.Context, topic Topic, handler Handl
 	}
 }
 
-// Close closes the topic.
+// Close closes the topic, once the messages published on it have been received.
+// It must not be called while a message is being published on the topic.
 func (s *MemoryPubSub) Close(_ context.Context, topic Topic) error {
-	if _, ok := s.topics[topic]; !ok {
-		return ErrTopicClosed
-	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	close(s.topics[topic])
+	if s.closed[topic] {
+		return ErrTopicClosed
+	}
+	s.closed[topic] = true
+	close(s.topic(topic))
 	return nil
 }
+
+// topic returns the channel of the topic, creating it if need be. The caller must hold the lock.
+func (s *MemoryPubSub) topic(topic Topic) chan Message {
+	ch, ok := s.topics[topic]
+	if !ok {
+		ch = make(chan Message)
+		s.topics[topic] = ch
+	}
+	return ch
+}
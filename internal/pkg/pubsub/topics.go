@@ -5,3 +5,6 @@ type Topic string
 
 // TradeTopic is the topic for trade messages.
 var TradeTopic = Topic("trade")
+
+// LateTradeTopic is the topic for trade messages which arrived too late to be processed in order.
+var LateTradeTopic = Topic("late_trade")
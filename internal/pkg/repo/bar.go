@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"context"
+	"time"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// BarRepo is used to perform CRUD operations on bar records in the database.
+//go:generate mockery --name BarRepo --filename bar_repo_mock.go
+type BarRepo interface {
+	CreateBar(ctx context.Context, bar *models.Bar) (int, error)
+	ReadBars(ctx context.Context, instrumentID, intervalSeconds int64, from, to time.Time) ([]*models.Bar, error)
+	DeleteBars(ctx context.Context, instrumentID, intervalSeconds int64) (int64, error)
+}
+
+// CreateBar creates a new bar.
+func (r *Repo) CreateBar(ctx context.Context, bar *models.Bar) (int, error) {
+	var txID int
+	if err := r.db.QueryRowContext(ctx,
+		r.queries[createBar],
+		bar.InstrumentID, bar.IntervalSeconds,
+		bar.Open, bar.High, bar.Low, bar.Close,
+		bar.Volume, bar.VWAP, bar.TradeCount,
+		bar.Timestamp.UTC(),
+	).Scan(&txID); err != nil {
+		return 0, errors.Wrap(err, "could not create bar")
+	}
+	return txID, nil
+}
+
+// ReadBars reads the bars of the given interval for an instrument which start in the range [from, to).
+func (r *Repo) ReadBars(ctx context.Context, instrumentID, intervalSeconds int64, from, to time.Time) ([]*models.Bar, error) {
+	rows, err := r.db.QueryContext(ctx,
+		r.queries[readBars],
+		instrumentID, intervalSeconds, from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read bars")
+	}
+	defer rows.Close()
+	var bars []*models.Bar
+	for rows.Next() {
+		var bar models.Bar
+		if err := rows.Scan(
+			&bar.ID,
+			&bar.InstrumentID,
+			&bar.IntervalSeconds,
+			&bar.Open,
+			&bar.High,
+			&bar.Low,
+			&bar.Close,
+			&bar.Volume,
+			&bar.VWAP,
+			&bar.TradeCount,
+			utc(&bar.Timestamp),
+		); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		bars = append(bars, &bar)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return bars, nil
+}
+
+// DeleteBars deletes all bars of the given interval for an instrument.
+func (r *Repo) DeleteBars(ctx context.Context, instrumentID, intervalSeconds int64) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		r.queries[deleteBars],
+		instrumentID, intervalSeconds,
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not delete bars")
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get number of deleted bars")
+	}
+	return n, nil
+}
@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateBar(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	bar := &models.Bar{
+		InstrumentID:    1,
+		IntervalSeconds: 60,
+		Open:            decimal.NewFromInt(10),
+		High:            decimal.NewFromInt(12),
+		Low:             decimal.NewFromInt(9),
+		Close:           decimal.NewFromInt(11),
+		Volume:          decimal.NewFromInt(30),
+		VWAP:            decimal.MustParse("10.5"),
+		TradeCount:      3,
+		Timestamp:       time.Date(2022, time.May, 1, 2, 3, 0, 0, time.UTC),
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[createBar],
+	)).WithArgs(
+		bar.InstrumentID, bar.IntervalSeconds,
+		bar.Open, bar.High, bar.Low, bar.Close,
+		bar.Volume, bar.VWAP, bar.TradeCount,
+		bar.Timestamp.UTC(),
+	).WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1),
+	)
+
+	id, err := r.CreateBar(context.Background(), bar)
+	require.NoError(t, err)
+	require.Equal(t, 1, id)
+}
+
+func TestReadBars(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	from := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, time.May, 2, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[readBars],
+	)).WithArgs(int64(1), int64(60), from.UTC(), to.UTC()).WillReturnRows(
+		sqlmock.NewRows([]string{
+			"id", "instrument_id", "interval_seconds", "open", "high", "low", "close", "volume", "vwap", "trade_count", "timestamp",
+		}).
+			AddRow(1, 1, 60, 10.0, 12.0, 9.0, 11.0, 30, 10.5, 3, from).
+			AddRow(2, 1, 60, 11.0, 11.0, 11.0, 11.0, 5, 11.0, 1, from.Add(time.Minute)),
+	)
+
+	bars, err := r.ReadBars(context.Background(), 1, 60, from, to)
+	require.NoError(t, err)
+	require.Len(t, bars, 2)
+	require.Equal(t, decimal.NewFromInt(30), bars[0].Volume)
+	require.Equal(t, from.Add(time.Minute), bars[1].Timestamp)
+}
@@ -13,3 +13,13 @@ func WithDB(db *sql.DB) ConfigFunc {
 		r.db = db
 	}
 }
+
+// FileConfigFunc is used to configure a FileRepo.
+type FileConfigFunc func(*FileRepo)
+
+// WithSegmentSize sets the size in bytes a segment file grows to before a new segment is started.
+func WithSegmentSize(size int64) FileConfigFunc {
+	return func(r *FileRepo) {
+		r.segmentSize = size
+	}
+}
@@ -0,0 +1,413 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sync"
+	"testing"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+// conformanceRepo is implemented by every repo which stores trades, positions and portfolios.
+type conformanceRepo interface {
+	TradeRepo
+	PositionRepo
+	PortfolioRepo
+}
+
+// testConformance runs the tests which every implementation of the trade, position and portfolio repos must pass,
+// given a function which creates a new, empty repo for each test.
+func testConformance(t *testing.T, newRepo func(t *testing.T) conformanceRepo) {
+	t.Run("Trades", func(t *testing.T) {
+		t.Parallel()
+		testConformanceTrades(t, newRepo(t))
+	})
+	t.Run("ListTrades", func(t *testing.T) {
+		t.Parallel()
+		testConformanceListTrades(t, newRepo(t))
+	})
+	t.Run("Positions", func(t *testing.T) {
+		t.Parallel()
+		testConformancePositions(t, newRepo(t))
+	})
+	t.Run("AsOf", func(t *testing.T) {
+		t.Parallel()
+		testConformanceAsOf(t, newRepo(t))
+	})
+	t.Run("Quantities", func(t *testing.T) {
+		t.Parallel()
+		testConformanceQuantities(t, newRepo(t))
+	})
+	t.Run("Concurrency", func(t *testing.T) {
+		t.Parallel()
+		testConformanceConcurrency(t, newRepo(t))
+	})
+}
+
+// conformanceTime returns a time on a fixed day, with a sub-microsecond part which is not stored.
+func conformanceTime(sec int) time.Time {
+	return time.Date(2022, time.May, 1, 0, 0, sec, 500, time.UTC)
+}
+
+func createTrades(t *testing.T, r conformanceRepo, trades ...*models.Trade) {
+	t.Helper()
+	for i, trade := range trades {
+		id, err := r.CreateTrade(context.Background(), trade)
+		require.NoError(t, err)
+		trade.ID = int64(id)
+		trade.Timestamp = trade.Timestamp.UTC().Truncate(TimestampPrecision)
+		require.NotZero(t, id, "trade %d", i)
+	}
+}
+
+func createPositions(t *testing.T, r conformanceRepo, positions ...*models.Position) {
+	t.Helper()
+	for i, position := range positions {
+		id, err := r.CreatePosition(context.Background(), position)
+		require.NoError(t, err)
+		position.ID = int64(id)
+		position.Timestamp = position.Timestamp.UTC().Truncate(TimestampPrecision)
+		require.NotZero(t, id, "position %d", i)
+	}
+}
+
+func testConformanceTrades(t *testing.T, r conformanceRepo) {
+	ctx := context.Background()
+	// prices are stored exactly, keeping their scale
+	trades := []*models.Trade{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Price: decimal.MustParse("100.50"), Timestamp: conformanceTime(3)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(-5), Price: decimal.NewFromInt(101), Timestamp: conformanceTime(1)},
+		{InstrumentID: 2, AccountID: 1, Size: decimal.NewFromInt(7), Price: decimal.NewFromInt(50), Timestamp: conformanceTime(2)},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(3), Price: decimal.MustParse("99.123456789012345678"), Timestamp: conformanceTime(1)},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(98), Timestamp: conformanceTime(0)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(2), Price: decimal.NewFromInt(99), Timestamp: conformanceTime(1).Add(250 * time.Microsecond)},
+	}
+	createTrades(t, r, trades...)
+
+	// trades are read after the given time, ordered by timestamp to the microsecond and then ID
+	read := func(after time.Time) []*models.Trade {
+		t.Helper()
+		ch, err := r.ReadTrades(ctx, 1, after)
+		require.NoError(t, err)
+		var read []*models.Trade
+		for trade := range ch {
+			read = append(read, trade)
+		}
+		return read
+	}
+	require.Equal(t, []*models.Trade{trades[1], trades[3], trades[5], trades[0]}, read(conformanceTime(0)))
+	require.Equal(t, []*models.Trade{trades[5], trades[0]}, read(conformanceTime(1)))
+
+	// a trade with the same ref and timestamp as a stored trade is not stored again
+	ref := &models.Trade{InstrumentID: 2, AccountID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(50), Timestamp: conformanceTime(4), Ref: "trades.jsonl:0"}
+	createTrades(t, r, ref)
+	_, err := r.CreateTrade(ctx, &models.Trade{InstrumentID: 2, AccountID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(50), Timestamp: conformanceTime(4), Ref: ref.Ref})
+	require.ErrorIs(t, err, ErrDuplicateTrade)
+	createTrades(t, r, &models.Trade{InstrumentID: 2, AccountID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(50), Timestamp: conformanceTime(5), Ref: ref.Ref})
+
+	ids, err := r.ReadInstrumentIDs(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 2}, ids)
+}
+
+func testConformanceListTrades(t *testing.T, r conformanceRepo) {
+	ctx := context.Background()
+	trades := []*models.Trade{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Price: decimal.NewFromInt(100), Timestamp: conformanceTime(1)},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(-20), Price: decimal.NewFromInt(110), Timestamp: conformanceTime(2)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(2), Price: decimal.NewFromInt(120), Timestamp: conformanceTime(2)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(30), Price: decimal.NewFromInt(130), Timestamp: conformanceTime(3)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(40), Price: decimal.NewFromInt(140), Timestamp: conformanceTime(4)},
+		{InstrumentID: 2, AccountID: 1, Size: decimal.NewFromInt(50), Price: decimal.NewFromInt(100), Timestamp: conformanceTime(2)},
+	}
+	createTrades(t, r, trades...)
+	list := func(filter TradeFilter) []int64 {
+		t.Helper()
+		filter.InstrumentID = 1
+		if filter.To.IsZero() {
+			filter.To = conformanceTime(60)
+		}
+		listed, err := r.ListTrades(ctx, filter)
+		require.NoError(t, err)
+		var ids []int64
+		for _, trade := range listed {
+			require.NotEmpty(t, trade.CreatedAt)
+			ids = append(ids, trade.ID)
+		}
+		return ids
+	}
+	id := func(i int) int64 {
+		return trades[i].ID
+	}
+	minPrice, maxPrice := decimal.NewFromInt(110), decimal.NewFromInt(130)
+
+	require.Equal(t, []int64{id(0), id(1), id(2), id(3), id(4)}, list(TradeFilter{}))
+	require.Equal(t, []int64{id(1), id(2)}, list(TradeFilter{From: conformanceTime(2), To: conformanceTime(3)}))
+	require.Equal(t, []int64{id(0), id(1), id(3), id(4)}, list(TradeFilter{MinSize: decimal.NewFromInt(10)}))
+	require.Equal(t, []int64{id(1), id(2), id(3)}, list(TradeFilter{MinPrice: &minPrice, MaxPrice: &maxPrice}))
+	// pages follow on from the last trade of the previous page, including trades at the same time
+	require.Equal(t, []int64{id(0), id(1)}, list(TradeFilter{Limit: 2}))
+	require.Equal(t, []int64{id(2), id(3)}, list(TradeFilter{AfterID: id(1), Limit: 2}))
+	require.Equal(t, []int64{id(4)}, list(TradeFilter{AfterID: id(3), Limit: 2}))
+	require.Empty(t, list(TradeFilter{AfterID: id(4), Limit: 2}))
+	// a cursor which is not a trade in the instrument is an error, rather than an empty page
+	for _, afterID := range []int64{trades[5].ID, id(4) + 100} {
+		_, err := r.ListTrades(ctx, TradeFilter{InstrumentID: 1, To: conformanceTime(60), AfterID: afterID})
+		require.ErrorIs(t, err, ErrUnknownCursor)
+	}
+}
+
+func testConformancePositions(t *testing.T, r conformanceRepo) {
+	ctx := context.Background()
+	trades := []*models.Trade{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Price: decimal.NewFromInt(100), Timestamp: conformanceTime(1)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(5), Price: decimal.NewFromInt(100), Timestamp: conformanceTime(2)},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(-4), Price: decimal.NewFromInt(100), Timestamp: conformanceTime(3)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(-5), Price: decimal.NewFromInt(100), Timestamp: conformanceTime(4)},
+	}
+	createTrades(t, r, trades...)
+	positions := []*models.Position{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Timestamp: conformanceTime(1), TradeIDs: []int64{trades[0].ID}},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(5), Timestamp: conformanceTime(2), TradeIDs: []int64{trades[1].ID}},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(6), Timestamp: conformanceTime(3), TradeIDs: []int64{trades[2].ID}},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(0), Timestamp: conformanceTime(4), TradeIDs: []int64{trades[3].ID}},
+		{InstrumentID: 2, AccountID: 2, Size: decimal.NewFromInt(-3), Timestamp: conformanceTime(2)},
+	}
+	createPositions(t, r, positions...)
+
+	// accounts 1 and 2 are in a portfolio and its child respectively, and account 3 is in neither
+	parentID, err := r.CreatePortfolio(ctx, &models.Portfolio{Name: "parent"})
+	require.NoError(t, err)
+	childID, err := r.CreatePortfolio(ctx, &models.Portfolio{Name: "child", ParentID: int64(parentID)})
+	require.NoError(t, err)
+	otherID, err := r.CreatePortfolio(ctx, &models.Portfolio{Name: "other"})
+	require.NoError(t, err)
+	require.NoError(t, r.AddPortfolioAccounts(ctx, int64(parentID), []int64{1}))
+	require.NoError(t, r.AddPortfolioAccounts(ctx, int64(childID), []int64{2, 2}))
+	require.NoError(t, r.AddPortfolioAccounts(ctx, int64(otherID), []int64{3}))
+	portfolios, err := r.ReadPortfolios(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []*models.Portfolio{
+		{ID: int64(parentID), Name: "parent", AccountIDs: []int64{1}},
+		{ID: int64(childID), Name: "child", ParentID: int64(parentID), AccountIDs: []int64{2}},
+		{ID: int64(otherID), Name: "other", AccountIDs: []int64{3}},
+	}, portfolios)
+
+	pos, err := r.ReadPosition(ctx, 1, 1, conformanceTime(2), time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, positions[0], pos)
+	_, err = r.ReadPosition(ctx, 1, 1, conformanceTime(0), time.Time{})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	accountPositions, err := r.ReadAccountPositions(ctx, 1, conformanceTime(3))
+	require.NoError(t, err)
+	require.Len(t, accountPositions, 2)
+	require.Equal(t, positions[2].ID, accountPositions[0].ID)
+	require.Equal(t, positions[1].ID, accountPositions[1].ID)
+
+	for _, tc := range []struct {
+		portfolioID int64
+		timestamp   time.Time
+		size        int64
+		latest      time.Time
+	}{
+		{0, conformanceTime(3), 11, positions[2].Timestamp},
+		{int64(parentID), conformanceTime(3), 11, positions[2].Timestamp},
+		{int64(childID), conformanceTime(3), 5, positions[1].Timestamp},
+		{int64(otherID), conformanceTime(3), 0, time.Time{}},
+		{0, conformanceTime(0), 0, time.Time{}},
+	} {
+		pos, err := r.ReadPortfolioPosition(ctx, 1, tc.portfolioID, tc.timestamp, time.Time{})
+		require.NoError(t, err)
+		require.Equal(t, decimal.NewFromInt(tc.size), pos.Size, "portfolio %d", tc.portfolioID)
+		require.True(t, tc.latest.Equal(pos.Timestamp), "portfolio %d", tc.portfolioID)
+	}
+
+	snapshot, err := r.ReadSnapshot(ctx, nil, 0, conformanceTime(4), false)
+	require.NoError(t, err)
+	require.Equal(t, []*models.Position{
+		{InstrumentID: 1, Size: decimal.NewFromInt(6), Timestamp: positions[3].Timestamp},
+		{InstrumentID: 2, Size: decimal.NewFromInt(-3), Timestamp: positions[4].Timestamp},
+	}, snapshot)
+	accountID := int64(2)
+	snapshot, err = r.ReadSnapshot(ctx, &accountID, 0, conformanceTime(4), true)
+	require.NoError(t, err)
+	require.Equal(t, []*models.Position{
+		{InstrumentID: 2, AccountID: 2, Size: decimal.NewFromInt(-3), Timestamp: positions[4].Timestamp},
+	}, snapshot)
+	snapshot, err = r.ReadSnapshot(ctx, nil, int64(childID), conformanceTime(4), true)
+	require.NoError(t, err)
+	require.Equal(t, []*models.Position{
+		{InstrumentID: 2, Size: decimal.NewFromInt(-3), Timestamp: positions[4].Timestamp},
+	}, snapshot)
+
+	// the history aggregates the change in position of every account at each time
+	ch, err := r.ReadPositionHistory(ctx, 1, nil, 0, conformanceTime(2), conformanceTime(4))
+	require.NoError(t, err)
+	var history []*models.Position
+	for pos := range ch {
+		history = append(history, pos)
+	}
+	require.Equal(t, []*models.Position{
+		{InstrumentID: 1, Size: decimal.NewFromInt(15), Timestamp: positions[1].Timestamp},
+		{InstrumentID: 1, Size: decimal.NewFromInt(11), Timestamp: positions[2].Timestamp},
+	}, history)
+	ch, err = r.ReadPositionHistory(ctx, 1, &accountID, int64(childID), time.Time{}, conformanceTime(60))
+	require.NoError(t, err)
+	history = nil
+	for pos := range ch {
+		history = append(history, pos)
+	}
+	require.Equal(t, []*models.Position{
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(5), Timestamp: positions[1].Timestamp},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(0), Timestamp: positions[3].Timestamp},
+	}, history)
+
+	read, err := r.ReadPositions(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, positions[:4], read)
+
+	positionTrades, err := r.ReadPositionTrades(ctx, 1, nil, int64(parentID), conformanceTime(3))
+	require.NoError(t, err)
+	require.Len(t, positionTrades, 3)
+	for i, trade := range []*models.Trade{trades[0], trades[1], trades[2]} {
+		require.Equal(t, trade.ID, positionTrades[i].ID)
+		require.Equal(t, trade.Size, positionTrades[i].Size)
+		require.NotEmpty(t, positionTrades[i].CreatedAt)
+	}
+	positionTrades, err = r.ReadPositionTrades(ctx, 1, &accountID, 0, conformanceTime(60))
+	require.NoError(t, err)
+	require.Len(t, positionTrades, 2)
+	require.Equal(t, trades[1].ID, positionTrades[0].ID)
+	require.Equal(t, trades[3].ID, positionTrades[1].ID)
+}
+
+func testConformanceAsOf(t *testing.T, r conformanceRepo) {
+	ctx := context.Background()
+	generation := func(size int64) []*models.Position {
+		return []*models.Position{
+			{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(size), Timestamp: conformanceTime(1)},
+			{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(2 * size), Timestamp: conformanceTime(2)},
+		}
+	}
+	first := generation(10)
+	createPositions(t, r, first...)
+	// as-of times are to the microsecond, so wait until the first generation was created strictly earlier
+	time.Sleep(time.Millisecond)
+	asOf := time.Now()
+	n, err := r.SupersedePositionsFrom(ctx, 1, conformanceTime(2))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	n, err = r.SupersedePositions(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	second := generation(20)
+	createPositions(t, r, second...)
+
+	pos, err := r.ReadPosition(ctx, 1, 1, conformanceTime(2), time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, second[1], pos)
+	pos, err = r.ReadPosition(ctx, 1, 1, conformanceTime(2), asOf)
+	require.NoError(t, err)
+	require.Equal(t, first[1], pos)
+	_, err = r.ReadPosition(ctx, 1, 1, conformanceTime(2), asOf.Add(-time.Hour))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	pos, err = r.ReadPortfolioPosition(ctx, 1, 0, conformanceTime(2), asOf)
+	require.NoError(t, err)
+	require.Equal(t, first[1].Size, pos.Size)
+	pos, err = r.ReadPortfolioPosition(ctx, 1, 0, conformanceTime(2), time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, second[1].Size, pos.Size)
+
+	read, err := r.ReadPositions(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, second, read)
+}
+
+func testConformanceQuantities(t *testing.T, r conformanceRepo) {
+	ctx := context.Background()
+	// sizes are stored exactly, keeping their scale, including fractional sizes and sizes beyond 32 bits
+	trades := []*models.Trade{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.MustParse("0.00012345"), Price: decimal.NewFromInt(30000), Timestamp: conformanceTime(1)},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.MustParse("-1.50"), Price: decimal.NewFromInt(30100), Timestamp: conformanceTime(2)},
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(5000000000), Price: decimal.NewFromInt(1), Timestamp: conformanceTime(3)},
+	}
+	createTrades(t, r, trades...)
+	ch, err := r.ReadTrades(ctx, 1, conformanceTime(0))
+	require.NoError(t, err)
+	var read []*models.Trade
+	for trade := range ch {
+		read = append(read, trade)
+	}
+	require.Equal(t, trades, read)
+
+	listed, err := r.ListTrades(ctx, TradeFilter{InstrumentID: 1, To: conformanceTime(60), MinSize: decimal.MustParse("1.5")})
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+	require.Equal(t, trades[1].ID, listed[0].ID)
+	require.Equal(t, trades[2].ID, listed[1].ID)
+
+	createPositions(t, r,
+		&models.Position{InstrumentID: 1, AccountID: 1, Size: decimal.MustParse("0.00012345"), Timestamp: conformanceTime(1)},
+		&models.Position{InstrumentID: 1, AccountID: 2, Size: decimal.MustParse("-1.50"), Timestamp: conformanceTime(2)},
+	)
+	pos, err := r.ReadPortfolioPosition(ctx, 1, 0, conformanceTime(2), time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, "-1.49987655", pos.Size.String())
+
+	// instrument IDs beyond 32 bits are stored for trades and positions
+	const bigInstrumentID = int64(math.MaxInt32) + 10
+	bigTrade := &models.Trade{InstrumentID: bigInstrumentID, AccountID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(1), Timestamp: conformanceTime(1)}
+	createTrades(t, r, bigTrade)
+	ch, err = r.ReadTrades(ctx, bigInstrumentID, time.Time{})
+	require.NoError(t, err)
+	read = nil
+	for trade := range ch {
+		read = append(read, trade)
+	}
+	require.Equal(t, []*models.Trade{bigTrade}, read)
+	createPositions(t, r, &models.Position{InstrumentID: bigInstrumentID, AccountID: 1, Size: decimal.NewFromInt(1), Timestamp: conformanceTime(1)})
+	pos, err = r.ReadPosition(ctx, bigInstrumentID, 1, conformanceTime(1), time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, bigInstrumentID, pos.InstrumentID)
+}
+
+func testConformanceConcurrency(t *testing.T, r conformanceRepo) {
+	ctx := context.Background()
+	const n = 50
+	ids := make(chan int, 2*n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			id, err := r.CreateTrade(ctx, &models.Trade{InstrumentID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(1), Timestamp: conformanceTime(i)})
+			require.NoError(t, err)
+			ids <- id
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			_, err := r.CreatePosition(ctx, &models.Position{InstrumentID: 1, Size: decimal.NewFromInt(int64(i)), Timestamp: conformanceTime(i)})
+			require.NoError(t, err)
+			_, err = r.ReadSnapshot(ctx, nil, 0, conformanceTime(i), false)
+			require.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+	seen := make(map[int]bool)
+	for id := range ids {
+		require.False(t, seen[id], "duplicate trade ID %d", id)
+		seen[id] = true
+	}
+	require.Len(t, seen, n)
+	positions, err := r.ReadPositions(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, positions, n)
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// lockDir takes an exclusive lock on the lock file in the directory, creating them if necessary,
+// or returns an error wrapping ErrDirLocked if another process holds it. The lock is released by
+// the returned function, or by the operating system if the process exits without releasing it.
+func lockDir(dir string) (func() error, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "could not create directory")
+	}
+	f, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open lock file")
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errors.Wrapf(ErrDirLocked, "directory %s", dir)
+		}
+		return nil, errors.Wrap(err, "could not lock directory")
+	}
+	return f.Close, nil
+}
@@ -0,0 +1,31 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// lockDir creates the lock file in the directory, creating the directory if necessary, or returns an error
+// wrapping ErrDirLocked if it already exists. The lock is released by the returned function, which removes
+// the lock file. If the process exits without releasing it, the lock file must be removed by hand.
+func lockDir(dir string) (func() error, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "could not create directory")
+	}
+	path := filepath.Join(dir, lockFile)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if os.IsExist(err) {
+		return nil, errors.Wrapf(ErrDirLocked, "directory %s", dir)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create lock file")
+	}
+	return func() error {
+		if err := f.Close(); err != nil {
+			return err
+		}
+		return os.Remove(path)
+	}, nil
+}
@@ -0,0 +1,526 @@
+package repo
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// These check that the FileRepo can be used wherever the Repo is used for trades, positions and portfolios.
+var (
+	_ TradeRepo     = (*FileRepo)(nil)
+	_ PositionRepo  = (*FileRepo)(nil)
+	_ PortfolioRepo = (*FileRepo)(nil)
+)
+
+// FileRepo stores trades, positions and portfolios as events in append-only logs on the local file system,
+// with the same semantics as the Repo. Each instrument has its own log of trades and positions, and portfolios
+// are kept in a separate log. Every write is synced to disk before it is applied.
+//
+// The trades, current positions and portfolios are replayed into memory when the repo is opened, which serves
+// most reads. Superseded positions are only kept on disk: reading a position as known at an earlier time replays
+// the log of the instrument up to that time, which a sparse index of the times events were recorded at bounds.
+// Compact drops positions which were superseded long enough ago to no longer be of interest.
+//
+// It is safe for concurrent use within a process, but only one process may open the directory at a time,
+// which is enforced by holding a lock on a file in it while the repo is open.
+type FileRepo struct {
+	mu             sync.Mutex // serialises writes and reads of the logs
+	dir            string
+	unlock         func() error // releases the lock on the directory
+	segmentSize    int64
+	view           *MemoryRepo
+	instruments    map[int64]*segmentLog
+	portfolios     *segmentLog
+	lastRecordedAt int64
+}
+
+// lockFile is the name of the file in the directory of a FileRepo which is locked while it is open.
+const lockFile = "LOCK"
+
+// ErrDirLocked indicates that the directory of a FileRepo is already open in another process.
+var ErrDirLocked = errors.New("directory is in use by another process")
+
+// OpenFileRepo opens the FileRepo in the directory, creating it if necessary, and replays its logs.
+// It returns an error wrapping ErrDirLocked if the directory is already open.
+func OpenFileRepo(dir string, cfgs ...FileConfigFunc) (*FileRepo, error) {
+	r := &FileRepo{
+		dir:         dir,
+		segmentSize: defaultSegmentSize,
+		view:        NewMemoryRepo(),
+		instruments: make(map[int64]*segmentLog),
+	}
+	for _, cfg := range cfgs {
+		cfg(r)
+	}
+	var err error
+	if r.unlock, err = lockDir(dir); err != nil {
+		return nil, err
+	}
+	if r.portfolios, err = openSegmentLog(filepath.Join(dir, "portfolios"), r.segmentSize, r.replay); err != nil {
+		_ = r.Close()
+		return nil, errors.Wrap(err, "could not open portfolio log")
+	}
+	instrumentIDs, err := r.instrumentIDs()
+	if err != nil {
+		_ = r.Close()
+		return nil, errors.Wrap(err, "could not read instrument logs")
+	}
+	for _, instrumentID := range instrumentIDs {
+		log, err := openSegmentLog(r.instrumentDir(instrumentID), r.segmentSize, r.replay)
+		if err != nil {
+			_ = r.Close()
+			return nil, errors.Wrapf(err, "could not open log of instrument %d", instrumentID)
+		}
+		r.instruments[instrumentID] = log
+	}
+	r.view.sortByID()
+	r.view.pruneSuperseded()
+	return r, nil
+}
+
+// Close closes the logs of the repo and releases the lock on its directory. Closing it again does nothing.
+func (r *FileRepo) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	if r.portfolios != nil {
+		err = r.portfolios.close()
+		r.portfolios = nil
+	}
+	for instrumentID, log := range r.instruments {
+		if closeErr := log.close(); err == nil {
+			err = closeErr
+		}
+		delete(r.instruments, instrumentID)
+	}
+	if r.unlock != nil {
+		if unlockErr := r.unlock(); err == nil {
+			err = unlockErr
+		}
+		r.unlock = nil
+	}
+	return errors.Wrap(err, "could not close repo")
+}
+
+// CreateTrade creates a new trade, or returns an error wrapping ErrDuplicateTrade if one with the same ref
+// and timestamp has already been stored.
+func (r *FileRepo) CreateTrade(ctx context.Context, trade *models.Trade) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	tr := *trade
+	tr.ID = r.view.lastTradeID + 1
+	tr.CreatedAt = now.Format(time.RFC3339Nano)
+	tr.Timestamp = truncateTimestamp(trade.Timestamp)
+	r.view.mu.RLock()
+	duplicate := r.view.hasTrade(&tr)
+	r.view.mu.RUnlock()
+	if duplicate {
+		return 0, errors.Wrapf(ErrDuplicateTrade, "ref %q", tr.Ref)
+	}
+	e := &fileEvent{Type: tradeEvent, RecordedAt: now.UnixNano(), Trade: &tr}
+	if err := r.write(tr.InstrumentID, e); err != nil {
+		return 0, errors.Wrap(err, "could not create trade")
+	}
+	return int(tr.ID), nil
+}
+
+// ReadTrades reads trades after the given time and sends them on the returned channel,
+// ordered by timestamp and then ID.
+func (r *FileRepo) ReadTrades(ctx context.Context, instrumentID int64, after time.Time) (<-chan *models.Trade, error) {
+	return r.view.ReadTrades(ctx, instrumentID, after)
+}
+
+// ListTrades lists the trades matching the filter, ordered by timestamp and then ID,
+// or returns an error wrapping ErrUnknownCursor if the trade to list after does not exist.
+func (r *FileRepo) ListTrades(ctx context.Context, filter TradeFilter) ([]*models.Trade, error) {
+	return r.view.ListTrades(ctx, filter)
+}
+
+// CreatePosition creates a new position.
+func (r *FileRepo) CreatePosition(ctx context.Context, position *models.Position) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	pos := *position
+	pos.ID = r.view.lastPositionID + 1
+	pos.CreatedAt = ""
+	pos.Timestamp = truncateTimestamp(position.Timestamp)
+	e := &fileEvent{Type: positionEvent, RecordedAt: now.UnixNano(), Position: &pos}
+	if err := r.write(pos.InstrumentID, e); err != nil {
+		return 0, errors.Wrap(err, "could not create position")
+	}
+	return int(pos.ID), nil
+}
+
+// ReadPosition reads the position of an account in an instrument at a given time,
+// as known at the asOf time, or as currently known if asOf is zero.
+func (r *FileRepo) ReadPosition(ctx context.Context, instrumentID, accountID int64, timestamp, asOf time.Time) (*models.Position, error) {
+	if asOf.IsZero() {
+		return r.view.ReadPosition(ctx, instrumentID, accountID, timestamp, asOf)
+	}
+	view, err := r.viewAsOf(ctx, instrumentID, asOf)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read position")
+	}
+	return view.ReadPosition(ctx, instrumentID, accountID, timestamp, time.Time{})
+}
+
+// ReadAccountPositions reads the position of every account in an instrument at a given time.
+func (r *FileRepo) ReadAccountPositions(ctx context.Context, instrumentID int64, timestamp time.Time) ([]*models.Position, error) {
+	return r.view.ReadAccountPositions(ctx, instrumentID, timestamp)
+}
+
+// ReadPortfolioPosition reads the position in an instrument at a given time aggregated over every
+// account in the portfolio and its descendants, or over all accounts if the portfolio ID is zero.
+// The position is as known at the asOf time, or as currently known if asOf is zero.
+func (r *FileRepo) ReadPortfolioPosition(ctx context.Context, instrumentID, portfolioID int64, timestamp, asOf time.Time) (*models.Position, error) {
+	if asOf.IsZero() {
+		return r.view.ReadPortfolioPosition(ctx, instrumentID, portfolioID, timestamp, asOf)
+	}
+	view, err := r.viewAsOf(ctx, instrumentID, asOf)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read portfolio position")
+	}
+	return view.ReadPortfolioPosition(ctx, instrumentID, portfolioID, timestamp, time.Time{})
+}
+
+// ReadPositionHistory reads every change in position within [from, to) and sends them on the returned channel
+// in time order.
+func (r *FileRepo) ReadPositionHistory(
+	ctx context.Context, instrumentID int64, accountID *int64, portfolioID int64, from, to time.Time,
+) (<-chan *models.Position, error) {
+	return r.view.ReadPositionHistory(ctx, instrumentID, accountID, portfolioID, from, to)
+}
+
+// ReadSnapshot reads the position in every instrument at the given timestamp, ordered by instrument ID.
+func (r *FileRepo) ReadSnapshot(
+	ctx context.Context, accountID *int64, portfolioID int64, timestamp time.Time, excludeFlat bool,
+) ([]*models.Position, error) {
+	return r.view.ReadSnapshot(ctx, accountID, portfolioID, timestamp, excludeFlat)
+}
+
+// ReadPositions reads every current position for an instrument, ordered by timestamp and then ID.
+func (r *FileRepo) ReadPositions(ctx context.Context, instrumentID int64) ([]*models.Position, error) {
+	return r.view.ReadPositions(ctx, instrumentID)
+}
+
+// ReadInstrumentIDs reads the IDs of every instrument with trades or current positions.
+func (r *FileRepo) ReadInstrumentIDs(ctx context.Context) ([]int64, error) {
+	return r.view.ReadInstrumentIDs(ctx)
+}
+
+// ReadPositionTrades reads the trades which contributed to the current positions in an instrument up to
+// the given time, ordered by timestamp and then ID.
+func (r *FileRepo) ReadPositionTrades(
+	ctx context.Context, instrumentID int64, accountID *int64, portfolioID int64, timestamp time.Time,
+) ([]*models.Trade, error) {
+	return r.view.ReadPositionTrades(ctx, instrumentID, accountID, portfolioID, timestamp)
+}
+
+// SupersedePositions supersedes all current positions for an instrument.
+func (r *FileRepo) SupersedePositions(ctx context.Context, instrumentID int64) (int64, error) {
+	n, err := r.supersede(supersession{InstrumentID: instrumentID})
+	return n, errors.Wrap(err, "could not supersede positions")
+}
+
+// SupersedePositionsFrom supersedes all current positions for an instrument at or after the given time.
+func (r *FileRepo) SupersedePositionsFrom(ctx context.Context, instrumentID int64, from time.Time) (int64, error) {
+	from = truncateTimestamp(from)
+	n, err := r.supersede(supersession{InstrumentID: instrumentID, From: &from})
+	return n, errors.Wrap(err, "could not supersede positions")
+}
+
+// CreatePortfolio creates a new portfolio, optionally nested under a parent portfolio.
+func (r *FileRepo) CreatePortfolio(ctx context.Context, portfolio *models.Portfolio) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	portfolios, err := r.view.ReadPortfolios(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not create portfolio")
+	}
+	parentExists := portfolio.ParentID == 0
+	for _, p := range portfolios {
+		if p.Name == portfolio.Name {
+			return 0, errors.Errorf("could not create portfolio: name %q already exists", portfolio.Name)
+		}
+		parentExists = parentExists || p.ID == portfolio.ParentID
+	}
+	if !parentExists {
+		return 0, errors.Errorf("could not create portfolio: parent %d does not exist", portfolio.ParentID)
+	}
+	p := &models.Portfolio{
+		ID:       r.view.lastPortfolioID + 1,
+		Name:     portfolio.Name,
+		ParentID: portfolio.ParentID,
+	}
+	if err := r.writePortfolios(&fileEvent{Type: portfolioEvent, RecordedAt: r.now().UnixNano(), Portfolio: p}); err != nil {
+		return 0, errors.Wrap(err, "could not create portfolio")
+	}
+	return int(p.ID), nil
+}
+
+// AddPortfolioAccounts adds accounts to a portfolio. Accounts already in the portfolio are ignored.
+func (r *FileRepo) AddPortfolioAccounts(ctx context.Context, portfolioID int64, accountIDs []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.view.mu.RLock()
+	exists := r.view.portfolio(portfolioID) != nil
+	r.view.mu.RUnlock()
+	if !exists {
+		return errors.Errorf("could not add portfolio account: portfolio %d does not exist", portfolioID)
+	}
+	e := &fileEvent{
+		Type:       portfolioAccountsEvent,
+		RecordedAt: r.now().UnixNano(),
+		Portfolio:  &models.Portfolio{ID: portfolioID, AccountIDs: accountIDs},
+	}
+	return errors.Wrap(r.writePortfolios(e), "could not add portfolio account")
+}
+
+// ReadPortfolios reads all portfolios along with the accounts directly in each.
+func (r *FileRepo) ReadPortfolios(ctx context.Context) ([]*models.Portfolio, error) {
+	return r.view.ReadPortfolios(ctx)
+}
+
+// Compact drops the positions superseded before the given time from the log of every instrument, along with
+// the events which superseded them, and returns the number of positions dropped.
+// Positions can no longer be read as known before that time once they have been compacted.
+// If compaction fails the repo must be reopened, which recovers the log of any instrument part way through.
+func (r *FileRepo) Compact(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cutoff := before.UnixNano()
+	instrumentIDs := make([]int64, 0, len(r.instruments))
+	for instrumentID := range r.instruments {
+		instrumentIDs = append(instrumentIDs, instrumentID)
+	}
+	sort.Slice(instrumentIDs, func(i, j int) bool {
+		return instrumentIDs[i] < instrumentIDs[j]
+	})
+	var dropped int64
+	for _, instrumentID := range instrumentIDs {
+		if err := ctx.Err(); err != nil {
+			return dropped, errors.Wrap(err, "could not compact repo")
+		}
+		log := r.instruments[instrumentID]
+		// replay the whole log to find when each position was superseded
+		all := NewMemoryRepo()
+		var last int64
+		if err := log.readUntil(math.MaxInt64, func(e *fileEvent) error {
+			if e.RecordedAt > last {
+				last = e.RecordedAt
+			}
+			return applyEvent(all, e)
+		}); err != nil {
+			return dropped, errors.Wrapf(err, "could not compact log of instrument %d", instrumentID)
+		}
+		superseded := make(map[int64]int64)
+		for _, pos := range all.positions {
+			if !pos.supersededAt.IsZero() {
+				superseded[pos.ID] = pos.supersededAt.UnixNano()
+			}
+		}
+		keep := func(e *fileEvent) bool {
+			switch e.Type {
+			case positionEvent:
+				at, ok := superseded[e.Position.ID]
+				if ok && at < cutoff {
+					dropped++
+					return false
+				}
+			case supersedeEvent:
+				return e.RecordedAt >= cutoff
+			case checkpointEvent:
+				// replaced by a new checkpoint
+				return false
+			}
+			return true
+		}
+		// the last position may be dropped, so record its ID so that it is not reused
+		checkpoint := &fileEvent{Type: checkpointEvent, RecordedAt: last, LastPositionID: all.lastPositionID}
+		// only superseded positions are dropped, which are already not in the view
+		compacted, err := log.compact(keep, checkpoint, func(*fileEvent) error { return nil })
+		if err != nil {
+			return dropped, errors.Wrapf(err, "could not compact log of instrument %d", instrumentID)
+		}
+		r.instruments[instrumentID] = compacted
+	}
+	return dropped, nil
+}
+
+// supersede records and applies the supersession, returning the number of positions superseded.
+func (r *FileRepo) supersede(s supersession) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	log, err := r.instrumentLog(s.InstrumentID)
+	if err != nil {
+		return 0, err
+	}
+	if err := log.appendSynced(&fileEvent{Type: supersedeEvent, RecordedAt: now.UnixNano(), Supersede: &s}); err != nil {
+		return 0, err
+	}
+	r.view.mu.Lock()
+	defer r.view.mu.Unlock()
+	n := r.view.supersedeAt(s, now)
+	r.view.pruneSuperseded()
+	return n, nil
+}
+
+// write records the event in the log of the instrument and applies it. The caller must hold the lock.
+func (r *FileRepo) write(instrumentID int64, e *fileEvent) error {
+	log, err := r.instrumentLog(instrumentID)
+	if err != nil {
+		return err
+	}
+	if err := log.appendSynced(e); err != nil {
+		return err
+	}
+	r.view.mu.Lock()
+	defer r.view.mu.Unlock()
+	return applyEvent(r.view, e)
+}
+
+// writePortfolios records the event in the portfolio log and applies it. The caller must hold the lock.
+func (r *FileRepo) writePortfolios(e *fileEvent) error {
+	if err := r.portfolios.appendSynced(e); err != nil {
+		return err
+	}
+	r.view.mu.Lock()
+	defer r.view.mu.Unlock()
+	return applyEvent(r.view, e)
+}
+
+// viewAsOf replays the positions in the log of the instrument as known at the asOf time into a new MemoryRepo,
+// along with the current portfolios, so that they can be read as current positions.
+func (r *FileRepo) viewAsOf(ctx context.Context, instrumentID int64, asOf time.Time) (*MemoryRepo, error) {
+	view := NewMemoryRepo()
+	portfolios, err := r.view.ReadPortfolios(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range portfolios {
+		view.restorePortfolio(p)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	log, ok := r.instruments[instrumentID]
+	if !ok {
+		return view, nil
+	}
+	if err := log.readUntil(truncateTimestamp(asOf).UnixNano(), func(e *fileEvent) error {
+		if e.Type == tradeEvent {
+			return nil
+		}
+		return applyEvent(view, e)
+	}); err != nil {
+		return nil, errors.Wrap(err, "replay log failed")
+	}
+	return view, nil
+}
+
+// instrumentLog returns the log of the instrument, creating it if necessary. The caller must hold the lock.
+func (r *FileRepo) instrumentLog(instrumentID int64) (*segmentLog, error) {
+	if log, ok := r.instruments[instrumentID]; ok {
+		return log, nil
+	}
+	log, err := openSegmentLog(r.instrumentDir(instrumentID), r.segmentSize, r.replay)
+	if err != nil {
+		return nil, errors.Wrap(err, "open instrument log failed")
+	}
+	r.instruments[instrumentID] = log
+	return log, nil
+}
+
+// instrumentIDs returns the IDs of the instruments with logs, including any part way through compaction.
+func (r *FileRepo) instrumentIDs() ([]int64, error) {
+	dir := filepath.Join(r.dir, "instruments")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "create instrument directory failed")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read instrument directory failed")
+	}
+	seen := make(map[int64]bool)
+	var instrumentIDs []int64
+	for _, entry := range entries {
+		name := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), compactingSuffix), replacedSuffix)
+		instrumentID, err := strconv.ParseInt(name, 10, 64)
+		if err != nil || !entry.IsDir() {
+			return nil, errors.Errorf("unexpected instrument log %s", entry.Name())
+		}
+		if !seen[instrumentID] {
+			seen[instrumentID] = true
+			instrumentIDs = append(instrumentIDs, instrumentID)
+		}
+	}
+	sort.Slice(instrumentIDs, func(i, j int) bool {
+		return instrumentIDs[i] < instrumentIDs[j]
+	})
+	return instrumentIDs, nil
+}
+
+func (r *FileRepo) instrumentDir(instrumentID int64) string {
+	return filepath.Join(r.dir, "instruments", strconv.FormatInt(instrumentID, 10))
+}
+
+// replay applies an event read when a log is opened.
+func (r *FileRepo) replay(e *fileEvent) error {
+	if e.RecordedAt > r.lastRecordedAt {
+		r.lastRecordedAt = e.RecordedAt
+	}
+	return applyEvent(r.view, e)
+}
+
+// now returns the time to record an event at, which is never before the last event recorded
+// so that the times in each log are ordered even if the clock goes backwards. The caller must hold the lock.
+func (r *FileRepo) now() time.Time {
+	now := time.Now().UTC()
+	if now.UnixNano() <= r.lastRecordedAt {
+		now = time.Unix(0, r.lastRecordedAt+1).UTC()
+	}
+	r.lastRecordedAt = now.UnixNano()
+	return now
+}
+
+// applyEvent applies an event to the view. The caller must hold the lock of the view, if it is shared.
+func applyEvent(view *MemoryRepo, e *fileEvent) error {
+	at := time.Unix(0, e.RecordedAt).UTC()
+	switch e.Type {
+	case tradeEvent:
+		trade := *e.Trade
+		view.restoreTrade(&trade)
+	case positionEvent:
+		view.restorePosition(e.Position, at)
+	case supersedeEvent:
+		view.supersedeAt(*e.Supersede, at)
+	case portfolioEvent:
+		portfolio := *e.Portfolio
+		view.restorePortfolio(&portfolio)
+	case portfolioAccountsEvent:
+		p := view.portfolio(e.Portfolio.ID)
+		if p == nil {
+			return errors.Errorf("portfolio %d does not exist", e.Portfolio.ID)
+		}
+		view.addPortfolioAccounts(p, e.Portfolio.AccountIDs)
+	case checkpointEvent:
+		if e.LastPositionID > view.lastPositionID {
+			view.lastPositionID = e.LastPositionID
+		}
+	default:
+		return errors.Errorf("unknown event type %q", e.Type)
+	}
+	return nil
+}
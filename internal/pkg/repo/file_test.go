@@ -0,0 +1,313 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func openTestFileRepo(t *testing.T, dir string) *FileRepo {
+	t.Helper()
+	// a small segment size exercises rolling and the sparse index
+	r, err := OpenFileRepo(dir, WithSegmentSize(512))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = r.Close()
+	})
+	return r
+}
+
+func TestFileRepoConformance(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	testConformance(t, func(t *testing.T) conformanceRepo {
+		return openTestFileRepo(t, t.TempDir())
+	})
+}
+
+func TestFileRepoReopen(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	r := openTestFileRepo(t, dir)
+	trades := []*models.Trade{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Price: decimal.NewFromInt(100), Timestamp: conformanceTime(1)},
+		{InstrumentID: 2, AccountID: 1, Size: decimal.NewFromInt(-5), Price: decimal.NewFromInt(50), Timestamp: conformanceTime(2), Ref: "trades.jsonl:0"},
+	}
+	createTrades(t, r, trades...)
+	first := []*models.Position{
+		{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(10), Timestamp: conformanceTime(1), TradeIDs: []int64{trades[0].ID}},
+		{InstrumentID: 2, AccountID: 1, Size: decimal.NewFromInt(-5), Timestamp: conformanceTime(2), TradeIDs: []int64{trades[1].ID}},
+	}
+	createPositions(t, r, first...)
+	portfolioID, err := r.CreatePortfolio(ctx, &models.Portfolio{Name: "desk"})
+	require.NoError(t, err)
+	require.NoError(t, r.AddPortfolioAccounts(ctx, int64(portfolioID), []int64{1}))
+	time.Sleep(time.Millisecond)
+	asOf := time.Now()
+	_, err = r.SupersedePositions(ctx, 1)
+	require.NoError(t, err)
+	second := &models.Position{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(20), Timestamp: conformanceTime(1)}
+	createPositions(t, r, second)
+	require.NoError(t, r.Close())
+
+	r = openTestFileRepo(t, dir)
+	read, err := r.ListTrades(ctx, TradeFilter{InstrumentID: 1, To: conformanceTime(10)})
+	require.NoError(t, err)
+	require.Len(t, read, 1)
+	require.Equal(t, trades[0].ID, read[0].ID)
+	positions, err := r.ReadPositions(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []*models.Position{second}, positions)
+	pos, err := r.ReadPosition(ctx, 1, 1, conformanceTime(1), asOf)
+	require.NoError(t, err)
+	require.Equal(t, first[0], pos)
+	pos, err = r.ReadPortfolioPosition(ctx, 1, int64(portfolioID), conformanceTime(1), asOf)
+	require.NoError(t, err)
+	require.Equal(t, first[0].Size, pos.Size)
+	portfolios, err := r.ReadPortfolios(ctx)
+	require.NoError(t, err)
+	require.Len(t, portfolios, 1)
+	require.Equal(t, []int64{1}, portfolios[0].AccountIDs)
+
+	// refs are replayed, so that a trade ingested again is not stored twice
+	_, err = r.CreateTrade(ctx, trades[1])
+	require.ErrorIs(t, err, ErrDuplicateTrade)
+
+	// IDs carry on from those replayed
+	id, err := r.CreateTrade(ctx, &models.Trade{InstrumentID: 3, AccountID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(1), Timestamp: conformanceTime(3)})
+	require.NoError(t, err)
+	require.Equal(t, 3, id)
+	id, err = r.CreatePosition(ctx, &models.Position{InstrumentID: 3, AccountID: 1, Size: decimal.NewFromInt(1), Timestamp: conformanceTime(3)})
+	require.NoError(t, err)
+	require.Equal(t, 4, id)
+}
+
+func TestFileRepoLock(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	dir := t.TempDir()
+	r, err := OpenFileRepo(dir)
+	require.NoError(t, err)
+	_, err = OpenFileRepo(dir)
+	require.ErrorIs(t, err, ErrDirLocked)
+
+	// the lock is released on close, and closing again does nothing
+	require.NoError(t, r.Close())
+	require.NoError(t, r.Close())
+	r, err = OpenFileRepo(dir)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+}
+
+func TestFileRepoSyncFailure(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	ctx := context.Background()
+	r := openTestFileRepo(t, t.TempDir())
+	trade := func() *models.Trade {
+		return &models.Trade{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(1), Timestamp: conformanceTime(1)}
+	}
+	createTrades(t, r, trade())
+
+	// a pipe accepts writes but cannot be synced, standing in for a disk which fails
+	pr, pw, err := os.Pipe()
+	require.NoError(t, err)
+	defer pr.Close()
+	log := r.instruments[1]
+	active := log.active
+	log.active = pw
+	_, err = r.CreateTrade(ctx, trade())
+	require.ErrorIs(t, err, ErrLogFailed)
+	log.active = active
+	require.NoError(t, pw.Close())
+
+	// the failed log refuses further writes, rather than assigning the ID of the record it failed to sync
+	_, err = r.CreateTrade(ctx, trade())
+	require.ErrorIs(t, err, ErrLogFailed)
+	trades, err := r.ListTrades(ctx, TradeFilter{InstrumentID: 1, To: conformanceTime(60)})
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+}
+
+// lastSegment returns the path of the last segment of the instrument log.
+func lastSegment(t *testing.T, dir string, instrumentID int64) string {
+	t.Helper()
+	segments, err := filepath.Glob(filepath.Join(dir, "instruments", strconv.FormatInt(instrumentID, 10), "*"+segmentExt))
+	require.NoError(t, err)
+	require.NotEmpty(t, segments)
+	return segments[len(segments)-1]
+}
+
+func TestFileRepoRecovery(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	ctx := context.Background()
+	tests := map[string]struct {
+		corrupt func(t *testing.T, dir string)
+		trades  int
+		err     error
+	}{
+		"torn record at end": {
+			corrupt: func(t *testing.T, dir string) {
+				f, err := os.OpenFile(lastSegment(t, dir, 1), os.O_WRONLY|os.O_APPEND, 0o644)
+				require.NoError(t, err)
+				_, err = f.Write([]byte{0, 0, 1, 0, 1, 2})
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+			},
+			trades: 20,
+		},
+		"checksum mismatch at end": {
+			corrupt: func(t *testing.T, dir string) {
+				path := lastSegment(t, dir, 1)
+				b, err := os.ReadFile(path)
+				require.NoError(t, err)
+				b[len(b)-2]++
+				require.NoError(t, os.WriteFile(path, b, 0o644))
+			},
+			trades: 19,
+		},
+		"checksum mismatch in earlier segment": {
+			corrupt: func(t *testing.T, dir string) {
+				path := filepath.Join(dir, "instruments", "1", "00000001"+segmentExt)
+				b, err := os.ReadFile(path)
+				require.NoError(t, err)
+				b[frameHeaderSize+1]++
+				require.NoError(t, os.WriteFile(path, b, 0o644))
+			},
+			err: ErrCorruptSegment,
+		},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			r, err := OpenFileRepo(dir, WithSegmentSize(512))
+			require.NoError(t, err)
+			for i := 0; i < 20; i++ {
+				_, err := r.CreateTrade(ctx, &models.Trade{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(1), Timestamp: conformanceTime(i)})
+				require.NoError(t, err)
+			}
+			require.NoError(t, r.Close())
+			test.corrupt(t, dir)
+
+			r, err = OpenFileRepo(dir, WithSegmentSize(512))
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			defer r.Close()
+			trades, err := r.ListTrades(ctx, TradeFilter{InstrumentID: 1, To: conformanceTime(60)})
+			require.NoError(t, err)
+			require.Len(t, trades, test.trades)
+			// appends after the truncated record are read back
+			_, err = r.CreateTrade(ctx, &models.Trade{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(1), Timestamp: conformanceTime(30)})
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			r, err = OpenFileRepo(dir, WithSegmentSize(512))
+			require.NoError(t, err)
+			trades, err = r.ListTrades(ctx, TradeFilter{InstrumentID: 1, To: conformanceTime(60)})
+			require.NoError(t, err)
+			require.Len(t, trades, test.trades+1)
+		})
+	}
+}
+
+func TestFileRepoCompact(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	r := openTestFileRepo(t, dir)
+	for i := 0; i < 10; i++ {
+		_, err := r.SupersedePositions(ctx, 1)
+		require.NoError(t, err)
+		createPositions(t, r, &models.Position{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(int64(i + 1)), Timestamp: conformanceTime(1)})
+	}
+	time.Sleep(time.Millisecond)
+	asOf := time.Now()
+	_, err := r.SupersedePositions(ctx, 1)
+	require.NoError(t, err)
+	current := &models.Position{InstrumentID: 1, AccountID: 1, Size: decimal.NewFromInt(100), Timestamp: conformanceTime(1)}
+	createPositions(t, r, current)
+
+	dropped, err := r.Compact(ctx, asOf)
+	require.NoError(t, err)
+	require.Equal(t, int64(9), dropped)
+	pos, err := r.ReadPosition(ctx, 1, 1, conformanceTime(1), asOf)
+	require.NoError(t, err)
+	require.Equal(t, decimal.NewFromInt(10), pos.Size)
+	require.NoError(t, r.Close())
+
+	r = openTestFileRepo(t, dir)
+	positions, err := r.ReadPositions(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []*models.Position{current}, positions)
+	pos, err = r.ReadPosition(ctx, 1, 1, conformanceTime(1), asOf)
+	require.NoError(t, err)
+	require.Equal(t, decimal.NewFromInt(10), pos.Size)
+	_, err = r.ReadPosition(ctx, 1, 1, conformanceTime(1), asOf.Add(-time.Hour))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	// the IDs of compacted positions are not reused
+	id, err := r.CreatePosition(ctx, &models.Position{InstrumentID: 2, AccountID: 1, Size: decimal.NewFromInt(1), Timestamp: conformanceTime(1)})
+	require.NoError(t, err)
+	require.Equal(t, int(current.ID)+1, id)
+
+	// a compaction interrupted after the old log was renamed aside is completed when the repo is opened
+	require.NoError(t, r.Close())
+	log := filepath.Join(dir, "instruments", "1")
+	require.NoError(t, os.Rename(log, log+replacedSuffix))
+	require.NoError(t, os.Mkdir(log+compactingSuffix, 0o755))
+	b, err := os.ReadFile(filepath.Join(log+replacedSuffix, "00000001"+segmentExt))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(log+compactingSuffix, "00000001"+segmentExt), b, 0o644))
+	r = openTestFileRepo(t, dir)
+	positions, err = r.ReadPositions(ctx, 1)
+	require.NoError(t, err)
+	require.NotEmpty(t, positions)
+	_, err = os.Stat(log + replacedSuffix)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestSupersessionJSON(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	from := time.Date(2022, time.May, 1, 0, 0, 1, 234000, time.UTC)
+	b, err := json.Marshal(supersession{InstrumentID: 1, From: &from})
+	require.NoError(t, err)
+	var s supersession
+	require.NoError(t, json.Unmarshal(b, &s))
+	require.Equal(t, supersession{InstrumentID: 1, From: &from}, s)
+	// logs written before timestamps had sub-second precision hold From in unix seconds
+	require.NoError(t, json.Unmarshal([]byte(`{"instrument_id":1,"from":1651363201}`), &s))
+	require.Equal(t, from.Truncate(time.Second), *s.From)
+	require.NoError(t, json.Unmarshal([]byte(`{"instrument_id":2}`), &s))
+	require.Equal(t, supersession{InstrumentID: 2}, s)
+}
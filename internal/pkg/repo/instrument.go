@@ -0,0 +1,154 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// InstrumentRepo is used to perform CRUD operations on instrument reference data in the database.
+//go:generate mockery --name InstrumentRepo --filename instrument_repo_mock.go
+type InstrumentRepo interface {
+	CreateInstrument(ctx context.Context, instrument *models.Instrument) (int, error)
+	UpsertInstruments(ctx context.Context, instruments []*models.Instrument) error
+	ReadInstrument(ctx context.Context, instrumentID int64) (*models.Instrument, error)
+	ReadInstruments(ctx context.Context) ([]*models.Instrument, error)
+	ResolveInstruments(ctx context.Context, ref string) ([]*models.Instrument, error)
+}
+
+// CreateInstrument creates a new instrument. If the instrument ID is zero, one is assigned.
+func (r *Repo) CreateInstrument(ctx context.Context, instrument *models.Instrument) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not begin transaction")
+	}
+	var txID int
+	if err := tx.QueryRowContext(ctx,
+		r.queries[createInstrument],
+		instrumentArgs(instrument)...,
+	).Scan(&txID); err != nil {
+		_ = tx.Rollback()
+		return 0, errors.Wrap(err, "could not create instrument")
+	}
+	if err := r.advanceInstrumentID(ctx, tx, instrument.ID); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	return txID, errors.Wrap(tx.Commit(), "could not commit transaction")
+}
+
+// UpsertInstruments creates the given instruments in a single transaction,
+// updating any existing instruments with the same symbol.
+func (r *Repo) UpsertInstruments(ctx context.Context, instruments []*models.Instrument) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "could not begin transaction")
+	}
+	for _, instrument := range instruments {
+		explicitID := instrument.ID
+		if err := tx.QueryRowContext(ctx,
+			r.queries[upsertInstrument],
+			instrumentArgs(instrument)...,
+		).Scan(&instrument.ID); err != nil {
+			_ = tx.Rollback()
+			return errors.Wrapf(err, "could not upsert instrument %s", instrument.Symbol)
+		}
+		if err := r.advanceInstrumentID(ctx, tx, explicitID); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return errors.Wrap(tx.Commit(), "could not commit transaction")
+}
+
+// advanceInstrumentID moves the sequence assigning instrument IDs past an ID given explicitly,
+// which is not drawn from it, so that later instruments are not assigned the same ID.
+func (r *Repo) advanceInstrumentID(ctx context.Context, tx *sql.Tx, instrumentID int64) error {
+	if instrumentID == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, r.queries[advanceInstrumentID], instrumentID)
+	return errors.Wrap(err, "could not advance instrument ID")
+}
+
+// ReadInstrument reads an instrument by ID.
+func (r *Repo) ReadInstrument(ctx context.Context, instrumentID int64) (*models.Instrument, error) {
+	instrument, err := scanInstrument(r.db.QueryRowContext(ctx, r.queries[readInstrument], instrumentID))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read instrument")
+	}
+	return instrument, nil
+}
+
+// ReadInstruments reads all instruments.
+func (r *Repo) ReadInstruments(ctx context.Context) ([]*models.Instrument, error) {
+	rows, err := r.db.QueryContext(ctx, r.queries[readInstruments])
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read instruments")
+	}
+	return scanInstruments(rows)
+}
+
+// ResolveInstruments reads all instruments whose ID, symbol or ISIN matches the reference.
+// Symbols and ISINs are matched case-insensitively.
+func (r *Repo) ResolveInstruments(ctx context.Context, ref string) ([]*models.Instrument, error) {
+	rows, err := r.db.QueryContext(ctx, r.queries[resolveInstruments], ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not resolve instruments")
+	}
+	return scanInstruments(rows)
+}
+
+func scanInstruments(rows *sql.Rows) ([]*models.Instrument, error) {
+	defer rows.Close()
+	var instruments []*models.Instrument
+	for rows.Next() {
+		instrument, err := scanInstrument(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		instruments = append(instruments, instrument)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return instruments, nil
+}
+
+// instrumentArgs returns the query arguments to write an instrument.
+func instrumentArgs(instrument *models.Instrument) []interface{} {
+	return []interface{}{
+		instrument.ID, instrument.Symbol, instrument.ISIN, instrument.CUSIP,
+		instrument.AssetClass, instrument.Currency,
+		instrument.LotSize, instrument.TickSize, instrument.Multiplier, instrument.QuantityScale,
+		nullTime(instrument.ActiveFrom), nullTime(instrument.ActiveTo),
+	}
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanInstrument(row scanner) (*models.Instrument, error) {
+	var instrument models.Instrument
+	if err := row.Scan(
+		&instrument.ID,
+		&instrument.Symbol,
+		&instrument.ISIN,
+		&instrument.CUSIP,
+		&instrument.AssetClass,
+		&instrument.Currency,
+		&instrument.LotSize,
+		&instrument.TickSize,
+		&instrument.Multiplier,
+		&instrument.QuantityScale,
+		utc(&instrument.ActiveFrom),
+		utc(&instrument.ActiveTo),
+	); err != nil {
+		return nil, errors.Wrap(err, "scan instrument failed")
+	}
+	return &instrument, nil
+}
@@ -0,0 +1,45 @@
+package repo
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"tradetracker/pkg/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateInstrument(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	// an assigned ID is drawn from the sequence, which is left as it is
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[createInstrument])).WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1),
+	)
+	mock.ExpectCommit()
+	id, err := r.CreateInstrument(context.Background(), &models.Instrument{Symbol: "ACME"})
+	require.NoError(t, err)
+	require.Equal(t, 1, id)
+
+	// an explicit ID moves the sequence past it
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[createInstrument])).WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(5000000000),
+	)
+	mock.ExpectExec(regexp.QuoteMeta(r.queries[advanceInstrumentID])).WithArgs(int64(5000000000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	id, err = r.CreateInstrument(context.Background(), &models.Instrument{ID: 5000000000, Symbol: "BTCUSD"})
+	require.NoError(t, err)
+	require.Equal(t, 5000000000, id)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,113 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLocked is returned when an instrument is locked by another process, and the lock was not released in time.
+var ErrLocked = errors.New("instrument is locked")
+
+// lockRetryInterval is how often a lock held by another process is tried again while waiting for it.
+const lockRetryInterval = 100 * time.Millisecond
+
+// LockRepo is used to take advisory locks on instruments, so that only one process at a time writes their positions.
+//go:generate mockery --name LockRepo --filename lock_repo_mock.go
+type LockRepo interface {
+	LockInstrument(ctx context.Context, instrumentID int64, holder string, timeout time.Duration) (*InstrumentLock, error)
+	ReadLocks(ctx context.Context) ([]*models.Lock, error)
+}
+
+// InstrumentLock is an advisory lock on an instrument, held by a database session until it is unlocked.
+type InstrumentLock struct {
+	conn         *sql.Conn
+	query        string
+	instrumentID int64
+}
+
+// LockInstrument takes the advisory lock on the instrument, recording the holder so that ReadLocks can show who holds it.
+// If another process holds the lock, it is tried again until the timeout has elapsed, after which an error
+// wrapping ErrLocked is returned. A zero timeout fails fast, and a negative one waits until the context is done.
+// The lock is held by a connection of its own, and is released if the process exits without unlocking it.
+// Its key is the instrument ID as a single bigint, so every instrument ID can be locked, and it cannot clash
+// with the two-key advisory locks taken when creating partitions.
+func (r *Repo) LockInstrument(ctx context.Context, instrumentID int64, holder string, timeout time.Duration) (*InstrumentLock, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get connection")
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, r.queries[lockInstrument], instrumentID, holder).Scan(&locked); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, "could not lock instrument")
+		}
+		if locked {
+			return &InstrumentLock{
+				conn:         conn,
+				query:        r.queries[unlockInstrument],
+				instrumentID: instrumentID,
+			}, nil
+		}
+		if timeout >= 0 && !time.Now().Add(lockRetryInterval).Before(deadline) {
+			conn.Close()
+			return nil, errors.Wrapf(ErrLocked, "instrument %d", instrumentID)
+		}
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return nil, errors.Wrap(ctx.Err(), "wait for instrument lock failed")
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// Unlock releases the lock and returns its connection to the pool. If the lock cannot be released,
+// the connection is closed instead, which releases the lock when the session ends.
+func (l *InstrumentLock) Unlock() error {
+	var unlocked bool
+	var applicationName string
+	err := l.conn.QueryRowContext(context.Background(), l.query, l.instrumentID).Scan(&unlocked, &applicationName)
+	if err != nil {
+		_ = l.conn.Raw(func(interface{}) error {
+			return driver.ErrBadConn
+		})
+		return errors.Wrap(err, "could not unlock instrument")
+	}
+	if err := l.conn.Close(); err != nil {
+		return errors.Wrap(err, "could not close connection")
+	}
+	if !unlocked {
+		return errors.Errorf("instrument %d was not locked", l.instrumentID)
+	}
+	return nil
+}
+
+// ReadLocks reads the advisory locks held on instruments, ordered by instrument ID.
+func (r *Repo) ReadLocks(ctx context.Context) ([]*models.Lock, error) {
+	rows, err := r.db.QueryContext(ctx, r.queries[readLocks])
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read locks")
+	}
+	defer rows.Close()
+	var locks []*models.Lock
+	for rows.Next() {
+		var lock models.Lock
+		if err := rows.Scan(
+			&lock.InstrumentID, &lock.PID, &lock.Holder, &lock.User, &lock.ClientAddr, utc(&lock.Since),
+		); err != nil {
+			return nil, errors.Wrap(err, "could not scan lock")
+		}
+		locks = append(locks, &lock)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return locks, nil
+}
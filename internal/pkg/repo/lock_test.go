@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+	"tradetracker/pkg/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockInstrument(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// a zero timeout fails fast when the instrument is locked elsewhere
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[lockInstrument])).
+		WithArgs(int64(42), "holder").
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+	_, err = r.LockInstrument(ctx, 42, "holder", 0)
+	require.ErrorIs(t, err, ErrLocked)
+
+	// a timeout waits for the lock to be released
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[lockInstrument])).
+		WithArgs(int64(42), "holder").
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[lockInstrument])).
+		WithArgs(int64(42), "holder").
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	lock, err := r.LockInstrument(ctx, 42, "holder", time.Minute)
+	require.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[unlockInstrument])).
+		WithArgs(int64(42)).
+		WillReturnRows(sqlmock.NewRows([]string{"unlocked", "application_name"}).AddRow(true, ""))
+	require.NoError(t, lock.Unlock())
+
+	// instrument IDs beyond 32 bits are locked by their full ID
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[lockInstrument])).
+		WithArgs(int64(5000000000), "holder").
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	lock, err = r.LockInstrument(ctx, 5000000000, "holder", 0)
+	require.NoError(t, err)
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[unlockInstrument])).
+		WithArgs(int64(5000000000)).
+		WillReturnRows(sqlmock.NewRows([]string{"unlocked", "application_name"}).AddRow(true, ""))
+	require.NoError(t, lock.Unlock())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReadLocks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	since := time.Date(2022, time.May, 1, 2, 3, 4, 5000, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[readLocks])).WillReturnRows(
+		sqlmock.NewRows([]string{"instrument_id", "pid", "holder", "user", "client_addr", "since"}).
+			AddRow(42, 1234, "tradetracker position (host pid 99)", "tradetracker", "10.0.0.1", since),
+	)
+	locks, err := r.ReadLocks(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []*models.Lock{{
+		InstrumentID: 42,
+		PID:          1234,
+		Holder:       "tradetracker position (host pid 99)",
+		User:         "tradetracker",
+		ClientAddr:   "10.0.0.1",
+		Since:        since,
+	}}, locks)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,637 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// These check that the MemoryRepo can be used wherever the Repo is used for trades, positions and portfolios.
+var (
+	_ TradeRepo     = (*MemoryRepo)(nil)
+	_ PositionRepo  = (*MemoryRepo)(nil)
+	_ PortfolioRepo = (*MemoryRepo)(nil)
+)
+
+// MemoryRepo stores trades, positions and portfolios in memory, with the same semantics as the Repo:
+// timestamps are stored to the microsecond in UTC, reads are ordered in the same way, and positions are superseded
+// rather than deleted so that they can be read as known at an earlier time.
+// It is safe for concurrent use. Nothing is persisted, so it is only suitable for tests and demos.
+type MemoryRepo struct {
+	mu              sync.RWMutex
+	trades          []*models.Trade
+	positions       []*memoryPosition
+	portfolios      []*models.Portfolio
+	lastTradeID     int64
+	lastPositionID  int64
+	lastPortfolioID int64
+	refs            map[tradeRef]bool
+}
+
+// tradeRef identifies a trade by its ref and timestamp, which are unique among the stored trades.
+type tradeRef struct {
+	ref       string
+	timestamp int64
+}
+
+// memoryPosition is a stored position along with the system times it was known between.
+type memoryPosition struct {
+	models.Position
+	createdAt    time.Time
+	supersededAt time.Time // zero if the position is current
+}
+
+// positionKey identifies the positions of an account in an instrument.
+type positionKey struct {
+	instrumentID, accountID int64
+}
+
+// NewMemoryRepo creates a new, empty MemoryRepo.
+func NewMemoryRepo() *MemoryRepo {
+	return &MemoryRepo{}
+}
+
+// CreateTrade creates a new trade, or returns an error wrapping ErrDuplicateTrade if one with the same ref
+// and timestamp has already been stored.
+func (r *MemoryRepo) CreateTrade(ctx context.Context, trade *models.Trade) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tr := *trade
+	tr.ID = r.lastTradeID + 1
+	tr.CreatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	tr.Timestamp = truncateTimestamp(trade.Timestamp)
+	if r.hasTrade(&tr) {
+		return 0, errors.Wrapf(ErrDuplicateTrade, "ref %q", tr.Ref)
+	}
+	r.restoreTrade(&tr)
+	return int(tr.ID), nil
+}
+
+// restoreTrade stores a trade which has already been assigned an ID and creation time,
+// e.g. when replaying a log. The caller must hold the lock.
+func (r *MemoryRepo) restoreTrade(trade *models.Trade) {
+	r.trades = append(r.trades, trade)
+	if trade.ID > r.lastTradeID {
+		r.lastTradeID = trade.ID
+	}
+	if trade.Ref != "" {
+		if r.refs == nil {
+			r.refs = make(map[tradeRef]bool)
+		}
+		r.refs[tradeRef{ref: trade.Ref, timestamp: trade.Timestamp.UnixNano()}] = true
+	}
+}
+
+// hasTrade reports whether a trade with the same ref and timestamp as the trade, which must already be
+// truncated, has been stored. Trades without a ref are never the same. The caller must hold the lock.
+func (r *MemoryRepo) hasTrade(trade *models.Trade) bool {
+	return trade.Ref != "" && r.refs[tradeRef{ref: trade.Ref, timestamp: trade.Timestamp.UnixNano()}]
+}
+
+// ReadTrades reads trades after the given time and sends them on the returned channel,
+// ordered by timestamp and then ID.
+func (r *MemoryRepo) ReadTrades(ctx context.Context, instrumentID int64, after time.Time) (<-chan *models.Trade, error) { // nolint:unparam // it's okay that the error is always nil
+	r.mu.RLock()
+	var trades []*models.Trade
+	for _, tr := range r.trades {
+		if tr.InstrumentID == instrumentID && tr.Timestamp.After(truncateTimestamp(after)) {
+			trade := *tr
+			trade.CreatedAt = ""
+			trades = append(trades, &trade)
+		}
+	}
+	r.mu.RUnlock()
+	sortTrades(trades)
+	ch := make(chan *models.Trade)
+	go func() {
+		defer close(ch)
+		for _, trade := range trades {
+			select {
+			case ch <- trade:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// ListTrades lists the trades matching the filter, ordered by timestamp and then ID,
+// or returns an error wrapping ErrUnknownCursor if the trade to list after does not exist.
+func (r *MemoryRepo) ListTrades(ctx context.Context, filter TradeFilter) ([]*models.Trade, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var after *models.Trade
+	if filter.AfterID != 0 {
+		for _, tr := range r.trades {
+			if tr.ID == filter.AfterID && tr.InstrumentID == filter.InstrumentID {
+				after = tr
+			}
+		}
+		if after == nil {
+			return nil, errors.Wrapf(ErrUnknownCursor, "trade %d", filter.AfterID)
+		}
+	}
+	var trades []*models.Trade
+	for _, tr := range r.trades {
+		switch {
+		case tr.InstrumentID != filter.InstrumentID,
+			tr.Timestamp.Before(truncateTimestamp(filter.From)),
+			!tr.Timestamp.Before(truncateTimestamp(filter.To)),
+			tr.Size.Abs().Cmp(filter.MinSize) < 0,
+			filter.MinPrice != nil && tr.Price.Cmp(*filter.MinPrice) < 0,
+			filter.MaxPrice != nil && tr.Price.Cmp(*filter.MaxPrice) > 0,
+			after != nil && !tradeLess(after, tr):
+			continue
+		}
+		trade := *tr
+		trades = append(trades, &trade)
+	}
+	sortTrades(trades)
+	if filter.Limit > 0 && int64(len(trades)) > filter.Limit {
+		trades = trades[:filter.Limit]
+	}
+	return trades, nil
+}
+
+// CreatePosition creates a new position.
+func (r *MemoryRepo) CreatePosition(ctx context.Context, position *models.Position) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pos := *position
+	pos.ID = r.lastPositionID + 1
+	r.restorePosition(&pos, time.Now().UTC())
+	return int(pos.ID), nil
+}
+
+// restorePosition stores a position which has already been assigned an ID, as created at the given time,
+// e.g. when replaying a log. The caller must hold the lock.
+func (r *MemoryRepo) restorePosition(position *models.Position, createdAt time.Time) {
+	pos := &memoryPosition{
+		Position:  *position,
+		createdAt: createdAt,
+	}
+	pos.CreatedAt = ""
+	pos.Timestamp = truncateTimestamp(position.Timestamp)
+	pos.TradeIDs = append([]int64(nil), position.TradeIDs...)
+	r.positions = append(r.positions, pos)
+	if pos.ID > r.lastPositionID {
+		r.lastPositionID = pos.ID
+	}
+}
+
+// ReadPosition reads the position of an account in an instrument at a given time,
+// as known at the asOf time, or as currently known if asOf is zero.
+func (r *MemoryRepo) ReadPosition(ctx context.Context, instrumentID, accountID int64, timestamp, asOf time.Time) (*models.Position, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	latest := latestPositions(r.positions, func(pos *memoryPosition) bool {
+		return pos.InstrumentID == instrumentID && pos.AccountID == accountID &&
+			!pos.Timestamp.After(truncateTimestamp(timestamp)) && pos.knownAt(asOf)
+	})
+	pos, ok := latest[positionKey{instrumentID, accountID}]
+	if !ok {
+		return nil, errors.Wrap(sql.ErrNoRows, "could not read position")
+	}
+	return pos.copy(true), nil
+}
+
+// ReadAccountPositions reads the position of every account in an instrument at a given time.
+func (r *MemoryRepo) ReadAccountPositions(ctx context.Context, instrumentID int64, timestamp time.Time) ([]*models.Position, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	latest := latestPositions(r.positions, func(pos *memoryPosition) bool {
+		return pos.InstrumentID == instrumentID && !pos.Timestamp.After(truncateTimestamp(timestamp)) && pos.supersededAt.IsZero()
+	})
+	var positions []*models.Position
+	for _, pos := range latest {
+		positions = append(positions, pos.copy(false))
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].AccountID < positions[j].AccountID
+	})
+	return positions, nil
+}
+
+// ReadPortfolioPosition reads the position in an instrument at a given time aggregated over every
+// account in the portfolio and its descendants, or over all accounts if the portfolio ID is zero.
+// The timestamp of the aggregated position is that of the latest contributing position,
+// and is zero if there are none. The position is as known at the asOf time, or as currently known if asOf is zero.
+func (r *MemoryRepo) ReadPortfolioPosition(ctx context.Context, instrumentID, portfolioID int64, timestamp, asOf time.Time) (*models.Position, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	inPortfolio := r.inPortfolio(portfolioID)
+	latest := latestPositions(r.positions, func(pos *memoryPosition) bool {
+		return pos.InstrumentID == instrumentID && !pos.Timestamp.After(truncateTimestamp(timestamp)) &&
+			pos.knownAt(asOf) && inPortfolio(pos.AccountID)
+	})
+	position := &models.Position{
+		InstrumentID: instrumentID,
+	}
+	for _, pos := range latest {
+		position.Size = position.Size.Add(pos.Size)
+		if pos.Timestamp.After(position.Timestamp) {
+			position.Timestamp = pos.Timestamp
+		}
+	}
+	return position, nil
+}
+
+// ReadPositionHistory reads every change in position within [from, to) and sends them on the returned channel
+// in time order. The positions are for a single account if one is given, otherwise they are aggregated over the
+// portfolio and its sub-portfolios, or over all accounts if the portfolio ID is zero.
+func (r *MemoryRepo) ReadPositionHistory(
+	ctx context.Context, instrumentID int64, accountID *int64, portfolioID int64, from, to time.Time,
+) (<-chan *models.Position, error) {
+	r.mu.RLock()
+	inPortfolio := r.inPortfolio(portfolioID)
+	positions := r.currentPositions(func(pos *memoryPosition) bool {
+		return pos.InstrumentID == instrumentID && pos.Timestamp.Before(truncateTimestamp(to)) &&
+			(accountID == nil || pos.AccountID == *accountID) && inPortfolio(pos.AccountID)
+	})
+	r.mu.RUnlock()
+	// sum the changes in the position of each account at each timestamp, then accumulate them over time
+	previous := make(map[int64]decimal.Decimal)
+	var timestamps []time.Time
+	deltas := make(map[time.Time]decimal.Decimal)
+	for _, pos := range positions {
+		if _, ok := deltas[pos.Timestamp]; !ok {
+			timestamps = append(timestamps, pos.Timestamp)
+		}
+		deltas[pos.Timestamp] = deltas[pos.Timestamp].Add(pos.Size.Sub(previous[pos.AccountID]))
+		previous[pos.AccountID] = pos.Size
+	}
+	var history []*models.Position
+	var size decimal.Decimal
+	for _, timestamp := range timestamps {
+		size = size.Add(deltas[timestamp])
+		if timestamp.Before(truncateTimestamp(from)) {
+			continue
+		}
+		position := &models.Position{
+			InstrumentID: instrumentID,
+			Size:         size,
+			Timestamp:    timestamp,
+		}
+		if accountID != nil {
+			position.AccountID = *accountID
+		}
+		history = append(history, position)
+	}
+	ch := make(chan *models.Position)
+	go func() {
+		defer close(ch)
+		for _, position := range history {
+			select {
+			case ch <- position:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// ReadSnapshot reads the position in every instrument at the given timestamp, ordered by instrument ID.
+// The positions are for a single account if one is given, otherwise they are aggregated over the portfolio
+// and its sub-portfolios, or over all accounts if the portfolio ID is zero. Flat positions are optionally excluded.
+func (r *MemoryRepo) ReadSnapshot(
+	ctx context.Context, accountID *int64, portfolioID int64, timestamp time.Time, excludeFlat bool,
+) ([]*models.Position, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	inPortfolio := r.inPortfolio(portfolioID)
+	latest := latestPositions(r.positions, func(pos *memoryPosition) bool {
+		return !pos.Timestamp.After(truncateTimestamp(timestamp)) && pos.supersededAt.IsZero() &&
+			(accountID == nil || pos.AccountID == *accountID) && inPortfolio(pos.AccountID)
+	})
+	byInstrument := make(map[int64]*models.Position)
+	for key, pos := range latest {
+		position, ok := byInstrument[key.instrumentID]
+		if !ok {
+			position = &models.Position{InstrumentID: key.instrumentID}
+			if accountID != nil {
+				position.AccountID = *accountID
+			}
+			byInstrument[key.instrumentID] = position
+		}
+		position.Size = position.Size.Add(pos.Size)
+		if pos.Timestamp.After(position.Timestamp) {
+			position.Timestamp = pos.Timestamp
+		}
+	}
+	var positions []*models.Position
+	for _, position := range byInstrument {
+		if excludeFlat && position.Size.IsZero() {
+			continue
+		}
+		positions = append(positions, position)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].InstrumentID < positions[j].InstrumentID
+	})
+	return positions, nil
+}
+
+// ReadPositions reads every current position for an instrument, ordered by timestamp and then ID.
+func (r *MemoryRepo) ReadPositions(ctx context.Context, instrumentID int64) ([]*models.Position, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var positions []*models.Position
+	for _, pos := range r.currentPositions(func(pos *memoryPosition) bool {
+		return pos.InstrumentID == instrumentID
+	}) {
+		positions = append(positions, pos.copy(true))
+	}
+	return positions, nil
+}
+
+// ReadInstrumentIDs reads the IDs of every instrument with trades or current positions.
+func (r *MemoryRepo) ReadInstrumentIDs(ctx context.Context) ([]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := make(map[int64]bool)
+	var instrumentIDs []int64
+	add := func(instrumentID int64) {
+		if !seen[instrumentID] {
+			seen[instrumentID] = true
+			instrumentIDs = append(instrumentIDs, instrumentID)
+		}
+	}
+	for _, tr := range r.trades {
+		add(tr.InstrumentID)
+	}
+	for _, pos := range r.positions {
+		if pos.supersededAt.IsZero() {
+			add(pos.InstrumentID)
+		}
+	}
+	sort.Slice(instrumentIDs, func(i, j int) bool {
+		return instrumentIDs[i] < instrumentIDs[j]
+	})
+	return instrumentIDs, nil
+}
+
+// ReadPositionTrades reads the trades which contributed to the current positions in an instrument up to
+// the given time, ordered by timestamp and then ID. The trades are for a single account if one is given,
+// otherwise they are for every account in the portfolio and its sub-portfolios, or all accounts if the
+// portfolio ID is zero.
+func (r *MemoryRepo) ReadPositionTrades(
+	ctx context.Context, instrumentID int64, accountID *int64, portfolioID int64, timestamp time.Time,
+) ([]*models.Trade, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	inPortfolio := r.inPortfolio(portfolioID)
+	tradeIDs := make(map[int64]bool)
+	for _, pos := range r.currentPositions(func(pos *memoryPosition) bool {
+		return pos.InstrumentID == instrumentID && !pos.Timestamp.After(truncateTimestamp(timestamp)) &&
+			(accountID == nil || pos.AccountID == *accountID) && inPortfolio(pos.AccountID)
+	}) {
+		for _, id := range pos.TradeIDs {
+			tradeIDs[id] = true
+		}
+	}
+	var trades []*models.Trade
+	for _, tr := range r.trades {
+		if tradeIDs[tr.ID] {
+			trade := *tr
+			trades = append(trades, &trade)
+		}
+	}
+	sortTrades(trades)
+	return trades, nil
+}
+
+// SupersedePositions supersedes all current positions for an instrument.
+func (r *MemoryRepo) SupersedePositions(ctx context.Context, instrumentID int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.supersedeAt(supersession{InstrumentID: instrumentID}, time.Now().UTC()), nil
+}
+
+// SupersedePositionsFrom supersedes all current positions for an instrument at or after the given time.
+func (r *MemoryRepo) SupersedePositionsFrom(ctx context.Context, instrumentID int64, from time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	from = truncateTimestamp(from)
+	return r.supersedeAt(supersession{InstrumentID: instrumentID, From: &from}, time.Now().UTC()), nil
+}
+
+// CreatePortfolio creates a new portfolio, optionally nested under a parent portfolio.
+func (r *MemoryRepo) CreatePortfolio(ctx context.Context, portfolio *models.Portfolio) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.portfolios {
+		if p.Name == portfolio.Name {
+			return 0, errors.Errorf("could not create portfolio: name %q already exists", portfolio.Name)
+		}
+	}
+	if portfolio.ParentID != 0 && r.portfolio(portfolio.ParentID) == nil {
+		return 0, errors.Errorf("could not create portfolio: parent %d does not exist", portfolio.ParentID)
+	}
+	p := &models.Portfolio{
+		ID:       r.lastPortfolioID + 1,
+		Name:     portfolio.Name,
+		ParentID: portfolio.ParentID,
+	}
+	r.restorePortfolio(p)
+	return int(p.ID), nil
+}
+
+// restorePortfolio stores a portfolio which has already been assigned an ID, e.g. when replaying a log.
+// The caller must hold the lock.
+func (r *MemoryRepo) restorePortfolio(portfolio *models.Portfolio) {
+	r.portfolios = append(r.portfolios, portfolio)
+	if portfolio.ID > r.lastPortfolioID {
+		r.lastPortfolioID = portfolio.ID
+	}
+}
+
+// AddPortfolioAccounts adds accounts to a portfolio. Accounts already in the portfolio are ignored.
+func (r *MemoryRepo) AddPortfolioAccounts(ctx context.Context, portfolioID int64, accountIDs []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.portfolio(portfolioID)
+	if p == nil {
+		return errors.Errorf("could not add portfolio account: portfolio %d does not exist", portfolioID)
+	}
+	r.addPortfolioAccounts(p, accountIDs)
+	return nil
+}
+
+// addPortfolioAccounts adds the accounts not already in the portfolio. The caller must hold the lock.
+func (r *MemoryRepo) addPortfolioAccounts(p *models.Portfolio, accountIDs []int64) {
+	for _, accountID := range accountIDs {
+		exists := false
+		for _, id := range p.AccountIDs {
+			exists = exists || id == accountID
+		}
+		if !exists {
+			p.AccountIDs = append(p.AccountIDs, accountID)
+		}
+	}
+}
+
+// ReadPortfolios reads all portfolios along with the accounts directly in each.
+func (r *MemoryRepo) ReadPortfolios(ctx context.Context) ([]*models.Portfolio, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var portfolios []*models.Portfolio
+	for _, p := range r.portfolios {
+		portfolio := *p
+		portfolio.AccountIDs = append([]int64(nil), p.AccountIDs...)
+		sort.Slice(portfolio.AccountIDs, func(i, j int) bool {
+			return portfolio.AccountIDs[i] < portfolio.AccountIDs[j]
+		})
+		portfolios = append(portfolios, &portfolio)
+	}
+	return portfolios, nil
+}
+
+// supersedeAt supersedes the current positions matching the supersession at the given time,
+// returning the number superseded. The caller must hold the lock.
+func (r *MemoryRepo) supersedeAt(s supersession, at time.Time) int64 {
+	var n int64
+	for _, pos := range r.positions {
+		if pos.supersededAt.IsZero() && pos.InstrumentID == s.InstrumentID &&
+			(s.From == nil || !pos.Timestamp.Before(*s.From)) {
+			pos.supersededAt = at
+			n++
+		}
+	}
+	return n
+}
+
+// pruneSuperseded drops the superseded positions. The caller must hold the lock.
+func (r *MemoryRepo) pruneSuperseded() {
+	current := r.positions[:0]
+	for _, pos := range r.positions {
+		if pos.supersededAt.IsZero() {
+			current = append(current, pos)
+		}
+	}
+	for i := len(current); i < len(r.positions); i++ {
+		r.positions[i] = nil
+	}
+	r.positions = current
+}
+
+// sortByID sorts the trades and positions by ID, as they are stored in ID order when created one at a time.
+// The caller must hold the lock.
+func (r *MemoryRepo) sortByID() {
+	sort.SliceStable(r.trades, func(i, j int) bool {
+		return r.trades[i].ID < r.trades[j].ID
+	})
+	sort.SliceStable(r.positions, func(i, j int) bool {
+		return r.positions[i].ID < r.positions[j].ID
+	})
+}
+
+// currentPositions returns the current positions which match, ordered by timestamp and then ID.
+// The caller must hold the lock.
+func (r *MemoryRepo) currentPositions(match func(*memoryPosition) bool) []*memoryPosition {
+	var positions []*memoryPosition
+	for _, pos := range r.positions {
+		if pos.supersededAt.IsZero() && match(pos) {
+			positions = append(positions, pos)
+		}
+	}
+	// positions are stored in ID order, so a stable sort by timestamp orders them by timestamp and then ID
+	sort.SliceStable(positions, func(i, j int) bool {
+		return positions[i].Timestamp.Before(positions[j].Timestamp)
+	})
+	return positions
+}
+
+// inPortfolio returns a function reporting whether an account is in the portfolio or its descendants,
+// or true for every account if the portfolio ID is zero. The caller must hold the lock.
+func (r *MemoryRepo) inPortfolio(portfolioID int64) func(accountID int64) bool {
+	if portfolioID == 0 {
+		return func(int64) bool { return true }
+	}
+	accounts := make(map[int64]bool)
+	tree := map[int64]bool{portfolioID: true}
+	// portfolios are created after their parents, so descendants follow their ancestors in ID order
+	for _, p := range r.portfolios {
+		if p.ID == portfolioID || tree[p.ParentID] {
+			tree[p.ID] = true
+			for _, accountID := range p.AccountIDs {
+				accounts[accountID] = true
+			}
+		}
+	}
+	return func(accountID int64) bool {
+		return accounts[accountID]
+	}
+}
+
+// portfolio returns the portfolio with the given ID, or nil if there is none. The caller must hold the lock.
+func (r *MemoryRepo) portfolio(portfolioID int64) *models.Portfolio {
+	for _, p := range r.portfolios {
+		if p.ID == portfolioID {
+			return p
+		}
+	}
+	return nil
+}
+
+// knownAt returns true if the position was known at the asOf time, or is current if asOf is zero.
+func (pos *memoryPosition) knownAt(asOf time.Time) bool {
+	if asOf.IsZero() {
+		return pos.supersededAt.IsZero()
+	}
+	asOf = truncateTimestamp(asOf)
+	return !pos.createdAt.After(asOf) && (pos.supersededAt.IsZero() || pos.supersededAt.After(asOf))
+}
+
+// copy returns a copy of the position, optionally with the IDs of the trades which changed it.
+func (pos *memoryPosition) copy(withTradeIDs bool) *models.Position {
+	position := pos.Position
+	position.TradeIDs = nil
+	if withTradeIDs {
+		position.TradeIDs = append([]int64(nil), pos.TradeIDs...)
+	}
+	return &position
+}
+
+// latestPositions returns the latest of the positions which match for each account in each instrument,
+// by timestamp and then ID.
+func latestPositions(positions []*memoryPosition, match func(*memoryPosition) bool) map[positionKey]*memoryPosition {
+	latest := make(map[positionKey]*memoryPosition)
+	for _, pos := range positions {
+		if !match(pos) {
+			continue
+		}
+		key := positionKey{pos.InstrumentID, pos.AccountID}
+		if prev, ok := latest[key]; !ok || !pos.Timestamp.Before(prev.Timestamp) {
+			latest[key] = pos
+		}
+	}
+	return latest
+}
+
+// sortTrades sorts trades by timestamp and then ID.
+func sortTrades(trades []*models.Trade) {
+	sort.Slice(trades, func(i, j int) bool {
+		return tradeLess(trades[i], trades[j])
+	})
+}
+
+// tradeLess returns true if trade a is ordered before trade b.
+func tradeLess(a, b *models.Trade) bool {
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
+	}
+	return a.ID < b.ID
+}
+
+// truncateTimestamp truncates the time to the TimestampPrecision in UTC, as it is stored in the database.
+func truncateTimestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(TimestampPrecision)
+}
@@ -0,0 +1,13 @@
+package repo
+
+import "testing"
+
+func TestMemoryRepoConformance(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	testConformance(t, func(t *testing.T) conformanceRepo {
+		return NewMemoryRepo()
+	})
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"context"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// PortfolioRepo is used to perform CRUD operations on the portfolio hierarchy in the database.
+//go:generate mockery --name PortfolioRepo --filename portfolio_repo_mock.go
+type PortfolioRepo interface {
+	CreatePortfolio(ctx context.Context, portfolio *models.Portfolio) (int, error)
+	AddPortfolioAccounts(ctx context.Context, portfolioID int64, accountIDs []int64) error
+	ReadPortfolios(ctx context.Context) ([]*models.Portfolio, error)
+}
+
+// CreatePortfolio creates a new portfolio, optionally nested under a parent portfolio.
+func (r *Repo) CreatePortfolio(ctx context.Context, portfolio *models.Portfolio) (int, error) {
+	var txID int
+	if err := r.db.QueryRowContext(ctx,
+		r.queries[createPortfolio],
+		portfolio.Name, portfolio.ParentID,
+	).Scan(&txID); err != nil {
+		return 0, errors.Wrap(err, "could not create portfolio")
+	}
+	return txID, nil
+}
+
+// AddPortfolioAccounts adds accounts to a portfolio. Accounts already in the portfolio are ignored.
+func (r *Repo) AddPortfolioAccounts(ctx context.Context, portfolioID int64, accountIDs []int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "could not begin transaction")
+	}
+	for _, accountID := range accountIDs {
+		if _, err := tx.ExecContext(ctx, r.queries[addPortfolioAccount], portfolioID, accountID); err != nil {
+			_ = tx.Rollback()
+			return errors.Wrap(err, "could not add portfolio account")
+		}
+	}
+	return errors.Wrap(tx.Commit(), "could not commit transaction")
+}
+
+// ReadPortfolios reads all portfolios along with the accounts directly in each.
+func (r *Repo) ReadPortfolios(ctx context.Context) ([]*models.Portfolio, error) {
+	rows, err := r.db.QueryContext(ctx, r.queries[readPortfolios])
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read portfolios")
+	}
+	defer rows.Close()
+	var portfolios []*models.Portfolio
+	for rows.Next() {
+		var portfolio models.Portfolio
+		var accountIDs string
+		if err := rows.Scan(
+			&portfolio.ID,
+			&portfolio.Name,
+			&portfolio.ParentID,
+			&accountIDs,
+		); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		if portfolio.AccountIDs, err = splitIDs(accountIDs); err != nil {
+			return nil, errors.Wrap(err, "split account IDs failed")
+		}
+		portfolios = append(portfolios, &portfolio)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return portfolios, nil
+}
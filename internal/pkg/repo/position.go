@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"database/sql"
 	"time"
 	"tradetracker/pkg/models"
 
@@ -9,54 +10,330 @@ import (
 )
 
 // PositionRepo is used to perform CRUD operations on position records in the database.
+// Positions are never deleted. Instead, regenerating positions supersedes the current generation,
+// so that reads can return the positions either as currently known or as known at an earlier time.
 //go:generate mockery --name PositionRepo --filename position_repo_mock.go
 type PositionRepo interface {
 	CreatePosition(ctx context.Context, position *models.Position) (int, error)
-	ReadPosition(ctx context.Context, instrumentID int64, timestamp time.Time) (*models.Position, error)
-	DeletePositions(ctx context.Context, instrumentID int64) (int64, error)
+	ReadPosition(ctx context.Context, instrumentID, accountID int64, timestamp, asOf time.Time) (*models.Position, error)
+	ReadAccountPositions(ctx context.Context, instrumentID int64, timestamp time.Time) ([]*models.Position, error)
+	ReadPortfolioPosition(ctx context.Context, instrumentID, portfolioID int64, timestamp, asOf time.Time) (*models.Position, error)
+	ReadPositionHistory(ctx context.Context, instrumentID int64, accountID *int64, portfolioID int64, from, to time.Time) (<-chan *models.Position, error)
+	ReadSnapshot(ctx context.Context, accountID *int64, portfolioID int64, timestamp time.Time, excludeFlat bool) ([]*models.Position, error)
+	ReadPositions(ctx context.Context, instrumentID int64) ([]*models.Position, error)
+	ReadInstrumentIDs(ctx context.Context) ([]int64, error)
+	ReadPositionTrades(ctx context.Context, instrumentID int64, accountID *int64, portfolioID int64, timestamp time.Time) ([]*models.Trade, error)
+	SupersedePositions(ctx context.Context, instrumentID int64) (int64, error)
+	SupersedePositionsFrom(ctx context.Context, instrumentID int64, from time.Time) (int64, error)
 }
 
 // CreatePosition creates a new position.
 func (r *Repo) CreatePosition(ctx context.Context, position *models.Position) (int, error) {
+	if err := r.ensurePartition(ctx, "positions", position.Timestamp); err != nil {
+		return 0, err
+	}
 	var txID int
 	if err := r.db.QueryRowContext(ctx,
 		r.queries[createPosition],
-		position.InstrumentID, position.Size, position.Timestamp.Unix(),
+		position.InstrumentID, position.AccountID, position.Size, position.Timestamp.UTC(), joinIDs(position.TradeIDs),
 	).Scan(&txID); err != nil {
 		return 0, errors.Wrap(err, "could not create position")
 	}
 	return txID, nil
 }
 
-// ReadPosition reads a position for an instrument at a given time.
-func (r *Repo) ReadPosition(ctx context.Context, instrumentID int64, timestamp time.Time) (*models.Position, error) {
+// ReadPosition reads the position of an account in an instrument at a given time,
+// as known at the asOf time, or as currently known if asOf is zero.
+func (r *Repo) ReadPosition(ctx context.Context, instrumentID, accountID int64, timestamp, asOf time.Time) (*models.Position, error) {
 	var position models.Position
+	var tradeIDs string
 	if err := r.db.QueryRowContext(ctx,
 		r.queries[readPosition],
-		instrumentID, timestamp.Unix(),
+		instrumentID, accountID, timestamp.UTC(), nullTime(asOf),
 	).Scan(
 		&position.ID,
 		&position.InstrumentID,
+		&position.AccountID,
 		&position.Size,
-		&position.Timestamp,
+		utc(&position.Timestamp),
+		&tradeIDs,
 	); err != nil {
 		return nil, errors.Wrap(err, "could not read position")
 	}
+	var err error
+	if position.TradeIDs, err = splitIDs(tradeIDs); err != nil {
+		return nil, errors.Wrap(err, "split trade IDs failed")
+	}
+	return &position, nil
+}
+
+// ReadAccountPositions reads the position of every account in an instrument at a given time.
+func (r *Repo) ReadAccountPositions(ctx context.Context, instrumentID int64, timestamp time.Time) ([]*models.Position, error) {
+	rows, err := r.db.QueryContext(ctx,
+		r.queries[readAccountPositions],
+		instrumentID, timestamp.UTC(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read account positions")
+	}
+	defer rows.Close()
+	var positions []*models.Position
+	for rows.Next() {
+		var position models.Position
+		if err := rows.Scan(
+			&position.ID,
+			&position.InstrumentID,
+			&position.AccountID,
+			&position.Size,
+			utc(&position.Timestamp),
+		); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		positions = append(positions, &position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return positions, nil
+}
+
+// ReadPortfolioPosition reads the position in an instrument at a given time aggregated over every
+// account in the portfolio and its descendants, or over all accounts if the portfolio ID is zero.
+// The timestamp of the aggregated position is that of the latest contributing position,
+// and is zero if there are none. The position is as known at the asOf time, or as currently known if asOf is zero.
+func (r *Repo) ReadPortfolioPosition(ctx context.Context, instrumentID, portfolioID int64, timestamp, asOf time.Time) (*models.Position, error) {
+	position := models.Position{
+		InstrumentID: instrumentID,
+	}
+	if err := r.db.QueryRowContext(ctx,
+		r.queries[readPortfolioPosition],
+		instrumentID, portfolioID, timestamp.UTC(), nullTime(asOf),
+	).Scan(
+		&position.Size,
+		utc(&position.Timestamp),
+	); err != nil {
+		return nil, errors.Wrap(err, "could not read portfolio position")
+	}
 	return &position, nil
 }
 
-// DeletePositions deletes all positions for an instrument.
-func (r *Repo) DeletePositions(ctx context.Context, instrumentID int64) (int64, error) {
+// SupersedePositions supersedes all current positions for an instrument.
+func (r *Repo) SupersedePositions(ctx context.Context, instrumentID int64) (int64, error) {
 	result, err := r.db.ExecContext(ctx,
-		r.queries[deletePositions],
+		r.queries[supersedePositions],
 		instrumentID,
 	)
 	if err != nil {
-		return 0, errors.Wrap(err, "could not delete positions")
+		return 0, errors.Wrap(err, "could not supersede positions")
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get number of superseded positions")
+	}
+	return n, nil
+}
+
+// SupersedePositionsFrom supersedes all current positions for an instrument at or after the given time.
+func (r *Repo) SupersedePositionsFrom(ctx context.Context, instrumentID int64, from time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		r.queries[supersedePositionsFrom],
+		instrumentID, from.UTC(),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not supersede positions")
 	}
 	n, err := result.RowsAffected()
 	if err != nil {
-		return 0, errors.Wrap(err, "could not get number of deleted positions")
+		return 0, errors.Wrap(err, "could not get number of superseded positions")
 	}
 	return n, nil
 }
+
+// ReadPositionHistory reads every change in position within [from, to) and sends them on the returned channel
+// in time order. The positions are for a single account if one is given, otherwise they are aggregated over the
+// portfolio and its sub-portfolios, or over all accounts if the portfolio ID is zero.
+func (r *Repo) ReadPositionHistory(
+	ctx context.Context, instrumentID int64, accountID *int64, portfolioID int64, from, to time.Time,
+) (<-chan *models.Position, error) {
+	var account sql.NullInt64
+	if accountID != nil {
+		account = sql.NullInt64{Int64: *accountID, Valid: true}
+	}
+	rows, err := r.db.QueryContext(ctx,
+		r.queries[readPositionHistory],
+		instrumentID, account, portfolioID, from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read position history")
+	}
+	ch := make(chan *models.Position)
+	go func() {
+		defer close(ch)
+		// a cancelled context stops the read, rather than failing it
+		defer func() {
+			if err := rows.Close(); err != nil && ctx.Err() == nil {
+				logger.Fatalln(errors.Wrap(err, "close rows failed"))
+			}
+		}()
+		for rows.Next() {
+			position := models.Position{
+				InstrumentID: instrumentID,
+				AccountID:    account.Int64,
+			}
+			if err := rows.Scan(
+				&position.Size,
+				utc(&position.Timestamp),
+			); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Fatalln(errors.Wrap(err, "scan failed"))
+				continue
+			}
+			select {
+			case ch <- &position:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := rows.Err(); err != nil && ctx.Err() == nil {
+			logger.Fatalln(errors.Wrap(err, "rows failed"))
+		}
+	}()
+	return ch, nil
+}
+
+// ReadSnapshot reads the position in every instrument at the given timestamp, ordered by instrument ID.
+// The positions are for a single account if one is given, otherwise they are aggregated over the portfolio
+// and its sub-portfolios, or over all accounts if the portfolio ID is zero. Flat positions are optionally excluded.
+func (r *Repo) ReadSnapshot(
+	ctx context.Context, accountID *int64, portfolioID int64, timestamp time.Time, excludeFlat bool,
+) ([]*models.Position, error) {
+	var account sql.NullInt64
+	if accountID != nil {
+		account = sql.NullInt64{Int64: *accountID, Valid: true}
+	}
+	rows, err := r.db.QueryContext(ctx,
+		r.queries[readSnapshot],
+		account, portfolioID, timestamp.UTC(), excludeFlat,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read snapshot")
+	}
+	defer rows.Close()
+	var positions []*models.Position
+	for rows.Next() {
+		position := models.Position{
+			AccountID: account.Int64,
+		}
+		if err := rows.Scan(
+			&position.InstrumentID,
+			&position.Size,
+			utc(&position.Timestamp),
+		); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		positions = append(positions, &position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return positions, nil
+}
+
+// ReadPositionTrades reads the trades which contributed to the current positions in an instrument up to
+// the given time, ordered by timestamp and then ID. The trades are for a single account if one is given,
+// otherwise they are for every account in the portfolio and its sub-portfolios, or all accounts if the
+// portfolio ID is zero.
+func (r *Repo) ReadPositionTrades(
+	ctx context.Context, instrumentID int64, accountID *int64, portfolioID int64, timestamp time.Time,
+) ([]*models.Trade, error) {
+	var account sql.NullInt64
+	if accountID != nil {
+		account = sql.NullInt64{Int64: *accountID, Valid: true}
+	}
+	rows, err := r.db.QueryContext(ctx,
+		r.queries[readPositionTrades],
+		instrumentID, account, portfolioID, timestamp.UTC(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read position trades")
+	}
+	defer rows.Close()
+	var trades []*models.Trade
+	for rows.Next() {
+		var trade models.Trade
+		if err := rows.Scan(
+			&trade.ID,
+			utc(&trade.CreatedAt),
+			&trade.InstrumentID,
+			&trade.AccountID,
+			&trade.Price,
+			&trade.Size,
+			utc(&trade.Timestamp),
+		); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		trades = append(trades, &trade)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return trades, nil
+}
+
+// ReadPositions reads every current position for an instrument, ordered by timestamp and then ID.
+func (r *Repo) ReadPositions(ctx context.Context, instrumentID int64) ([]*models.Position, error) {
+	rows, err := r.db.QueryContext(ctx,
+		r.queries[readPositions],
+		instrumentID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read positions")
+	}
+	defer rows.Close()
+	var positions []*models.Position
+	for rows.Next() {
+		var position models.Position
+		var tradeIDs string
+		if err := rows.Scan(
+			&position.ID,
+			&position.InstrumentID,
+			&position.AccountID,
+			&position.Size,
+			utc(&position.Timestamp),
+			&tradeIDs,
+		); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		if position.TradeIDs, err = splitIDs(tradeIDs); err != nil {
+			return nil, errors.Wrap(err, "split trade IDs failed")
+		}
+		positions = append(positions, &position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return positions, nil
+}
+
+// ReadInstrumentIDs reads the IDs of every instrument with trades or current positions.
+func (r *Repo) ReadInstrumentIDs(ctx context.Context) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx, r.queries[readInstrumentIDs])
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read instrument IDs")
+	}
+	defer rows.Close()
+	var instrumentIDs []int64
+	for rows.Next() {
+		var instrumentID int64
+		if err := rows.Scan(&instrumentID); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		instrumentIDs = append(instrumentIDs, instrumentID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return instrumentIDs, nil
+}
@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"testing"
 	"time"
+	"tradetracker/pkg/decimal"
 	"tradetracker/pkg/models"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -27,17 +28,259 @@ func TestCreatePosition(t *testing.T) {
 
 	position := &models.Position{
 		InstrumentID: 1,
-		Size:         20,
+		AccountID:    2,
+		Size:         decimal.NewFromInt(20),
 		Timestamp:    time.Date(2022, time.May, 1, 2, 3, 4, 5, time.UTC),
+		TradeIDs:     []int64{3, 4},
 	}
 
+	mock.ExpectExec(regexp.QuoteMeta(
+		r.queries[ensurePartition],
+	)).WithArgs("positions", position.Timestamp.UTC()).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectQuery(regexp.QuoteMeta(
 		r.queries[createPosition],
-	)).WithArgs(position.InstrumentID, position.Size, position.Timestamp.Unix()).WillReturnRows(
+	)).WithArgs(position.InstrumentID, position.AccountID, position.Size, position.Timestamp.UTC(), "3,4").WillReturnRows(
 		sqlmock.NewRows([]string{"id"}).AddRow(1),
 	)
 
 	id, err := r.CreatePosition(context.Background(), position)
 	require.NoError(t, err)
 	require.Equal(t, 1, id)
+
+	// instrument IDs beyond 32 bits are passed as bigint
+	position.InstrumentID = 5000000000
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[createPosition],
+	)).WithArgs(int64(5000000000), position.AccountID, position.Size, position.Timestamp.UTC(), "3,4").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(2),
+	)
+	id, err = r.CreatePosition(context.Background(), position)
+	require.NoError(t, err)
+	require.Equal(t, 2, id)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSupersedePositionsFrom(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	from := time.Date(2022, time.May, 1, 2, 3, 4, 0, time.UTC)
+	mock.ExpectExec(regexp.QuoteMeta(
+		r.queries[supersedePositionsFrom],
+	)).WithArgs(int64(1), from.UTC()).WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := r.SupersedePositionsFrom(context.Background(), 1, from)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+}
+
+func TestReadPortfolioPosition(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	timestamp := time.Date(2022, time.May, 1, 2, 3, 4, 0, time.UTC)
+	latest := timestamp.Add(-time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[readPortfolioPosition],
+	)).WithArgs(int64(1), int64(3), timestamp.UTC(), nil).WillReturnRows(
+		sqlmock.NewRows([]string{"sum", "max"}).AddRow(42, latest),
+	)
+
+	pos, err := r.ReadPortfolioPosition(context.Background(), 1, 3, timestamp, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), pos.InstrumentID)
+	require.Equal(t, decimal.NewFromInt(42), pos.Size)
+	require.Equal(t, latest, pos.Timestamp)
+}
+
+func TestReadPositionAsOf(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	timestamp := time.Date(2022, time.May, 1, 16, 0, 0, 0, time.UTC)
+	asOf := timestamp.Add(24 * time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[readPosition],
+	)).WithArgs(int64(1), int64(2), timestamp.UTC(), asOf.UTC()).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "instrument_id", "account_id", "size", "timestamp", "trade_ids"}).
+			AddRow(7, 1, 2, 10, timestamp.Add(-time.Minute), "5"),
+	)
+
+	pos, err := r.ReadPosition(context.Background(), 1, 2, timestamp, asOf)
+	require.NoError(t, err)
+	require.Equal(t, &models.Position{
+		ID:           7,
+		InstrumentID: 1,
+		AccountID:    2,
+		Size:         decimal.NewFromInt(10),
+		Timestamp:    timestamp.Add(-time.Minute),
+		TradeIDs:     []int64{5},
+	}, pos)
+}
+
+func TestReadPositionHistory(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	from := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	accountID := int64(2)
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[readPositionHistory],
+	)).WithArgs(int64(1), accountID, int64(0), from.UTC(), to.UTC()).WillReturnRows(
+		sqlmock.NewRows([]string{"size", "timestamp"}).
+			AddRow(10, from).
+			AddRow(-5, from.Add(time.Minute)),
+	)
+
+	ch, err := r.ReadPositionHistory(context.Background(), 1, &accountID, 0, from, to)
+	require.NoError(t, err)
+	var positions []*models.Position
+	for pos := range ch {
+		positions = append(positions, pos)
+	}
+	require.Equal(t, []*models.Position{
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(10), Timestamp: from},
+		{InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(-5), Timestamp: from.Add(time.Minute)},
+	}, positions)
+}
+
+func TestReadSnapshot(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	timestamp := time.Date(2022, time.May, 1, 16, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[readSnapshot],
+	)).WithArgs(nil, int64(3), timestamp.UTC(), true).WillReturnRows(
+		sqlmock.NewRows([]string{"instrument_id", "sum", "max"}).
+			AddRow(1, 10, timestamp.Add(-time.Hour)).
+			AddRow(2, -4, timestamp.Add(-time.Minute)),
+	)
+
+	positions, err := r.ReadSnapshot(context.Background(), nil, 3, timestamp, true)
+	require.NoError(t, err)
+	require.Equal(t, []*models.Position{
+		{InstrumentID: 1, Size: decimal.NewFromInt(10), Timestamp: timestamp.Add(-time.Hour)},
+		{InstrumentID: 2, Size: decimal.NewFromInt(-4), Timestamp: timestamp.Add(-time.Minute)},
+	}, positions)
+}
+
+func TestReadPositionTrades(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	timestamp := time.Date(2022, time.May, 1, 16, 0, 0, 0, time.UTC)
+	createdAt := timestamp.Add(time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[readPositionTrades],
+	)).WithArgs(int64(1), nil, int64(0), timestamp.UTC()).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "created_at", "instrument_id", "account_id", "price", "size", "timestamp"}).
+			AddRow(5, createdAt, 1, 2, 9.5, 10, timestamp.Add(-time.Minute)),
+	)
+
+	trades, err := r.ReadPositionTrades(context.Background(), 1, nil, 0, timestamp)
+	require.NoError(t, err)
+	require.Equal(t, []*models.Trade{
+		{
+			ID:           5,
+			CreatedAt:    createdAt.Format(time.RFC3339Nano),
+			InstrumentID: 1,
+			AccountID:    2,
+			Price:        decimal.MustParse("9.5"),
+			Size:         decimal.NewFromInt(10),
+			Timestamp:    timestamp.Add(-time.Minute),
+		},
+	}, trades)
+}
+
+func TestReadPositions(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	timestamp := time.Date(2022, time.May, 1, 16, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[readPositions],
+	)).WithArgs(int64(1)).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "instrument_id", "account_id", "size", "timestamp", "trade_ids"}).
+			AddRow(1, 1, 2, 10, timestamp, "5").
+			AddRow(2, 1, 3, -4, timestamp, ""),
+	)
+
+	positions, err := r.ReadPositions(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, []*models.Position{
+		{ID: 1, InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(10), Timestamp: timestamp, TradeIDs: []int64{5}},
+		{ID: 2, InstrumentID: 1, AccountID: 3, Size: decimal.NewFromInt(-4), Timestamp: timestamp},
+	}, positions)
 }
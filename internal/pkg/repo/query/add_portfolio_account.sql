@@ -0,0 +1,3 @@
+INSERT INTO portfolio_accounts (portfolio_id, account_id)
+VALUES ($1::int, $2::bigint)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1 @@
+SELECT setval('instruments_id_seq', GREATEST($1::bigint, (SELECT last_value FROM instruments_id_seq)));
@@ -0,0 +1,3 @@
+INSERT INTO archives (instrument_id, archived_before)
+VALUES ($1::bigint, $2::timestamptz)
+RETURNING id, archived_at;
@@ -0,0 +1,8 @@
+INSERT INTO bars (instrument_id, interval_seconds, open, high, low, close, volume, vwap, trade_count, timestamp)
+VALUES (
+    $1::bigint, $2::bigint,
+    $3::numeric, $4::numeric, $5::numeric, $6::numeric,
+    $7::numeric, $8::numeric, $9::bigint,
+    $10::timestamptz
+)
+RETURNING id;
@@ -0,0 +1,9 @@
+INSERT INTO instruments (id, symbol, isin, cusip, asset_class, currency, lot_size, tick_size, multiplier, quantity_scale, active_from, active_to)
+VALUES (
+    COALESCE(NULLIF($1::bigint, 0), nextval('instruments_id_seq')),
+    $2::text, NULLIF($3::text, ''), NULLIF($4::text, ''),
+    $5::text, $6::text,
+    $7::bigint, $8::numeric, $9::numeric, $10::integer,
+    $11::timestamptz, $12::timestamptz
+)
+RETURNING id;
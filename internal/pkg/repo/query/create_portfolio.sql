@@ -0,0 +1,3 @@
+INSERT INTO portfolios (name, parent_id)
+VALUES ($1::text, NULLIF($2::int, 0))
+RETURNING id;
@@ -1,3 +1,3 @@
-INSERT INTO positions (instrument_id, size, timestamp)
-VALUES ($1::int, $2::int, to_timestamp($3::bigint) AT TIME ZONE 'UTC')
+INSERT INTO positions (instrument_id, account_id, size, timestamp, trade_ids)
+VALUES ($1::bigint, $2::bigint, $3::numeric, $4::timestamptz, string_to_array($5::text, ',')::bigint[])
 RETURNING id;
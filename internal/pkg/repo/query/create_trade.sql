@@ -1,3 +1,4 @@
-INSERT INTO trades (instrument_id, size, price, timestamp)
-VALUES ($1::int, $2::int, $3::numeric, to_timestamp($4::bigint) AT TIME ZONE 'UTC')
+INSERT INTO trades (instrument_id, account_id, size, price, timestamp, ref)
+VALUES ($1::bigint, $2::bigint, $3::numeric, $4::numeric, $5::timestamptz, NULLIF($6::text, ''))
+ON CONFLICT (ref, timestamp) DO NOTHING
 RETURNING id;
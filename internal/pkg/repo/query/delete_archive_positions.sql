@@ -0,0 +1,2 @@
+DELETE FROM positions
+WHERE instrument_id=$1::bigint AND timestamp < $2::timestamptz;
@@ -0,0 +1,2 @@
+DELETE FROM trades
+WHERE instrument_id=$1::bigint AND timestamp < $2::timestamptz;
@@ -0,0 +1,3 @@
+DELETE FROM bars
+WHERE instrument_id=$1::bigint
+AND interval_seconds=$2::bigint;
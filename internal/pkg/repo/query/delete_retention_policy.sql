@@ -1,2 +1,2 @@
-DELETE FROM positions
+DELETE FROM retention_policies
 WHERE instrument_id=$1::bigint;
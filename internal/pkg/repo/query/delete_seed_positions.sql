@@ -0,0 +1,3 @@
+DELETE FROM positions
+WHERE instrument_id=$1::bigint AND timestamp < $2::timestamptz
+AND seed;
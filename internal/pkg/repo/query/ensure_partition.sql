@@ -0,0 +1 @@
+SELECT ensure_month_partition($1::text, $2::timestamptz);
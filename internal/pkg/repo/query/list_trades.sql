@@ -0,0 +1,11 @@
+SELECT id, created_at, instrument_id, account_id, price, size, timestamp
+FROM trades
+WHERE instrument_id=$1::bigint
+AND timestamp >= $2::timestamptz
+AND timestamp < $3::timestamptz
+AND abs(size) >= $4::numeric
+AND ($5::numeric IS NULL OR price >= $5::numeric)
+AND ($6::numeric IS NULL OR price <= $6::numeric)
+AND ($7::bigint = 0 OR (timestamp, id) > ($9::timestamptz, $7::bigint))
+ORDER BY timestamp ASC, id ASC
+LIMIT NULLIF($8::bigint, 0);
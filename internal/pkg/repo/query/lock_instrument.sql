@@ -0,0 +1,4 @@
+SELECT CASE WHEN pg_try_advisory_lock($1::bigint)
+    THEN set_config('application_name', $2::text, false) IS NOT NULL
+    ELSE false
+END;
@@ -0,0 +1,3 @@
+UPDATE archives
+SET restored_at = now()
+WHERE id=$1::integer;
@@ -0,0 +1,6 @@
+SELECT DISTINCT ON (account_id) id, instrument_id, account_id, size, timestamp
+FROM positions
+WHERE instrument_id=$1::bigint
+AND timestamp <= $2::timestamptz
+AND superseded_at IS NULL
+ORDER BY account_id, timestamp DESC, id DESC;
@@ -0,0 +1,4 @@
+SELECT id, instrument_id, archived_before, archived_at, trades, positions, restored_at
+FROM archives
+WHERE id=$1::integer
+FOR UPDATE;
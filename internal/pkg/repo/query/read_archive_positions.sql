@@ -0,0 +1,4 @@
+SELECT id, created_at, instrument_id, account_id, size, timestamp, superseded_at, array_to_string(trade_ids, ','), seed
+FROM positions
+WHERE instrument_id=$1::bigint AND timestamp < $2::timestamptz
+ORDER BY timestamp ASC, id ASC;
@@ -0,0 +1,4 @@
+SELECT id, instrument_id, archived_before, archived_at, trades, positions, restored_at
+FROM archives
+WHERE ($1::bigint = 0 OR instrument_id=$1::bigint)
+ORDER BY id ASC;
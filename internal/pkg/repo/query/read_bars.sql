@@ -0,0 +1,7 @@
+SELECT id, instrument_id, interval_seconds, open, high, low, close, volume, vwap, trade_count, timestamp
+FROM bars
+WHERE instrument_id=$1::bigint
+AND interval_seconds=$2::bigint
+AND timestamp >= $3::timestamptz
+AND timestamp < $4::timestamptz
+ORDER BY timestamp ASC;
@@ -0,0 +1,4 @@
+SELECT instrument_id FROM trades
+UNION
+SELECT instrument_id FROM positions WHERE superseded_at IS NULL
+ORDER BY instrument_id ASC;
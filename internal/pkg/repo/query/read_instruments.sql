@@ -0,0 +1,3 @@
+SELECT id, symbol, COALESCE(isin, ''), COALESCE(cusip, ''), asset_class, currency, lot_size, tick_size, multiplier, quantity_scale, active_from, active_to
+FROM instruments
+ORDER BY id ASC;
@@ -0,0 +1,4 @@
+SELECT COALESCE(max(id), 0)
+FROM archives
+WHERE instrument_id=$1::bigint
+AND restored_at IS NULL;
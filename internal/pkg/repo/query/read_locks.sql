@@ -0,0 +1,14 @@
+SELECT
+    (l.classid::bigint << 32) | l.objid::bigint,
+    l.pid,
+    COALESCE(a.application_name, ''),
+    COALESCE(a.usename::text, ''),
+    COALESCE(host(a.client_addr), ''),
+    a.state_change
+FROM pg_locks l
+LEFT JOIN pg_stat_activity a ON a.pid = l.pid
+WHERE l.locktype = 'advisory'
+    AND l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+    AND l.objsubid = 1
+    AND l.granted
+ORDER BY 1, l.pid;
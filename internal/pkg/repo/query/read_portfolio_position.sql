@@ -0,0 +1,24 @@
+WITH RECURSIVE tree AS (
+    SELECT id FROM portfolios WHERE id=$2::bigint
+    UNION ALL
+    SELECT p.id FROM portfolios p JOIN tree t ON p.parent_id=t.id
+), latest AS (
+    SELECT DISTINCT ON (account_id) account_id, size, timestamp
+    FROM positions
+    WHERE instrument_id=$1::bigint
+    AND timestamp <= $3::timestamptz
+    AND (
+        ($4::timestamptz IS NULL AND superseded_at IS NULL)
+        OR (
+            created_at <= $4::timestamptz
+            AND (superseded_at IS NULL OR superseded_at > $4::timestamptz)
+        )
+    )
+    AND (
+        $2::bigint = 0
+        OR account_id IN (SELECT account_id FROM portfolio_accounts WHERE portfolio_id IN (SELECT id FROM tree))
+    )
+    ORDER BY account_id, timestamp DESC, id DESC
+)
+SELECT COALESCE(SUM(size), 0), MAX(timestamp)
+FROM latest;
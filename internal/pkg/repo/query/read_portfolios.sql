@@ -0,0 +1,5 @@
+SELECT p.id, p.name, COALESCE(p.parent_id, 0), COALESCE(string_agg(pa.account_id::text, ',' ORDER BY pa.account_id), '')
+FROM portfolios p
+LEFT JOIN portfolio_accounts pa ON pa.portfolio_id=p.id
+GROUP BY p.id
+ORDER BY p.id ASC;
@@ -1,6 +1,14 @@
-SELECT id, instrument_id, size, timestamp
+SELECT id, instrument_id, account_id, size, timestamp, array_to_string(trade_ids, ',')
 FROM positions
 WHERE instrument_id=$1::bigint
-AND timestamp <= to_timestamp($2::bigint) AT TIME ZONE 'UTC'
-ORDER BY timestamp DESC
+AND account_id=$2::bigint
+AND timestamp <= $3::timestamptz
+AND (
+    ($4::timestamptz IS NULL AND superseded_at IS NULL)
+    OR (
+        created_at <= $4::timestamptz
+        AND (superseded_at IS NULL OR superseded_at > $4::timestamptz)
+    )
+)
+ORDER BY timestamp DESC, id DESC
 LIMIT 1::bigint;
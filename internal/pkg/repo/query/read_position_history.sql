@@ -0,0 +1,24 @@
+WITH RECURSIVE tree AS (
+    SELECT id FROM portfolios WHERE id=$3::bigint
+    UNION ALL
+    SELECT p.id FROM portfolios p JOIN tree t ON p.parent_id=t.id
+), deltas AS (
+    SELECT timestamp, size - COALESCE(LAG(size) OVER (PARTITION BY account_id ORDER BY timestamp, id), 0) AS delta
+    FROM positions
+    WHERE instrument_id=$1::bigint
+    AND timestamp < $5::timestamptz
+    AND superseded_at IS NULL
+    AND ($2::bigint IS NULL OR account_id=$2::bigint)
+    AND (
+        $3::bigint = 0
+        OR account_id IN (SELECT account_id FROM portfolio_accounts WHERE portfolio_id IN (SELECT id FROM tree))
+    )
+), history AS (
+    SELECT timestamp, SUM(SUM(delta)) OVER (ORDER BY timestamp) AS size
+    FROM deltas
+    GROUP BY timestamp
+)
+SELECT size, timestamp
+FROM history
+WHERE timestamp >= $4::timestamptz
+ORDER BY timestamp ASC;
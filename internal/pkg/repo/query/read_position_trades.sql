@@ -0,0 +1,20 @@
+WITH RECURSIVE tree AS (
+    SELECT id FROM portfolios WHERE id=$3::bigint
+    UNION ALL
+    SELECT p.id FROM portfolios p JOIN tree t ON p.parent_id=t.id
+)
+SELECT id, created_at, instrument_id, account_id, price, size, timestamp
+FROM trades
+WHERE id IN (
+    SELECT unnest(trade_ids)
+    FROM positions
+    WHERE instrument_id=$1::bigint
+    AND timestamp <= $4::timestamptz
+    AND superseded_at IS NULL
+    AND ($2::bigint IS NULL OR account_id=$2::bigint)
+    AND (
+        $3::bigint = 0
+        OR account_id IN (SELECT account_id FROM portfolio_accounts WHERE portfolio_id IN (SELECT id FROM tree))
+    )
+)
+ORDER BY timestamp ASC, id ASC;
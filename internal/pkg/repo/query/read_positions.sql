@@ -0,0 +1,5 @@
+SELECT id, instrument_id, account_id, size, timestamp, array_to_string(trade_ids, ',')
+FROM positions
+WHERE instrument_id=$1::bigint
+AND superseded_at IS NULL
+ORDER BY timestamp ASC, id ASC;
@@ -0,0 +1,3 @@
+SELECT instrument_id, retain_seconds
+FROM retention_policies
+ORDER BY instrument_id ASC;
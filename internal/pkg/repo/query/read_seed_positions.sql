@@ -0,0 +1,6 @@
+SELECT id, instrument_id, account_id, size, timestamp
+FROM positions
+WHERE instrument_id=$1::bigint
+AND seed
+AND superseded_at IS NULL
+ORDER BY timestamp ASC, id ASC;
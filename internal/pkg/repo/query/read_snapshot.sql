@@ -0,0 +1,21 @@
+WITH RECURSIVE tree AS (
+    SELECT id FROM portfolios WHERE id=$2::bigint
+    UNION ALL
+    SELECT p.id FROM portfolios p JOIN tree t ON p.parent_id=t.id
+), latest AS (
+    SELECT DISTINCT ON (instrument_id, account_id) instrument_id, size, timestamp
+    FROM positions
+    WHERE timestamp <= $3::timestamptz
+    AND superseded_at IS NULL
+    AND ($1::bigint IS NULL OR account_id=$1::bigint)
+    AND (
+        $2::bigint = 0
+        OR account_id IN (SELECT account_id FROM portfolio_accounts WHERE portfolio_id IN (SELECT id FROM tree))
+    )
+    ORDER BY instrument_id, account_id, timestamp DESC, id DESC
+)
+SELECT instrument_id, SUM(size), MAX(timestamp)
+FROM latest
+GROUP BY instrument_id
+HAVING NOT $4::boolean OR SUM(size) <> 0
+ORDER BY instrument_id ASC;
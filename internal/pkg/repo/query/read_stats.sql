@@ -0,0 +1,80 @@
+WITH bounds AS (
+    SELECT
+        COALESCE(
+            $3::timestamptz,
+            (SELECT MIN(timestamp) FROM trades WHERE instrument_id=$1::bigint)
+        ) AS lo,
+        $4::timestamptz AS hi
+), periods AS (
+    SELECT
+        p AT TIME ZONE 'UTC' AS period,
+        GREATEST(p AT TIME ZONE 'UTC', b.lo) AS lo,
+        LEAST((p + ('1 ' || $2::text)::interval) AT TIME ZONE 'UTC', b.hi) AS hi
+    FROM bounds b, generate_series(
+        date_trunc($2::text, b.lo AT TIME ZONE 'UTC'),
+        (b.hi AT TIME ZONE 'UTC') - interval '1 microsecond',
+        ('1 ' || $2::text)::interval
+    ) p
+), deltas AS (
+    SELECT timestamp, size - COALESCE(LAG(size) OVER (PARTITION BY account_id ORDER BY timestamp, id), 0) AS delta
+    FROM positions
+    WHERE instrument_id=$1::bigint
+    AND timestamp < (SELECT hi FROM bounds)
+    AND superseded_at IS NULL
+), history AS (
+    SELECT timestamp, SUM(SUM(delta)) OVER (ORDER BY timestamp) AS size
+    FROM deltas
+    GROUP BY timestamp
+    UNION ALL
+    SELECT '-infinity'::timestamptz, 0
+), segments AS (
+    SELECT size, timestamp AS lo, LEAD(timestamp, 1, 'infinity'::timestamptz) OVER (ORDER BY timestamp) AS hi
+    FROM history
+), holdings AS (
+    SELECT p.period, s.size, EXTRACT(EPOCH FROM LEAST(s.hi, p.hi) - GREATEST(s.lo, p.lo)) AS seconds
+    FROM periods p
+    JOIN segments s ON s.lo < p.hi AND s.hi > p.lo
+), position_stats AS (
+    SELECT
+        period,
+        MAX(size) AS max_size,
+        MIN(size) AS min_size,
+        SUM(size * seconds) / NULLIF(SUM(seconds), 0) AS avg_size,
+        SUM(abs(size) * seconds) / NULLIF(SUM(seconds), 0) AS avg_abs_size,
+        SUM(seconds) FILTER (WHERE size = 0) AS flat_seconds,
+        SUM(seconds) FILTER (WHERE size > 0) AS long_seconds,
+        SUM(seconds) FILTER (WHERE size < 0) AS short_seconds
+    FROM holdings
+    GROUP BY period
+), trade_stats AS (
+    SELECT
+        date_trunc($2::text, timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS period,
+        COUNT(*) AS trade_count,
+        SUM(abs(size)) AS gross_volume,
+        SUM(size) AS net_volume,
+        SUM(abs(size) * price) AS notional,
+        (ARRAY_AGG(size ORDER BY abs(size) DESC, id ASC))[1] AS largest_trade
+    FROM trades
+    WHERE instrument_id=$1::bigint
+    AND timestamp >= (SELECT lo FROM bounds)
+    AND timestamp < (SELECT hi FROM bounds)
+    GROUP BY 1
+)
+SELECT
+    p.period,
+    COALESCE(t.trade_count, 0)::bigint,
+    COALESCE(t.gross_volume, 0)::numeric,
+    COALESCE(t.net_volume, 0)::numeric,
+    COALESCE(t.notional, 0)::numeric,
+    COALESCE(t.gross_volume / NULLIF(h.avg_abs_size, 0), 0)::double precision,
+    COALESCE(t.largest_trade, 0)::numeric,
+    COALESCE(h.max_size, 0)::numeric,
+    COALESCE(h.min_size, 0)::numeric,
+    COALESCE(h.avg_size, 0)::double precision,
+    COALESCE(h.flat_seconds, 0)::double precision,
+    COALESCE(h.long_seconds, 0)::double precision,
+    COALESCE(h.short_seconds, 0)::double precision
+FROM periods p
+LEFT JOIN trade_stats t USING (period)
+LEFT JOIN position_stats h USING (period)
+ORDER BY p.period ASC;
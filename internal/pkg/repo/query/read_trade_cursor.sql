@@ -0,0 +1,5 @@
+SELECT timestamp
+FROM trades
+WHERE id=$1::bigint
+AND instrument_id=$2::bigint
+LIMIT 1;
@@ -1,4 +1,4 @@
-SELECT id, instrument_id, price, size, timestamp
+SELECT id, instrument_id, account_id, price, size, timestamp
 FROM trades
-WHERE instrument_id=$1::bigint AND timestamp > to_timestamp($2::bigint) AT TIME ZONE 'UTC'
-ORDER BY timestamp ASC;
+WHERE instrument_id=$1::bigint AND timestamp > $2::timestamptz
+ORDER BY timestamp ASC, id ASC;
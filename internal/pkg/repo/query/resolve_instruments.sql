@@ -0,0 +1,6 @@
+SELECT id, symbol, COALESCE(isin, ''), COALESCE(cusip, ''), asset_class, currency, lot_size, tick_size, multiplier, quantity_scale, active_from, active_to
+FROM instruments
+WHERE id::text=$1::text
+OR upper(symbol)=upper($1::text)
+OR isin=upper($1::text)
+ORDER BY id ASC;
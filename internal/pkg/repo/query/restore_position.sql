@@ -0,0 +1,5 @@
+INSERT INTO positions (id, created_at, instrument_id, account_id, size, timestamp, superseded_at, trade_ids, seed)
+SELECT
+    $1::integer, $2::timestamptz, $3::bigint, $4::bigint, $5::numeric, $6::timestamptz, $7::timestamptz,
+    string_to_array($8::text, ',')::bigint[], $9::boolean
+WHERE NOT EXISTS (SELECT 1 FROM positions WHERE id=$1::integer);
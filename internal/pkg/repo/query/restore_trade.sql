@@ -0,0 +1,3 @@
+INSERT INTO trades (id, created_at, instrument_id, account_id, size, price, timestamp, ref)
+SELECT $1::integer, $2::timestamptz, $3::bigint, $4::bigint, $5::numeric, $6::numeric, $7::timestamptz, NULLIF($8::text, '')
+WHERE NOT EXISTS (SELECT 1 FROM trades WHERE id=$1::integer);
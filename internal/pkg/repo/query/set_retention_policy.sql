@@ -0,0 +1,3 @@
+INSERT INTO retention_policies (instrument_id, retain_seconds)
+VALUES ($1::bigint, $2::bigint)
+ON CONFLICT (instrument_id) DO UPDATE SET retain_seconds = EXCLUDED.retain_seconds;
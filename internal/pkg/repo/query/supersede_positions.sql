@@ -0,0 +1,5 @@
+UPDATE positions
+SET superseded_at = now()
+WHERE instrument_id=$1::bigint
+AND superseded_at IS NULL
+AND NOT seed;
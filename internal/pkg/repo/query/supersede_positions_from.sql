@@ -0,0 +1,6 @@
+UPDATE positions
+SET superseded_at = now()
+WHERE instrument_id=$1::bigint
+AND timestamp >= $2::timestamptz
+AND superseded_at IS NULL
+AND NOT seed;
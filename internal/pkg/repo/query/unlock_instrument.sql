@@ -0,0 +1 @@
+SELECT pg_advisory_unlock($1::bigint), set_config('application_name', '', false);
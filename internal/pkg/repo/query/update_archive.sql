@@ -0,0 +1,3 @@
+UPDATE archives
+SET trades=$2::bigint, positions=$3::bigint
+WHERE id=$1::integer;
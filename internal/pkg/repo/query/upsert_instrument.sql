@@ -0,0 +1,20 @@
+INSERT INTO instruments (id, symbol, isin, cusip, asset_class, currency, lot_size, tick_size, multiplier, quantity_scale, active_from, active_to)
+VALUES (
+    COALESCE(NULLIF($1::bigint, 0), nextval('instruments_id_seq')),
+    $2::text, NULLIF($3::text, ''), NULLIF($4::text, ''),
+    $5::text, $6::text,
+    $7::bigint, $8::numeric, $9::numeric, $10::integer,
+    $11::timestamptz, $12::timestamptz
+)
+ON CONFLICT (symbol) DO UPDATE SET
+    isin=EXCLUDED.isin,
+    cusip=EXCLUDED.cusip,
+    asset_class=EXCLUDED.asset_class,
+    currency=EXCLUDED.currency,
+    lot_size=EXCLUDED.lot_size,
+    tick_size=EXCLUDED.tick_size,
+    multiplier=EXCLUDED.multiplier,
+    quantity_scale=EXCLUDED.quantity_scale,
+    active_from=EXCLUDED.active_from,
+    active_to=EXCLUDED.active_to
+RETURNING id;
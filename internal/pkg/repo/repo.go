@@ -1,9 +1,14 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 	"tradetracker/internal/pkg/validate"
 
 	"github.com/pkg/errors"
@@ -17,17 +22,64 @@ var queries embed.FS
 
 // These are query names.
 const (
-	createTrade     = "create_trade.sql"
-	createPosition  = "create_position.sql"
-	readTrades      = "read_trades.sql"
-	readPosition    = "read_position.sql"
-	deletePositions = "delete_positions.sql"
+	createTrade        = "create_trade.sql"
+	createPosition     = "create_position.sql"
+	readTrades         = "read_trades.sql"
+	readPosition       = "read_position.sql"
+	supersedePositions = "supersede_positions.sql"
+	createBar          = "create_bar.sql"
+	readBars           = "read_bars.sql"
+	deleteBars         = "delete_bars.sql"
+
+	supersedePositionsFrom = "supersede_positions_from.sql"
+	readAccountPositions   = "read_account_positions.sql"
+	readPortfolioPosition  = "read_portfolio_position.sql"
+	createPortfolio        = "create_portfolio.sql"
+	addPortfolioAccount    = "add_portfolio_account.sql"
+	readPortfolios         = "read_portfolios.sql"
+	createInstrument       = "create_instrument.sql"
+	upsertInstrument       = "upsert_instrument.sql"
+	advanceInstrumentID    = "advance_instrument_id.sql"
+	readInstrument         = "read_instrument.sql"
+	readInstruments        = "read_instruments.sql"
+	resolveInstruments     = "resolve_instruments.sql"
+	readPositionHistory    = "read_position_history.sql"
+	readSnapshot           = "read_snapshot.sql"
+	listTrades             = "list_trades.sql"
+	readTradeCursor        = "read_trade_cursor.sql"
+	readPositionTrades     = "read_position_trades.sql"
+	readPositions          = "read_positions.sql"
+	readInstrumentIDs      = "read_instrument_ids.sql"
+	readStats              = "read_stats.sql"
+	ensurePartition        = "ensure_partition.sql"
+	setRetentionPolicy     = "set_retention_policy.sql"
+	deleteRetentionPolicy  = "delete_retention_policy.sql"
+	readRetentionPolicies  = "read_retention_policies.sql"
+	readArchives           = "read_archives.sql"
+	readSeedPositions      = "read_seed_positions.sql"
+	createArchive          = "create_archive.sql"
+	updateArchive          = "update_archive.sql"
+	readArchiveTrades      = "read_archive_trades.sql"
+	readArchivePositions   = "read_archive_positions.sql"
+	deleteArchiveTrades    = "delete_archive_trades.sql"
+	deleteArchivePositions = "delete_archive_positions.sql"
+	readArchive            = "read_archive.sql"
+	readLatestArchiveID    = "read_latest_archive_id.sql"
+	deleteSeedPositions    = "delete_seed_positions.sql"
+	restoreTrade           = "restore_trade.sql"
+	restorePosition        = "restore_position.sql"
+	markArchiveRestored    = "mark_archive_restored.sql"
+	lockInstrument         = "lock_instrument.sql"
+	unlockInstrument       = "unlock_instrument.sql"
+	readLocks              = "read_locks.sql"
 )
 
 // Repo interacts with the postgres database.
 type Repo struct {
 	db      *sql.DB           `validate:"required"`
 	queries map[string]string `validate:"required"`
+	// partitions caches the monthly partitions known to exist, keyed by partitionKey.
+	partitions sync.Map
 }
 
 // NewRepo creates a new Repo for interacting with the database.
@@ -39,7 +91,51 @@ func NewRepo(cfgs ...ConfigFunc) (*Repo, error) {
 		createPosition,
 		readTrades,
 		readPosition,
-		deletePositions,
+		supersedePositions,
+		createBar,
+		readBars,
+		deleteBars,
+		supersedePositionsFrom,
+		readAccountPositions,
+		readPortfolioPosition,
+		createPortfolio,
+		addPortfolioAccount,
+		readPortfolios,
+		createInstrument,
+		upsertInstrument,
+		advanceInstrumentID,
+		readInstrument,
+		readInstruments,
+		resolveInstruments,
+		readPositionHistory,
+		readSnapshot,
+		listTrades,
+		readTradeCursor,
+		readPositionTrades,
+		readPositions,
+		readInstrumentIDs,
+		readStats,
+		ensurePartition,
+		setRetentionPolicy,
+		deleteRetentionPolicy,
+		readRetentionPolicies,
+		readArchives,
+		readSeedPositions,
+		createArchive,
+		updateArchive,
+		readArchiveTrades,
+		readArchivePositions,
+		deleteArchiveTrades,
+		deleteArchivePositions,
+		readArchive,
+		readLatestArchiveID,
+		deleteSeedPositions,
+		restoreTrade,
+		restorePosition,
+		markArchiveRestored,
+		lockInstrument,
+		unlockInstrument,
+		readLocks,
 		// TODO: add more queries here...
 	}
 	r.queries = make(map[string]string, len(queryFiles))
@@ -58,3 +154,103 @@ func NewRepo(cfgs ...ConfigFunc) (*Repo, error) {
 	}
 	return r, nil
 }
+
+// TimestampPrecision is the precision to which timestamps are stored. Finer timestamps are truncated.
+const TimestampPrecision = time.Microsecond
+
+// partitionKey identifies the monthly partition of a table.
+type partitionKey struct {
+	table string
+	month time.Time
+}
+
+func newPartitionKey(table string, timestamp time.Time) partitionKey {
+	timestamp = timestamp.UTC()
+	return partitionKey{
+		table: table,
+		month: time.Date(timestamp.Year(), timestamp.Month(), 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// ensurePartition creates the monthly partition of the table holding the timestamp, if it does not exist.
+// Rows written without it would land in the default partition, which is not pruned by range.
+// Partitions are cached once ensured, so only the first write in a month costs a round trip.
+func (r *Repo) ensurePartition(ctx context.Context, table string, timestamp time.Time) error {
+	key := newPartitionKey(table, timestamp)
+	if _, ok := r.partitions.Load(key); ok {
+		return nil
+	}
+	if _, err := r.db.ExecContext(ctx, r.queries[ensurePartition], table, timestamp.UTC()); err != nil {
+		return errors.Wrap(err, "could not ensure partition")
+	}
+	r.partitions.Store(key, struct{}{})
+	return nil
+}
+
+// nullTime returns the timestamp in UTC, or null if it is zero.
+func nullTime(timestamp time.Time) sql.NullTime {
+	if timestamp.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: timestamp.UTC(), Valid: true}
+}
+
+// utcScanner scans a timestamptz, which the driver returns in the local time zone, in UTC.
+type utcScanner struct {
+	dest interface{}
+}
+
+// utc returns a scan destination which scans a timestamptz into a *time.Time, or a *string in RFC 3339 format,
+// in UTC. A null timestamp is scanned as the zero value.
+func utc(dest interface{}) sql.Scanner {
+	return utcScanner{dest: dest}
+}
+
+// Scan implements the sql.Scanner interface.
+func (s utcScanner) Scan(src interface{}) error {
+	var t time.Time
+	switch v := src.(type) {
+	case time.Time:
+		t = v.UTC()
+	case nil:
+	default:
+		return errors.Errorf("cannot scan %T into a timestamp", src)
+	}
+	switch dest := s.dest.(type) {
+	case *time.Time:
+		*dest = t
+	case *string:
+		*dest = ""
+		if !t.IsZero() {
+			*dest = t.Format(time.RFC3339Nano)
+		}
+	default:
+		return errors.Errorf("cannot scan a timestamp into %T", s.dest)
+	}
+	return nil
+}
+
+// joinIDs joins IDs into a comma-separated list, to be passed to queries as an array.
+func joinIDs(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(s, ",")
+}
+
+// splitIDs splits a comma-separated list of IDs returned by a query.
+func splitIDs(s string) ([]int64, error) {
+	var ids []int64
+	for _, field := range strings.Split(s, ",") {
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse ID failed")
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,121 @@
+// build +integration
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"tradetracker/internal"
+	"tradetracker/pkg/testhelper"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoConformance(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip()
+	}
+	testConformance(t, func(t *testing.T) conformanceRepo {
+		name := strings.ToLower(strings.ReplaceAll("tradetracker_"+t.Name(), "/", "_"))
+		dbClient := testhelper.NewDBClient(t,
+			name,
+			internal.PostgresUser,
+			internal.PostgresPassword,
+			internal.PostgresHost,
+			internal.PostgresPort,
+		)
+		r, err := NewRepo(WithDB(dbClient))
+		require.NoError(t, err)
+		return r
+	})
+}
+
+// benchRows is the default number of positions seeded by BenchmarkReadPositionAsOf,
+// overridden by the BENCH_ROWS environment variable.
+const benchRows = 100_000_000
+
+// BenchmarkReadPositionAsOf measures as-of position reads against a partitioned positions table of benchRows rows,
+// spread over 1000 instruments, 100 accounts and two years, in two generations of which the first is superseded.
+func BenchmarkReadPositionAsOf(b *testing.B) {
+	if testing.Short() {
+		b.Skip()
+	}
+	rows := int64(benchRows)
+	if s := os.Getenv("BENCH_ROWS"); s != "" {
+		var err error
+		rows, err = strconv.ParseInt(s, 10, 64)
+		require.NoError(b, err)
+	}
+	ctx := context.Background()
+	dbClient := testhelper.NewDBClient(b,
+		"tradetracker_benchmark_read_position_as_of",
+		internal.PostgresUser,
+		internal.PostgresPassword,
+		internal.PostgresHost,
+		internal.PostgresPort,
+	)
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	span := int64(2 * 365 * 24 * time.Hour / time.Second)
+	superseded := start.Add(time.Duration(span) * time.Second)
+	_, err := dbClient.ExecContext(ctx, `
+		SELECT ensure_month_partition('positions', month)
+		FROM generate_series(to_timestamp($1::bigint), to_timestamp($2::bigint), interval '1 month') AS month
+	`, start.Unix(), superseded.Unix())
+	require.NoError(b, err)
+	// seed in batches, so that no single transaction has to hold every row
+	const batch = 1_000_000
+	for from := int64(1); from <= rows; from += batch {
+		to := from + batch - 1
+		if to > rows {
+			to = rows
+		}
+		_, err := dbClient.ExecContext(ctx, `
+			INSERT INTO positions (created_at, instrument_id, account_id, size, timestamp, superseded_at)
+			SELECT
+				to_timestamp($4::bigint + (g % 2) * $3::bigint),
+				g / 2 % 1000 + 1,
+				g / 2000 % 100 + 1,
+				g % 1000,
+				to_timestamp($4::bigint + g * $3::bigint / $5::bigint),
+				CASE WHEN g % 2 = 0 THEN to_timestamp($4::bigint + $3::bigint) END
+			FROM generate_series($1::bigint, $2::bigint) AS g
+		`, from, to, span, start.Unix(), rows)
+		require.NoError(b, err)
+		b.Logf("seeded %d of %d positions", to, rows)
+	}
+	_, err = dbClient.ExecContext(ctx, "ANALYZE positions")
+	require.NoError(b, err)
+	r, err := NewRepo(WithDB(dbClient))
+	require.NoError(b, err)
+
+	// the seeding above runs once, while the sub-benchmark is run with increasing b.N
+	// the latencies of the reads are reported as the p50 and p99 metrics, alongside the mean of ns/op
+	b.Run("read", func(b *testing.B) {
+		rnd := rand.New(rand.NewSource(1))
+		latencies := make([]time.Duration, b.N)
+		for i := 0; i < b.N; i++ {
+			timestamp := start.Add(time.Duration(rnd.Int63n(span)) * time.Second)
+			asOf := start.Add(time.Duration(rnd.Int63n(2*span)) * time.Second)
+			readStart := time.Now()
+			_, err := r.ReadPosition(ctx, rnd.Int63n(1000)+1, rnd.Int63n(100)+1, timestamp, asOf)
+			latencies[i] = time.Since(readStart)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				b.Fatal(err)
+			}
+		}
+		sort.Slice(latencies, func(i, j int) bool {
+			return latencies[i] < latencies[j]
+		})
+		b.ReportMetric(float64(latencies[b.N*50/100].Microseconds()), "p50-us")
+		b.ReportMetric(float64(latencies[b.N*99/100].Microseconds()), "p99-us")
+		b.ReportMetric(float64(rows), "rows")
+	})
+}
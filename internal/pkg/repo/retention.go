@@ -0,0 +1,480 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"time"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrArchiveRestored is returned when restoring an archive which has already been restored.
+	ErrArchiveRestored = errors.New("archive has already been restored")
+	// ErrArchiveNotLatest is returned when restoring an archive of an instrument which has been archived again since,
+	// as the later archive holds the seed positions that the earlier archive's positions were replaced with.
+	ErrArchiveNotLatest = errors.New("archive is not the latest archive of the instrument")
+	// ErrDuplicateID is returned when restoring a trade or position whose ID is already in use, as IDs are not
+	// unique keys of the partitioned tables and so are not enforced by the database.
+	ErrDuplicateID = errors.New("ID is already in use")
+)
+
+// RetentionRepo is used to manage how long trades and positions are kept in the database,
+// and to move them out to archives and back.
+//go:generate mockery --name RetentionRepo --filename retention_repo_mock.go
+type RetentionRepo interface {
+	SetRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) error
+	DeleteRetentionPolicy(ctx context.Context, instrumentID int64) (bool, error)
+	ReadRetentionPolicies(ctx context.Context) ([]*models.RetentionPolicy, error)
+	ReadArchives(ctx context.Context, instrumentID int64) ([]*models.Archive, error)
+	ReadSeedPositions(ctx context.Context, instrumentID int64) ([]*models.Position, error)
+	Archive(ctx context.Context, instrumentID int64, before time.Time, sink ArchiveSink) (*models.Archive, error)
+	Restore(ctx context.Context, archiveID int64, source ArchiveSource) (*models.Archive, error)
+}
+
+// txPartitions ensures partitions within a transaction. Creating a partition on another connection could wait
+// forever on the locks the transaction holds on the default partition. The partitions ensured are only added to
+// the repo's cache once the transaction commits.
+type txPartitions struct {
+	r       *Repo
+	tx      *sql.Tx
+	ensured map[partitionKey]bool
+}
+
+func (r *Repo) txPartitions(tx *sql.Tx) *txPartitions {
+	return &txPartitions{
+		r:       r,
+		tx:      tx,
+		ensured: make(map[partitionKey]bool),
+	}
+}
+
+func (p *txPartitions) ensure(ctx context.Context, table string, timestamp time.Time) error {
+	key := newPartitionKey(table, timestamp)
+	if _, ok := p.r.partitions.Load(key); ok || p.ensured[key] {
+		return nil
+	}
+	if _, err := p.tx.ExecContext(ctx, p.r.queries[ensurePartition], table, timestamp.UTC()); err != nil {
+		return errors.Wrap(err, "could not ensure partition")
+	}
+	p.ensured[key] = true
+	return nil
+}
+
+func (p *txPartitions) commit() {
+	for key := range p.ensured {
+		p.r.partitions.Store(key, struct{}{})
+	}
+}
+
+// ArchiveSink receives the trades and positions being archived, in timestamp order.
+// Commit is called once they have all been written, before they are deleted from the database;
+// if it returns an error, nothing is deleted.
+type ArchiveSink interface {
+	WriteTrade(trade *models.ArchivedTrade) error
+	WritePosition(position *models.ArchivedPosition) error
+	Commit(archive *models.Archive) error
+}
+
+// ArchiveSource provides the trades and positions being restored from an archive.
+// Each method returns io.EOF when there are no more.
+type ArchiveSource interface {
+	NextTrade() (*models.ArchivedTrade, error)
+	NextPosition() (*models.ArchivedPosition, error)
+}
+
+// SetRetentionPolicy creates or replaces the retention policy of an instrument.
+func (r *Repo) SetRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) error {
+	if _, err := r.db.ExecContext(ctx,
+		r.queries[setRetentionPolicy],
+		policy.InstrumentID, int64(policy.Retain/time.Second),
+	); err != nil {
+		return errors.Wrap(err, "could not set retention policy")
+	}
+	return nil
+}
+
+// DeleteRetentionPolicy deletes the retention policy of an instrument, returning false if it had none.
+func (r *Repo) DeleteRetentionPolicy(ctx context.Context, instrumentID int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, r.queries[deleteRetentionPolicy], instrumentID)
+	if err != nil {
+		return false, errors.Wrap(err, "could not delete retention policy")
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "could not get number of deleted retention policies")
+	}
+	return n > 0, nil
+}
+
+// ReadRetentionPolicies reads the retention policy of every instrument which has one.
+func (r *Repo) ReadRetentionPolicies(ctx context.Context) ([]*models.RetentionPolicy, error) {
+	rows, err := r.db.QueryContext(ctx, r.queries[readRetentionPolicies])
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read retention policies")
+	}
+	defer rows.Close()
+	var policies []*models.RetentionPolicy
+	for rows.Next() {
+		var policy models.RetentionPolicy
+		var seconds int64
+		if err := rows.Scan(&policy.InstrumentID, &seconds); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		policy.Retain = time.Duration(seconds) * time.Second
+		policies = append(policies, &policy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return policies, nil
+}
+
+// ReadArchives reads the archives of an instrument, or of every instrument if the instrument ID is zero.
+func (r *Repo) ReadArchives(ctx context.Context, instrumentID int64) ([]*models.Archive, error) {
+	rows, err := r.db.QueryContext(ctx, r.queries[readArchives], instrumentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read archives")
+	}
+	defer rows.Close()
+	var archives []*models.Archive
+	for rows.Next() {
+		archive, err := scanArchive(rows)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, archive)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return archives, nil
+}
+
+// ReadSeedPositions reads the current seed positions of an instrument, which positions are rebuilt from
+// in place of the archived trades.
+func (r *Repo) ReadSeedPositions(ctx context.Context, instrumentID int64) ([]*models.Position, error) {
+	rows, err := r.db.QueryContext(ctx, r.queries[readSeedPositions], instrumentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read seed positions")
+	}
+	defer rows.Close()
+	var positions []*models.Position
+	for rows.Next() {
+		var position models.Position
+		if err := rows.Scan(
+			&position.ID,
+			&position.InstrumentID,
+			&position.AccountID,
+			&position.Size,
+			utc(&position.Timestamp),
+		); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		positions = append(positions, &position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return positions, nil
+}
+
+// Archive writes the trades and positions in an instrument before the given time to the sink, deletes them,
+// and replaces the latest current position of each account with a seed position, so that positions can still
+// be rebuilt from the remaining trades. Every generation of positions is archived, so that they can be restored
+// exactly. It returns nil if there is nothing to archive.
+//
+// The archive runs in a single repeatable read transaction, so that the rows deleted are exactly those written
+// to the sink: trades written concurrently are left in place, and positions superseded concurrently fail the
+// archive rather than being archived as they were.
+func (r *Repo) Archive(ctx context.Context, instrumentID int64, before time.Time, sink ArchiveSink) (*models.Archive, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not begin transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	// the time is stored to the microsecond, so it is truncated to match the rows archived
+	before = before.UTC().Truncate(TimestampPrecision)
+	archive := &models.Archive{
+		InstrumentID: instrumentID,
+		Before:       before,
+	}
+	if err := tx.QueryRowContext(ctx,
+		r.queries[createArchive],
+		instrumentID, before,
+	).Scan(&archive.ID, utc(&archive.ArchivedAt)); err != nil {
+		return nil, errors.Wrap(err, "could not create archive")
+	}
+	if archive.Trades, err = r.archiveTrades(ctx, tx, archive, sink); err != nil {
+		return nil, err
+	}
+	seeds, err := r.archivePositions(ctx, tx, archive, sink)
+	if err != nil {
+		return nil, err
+	}
+	if archive.Trades == 0 && archive.Positions == 0 {
+		return nil, nil
+	}
+	if _, err := tx.ExecContext(ctx, r.queries[updateArchive], archive.ID, archive.Trades, archive.Positions); err != nil {
+		return nil, errors.Wrap(err, "could not update archive")
+	}
+	if _, err := tx.ExecContext(ctx, r.queries[deleteArchiveTrades], instrumentID, before); err != nil {
+		return nil, errors.Wrap(err, "could not delete archived trades")
+	}
+	if _, err := tx.ExecContext(ctx, r.queries[deleteArchivePositions], instrumentID, before); err != nil {
+		return nil, errors.Wrap(err, "could not delete archived positions")
+	}
+	partitions := r.txPartitions(tx)
+	for _, seed := range seeds {
+		seed.SupersededAt = nil
+		seed.TradeIDs = nil
+		seed.Seed = true
+		if err := r.insertArchivedPosition(ctx, partitions, seed); err != nil {
+			return nil, errors.Wrap(err, "could not create seed position")
+		}
+	}
+	if err := sink.Commit(archive); err != nil {
+		return nil, errors.Wrap(err, "commit archive sink failed")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "could not commit transaction")
+	}
+	partitions.commit()
+	return archive, nil
+}
+
+// archiveTrades writes the trades being archived to the sink, returning how many there were.
+func (r *Repo) archiveTrades(ctx context.Context, tx *sql.Tx, archive *models.Archive, sink ArchiveSink) (int64, error) {
+	rows, err := tx.QueryContext(ctx, r.queries[readArchiveTrades], archive.InstrumentID, archive.Before.UTC())
+	if err != nil {
+		return 0, errors.Wrap(err, "could not read archived trades")
+	}
+	defer rows.Close()
+	var n int64
+	for rows.Next() {
+		var trade models.ArchivedTrade
+		if err := rows.Scan(
+			&trade.ID,
+			utc(&trade.CreatedAt),
+			&trade.InstrumentID,
+			&trade.AccountID,
+			&trade.Size,
+			&trade.Price,
+			utc(&trade.Timestamp),
+			&trade.Ref,
+		); err != nil {
+			return 0, errors.Wrap(err, "scan failed")
+		}
+		if err := sink.WriteTrade(&trade); err != nil {
+			return 0, errors.Wrap(err, "write trade failed")
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, errors.Wrap(err, "rows failed")
+	}
+	return n, nil
+}
+
+// archivePositions writes the positions being archived to the sink, counting them in the archive,
+// and returns the latest current position of each account, which are to be replaced with seed positions.
+func (r *Repo) archivePositions(
+	ctx context.Context, tx *sql.Tx, archive *models.Archive, sink ArchiveSink,
+) ([]*models.ArchivedPosition, error) {
+	rows, err := tx.QueryContext(ctx, r.queries[readArchivePositions], archive.InstrumentID, archive.Before.UTC())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read archived positions")
+	}
+	defer rows.Close()
+	latest := make(map[int64]int)
+	var seeds []*models.ArchivedPosition
+	for rows.Next() {
+		var position models.ArchivedPosition
+		var supersededAt time.Time
+		var tradeIDs string
+		if err := rows.Scan(
+			&position.ID,
+			utc(&position.CreatedAt),
+			&position.InstrumentID,
+			&position.AccountID,
+			&position.Size,
+			utc(&position.Timestamp),
+			utc(&supersededAt),
+			&tradeIDs,
+			&position.Seed,
+		); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		if !supersededAt.IsZero() {
+			position.SupersededAt = &supersededAt
+		}
+		if position.TradeIDs, err = splitIDs(tradeIDs); err != nil {
+			return nil, errors.Wrap(err, "split trade IDs failed")
+		}
+		if err := sink.WritePosition(&position); err != nil {
+			return nil, errors.Wrap(err, "write position failed")
+		}
+		archive.Positions++
+		if position.SupersededAt != nil {
+			continue
+		}
+		// positions are read in timestamp order, so the last current position of an account is its latest
+		seed := position
+		if i, ok := latest[position.AccountID]; ok {
+			seeds[i] = &seed
+			continue
+		}
+		latest[position.AccountID] = len(seeds)
+		seeds = append(seeds, &seed)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return seeds, nil
+}
+
+// Restore inserts the trades and positions of an archive from the source back into the database, replacing
+// the seed positions the archive left. Only the latest archive of an instrument which has not been restored
+// can be restored, so that archives are restored in the reverse of the order they were made.
+func (r *Repo) Restore(ctx context.Context, archiveID int64, source ArchiveSource) (*models.Archive, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not begin transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	archive, err := scanArchive(tx.QueryRowContext(ctx, r.queries[readArchive], archiveID))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read archive")
+	}
+	if !archive.RestoredAt.IsZero() {
+		return nil, ErrArchiveRestored
+	}
+	var latestID int64
+	if err := tx.QueryRowContext(ctx, r.queries[readLatestArchiveID], archive.InstrumentID).Scan(&latestID); err != nil {
+		return nil, errors.Wrap(err, "could not read latest archive")
+	}
+	if latestID != archive.ID {
+		return nil, errors.Wrapf(ErrArchiveNotLatest, "archive %d must be restored first", latestID)
+	}
+	if _, err := tx.ExecContext(ctx, r.queries[deleteSeedPositions], archive.InstrumentID, archive.Before.UTC()); err != nil {
+		return nil, errors.Wrap(err, "could not delete seed positions")
+	}
+	partitions := r.txPartitions(tx)
+	var trades, positions int64
+	for {
+		trade, err := source.NextTrade()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "next trade failed")
+		}
+		if err := r.insertArchivedTrade(ctx, partitions, archive, trade); err != nil {
+			return nil, errors.Wrapf(err, "could not restore trade %d", trade.ID)
+		}
+		trades++
+	}
+	for {
+		position, err := source.NextPosition()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "next position failed")
+		}
+		if position.InstrumentID != archive.InstrumentID || !position.Timestamp.Before(archive.Before) {
+			return nil, errors.Errorf("position %d is outside the archive", position.ID)
+		}
+		if err := r.insertArchivedPosition(ctx, partitions, position); err != nil {
+			return nil, errors.Wrapf(err, "could not restore position %d", position.ID)
+		}
+		positions++
+	}
+	if trades != archive.Trades || positions != archive.Positions {
+		return nil, errors.Errorf(
+			"archive has %d trades and %d positions but %d and %d were recorded",
+			trades, positions, archive.Trades, archive.Positions,
+		)
+	}
+	if _, err := tx.ExecContext(ctx, r.queries[markArchiveRestored], archive.ID); err != nil {
+		return nil, errors.Wrap(err, "could not mark archive restored")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "could not commit transaction")
+	}
+	partitions.commit()
+	return archive, nil
+}
+
+func (r *Repo) insertArchivedTrade(ctx context.Context, p *txPartitions, archive *models.Archive, trade *models.ArchivedTrade) error {
+	if trade.InstrumentID != archive.InstrumentID || !trade.Timestamp.Before(archive.Before) {
+		return errors.New("trade is outside the archive")
+	}
+	if err := p.ensure(ctx, "trades", trade.Timestamp); err != nil {
+		return err
+	}
+	res, err := p.tx.ExecContext(ctx,
+		r.queries[restoreTrade],
+		trade.ID, trade.CreatedAt.UTC(), trade.InstrumentID, trade.AccountID, trade.Size, trade.Price, trade.Timestamp.UTC(),
+		trade.Ref,
+	)
+	if err != nil {
+		return err
+	}
+	return checkRestored(res)
+}
+
+// insertArchivedPosition inserts an archived position with its original ID.
+func (r *Repo) insertArchivedPosition(ctx context.Context, p *txPartitions, position *models.ArchivedPosition) error {
+	if err := p.ensure(ctx, "positions", position.Timestamp); err != nil {
+		return err
+	}
+	var supersededAt sql.NullTime
+	if position.SupersededAt != nil {
+		supersededAt = sql.NullTime{Time: position.SupersededAt.UTC(), Valid: true}
+	}
+	res, err := p.tx.ExecContext(ctx,
+		r.queries[restorePosition],
+		position.ID, position.CreatedAt.UTC(), position.InstrumentID, position.AccountID, position.Size,
+		position.Timestamp.UTC(), supersededAt, joinIDs(position.TradeIDs), position.Seed,
+	)
+	if err != nil {
+		return err
+	}
+	return checkRestored(res)
+}
+
+// checkRestored returns ErrDuplicateID if a restore query inserted nothing, as a row with the ID already exists.
+func checkRestored(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "could not read rows affected")
+	}
+	if n == 0 {
+		return ErrDuplicateID
+	}
+	return nil
+}
+
+// scanArchive scans an archive from a row of the archives table.
+func scanArchive(row scanner) (*models.Archive, error) {
+	var archive models.Archive
+	if err := row.Scan(
+		&archive.ID,
+		&archive.InstrumentID,
+		utc(&archive.Before),
+		utc(&archive.ArchivedAt),
+		&archive.Trades,
+		&archive.Positions,
+		utc(&archive.RestoredAt),
+	); err != nil {
+		return nil, errors.Wrap(err, "scan failed")
+	}
+	return &archive, nil
+}
@@ -0,0 +1,196 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSink records the rows archived.
+type recordingSink struct {
+	trades    []*models.ArchivedTrade
+	positions []*models.ArchivedPosition
+	committed *models.Archive
+}
+
+func (s *recordingSink) WriteTrade(trade *models.ArchivedTrade) error {
+	s.trades = append(s.trades, trade)
+	return nil
+}
+
+func (s *recordingSink) WritePosition(position *models.ArchivedPosition) error {
+	s.positions = append(s.positions, position)
+	return nil
+}
+
+func (s *recordingSink) Commit(archive *models.Archive) error {
+	s.committed = archive
+	return nil
+}
+
+func TestArchive(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	before := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	ts := time.Date(2022, time.April, 1, 2, 3, 4, 0, time.UTC)
+	superseded := ts.Add(time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[createArchive])).WithArgs(int64(1), before).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "archived_at"}).AddRow(5, before.Add(time.Hour)),
+	)
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[readArchiveTrades])).WithArgs(int64(1), before).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "created_at", "instrument_id", "account_id", "size", "price", "timestamp", "ref"}).
+			AddRow(1, ts, 1, 2, 10, 100.5, ts, "").
+			AddRow(2, ts, 1, 2, -4, 101, ts.Add(time.Minute), "trades.jsonl:0"),
+	)
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[readArchivePositions])).WithArgs(int64(1), before).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "created_at", "instrument_id", "account_id", "size", "timestamp", "superseded_at", "trade_ids", "seed"}).
+			AddRow(1, ts, 1, 2, 10, ts, superseded, "1", false).
+			AddRow(3, superseded, 1, 2, 10, ts, nil, "1", false).
+			AddRow(4, superseded, 1, 2, 6, ts.Add(time.Minute), nil, "2", false),
+	)
+	mock.ExpectExec(regexp.QuoteMeta(r.queries[updateArchive])).WithArgs(int64(5), int64(2), int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(r.queries[deleteArchiveTrades])).WithArgs(int64(1), before).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(r.queries[deleteArchivePositions])).WithArgs(int64(1), before).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	// the latest current position of the account is replaced with a seed position
+	mock.ExpectExec(regexp.QuoteMeta(r.queries[ensurePartition])).WithArgs("positions", ts.Add(time.Minute)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(r.queries[restorePosition])).WithArgs(
+		int64(4), superseded, int64(1), int64(2), decimal.NewFromInt(6), ts.Add(time.Minute), sql.NullTime{}, "", true,
+	).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	sink := &recordingSink{}
+	archive, err := r.Archive(context.Background(), 1, before.Add(time.Nanosecond), sink)
+	require.NoError(t, err)
+	require.Equal(t, &models.Archive{
+		ID:           5,
+		InstrumentID: 1,
+		Before:       before,
+		ArchivedAt:   before.Add(time.Hour),
+		Trades:       2,
+		Positions:    3,
+	}, archive)
+	require.Equal(t, archive, sink.committed)
+	require.Len(t, sink.trades, 2)
+	require.Len(t, sink.positions, 3)
+	require.Equal(t, &superseded, sink.positions[0].SupersededAt)
+	require.Equal(t, []int64{2}, sink.positions[2].TradeIDs)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestoreNotLatest(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	before := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[readArchive])).WithArgs(int64(5)).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "instrument_id", "archived_before", "archived_at", "trades", "positions", "restored_at"}).
+			AddRow(5, 1, before, before, 2, 3, nil),
+	)
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[readLatestArchiveID])).WithArgs(int64(1)).WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(6),
+	)
+	mock.ExpectRollback()
+
+	_, err = r.Restore(context.Background(), 5, nil)
+	require.ErrorIs(t, err, ErrArchiveNotLatest)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// sliceSource is an archive source of the given rows.
+type sliceSource struct {
+	trades    []*models.ArchivedTrade
+	positions []*models.ArchivedPosition
+}
+
+func (s *sliceSource) NextTrade() (*models.ArchivedTrade, error) {
+	if len(s.trades) == 0 {
+		return nil, io.EOF
+	}
+	trade := s.trades[0]
+	s.trades = s.trades[1:]
+	return trade, nil
+}
+
+func (s *sliceSource) NextPosition() (*models.ArchivedPosition, error) {
+	if len(s.positions) == 0 {
+		return nil, io.EOF
+	}
+	position := s.positions[0]
+	s.positions = s.positions[1:]
+	return position, nil
+}
+
+func TestRestoreDuplicateID(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	before := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	ts := time.Date(2022, time.April, 1, 2, 3, 4, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[readArchive])).WithArgs(int64(5)).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "instrument_id", "archived_before", "archived_at", "trades", "positions", "restored_at"}).
+			AddRow(5, 1, before, before, 1, 0, nil),
+	)
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[readLatestArchiveID])).WithArgs(int64(1)).WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(5),
+	)
+	mock.ExpectExec(regexp.QuoteMeta(r.queries[deleteSeedPositions])).WithArgs(int64(1), before).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(r.queries[ensurePartition])).WithArgs("trades", ts).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// a trade with the ID already exists, so nothing is inserted
+	mock.ExpectExec(regexp.QuoteMeta(r.queries[restoreTrade])).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	source := &sliceSource{trades: []*models.ArchivedTrade{
+		{ID: 1, CreatedAt: ts, InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(10), Price: decimal.NewFromInt(100), Timestamp: ts},
+	}}
+	_, err = r.Restore(context.Background(), 5, source)
+	require.ErrorIs(t, err, ErrDuplicateID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,441 @@
+package repo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCorruptSegment indicates that a segment file of a FileRepo is corrupt somewhere other than
+// at the end of the log, where a torn write from a crash would be recovered from instead.
+var ErrCorruptSegment = errors.New("corrupt segment")
+
+const (
+	// segmentExt is the file extension of segment files.
+	segmentExt = ".seg"
+	// frameHeaderSize is the size of the header before each record: the length and checksum of the record.
+	frameHeaderSize = 8
+	// maxRecordSize bounds the length read from a frame header, so a corrupt header is not trusted.
+	maxRecordSize = 16 << 20
+	// indexInterval is the number of records between entries in the sparse time index.
+	indexInterval = 64
+	// defaultSegmentSize is the size a segment grows to before a new segment is started.
+	defaultSegmentSize = 4 << 20
+	// compactingSuffix and replacedSuffix are appended to the directory of a log while it is compacted.
+	compactingSuffix = ".compact"
+	replacedSuffix   = ".old"
+)
+
+// castagnoli is the CRC-32C table used to checksum records.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// These are the types of event recorded in the log of a FileRepo.
+const (
+	tradeEvent             = "trade"
+	positionEvent          = "position"
+	supersedeEvent         = "supersede"
+	portfolioEvent         = "portfolio"
+	portfolioAccountsEvent = "portfolio_accounts"
+	checkpointEvent        = "checkpoint"
+)
+
+// fileEvent is a record in the log of a FileRepo. RecordedAt is the system time the event was
+// recorded at in unix nanoseconds, which is the time positions are created or superseded at.
+// A checkpoint is written by compaction to record the last position ID, which may have been compacted away.
+type fileEvent struct {
+	Type           string            `json:"type"`
+	RecordedAt     int64             `json:"recorded_at"`
+	Trade          *models.Trade     `json:"trade,omitempty"`
+	Position       *models.Position  `json:"position,omitempty"`
+	Supersede      *supersession     `json:"supersede,omitempty"`
+	Portfolio      *models.Portfolio `json:"portfolio,omitempty"`
+	LastPositionID int64             `json:"last_position_id,omitempty"`
+}
+
+// supersession supersedes the current positions in an instrument at or after From,
+// or all of them if From is nil.
+type supersession struct {
+	InstrumentID int64      `json:"instrument_id"`
+	From         *time.Time `json:"from,omitempty"`
+}
+
+// UnmarshalJSON unmarshals a supersession, reading From as unix seconds if it is a number,
+// as it was written before timestamps were stored with sub-second precision.
+func (s *supersession) UnmarshalJSON(b []byte) error {
+	var v struct {
+		InstrumentID int64           `json:"instrument_id"`
+		From         json.RawMessage `json:"from"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*s = supersession{InstrumentID: v.InstrumentID}
+	if len(v.From) == 0 || string(v.From) == "null" {
+		return nil
+	}
+	var from time.Time
+	var seconds int64
+	if err := json.Unmarshal(v.From, &seconds); err == nil {
+		from = time.Unix(seconds, 0)
+	} else if err := json.Unmarshal(v.From, &from); err != nil {
+		return errors.Wrap(err, "unmarshal supersession from failed")
+	}
+	from = from.UTC()
+	s.From = &from
+	return nil
+}
+
+// indexEntry is an entry in the sparse time index of a segment log, locating the first record
+// recorded at or after the given time.
+type indexEntry struct {
+	recordedAt int64
+	seq        int
+	offset     int64
+}
+
+// ErrLogFailed indicates that a log could not be synced to disk, after which it refuses further writes
+// until it is opened again, as it is uncertain what was written to disk.
+var ErrLogFailed = errors.New("log failed")
+
+// segmentLog is an append-only log of events stored in a directory of numbered segment files.
+// Each record is framed by its length and a CRC-32C checksum, so that a record torn by a crash
+// can be detected and truncated when the log is opened.
+// It is not safe for concurrent use.
+type segmentLog struct {
+	dir         string
+	segmentSize int64
+	seqs        []int
+	active      *os.File
+	activeSize  int64
+	lastOffset  int64 // the offset of the last record appended to the active segment
+	index       []indexEntry
+	sinceIndex  int
+	failed      error // set once the log fails to sync, failing every later append
+}
+
+// openSegmentLog opens the log in the directory, creating it if necessary, and replays every event in it.
+// A torn or corrupt record at the end of the last segment is truncated, as left by a crash part way through
+// an append. Corruption anywhere else fails with ErrCorruptSegment.
+func openSegmentLog(dir string, segmentSize int64, replay func(*fileEvent) error) (*segmentLog, error) {
+	if err := recoverCompaction(dir); err != nil {
+		return nil, errors.Wrap(err, "recover compaction failed")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "create log directory failed")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read log directory failed")
+	}
+	l := &segmentLog{
+		dir:         dir,
+		segmentSize: segmentSize,
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(name, segmentExt))
+		if err != nil {
+			return nil, errors.Wrapf(ErrCorruptSegment, "unexpected segment file %s", name)
+		}
+		l.seqs = append(l.seqs, seq)
+	}
+	sort.Ints(l.seqs)
+	for i, seq := range l.seqs {
+		last := i == len(l.seqs)-1
+		end, err := l.scan(seq, -1, func(e *fileEvent, offset int64) error {
+			l.indexRecord(e, seq, offset)
+			return replay(e)
+		})
+		var corrupt *corruptRecordError
+		switch {
+		case errors.As(err, &corrupt) && last:
+			logger.WithFields(logrus.Fields{
+				"segment": l.path(seq),
+				"offset":  end,
+			}).WithError(err).Warn("truncating torn record at end of log")
+			if err := os.Truncate(l.path(seq), end); err != nil {
+				return nil, errors.Wrap(err, "truncate segment failed")
+			}
+		case errors.As(err, &corrupt):
+			return nil, errors.Wrapf(ErrCorruptSegment, "%s: %s", l.path(seq), err)
+		case err != nil:
+			return nil, errors.Wrap(err, "scan segment failed")
+		}
+		if last {
+			l.activeSize = end
+		}
+	}
+	if len(l.seqs) == 0 {
+		l.seqs = []int{1}
+	}
+	seq := l.seqs[len(l.seqs)-1]
+	if l.active, err = os.OpenFile(l.path(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return nil, errors.Wrap(err, "open segment failed")
+	}
+	return l, nil
+}
+
+// append appends an event to the log, starting a new segment if the active segment is full.
+func (l *segmentLog) append(e *fileEvent) error {
+	if l.failed != nil {
+		return l.failed
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "marshal event failed")
+	}
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, castagnoli))
+	copy(frame[frameHeaderSize:], payload)
+	if l.activeSize > 0 && l.activeSize+int64(len(frame)) > l.segmentSize {
+		if err := l.roll(); err != nil {
+			return l.fail(errors.Wrap(err, "roll segment failed"))
+		}
+	}
+	seq := l.seqs[len(l.seqs)-1]
+	offset := l.activeSize
+	if _, err := l.active.Write(frame); err != nil {
+		// drop any partial write, so that later appends are not read as part of a torn record
+		_ = l.active.Truncate(offset)
+		return errors.Wrap(err, "write record failed")
+	}
+	l.lastOffset = offset
+	l.activeSize += int64(len(frame))
+	l.indexRecord(e, seq, offset)
+	return nil
+}
+
+// appendSynced appends an event to the log and syncs it to disk. If the sync fails, the record is truncated,
+// so that it is not replayed when the log is next opened, and the log fails.
+func (l *segmentLog) appendSynced(e *fileEvent) error {
+	if err := l.append(e); err != nil {
+		return err
+	}
+	if err := l.active.Sync(); err != nil {
+		if truncErr := l.active.Truncate(l.lastOffset); truncErr == nil {
+			l.activeSize = l.lastOffset
+		}
+		return l.fail(errors.Wrap(err, "sync segment failed"))
+	}
+	return nil
+}
+
+// fail marks the log as failed by the error, so that it refuses further writes, and returns the failure.
+func (l *segmentLog) fail(err error) error {
+	l.failed = errors.Wrapf(ErrLogFailed, "%s: %s", l.dir, err)
+	return l.failed
+}
+
+// roll syncs and closes the active segment, and starts the next.
+func (l *segmentLog) roll() error {
+	if err := l.active.Sync(); err != nil {
+		return errors.Wrap(err, "sync segment failed")
+	}
+	if err := l.active.Close(); err != nil {
+		return errors.Wrap(err, "close segment failed")
+	}
+	seq := l.seqs[len(l.seqs)-1] + 1
+	f, err := os.OpenFile(l.path(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "create segment failed")
+	}
+	l.seqs = append(l.seqs, seq)
+	l.active = f
+	l.activeSize = 0
+	return nil
+}
+
+// indexRecord adds the record to the sparse time index if it is the first in its segment,
+// or if enough records have been added since the last entry.
+func (l *segmentLog) indexRecord(e *fileEvent, seq int, offset int64) {
+	if offset == 0 || l.sinceIndex >= indexInterval {
+		l.index = append(l.index, indexEntry{recordedAt: e.RecordedAt, seq: seq, offset: offset})
+		l.sinceIndex = 0
+	}
+	l.sinceIndex++
+}
+
+// readUntil reads every event recorded at or before the given time, in the order they were appended.
+// The sparse time index bounds the read, so that the log after the time is not read.
+func (l *segmentLog) readUntil(recordedAt int64, fn func(*fileEvent) error) error {
+	// the first entry recorded after the time bounds the records which may have been recorded before it
+	i := sort.Search(len(l.index), func(i int) bool {
+		return l.index[i].recordedAt > recordedAt
+	})
+	stopSeq, stopOffset := -1, int64(-1)
+	if i < len(l.index) {
+		stopSeq, stopOffset = l.index[i].seq, l.index[i].offset
+	}
+	for _, seq := range l.seqs {
+		if stopSeq >= 0 && seq > stopSeq {
+			break
+		}
+		limit := int64(-1)
+		if seq == stopSeq {
+			limit = stopOffset
+		}
+		if _, err := l.scan(seq, limit, func(e *fileEvent, _ int64) error {
+			if e.RecordedAt > recordedAt {
+				return nil
+			}
+			return fn(e)
+		}); err != nil {
+			return errors.Wrap(err, "scan segment failed")
+		}
+	}
+	return nil
+}
+
+// sync flushes the active segment to disk.
+func (l *segmentLog) sync() error {
+	return errors.Wrap(l.active.Sync(), "sync segment failed")
+}
+
+// close syncs and closes the active segment.
+func (l *segmentLog) close() error {
+	if err := l.sync(); err != nil {
+		return err
+	}
+	return errors.Wrap(l.active.Close(), "close segment failed")
+}
+
+func (l *segmentLog) path(seq int) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%08d%s", seq, segmentExt))
+}
+
+// compact rewrites the log with only the events to keep, followed by the checkpoint if one is given,
+// and returns the compacted log opened in place of this one, which is closed.
+// The compacted log is written alongside the log and swapped in by renaming, so that a crash part way through
+// leaves either the old or the compacted log in place, as resolved by recoverCompaction when it is next opened.
+func (l *segmentLog) compact(keep func(*fileEvent) bool, checkpoint *fileEvent, replay func(*fileEvent) error) (*segmentLog, error) {
+	if err := l.close(); err != nil {
+		return nil, err
+	}
+	tmp := l.dir + compactingSuffix
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, errors.Wrap(err, "remove compacted log failed")
+	}
+	compacted, err := openSegmentLog(tmp, l.segmentSize, func(*fileEvent) error { return nil })
+	if err != nil {
+		return nil, errors.Wrap(err, "create compacted log failed")
+	}
+	for _, seq := range l.seqs {
+		if _, err := l.scan(seq, -1, func(e *fileEvent, _ int64) error {
+			if !keep(e) {
+				return nil
+			}
+			return compacted.append(e)
+		}); err != nil {
+			_ = compacted.close()
+			return nil, errors.Wrap(err, "copy segment failed")
+		}
+	}
+	if checkpoint != nil {
+		if err := compacted.append(checkpoint); err != nil {
+			_ = compacted.close()
+			return nil, errors.Wrap(err, "write checkpoint failed")
+		}
+	}
+	if err := compacted.close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(l.dir, l.dir+replacedSuffix); err != nil {
+		return nil, errors.Wrap(err, "replace log failed")
+	}
+	if err := os.Rename(tmp, l.dir); err != nil {
+		return nil, errors.Wrap(err, "replace log failed")
+	}
+	if err := os.RemoveAll(l.dir + replacedSuffix); err != nil {
+		return nil, errors.Wrap(err, "remove replaced log failed")
+	}
+	return openSegmentLog(l.dir, l.segmentSize, replay)
+}
+
+// recoverCompaction resolves a compaction of the log in the directory which was interrupted by a crash.
+// If the log was renamed aside, the compacted log was complete and replaces it, otherwise the compacted log
+// is incomplete and is removed.
+func recoverCompaction(dir string) error {
+	replaced := dir + replacedSuffix
+	if _, err := os.Stat(replaced); err == nil {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err := os.Rename(dir+compactingSuffix, dir); err != nil {
+				return errors.Wrap(err, "replace log failed")
+			}
+		}
+		if err := os.RemoveAll(replaced); err != nil {
+			return errors.Wrap(err, "remove replaced log failed")
+		}
+	}
+	return errors.Wrap(os.RemoveAll(dir+compactingSuffix), "remove compacted log failed")
+}
+
+// corruptRecordError describes a record which is torn or fails its checksum.
+type corruptRecordError struct {
+	reason string
+}
+
+func (e *corruptRecordError) Error() string {
+	return e.reason
+}
+
+// scan reads the records of a segment up to the limit offset, or the whole segment if the limit is negative,
+// calling fn with each event and its offset. It returns the offset after the last valid record, and
+// a *corruptRecordError if a record is torn or fails its checksum.
+func (l *segmentLog) scan(seq int, limit int64, fn func(*fileEvent, int64) error) (int64, error) {
+	f, err := os.Open(l.path(seq))
+	if err != nil {
+		return 0, errors.Wrap(err, "open segment failed")
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var offset int64
+	header := make([]byte, frameHeaderSize)
+	for limit < 0 || offset < limit {
+		if _, err := io.ReadFull(r, header); errors.Is(err, io.EOF) {
+			return offset, nil
+		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+			return offset, &corruptRecordError{reason: "torn record header"}
+		} else if err != nil {
+			return offset, errors.Wrap(err, "read record header failed")
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		if length > maxRecordSize {
+			return offset, &corruptRecordError{reason: fmt.Sprintf("record length %d exceeds the maximum", length)}
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return offset, &corruptRecordError{reason: "torn record"}
+		} else if err != nil {
+			return offset, errors.Wrap(err, "read record failed")
+		}
+		if crc32.Checksum(payload, castagnoli) != binary.BigEndian.Uint32(header[4:8]) {
+			return offset, &corruptRecordError{reason: "record checksum mismatch"}
+		}
+		var e fileEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return offset, &corruptRecordError{reason: "record is not a valid event"}
+		}
+		if err := fn(&e, offset); err != nil {
+			return offset, err
+		}
+		offset += int64(frameHeaderSize) + int64(length)
+	}
+	return offset, nil
+}
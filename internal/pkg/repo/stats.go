@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"context"
+	"time"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// Period is the length of the calendar periods that stats are aggregated over.
+type Period string
+
+// These are the supported periods.
+const (
+	Day   Period = "day"
+	Week  Period = "week"
+	Month Period = "month"
+)
+
+// ParsePeriod parses the name of a period.
+func ParsePeriod(name string) (Period, error) {
+	switch p := Period(name); p {
+	case Day, Week, Month:
+		return p, nil
+	default:
+		return "", errors.Errorf("unknown period %q, should be one of: day, week, month", name)
+	}
+}
+
+// StatsRepo is used to aggregate statistics over trade and position records in the database.
+//go:generate mockery --name StatsRepo --filename stats_repo_mock.go
+type StatsRepo interface {
+	ReadStats(ctx context.Context, instrumentID int64, period Period, from, to time.Time) ([]*models.Stats, error)
+}
+
+// ReadStats reads the stats of an instrument for every period which overlaps the range [from, to).
+// Weeks start on Monday, and periods are in UTC. The first and last periods are clipped to the range,
+// and a zero from time starts the range at the first trade in the instrument.
+func (r *Repo) ReadStats(ctx context.Context, instrumentID int64, period Period, from, to time.Time) ([]*models.Stats, error) {
+	rows, err := r.db.QueryContext(ctx, r.queries[readStats], instrumentID, string(period), nullTime(from), to.UTC())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read stats")
+	}
+	defer rows.Close()
+	var stats []*models.Stats
+	for rows.Next() {
+		s := models.Stats{InstrumentID: instrumentID}
+		var flat, long, short float64
+		if err := rows.Scan(
+			utc(&s.Period),
+			&s.TradeCount,
+			&s.GrossVolume,
+			&s.NetVolume,
+			&s.Notional,
+			&s.Turnover,
+			&s.LargestTrade,
+			&s.MaxPosition,
+			&s.MinPosition,
+			&s.AvgPosition,
+			&flat,
+			&long,
+			&short,
+		); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		s.Flat = seconds(flat)
+		s.Long = seconds(long)
+		s.Short = seconds(short)
+		stats = append(stats, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return stats, nil
+}
+
+// seconds converts a number of seconds returned by a query to a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+	"tradetracker/pkg/decimal"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePeriod(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"day", "week", "month"} {
+		period, err := ParsePeriod(name)
+		require.NoError(t, err)
+		require.Equal(t, Period(name), period)
+	}
+	_, err := ParsePeriod("year")
+	require.Error(t, err)
+}
+
+func TestReadStats(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	from := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(48 * time.Hour)
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[readStats],
+	)).WithArgs(int64(1), "day", sql.NullTime{}, to.UTC()).WillReturnRows(
+		sqlmock.NewRows([]string{
+			"period", "trade_count", "gross_volume", "net_volume", "notional", "turnover", "largest_trade",
+			"max_position", "min_position", "avg_position", "flat_seconds", "long_seconds", "short_seconds",
+		}).
+			AddRow(from, 3, 30, 10, "300.5", 1.5, -15, 20, -5, 7.5, 3600, 79200, 3600).
+			AddRow(from.Add(24*time.Hour), 0, 0, 0, 0, 0, 0, 10, 10, 10, 0, 86400, 0),
+	)
+
+	stats, err := r.ReadStats(context.Background(), 1, Day, time.Time{}, to)
+	require.NoError(t, err)
+	require.Len(t, stats, 2)
+	require.Equal(t, int64(1), stats[0].InstrumentID)
+	require.Equal(t, from, stats[0].Period)
+	require.Equal(t, int64(3), stats[0].TradeCount)
+	require.Equal(t, decimal.NewFromInt(30), stats[0].GrossVolume)
+	require.Equal(t, decimal.NewFromInt(10), stats[0].NetVolume)
+	require.Equal(t, decimal.MustParse("300.5"), stats[0].Notional)
+	require.Equal(t, decimal.NewFromInt(-15), stats[0].LargestTrade)
+	require.Equal(t, 7.5, stats[0].AvgPosition)
+	require.Equal(t, time.Hour, stats[0].Flat)
+	require.Equal(t, 22*time.Hour, stats[0].Long)
+	require.Equal(t, time.Hour, stats[0].Short)
+	require.Equal(t, 24*time.Hour, stats[1].Long)
+}
@@ -2,42 +2,77 @@ package repo
 
 import (
 	"context"
+	"database/sql"
 	"time"
+	"tradetracker/pkg/decimal"
 	"tradetracker/pkg/models"
 
 	"github.com/pkg/errors"
 )
 
 // TradeRepo is used to perform CRUD operations on trade records in the database.
+//
 //go:generate mockery --name TradeRepo --filename trade_repo_mock.go
 type TradeRepo interface {
 	CreateTrade(ctx context.Context, trade *models.Trade) (int, error)
 	ReadTrades(ctx context.Context, instrumentID int64, after time.Time) (<-chan *models.Trade, error)
+	ListTrades(ctx context.Context, filter TradeFilter) ([]*models.Trade, error)
 }
 
-// CreateTrade creates a new trade.
+// TradeFilter filters the trades listed by ListTrades.
+// Trades are listed in time order, and a page of trades following on from a previous page
+// is listed by setting AfterID to the ID of the last trade in the previous page.
+type TradeFilter struct {
+	InstrumentID int64
+	From, To     time.Time       // the range of trade timestamps [From, To)
+	MinSize      decimal.Decimal // the minimum absolute trade size
+	MinPrice     *decimal.Decimal
+	MaxPrice     *decimal.Decimal
+	AfterID      int64 // the ID of the trade to list trades after, or zero to list from the start
+	Limit        int64 // the maximum number of trades to list, or zero for no limit
+}
+
+// ErrUnknownCursor indicates that the trade to list trades after does not exist in the instrument,
+// for example because it has been archived, rather than there being no more trades to list.
+var ErrUnknownCursor = errors.New("unknown cursor")
+
+// ErrDuplicateTrade indicates that a trade with the same ref and timestamp has already been stored.
+var ErrDuplicateTrade = errors.New("duplicate trade")
+
+// CreateTrade creates a new trade, or returns an error wrapping ErrDuplicateTrade if a trade
+// with the same ref and timestamp has already been stored.
 func (r *Repo) CreateTrade(ctx context.Context, trade *models.Trade) (int, error) {
+	if err := r.ensurePartition(ctx, "trades", trade.Timestamp); err != nil {
+		return 0, err
+	}
 	var txID int
 	if err := r.db.QueryRowContext(ctx,
 		r.queries[createTrade],
-		trade.InstrumentID, trade.Size, trade.Price, trade.Timestamp.Unix(),
-	).Scan(&txID); err != nil {
+		trade.InstrumentID, trade.AccountID, trade.Size, trade.Price, trade.Timestamp.UTC(), trade.Ref,
+	).Scan(&txID); errors.Is(err, sql.ErrNoRows) {
+		return 0, errors.Wrapf(ErrDuplicateTrade, "ref %q", trade.Ref)
+	} else if err != nil {
 		return 0, errors.Wrap(err, "could not create trade")
 	}
 	return txID, nil
 }
 
-// ReadTrades reads trades from the database and sends them on the returned channel.
+// ReadTrades reads trades from the database and sends them on the returned channel,
+// which is closed once they have all been sent or the context is cancelled.
 func (r *Repo) ReadTrades(ctx context.Context, instrumentID int64, after time.Time) (<-chan *models.Trade, error) { // nolint:unparam // it's okay that the error is always nil
 	ch := make(chan *models.Trade)
 	go func() {
-		rows, err := r.db.QueryContext(ctx, r.queries[readTrades], instrumentID, after.Unix())
+		defer close(ch)
+		// a cancelled context stops the read, rather than failing it
+		rows, err := r.db.QueryContext(ctx, r.queries[readTrades], instrumentID, after.UTC())
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			logger.Fatalln(errors.Wrap(err, "could not read trades"))
 		}
-		defer close(ch)
 		defer func() {
-			if err := rows.Close(); err != nil {
+			if err := rows.Close(); err != nil && ctx.Err() == nil {
 				logger.Fatalln(errors.Wrap(err, "close rows failed"))
 			}
 		}()
@@ -46,18 +81,69 @@ func (r *Repo) ReadTrades(ctx context.Context, instrumentID int64, after time.Ti
 			if err := rows.Scan(
 				&trade.ID,
 				&trade.InstrumentID,
+				&trade.AccountID,
 				&trade.Price,
 				&trade.Size,
-				&trade.Timestamp,
+				utc(&trade.Timestamp),
 			); err != nil {
 				logger.Fatalln(errors.Wrap(err, "scan failed"))
 				continue
 			}
-			ch <- &trade
+			select {
+			case ch <- &trade:
+			case <-ctx.Done():
+				return
+			}
 		}
-		if err := rows.Err(); err != nil {
+		if err := rows.Err(); err != nil && ctx.Err() == nil {
 			logger.Fatalln(errors.Wrap(err, "rows failed"))
 		}
 	}()
 	return ch, nil
 }
+
+// ListTrades lists the trades matching the filter, ordered by timestamp and then ID,
+// or returns an error wrapping ErrUnknownCursor if the trade to list after does not exist.
+func (r *Repo) ListTrades(ctx context.Context, filter TradeFilter) ([]*models.Trade, error) {
+	// trades are listed after the timestamp and ID of the cursor trade
+	var afterTimestamp time.Time
+	if filter.AfterID != 0 {
+		if err := r.db.QueryRowContext(ctx,
+			r.queries[readTradeCursor], filter.AfterID, filter.InstrumentID,
+		).Scan(utc(&afterTimestamp)); errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.Wrapf(ErrUnknownCursor, "trade %d", filter.AfterID)
+		} else if err != nil {
+			return nil, errors.Wrap(err, "could not read cursor")
+		}
+	}
+	// a nil price bound is passed as null
+	rows, err := r.db.QueryContext(ctx,
+		r.queries[listTrades],
+		filter.InstrumentID, filter.From.UTC(), filter.To.UTC(), filter.MinSize,
+		filter.MinPrice, filter.MaxPrice, filter.AfterID, filter.Limit, afterTimestamp,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list trades")
+	}
+	defer rows.Close()
+	var trades []*models.Trade
+	for rows.Next() {
+		var trade models.Trade
+		if err := rows.Scan(
+			&trade.ID,
+			utc(&trade.CreatedAt),
+			&trade.InstrumentID,
+			&trade.AccountID,
+			&trade.Price,
+			&trade.Size,
+			utc(&trade.Timestamp),
+		); err != nil {
+			return nil, errors.Wrap(err, "scan failed")
+		}
+		trades = append(trades, &trade)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows failed")
+	}
+	return trades, nil
+}
@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"testing"
 	"time"
+	"tradetracker/pkg/decimal"
 	"tradetracker/pkg/models"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -23,18 +24,106 @@ func TestCreateTrade(t *testing.T) {
 
 	trade := &models.Trade{
 		InstrumentID: 1,
-		Price:        10.0,
-		Size:         20,
+		AccountID:    2,
+		Price:        decimal.NewFromInt(10),
+		Size:         decimal.NewFromInt(20),
 		Timestamp:    time.Date(2022, time.May, 1, 2, 3, 4, 5, time.UTC),
 	}
 
+	mock.ExpectExec(regexp.QuoteMeta(
+		r.queries[ensurePartition],
+	)).WithArgs("trades", trade.Timestamp.UTC()).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectQuery(regexp.QuoteMeta(
 		r.queries[createTrade],
-	)).WithArgs(trade.InstrumentID, trade.Size, trade.Price, trade.Timestamp.Unix()).WillReturnRows(
+	)).WithArgs(trade.InstrumentID, trade.AccountID, trade.Size, trade.Price, trade.Timestamp.UTC(), trade.Ref).WillReturnRows(
 		sqlmock.NewRows([]string{"id"}).AddRow(1),
 	)
 
 	id, err := r.CreateTrade(context.Background(), trade)
 	require.NoError(t, err)
 	require.Equal(t, 1, id)
+
+	// the partition is only ensured for the first trade in the month
+	trade.Timestamp = trade.Timestamp.Add(time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[createTrade],
+	)).WithArgs(trade.InstrumentID, trade.AccountID, trade.Size, trade.Price, trade.Timestamp.UTC(), trade.Ref).WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(2),
+	)
+
+	id, err = r.CreateTrade(context.Background(), trade)
+	require.NoError(t, err)
+	require.Equal(t, 2, id)
+
+	// a trade with the same ref and timestamp as a stored trade is not stored again
+	trade.Ref = "trades.jsonl:0"
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[createTrade],
+	)).WithArgs(trade.InstrumentID, trade.AccountID, trade.Size, trade.Price, trade.Timestamp.UTC(), trade.Ref).WillReturnRows(
+		sqlmock.NewRows([]string{"id"}),
+	)
+
+	_, err = r.CreateTrade(context.Background(), trade)
+	require.ErrorIs(t, err, ErrDuplicateTrade)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListTrades(t *testing.T) {
+	t.Parallel()
+	if !testing.Short() {
+		t.Skip()
+	}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		require.NoError(t, db.Close())
+	}()
+	r, err := NewRepo(WithDB(db))
+	require.NoError(t, err)
+
+	from := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	createdAt := from.Add(48 * time.Hour)
+	minPrice := decimal.NewFromInt(10)
+	filter := TradeFilter{
+		InstrumentID: 1,
+		From:         from,
+		To:           to,
+		MinSize:      decimal.NewFromInt(5),
+		MinPrice:     &minPrice,
+		AfterID:      41,
+		Limit:        2,
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[readTradeCursor])).WithArgs(int64(41), int64(1)).WillReturnRows(
+		sqlmock.NewRows([]string{"timestamp"}).AddRow(from),
+	)
+	mock.ExpectQuery(regexp.QuoteMeta(
+		r.queries[listTrades],
+	)).WithArgs(int64(1), from.UTC(), to.UTC(), filter.MinSize, minPrice, nil, int64(41), int64(2), from).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "created_at", "instrument_id", "account_id", "price", "size", "timestamp"}).
+			AddRow(42, createdAt, 1, 3, 12.5, -10, from.Add(time.Hour)),
+	)
+
+	trades, err := r.ListTrades(context.Background(), filter)
+	require.NoError(t, err)
+	require.Equal(t, []*models.Trade{
+		{
+			ID:           42,
+			CreatedAt:    createdAt.Format(time.RFC3339Nano),
+			InstrumentID: 1,
+			AccountID:    3,
+			Price:        decimal.MustParse("12.5"),
+			Size:         decimal.NewFromInt(-10),
+			Timestamp:    from.Add(time.Hour),
+		},
+	}, trades)
+
+	// a cursor which is not a trade in the instrument is an error, rather than an empty page
+	mock.ExpectQuery(regexp.QuoteMeta(r.queries[readTradeCursor])).WithArgs(int64(41), int64(1)).WillReturnRows(
+		sqlmock.NewRows([]string{"timestamp"}),
+	)
+	_, err = r.ListTrades(context.Background(), filter)
+	require.ErrorIs(t, err, ErrUnknownCursor)
+	require.NoError(t, mock.ExpectationsWereMet())
 }
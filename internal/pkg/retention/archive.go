@@ -0,0 +1,354 @@
+// Package retention implements moving old trades and positions out of the database into archive files,
+// and restoring them.
+//
+// An archive is a directory holding the trades and positions of an instrument before a time as gzipped NDJSON,
+// one row per line, and a manifest recording the archive and the SHA-256 checksum of each file.
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// These are the names of the files in an archive.
+const (
+	ManifestName  = "manifest.json"
+	TradesName    = "trades.ndjson.gz"
+	PositionsName = "positions.ndjson.gz"
+)
+
+// ErrChecksumMismatch is returned when an archive file does not match the checksum in its manifest.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Repo archives and restores trades and positions.
+type Repo interface {
+	Archive(ctx context.Context, instrumentID int64, before time.Time, sink repo.ArchiveSink) (*models.Archive, error)
+	Restore(ctx context.Context, archiveID int64, source repo.ArchiveSource) (*models.Archive, error)
+}
+
+// Manifest describes the contents of an archive.
+type Manifest struct {
+	ArchiveID    int64           `json:"archive_id"`
+	InstrumentID int64           `json:"instrument_id"`
+	Before       time.Time       `json:"before"`
+	ArchivedAt   time.Time       `json:"archived_at"`
+	Files        []*ManifestFile `json:"files"`
+}
+
+// ManifestFile describes a file in an archive.
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Rows   int64  `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// Archive archives the trades and positions in an instrument before the given time into a new archive
+// in the directory, returning its manifest and path. It returns a nil manifest if there was nothing to archive.
+// The archive is written to a temporary directory and moved into place before the rows are deleted
+// from the database, so an archive which fails part way leaves the database as it was.
+func Archive(ctx context.Context, r Repo, dir string, instrumentID int64, before time.Time) (*Manifest, string, error) {
+	instrumentDir := filepath.Join(dir, strconv.FormatInt(instrumentID, 10))
+	if err := os.MkdirAll(instrumentDir, 0o755); err != nil {
+		return nil, "", errors.Wrap(err, "create archive directory failed")
+	}
+	tmp, err := os.MkdirTemp(instrumentDir, ".archive-")
+	if err != nil {
+		return nil, "", errors.Wrap(err, "create temporary directory failed")
+	}
+	defer os.RemoveAll(tmp) // nolint:errcheck // a no-op once the archive has been moved into place
+	sink := &fileSink{dir: tmp}
+	if sink.trades, err = createNDJSON(tmp, TradesName); err != nil {
+		return nil, "", err
+	}
+	defer sink.trades.f.Close()
+	if sink.positions, err = createNDJSON(tmp, PositionsName); err != nil {
+		return nil, "", err
+	}
+	defer sink.positions.f.Close()
+	archive, err := r.Archive(ctx, instrumentID, before, sink)
+	if err != nil {
+		if sink.path != "" {
+			// the database may have committed even though an error was returned, so the archive is kept
+			return nil, "", errors.Wrapf(err, "archive failed after writing %s", sink.path)
+		}
+		return nil, "", errors.Wrap(err, "archive failed")
+	}
+	if archive == nil {
+		return nil, "", nil
+	}
+	return sink.manifest, sink.path, nil
+}
+
+// Restore verifies the archive in the directory against the checksums in its manifest,
+// and restores its trades and positions to the database.
+func Restore(ctx context.Context, r Repo, dir string) (*Manifest, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(dir, manifest); err != nil {
+		return nil, err
+	}
+	source := &fileSource{}
+	if source.trades, err = openNDJSON(dir, TradesName); err != nil {
+		return nil, err
+	}
+	defer source.trades.close()
+	if source.positions, err = openNDJSON(dir, PositionsName); err != nil {
+		return nil, err
+	}
+	defer source.positions.close()
+	archive, err := r.Restore(ctx, manifest.ArchiveID, source)
+	if err != nil {
+		return nil, errors.Wrap(err, "restore failed")
+	}
+	if archive.InstrumentID != manifest.InstrumentID {
+		return nil, errors.Errorf("archive %d is of instrument %d, not %d", archive.ID, archive.InstrumentID, manifest.InstrumentID)
+	}
+	return manifest, nil
+}
+
+// ReadManifest reads the manifest of the archive in the directory.
+func ReadManifest(dir string) (*Manifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, errors.Wrap(err, "read manifest failed")
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, errors.Wrap(err, "unmarshal manifest failed")
+	}
+	return &manifest, nil
+}
+
+// Verify checks that the trades and positions files of the archive in the directory are listed in the manifest
+// and match their checksums.
+func Verify(dir string, manifest *Manifest) error {
+	files := make(map[string]*ManifestFile, len(manifest.Files))
+	for _, file := range manifest.Files {
+		files[file.Name] = file
+	}
+	for _, name := range []string{TradesName, PositionsName} {
+		file, ok := files[name]
+		if !ok {
+			return errors.Errorf("manifest does not list %s", name)
+		}
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return errors.Wrap(err, "open archive file failed")
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		_ = f.Close()
+		if err != nil {
+			return errors.Wrap(err, "read archive file failed")
+		}
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != file.SHA256 {
+			return errors.Wrapf(ErrChecksumMismatch, "%s has checksum %s, expected %s", name, sum, file.SHA256)
+		}
+	}
+	return nil
+}
+
+// fileSink writes archived rows to the files of an archive in a temporary directory,
+// and moves the directory into place when committed.
+type fileSink struct {
+	dir               string
+	trades, positions *ndjsonWriter
+	manifest          *Manifest
+	path              string // set once the archive is in place
+}
+
+func (s *fileSink) WriteTrade(trade *models.ArchivedTrade) error {
+	return s.trades.write(trade)
+}
+
+func (s *fileSink) WritePosition(position *models.ArchivedPosition) error {
+	return s.positions.write(position)
+}
+
+// Commit closes the files, writes the manifest and moves the archive into place, named after its ID and time.
+func (s *fileSink) Commit(archive *models.Archive) error {
+	s.manifest = &Manifest{
+		ArchiveID:    archive.ID,
+		InstrumentID: archive.InstrumentID,
+		Before:       archive.Before,
+		ArchivedAt:   archive.ArchivedAt,
+	}
+	for _, w := range []*ndjsonWriter{s.trades, s.positions} {
+		file, err := w.close()
+		if err != nil {
+			return err
+		}
+		s.manifest.Files = append(s.manifest.Files, file)
+	}
+	b, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal manifest failed")
+	}
+	if err := writeFileSync(filepath.Join(s.dir, ManifestName), b); err != nil {
+		return errors.Wrap(err, "write manifest failed")
+	}
+	path := filepath.Join(filepath.Dir(s.dir), fmt.Sprintf("%d_%s", archive.ID, archive.Before.UTC().Format("20060102T150405Z")))
+	if err := os.Rename(s.dir, path); err != nil {
+		return errors.Wrap(err, "move archive into place failed")
+	}
+	s.path = path
+	return errors.Wrap(syncDir(filepath.Dir(path)), "sync archive directory failed")
+}
+
+// fileSource reads archived rows from the files of an archive.
+type fileSource struct {
+	trades, positions *ndjsonReader
+}
+
+func (s *fileSource) NextTrade() (*models.ArchivedTrade, error) {
+	var trade models.ArchivedTrade
+	if err := s.trades.read(&trade); err != nil {
+		return nil, err
+	}
+	return &trade, nil
+}
+
+func (s *fileSource) NextPosition() (*models.ArchivedPosition, error) {
+	var position models.ArchivedPosition
+	if err := s.positions.read(&position); err != nil {
+		return nil, err
+	}
+	return &position, nil
+}
+
+// ndjsonWriter writes rows to a gzipped NDJSON file, checksumming the file as it is written.
+type ndjsonWriter struct {
+	name string
+	f    *os.File
+	h    hash.Hash
+	gz   *gzip.Writer
+	enc  *json.Encoder
+	rows int64
+}
+
+func createNDJSON(dir, name string) (*ndjsonWriter, error) {
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, errors.Wrap(err, "create archive file failed")
+	}
+	h := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(f, h))
+	return &ndjsonWriter{
+		name: name,
+		f:    f,
+		h:    h,
+		gz:   gz,
+		enc:  json.NewEncoder(gz),
+	}, nil
+}
+
+func (w *ndjsonWriter) write(v interface{}) error {
+	if err := w.enc.Encode(v); err != nil {
+		return errors.Wrapf(err, "write %s failed", w.name)
+	}
+	w.rows++
+	return nil
+}
+
+// close flushes and syncs the file, and describes it for the manifest.
+func (w *ndjsonWriter) close() (*ManifestFile, error) {
+	if err := w.gz.Close(); err != nil {
+		return nil, errors.Wrapf(err, "close %s failed", w.name)
+	}
+	if err := w.f.Sync(); err != nil {
+		return nil, errors.Wrapf(err, "sync %s failed", w.name)
+	}
+	if err := w.f.Close(); err != nil {
+		return nil, errors.Wrapf(err, "close %s failed", w.name)
+	}
+	return &ManifestFile{
+		Name:   w.name,
+		Rows:   w.rows,
+		SHA256: hex.EncodeToString(w.h.Sum(nil)),
+	}, nil
+}
+
+// ndjsonReader reads rows from a gzipped NDJSON file.
+type ndjsonReader struct {
+	name string
+	f    *os.File
+	gz   *gzip.Reader
+	dec  *json.Decoder
+}
+
+func openNDJSON(dir, name string) (*ndjsonReader, error) {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return nil, errors.Wrap(err, "open archive file failed")
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, errors.Wrapf(err, "read %s failed", name)
+	}
+	return &ndjsonReader{
+		name: name,
+		f:    f,
+		gz:   gz,
+		dec:  json.NewDecoder(gz),
+	}, nil
+}
+
+// read decodes the next row, returning io.EOF if there are no more.
+func (r *ndjsonReader) read(v interface{}) error {
+	if err := r.dec.Decode(v); err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return errors.Wrapf(err, "read %s failed", r.name)
+	}
+	return nil
+}
+
+func (r *ndjsonReader) close() {
+	_ = r.gz.Close()
+	_ = r.f.Close()
+}
+
+// writeFileSync writes the file and syncs it to disk.
+func writeFileSync(path string, b []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs a directory, so that files renamed into it survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
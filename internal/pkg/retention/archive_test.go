@@ -0,0 +1,188 @@
+package retention
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"tradetracker/internal/pkg/repo"
+	"tradetracker/pkg/decimal"
+	"tradetracker/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRepo archives the given rows, and records the rows restored.
+type fakeRepo struct {
+	trades    []*models.ArchivedTrade
+	positions []*models.ArchivedPosition
+	archive   *models.Archive
+}
+
+func (r *fakeRepo) Archive(_ context.Context, instrumentID int64, before time.Time, sink repo.ArchiveSink) (*models.Archive, error) {
+	if len(r.trades) == 0 && len(r.positions) == 0 {
+		return nil, nil
+	}
+	for _, trade := range r.trades {
+		if err := sink.WriteTrade(trade); err != nil {
+			return nil, err
+		}
+	}
+	for _, position := range r.positions {
+		if err := sink.WritePosition(position); err != nil {
+			return nil, err
+		}
+	}
+	r.archive = &models.Archive{
+		ID:           7,
+		InstrumentID: instrumentID,
+		Before:       before,
+		ArchivedAt:   before.Add(time.Hour),
+		Trades:       int64(len(r.trades)),
+		Positions:    int64(len(r.positions)),
+	}
+	return r.archive, sink.Commit(r.archive)
+}
+
+func (r *fakeRepo) Restore(_ context.Context, archiveID int64, source repo.ArchiveSource) (*models.Archive, error) {
+	r.trades, r.positions = nil, nil
+	for {
+		trade, err := source.NextTrade()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.trades = append(r.trades, trade)
+	}
+	for {
+		position, err := source.NextPosition()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.positions = append(r.positions, position)
+	}
+	return r.archive, nil
+}
+
+func TestArchiveRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	before := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	ts := time.Date(2022, time.April, 1, 2, 3, 4, 0, time.UTC)
+	superseded := ts.Add(time.Hour)
+	trades := []*models.ArchivedTrade{
+		{ID: 1, CreatedAt: ts, InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(10), Price: decimal.MustParse("100.5"), Timestamp: ts},
+		{ID: 2, CreatedAt: ts, InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(-4), Price: decimal.NewFromInt(101), Timestamp: ts.Add(time.Minute)},
+	}
+	positions := []*models.ArchivedPosition{
+		{ID: 1, CreatedAt: ts, InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(10), Timestamp: ts, SupersededAt: &superseded, TradeIDs: []int64{1}},
+		{ID: 3, CreatedAt: superseded, InstrumentID: 1, AccountID: 2, Size: decimal.NewFromInt(6), Timestamp: ts.Add(time.Minute), TradeIDs: []int64{2}},
+		{ID: 4, CreatedAt: ts, InstrumentID: 1, AccountID: 3, Size: decimal.NewFromInt(5), Timestamp: ts, Seed: true},
+	}
+	r := &fakeRepo{trades: trades, positions: positions}
+
+	manifest, path, err := Archive(ctx, r, dir, 1, before)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "1", "7_20220501T000000Z"), path)
+	require.Equal(t, int64(7), manifest.ArchiveID)
+	require.Equal(t, int64(1), manifest.InstrumentID)
+	require.Len(t, manifest.Files, 2)
+	require.Equal(t, int64(2), manifest.Files[0].Rows)
+	require.Equal(t, int64(3), manifest.Files[1].Rows)
+	read, err := ReadManifest(path)
+	require.NoError(t, err)
+	require.Equal(t, manifest.Files, read.Files)
+	// only the archive is left in the instrument directory
+	entries, err := os.ReadDir(filepath.Join(dir, "1"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	_, err = Restore(ctx, r, path)
+	require.NoError(t, err)
+	require.Equal(t, trades, r.trades)
+	require.Equal(t, positions, r.positions)
+}
+
+func TestArchiveNothing(t *testing.T) {
+	dir := t.TempDir()
+	manifest, path, err := Archive(context.Background(), &fakeRepo{}, dir, 1, time.Now())
+	require.NoError(t, err)
+	require.Nil(t, manifest)
+	require.Empty(t, path)
+	entries, err := os.ReadDir(filepath.Join(dir, "1"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestRestoreChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	ts := time.Date(2022, time.April, 1, 0, 0, 0, 0, time.UTC)
+	r := &fakeRepo{trades: []*models.ArchivedTrade{{ID: 1, InstrumentID: 1, Size: decimal.NewFromInt(1), Price: decimal.NewFromInt(1), Timestamp: ts}}}
+	_, path, err := Archive(ctx, r, t.TempDir(), 1, ts.Add(time.Hour))
+	require.NoError(t, err)
+	b, err := os.ReadFile(filepath.Join(path, TradesName))
+	require.NoError(t, err)
+	b[len(b)-1]++
+	require.NoError(t, os.WriteFile(filepath.Join(path, TradesName), b, 0o644))
+
+	r.trades = nil
+	_, err = Restore(ctx, r, path)
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	require.Nil(t, r.trades)
+}
+
+func TestCutoff(t *testing.T) {
+	now := time.Date(2022, time.May, 10, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		policy *models.RetentionPolicy
+		before time.Time
+		cutoff time.Time
+	}{
+		"no policy": {
+			before: before,
+			cutoff: before,
+		},
+		"no policy or time": {},
+		"policy only": {
+			policy: &models.RetentionPolicy{Retain: 24 * time.Hour},
+			cutoff: now.Add(-24 * time.Hour),
+		},
+		"policy retains beyond time": {
+			policy: &models.RetentionPolicy{Retain: 30 * 24 * time.Hour},
+			before: before,
+			cutoff: now.Add(-30 * 24 * time.Hour),
+		},
+		"time before policy": {
+			policy: &models.RetentionPolicy{Retain: 24 * time.Hour},
+			before: before,
+			cutoff: before,
+		},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.cutoff, Cutoff(test.policy, test.before, now))
+		})
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	retain, err := ParseRetention("90d")
+	require.NoError(t, err)
+	require.Equal(t, 90*24*time.Hour, retain)
+	retain, err = ParseRetention("36h")
+	require.NoError(t, err)
+	require.Equal(t, 36*time.Hour, retain)
+	for _, s := range []string{"", "d", "1.5d", "0s", "-1d", "1ms"} {
+		_, err := ParseRetention(s)
+		require.Error(t, err, s)
+	}
+}
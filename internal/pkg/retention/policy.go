@@ -0,0 +1,47 @@
+package retention
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"tradetracker/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+// ParseRetention parses how long to retain trades and positions for, either as a Go duration, e.g. 720h,
+// or as a whole number of days, e.g. 90d.
+func ParseRetention(s string) (time.Duration, error) {
+	var retain time.Duration
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.ParseInt(days, 10, 64)
+		if err != nil {
+			return 0, errors.Wrap(err, "parse days failed")
+		}
+		retain = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if retain, err = time.ParseDuration(s); err != nil {
+			return 0, errors.Wrap(err, "parse duration failed")
+		}
+	}
+	if retain < time.Second {
+		return 0, errors.Errorf("retention %q must be at least a second", s)
+	}
+	return retain, nil
+}
+
+// Cutoff returns the time before which the trades and positions of an instrument are archived.
+// The policy of the instrument, if it has one, retains everything more recent than its retention period,
+// so the cutoff is the earlier of before and that. If before is zero, the cutoff is given by the policy alone,
+// and is zero if there is no policy, meaning that nothing is archived.
+func Cutoff(policy *models.RetentionPolicy, before, now time.Time) time.Time {
+	if policy == nil {
+		return before
+	}
+	retained := now.Add(-policy.Retain)
+	if before.IsZero() || retained.Before(before) {
+		return retained
+	}
+	return before
+}
@@ -0,0 +1,6 @@
+package timeexpr
+
+import "github.com/pkg/errors"
+
+// ErrInvalidExpression indicates that a time expression could not be parsed.
+var ErrInvalidExpression error = errors.New("invalid time expression")
@@ -0,0 +1,181 @@
+// Package timeexpr parses the time expressions accepted by commands which take a timestamp.
+//
+// An expression is a base time, optionally followed by offsets such as -1h or +1d12h.
+// The base time is one of:
+//
+//   now                   the current time
+//   sod, today            the start of the current day
+//   eod                   the end of the current day
+//   yesterday, tomorrow   the start of the previous or next day
+//   2022-05-01            the start of a date
+//   2022-05-01T16:00:00   a date and time, optionally with fractional seconds, e.g. 16:00:00.123456
+//   RFC3339               e.g. 2022-05-01T16:00:00Z, with an explicit offset
+//   1651420800            a unix epoch in seconds, optionally with fractional seconds, e.g. 1651420800.123456,
+//                         or in milliseconds, microseconds or nanoseconds if it has 13, 16 or 19 digits
+//
+// If the base time is omitted, offsets are relative to now. Offsets are Go durations,
+// extended with d for days and w for weeks, which respect daylight saving time.
+// Days, dates and times without an explicit offset are in the configured location, which defaults to UTC.
+package timeexpr
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	mu       sync.RWMutex
+	location = time.UTC
+)
+
+// SetLocation sets the location, by its IANA time zone name such as Europe/London,
+// which expressions are interpreted in by Parse.
+func SetLocation(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return errors.Wrap(err, "load location failed")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	location = loc
+	return nil
+}
+
+// Location returns the location which expressions are interpreted in by Parse.
+func Location() *time.Location {
+	mu.RLock()
+	defer mu.RUnlock()
+	return location
+}
+
+// Parse parses a time expression relative to the current time, in the configured location.
+func Parse(expr string) (time.Time, error) {
+	return ParseAt(expr, time.Now(), Location())
+}
+
+// ParseAt parses a time expression relative to the given time, in the given location.
+func ParseAt(expr string, now time.Time, loc *time.Location) (time.Time, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return time.Time{}, errors.Wrap(ErrInvalidExpression, "empty expression")
+	}
+	now = now.In(loc)
+	// RFC3339 timestamps and dates contain signs, so are matched before splitting off any offsets
+	if t, ok := parseAbsolute(expr, loc); ok {
+		return t, nil
+	}
+	match := exprRegexp.FindStringSubmatch(expr)
+	base, offsets := match[1], match[2]
+	var t time.Time
+	switch strings.ToLower(base) {
+	case "", "now":
+		t = now
+	case "sod", "today":
+		t = startOfDay(now)
+	case "eod":
+		t = startOfDay(now).AddDate(0, 0, 1).Add(-time.Nanosecond)
+	case "yesterday":
+		t = startOfDay(now).AddDate(0, 0, -1)
+	case "tomorrow":
+		t = startOfDay(now).AddDate(0, 0, 1)
+	default:
+		var ok bool
+		if t, ok = parseAbsolute(base, loc); !ok {
+			return time.Time{}, errors.Wrapf(ErrInvalidExpression, "unknown time %q", base)
+		}
+	}
+	return addOffsets(t, offsets)
+}
+
+// layouts are the layouts of absolute times, other than epochs.
+var layouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseAbsolute parses a time which does not depend on the current time.
+func parseAbsolute(s string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	if epoch, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case len(s) >= 19:
+			return time.Unix(0, epoch).In(loc), true
+		case len(s) >= 16:
+			return time.UnixMicro(epoch).In(loc), true
+		case len(s) >= 13:
+			return time.UnixMilli(epoch).In(loc), true
+		}
+		return time.Unix(epoch, 0).In(loc), true
+	}
+	if m := fractionalEpochRegexp.FindStringSubmatch(s); m != nil {
+		if secs, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+			nanos, _ := strconv.ParseInt((m[2] + "00000000")[:9], 10, 64)
+			return time.Unix(secs, nanos).In(loc), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// fractionalEpochRegexp matches a unix epoch in seconds with up to nanosecond fractional seconds.
+var fractionalEpochRegexp = regexp.MustCompile(`^(\d+)\.(\d{1,9})$`)
+
+// startOfDay returns midnight at the start of the day of the time, in its location.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+const offsetPattern = `[+-](?:\d+(?:\.\d+)?(?:ns|us|µs|ms|s|m|h|d|w))+`
+
+// exprRegexp splits an expression into its base time and the shortest suffix of offsets.
+var exprRegexp = regexp.MustCompile(`^(.*?)((?:` + offsetPattern + `)*)$`)
+
+var offsetRegexp = regexp.MustCompile(`^([+-])((?:\d+(?:\.\d+)?(?:ns|us|µs|ms|s|m|h|d|w))+)`)
+
+var calendarRegexp = regexp.MustCompile(`(\d+)([dw])`)
+
+// addOffsets adds a sequence of signed offsets such as -1d+2h30m to the time.
+func addOffsets(t time.Time, offsets string) (time.Time, error) {
+	for offsets != "" {
+		match := offsetRegexp.FindStringSubmatch(offsets)
+		if match == nil {
+			return time.Time{}, errors.Wrapf(ErrInvalidExpression, "invalid offset %q", offsets)
+		}
+		offsets = offsets[len(match[0]):]
+		sign := 1
+		if match[1] == "-" {
+			sign = -1
+		}
+		// days and weeks are added to the calendar date, and the rest as a duration
+		var days int
+		rest := calendarRegexp.ReplaceAllStringFunc(match[2], func(s string) string {
+			m := calendarRegexp.FindStringSubmatch(s)
+			n, _ := strconv.Atoi(m[1])
+			if m[2] == "w" {
+				n *= 7
+			}
+			days += n
+			return ""
+		})
+		t = t.AddDate(0, 0, sign*days)
+		if rest != "" {
+			d, err := time.ParseDuration(rest)
+			if err != nil {
+				return time.Time{}, errors.Wrapf(ErrInvalidExpression, "invalid offset %q", match[2])
+			}
+			t = t.Add(time.Duration(sign) * d)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,64 @@
+package timeexpr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAt(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+	now := time.Date(2022, 5, 2, 13, 30, 15, 0, time.UTC)
+	tsts := []struct {
+		expr string
+		loc  *time.Location
+		want time.Time
+	}{
+		{"now", time.UTC, now},
+		{"now-1h", time.UTC, now.Add(-time.Hour)},
+		{"-90m", time.UTC, now.Add(-90 * time.Minute)},
+		{"sod", time.UTC, time.Date(2022, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{"today+9h30m", time.UTC, time.Date(2022, 5, 2, 9, 30, 0, 0, time.UTC)},
+		{"eod", time.UTC, time.Date(2022, 5, 2, 23, 59, 59, 999999999, time.UTC)},
+		{"yesterday", time.UTC, time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{"yesterday+16h", london, time.Date(2022, 5, 1, 15, 0, 0, 0, time.UTC)},
+		{"tomorrow", time.UTC, time.Date(2022, 5, 3, 0, 0, 0, 0, time.UTC)},
+		{"sod-1w+1d", time.UTC, time.Date(2022, 4, 26, 0, 0, 0, 0, time.UTC)},
+		{"2022-05-01", time.UTC, time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{"2022-05-01", london, time.Date(2022, 4, 30, 23, 0, 0, 0, time.UTC)},
+		{"2022-05-01-1d", time.UTC, time.Date(2022, 4, 30, 0, 0, 0, 0, time.UTC)},
+		{"2022-05-01T16:00:00", time.UTC, time.Date(2022, 5, 1, 16, 0, 0, 0, time.UTC)},
+		{"2022-05-01T16:00:00Z", london, time.Date(2022, 5, 1, 16, 0, 0, 0, time.UTC)},
+		{"2022-05-01T16:00:00+01:00", time.UTC, time.Date(2022, 5, 1, 15, 0, 0, 0, time.UTC)},
+		{"2022-05-01T16:00:00Z+1h", time.UTC, time.Date(2022, 5, 1, 17, 0, 0, 0, time.UTC)},
+		{"1651420800", time.UTC, time.Date(2022, 5, 1, 16, 0, 0, 0, time.UTC)},
+		{"1651420800500", time.UTC, time.Date(2022, 5, 1, 16, 0, 0, 500000000, time.UTC)},
+		{"1651420800500123", time.UTC, time.Date(2022, 5, 1, 16, 0, 0, 500123000, time.UTC)},
+		{"1651420800500123456", time.UTC, time.Date(2022, 5, 1, 16, 0, 0, 500123456, time.UTC)},
+		{"1651420800.000001", time.UTC, time.Date(2022, 5, 1, 16, 0, 0, 1000, time.UTC)},
+		{"1651420800.5-1h", time.UTC, time.Date(2022, 5, 1, 15, 0, 0, 500000000, time.UTC)},
+		{"2022-05-01T16:00:00.123456", time.UTC, time.Date(2022, 5, 1, 16, 0, 0, 123456000, time.UTC)},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.expr, func(t *testing.T) {
+			got, err := ParseAt(tst.expr, now, tst.loc)
+			require.NoError(t, err)
+			require.True(t, tst.want.Equal(got), "want %s, got %s", tst.want, got)
+		})
+	}
+}
+
+func TestParseAtInvalid(t *testing.T) {
+	for _, expr := range []string{"", "later", "now-1y", "now-", "2022-13-01", "now+1h-"} {
+		_, err := ParseAt(expr, time.Now(), time.UTC)
+		require.True(t, errors.Is(err, ErrInvalidExpression), expr)
+	}
+}
+
+func TestSetLocation(t *testing.T) {
+	require.Error(t, SetLocation("Nowhere/Special"))
+	require.Equal(t, time.UTC, Location())
+}
@@ -3,6 +3,7 @@ package trade
 
 import (
 	"context"
+	"tradetracker/internal/pkg/instrument"
 	"tradetracker/internal/pkg/pubsub"
 	"tradetracker/internal/pkg/repo"
 	"tradetracker/pkg/models"
@@ -15,10 +16,16 @@ var logger logrus.FieldLogger = logrus.StandardLogger()
 
 // Processor consumes trades from a pub-sub system and stores them in a repository.
 type Processor struct {
-	repo repo.TradeRepo
-	sub  pubsub.Subscriber
+	repo        repo.TradeRepo
+	sub         pubsub.Subscriber
+	instruments *instrument.Registry
+	ack         Ack
 }
 
+// Ack is called with each trade message once it has been processed, with the trade if it was stored,
+// or nil if it was rejected or skipped.
+type Ack func(m pubsub.Message, stored *models.Trade) error
+
 // Cfg is a configuration function for Processor.
 type Cfg func(*Processor) error
 
@@ -49,28 +56,86 @@ func WithSubscriber(source pubsub.Subscriber) Cfg {
 	}
 }
 
+// WithInstruments sets the instrument reference data used to reject trades in unknown or inactive instruments.
+// If it is not set, trades are not checked.
+func WithInstruments(instruments *instrument.Registry) Cfg {
+	return func(c *Processor) error {
+		c.instruments = instruments
+		return nil
+	}
+}
+
+// WithAck sets a function called with each trade message once it has been processed,
+// e.g. to build positions from the stored trade or to commit the offset of the message.
+func WithAck(ack Ack) Cfg {
+	return func(c *Processor) error {
+		c.ack = ack
+		return nil
+	}
+}
+
 // Process consumes trade messages from the trade source and adds them to the repo.
+// Trades in unknown or inactive instruments, or with sizes finer than the quantity scale of the instrument, are rejected,
+// and trades with the same ref and timestamp as a trade already stored are skipped.
 func (t *Processor) Process(ctx context.Context) error {
 	err := t.sub.Subscribe(ctx, pubsub.TradeTopic, func(m pubsub.Message) error {
 		trade, ok := m.Value.(*models.Trade)
 		if !ok {
 			return errors.New("could not assert message as trade")
 		}
+		if t.instruments != nil {
+			err := t.instruments.CheckTrade(ctx, trade)
+			if errors.Is(err, instrument.ErrUnknownInstrument) || errors.Is(err, instrument.ErrInactiveInstrument) ||
+				errors.Is(err, instrument.ErrInvalidQuantity) {
+				logger.WithFields(logrus.Fields{
+					"instrument_id": trade.InstrumentID,
+					"size":          trade.Size,
+					"price":         trade.Price,
+					"timestamp":     trade.Timestamp,
+				}).WithError(err).Warn("rejected trade")
+				return t.acknowledge(m, nil)
+			}
+			if err != nil {
+				return errors.Wrap(err, "check instrument failed")
+			}
+		}
 		id, err := t.repo.CreateTrade(ctx, trade)
+		if errors.Is(err, repo.ErrDuplicateTrade) {
+			logger.WithFields(logrus.Fields{
+				"instrument_id": trade.InstrumentID,
+				"ref":           trade.Ref,
+				"timestamp":     trade.Timestamp,
+			}).Info("skipped trade already stored")
+			return t.acknowledge(m, nil)
+		}
 		if err != nil {
 			return errors.Wrap(err, "create trade failed")
 		}
-		logger.WithFields(logrus.Fields{
+		trade.ID = int64(id)
+		fields := logrus.Fields{
 			"id":            id,
 			"instrument_id": trade.InstrumentID,
+			"account_id":    trade.AccountID,
 			"size":          trade.Size,
 			"price":         trade.Price,
 			"timestamp":     trade.Timestamp,
-		}).Info("added trade")
-		return nil
+		}
+		if t.instruments != nil {
+			fields["symbol"] = t.instruments.Symbol(ctx, trade.InstrumentID)
+		}
+		logger.WithFields(fields).Info("added trade")
+		return t.acknowledge(m, trade)
 	})
 	if err != nil {
 		return errors.Wrap(err, "subscribe failed")
 	}
 	return nil
 }
+
+// acknowledge calls the ack function with the processed message, if one is set.
+func (t *Processor) acknowledge(m pubsub.Message, stored *models.Trade) error {
+	if t.ack == nil {
+		return nil
+	}
+	return errors.Wrap(t.ack(m, stored), "ack failed")
+}
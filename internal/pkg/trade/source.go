@@ -1,12 +1,22 @@
 package trade
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"tradetracker/internal/pkg/repo"
+	"tradetracker/pkg/decimal"
 	"tradetracker/pkg/models"
 
 	"github.com/pkg/errors"
@@ -19,21 +29,32 @@ type Source interface {
 	Next() (*models.Trade, error)
 }
 
+// OffsetSource is a Source which can resume from an offset, such as a log of trades.
+// Offset returns the offset just past the last trade returned by Next, and Commit records
+// that every trade before the offset has been processed, so that it resumes from there if restarted.
+type OffsetSource interface {
+	Source
+	Offset() int64
+	Commit(offset int64) error
+}
+
 // RandomSource is a source of random trade information.
 type RandomSource struct {
 	total         int64
 	num           int64
 	baseDate      time.Time
 	instrumentIDs []int64
+	accountIDs    []int64
 	r             *rand.Rand
 }
 
-// NewRandomSource creates a new RandomSource.
-func NewRandomSource(num int64, baseDate time.Time, instrumentIDs []int64) *RandomSource {
+// NewRandomSource creates a new RandomSource which books trades in the given instruments to the given accounts.
+func NewRandomSource(num int64, baseDate time.Time, instrumentIDs, accountIDs []int64) *RandomSource {
 	return &RandomSource{
 		total:         num,
 		baseDate:      baseDate,
 		instrumentIDs: instrumentIDs,
+		accountIDs:    accountIDs,
 	}
 }
 
@@ -50,10 +71,12 @@ func (t *RandomSource) Next() (*models.Trade, error) {
 	}
 	trade := &models.Trade{}
 	trade.InstrumentID = t.instrumentIDs[t.r.Intn(len(t.instrumentIDs))]
-	trade.Price = math.Round(t.r.Float64()*float64(t.r.Int31n(1000))*100) / 100
-	trade.Size = int64(t.r.Int31n(1000))
-	// generate random timestamp between baseDate and now
-	trade.Timestamp = time.Unix(t.r.Int63n(time.Now().Unix()-t.baseDate.Unix())+t.baseDate.Unix(), 0)
+	trade.AccountID = t.accountIDs[t.r.Intn(len(t.accountIDs))]
+	trade.Price = decimal.New(int64(math.Round(t.r.Float64()*float64(t.r.Int31n(1000))*100)), 2) // in cents
+	trade.Size = decimal.NewFromInt(int64(t.r.Int31n(1000)))
+	// generate random timestamp between baseDate and now, to the microsecond
+	micros := t.r.Int63n(int64(time.Since(t.baseDate) / time.Microsecond))
+	trade.Timestamp = t.baseDate.Add(time.Duration(micros) * time.Microsecond).UTC()
 	t.num++
 	return trade, nil
 }
@@ -97,3 +120,154 @@ func (t *RepoSource) Next() (*models.Trade, error) {
 	}
 	return trade, nil
 }
+
+const (
+	// offsetSuffix is appended to the path of a FileSource to give the path of its committed offset.
+	offsetSuffix = ".offset"
+	// filePollInterval is how often a FileSource checks for trades appended to its file.
+	filePollInterval = 100 * time.Millisecond
+)
+
+// FileSource follows a file of trades, one JSON object per line, reading trades as they are appended to it.
+// It resumes after the offset last committed, which is kept in a file alongside it. Trades without a ref
+// are given one from the name of the file and the offset of their line, so that trades read again after
+// a restart, as they were processed after the offset last committed, are not stored twice.
+type FileSource struct {
+	path    string
+	f       *os.File
+	r       *bufio.Reader
+	partial []byte
+	offset  int64
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewFileSource creates a new FileSource to follow the file at the given path.
+func NewFileSource(path string) *FileSource {
+	return &FileSource{
+		path: path,
+		stop: make(chan struct{}),
+	}
+}
+
+// Prepare opens the file from the committed offset, or its start if no offset has been committed.
+func (t *FileSource) Prepare(_ context.Context) error {
+	offset, err := t.committed()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(t.path)
+	if err != nil {
+		return errors.Wrap(err, "open trade file failed")
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return errors.Wrap(err, "seek trade file failed")
+	}
+	t.f = f
+	t.r = bufio.NewReader(f)
+	t.offset = offset
+	return nil
+}
+
+// Next returns the next trade in the file, waiting for one to be appended if there are none,
+// or io.EOF once the source has been stopped. Lines which are not trades are logged and skipped.
+func (t *FileSource) Next() (*models.Trade, error) {
+	if t.r == nil {
+		return nil, io.EOF
+	}
+	for {
+		select {
+		case <-t.stop:
+			return nil, io.EOF
+		default:
+		}
+		line, err := t.r.ReadBytes('\n')
+		t.partial = append(t.partial, line...)
+		if errors.Is(err, io.EOF) {
+			// wait for the rest of the line to be written
+			select {
+			case <-t.stop:
+				return nil, io.EOF
+			case <-time.After(filePollInterval):
+			}
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read trade file failed")
+		}
+		line, t.partial = t.partial, nil
+		start := t.offset
+		t.offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var trade models.Trade
+		if err := json.Unmarshal(line, &trade); err != nil {
+			logger.WithField("offset", start).WithError(err).Warn("skipped invalid trade")
+			continue
+		}
+		if trade.Ref == "" {
+			trade.Ref = fmt.Sprintf("%s:%d", filepath.Base(t.path), start)
+		}
+		return &trade, nil
+	}
+}
+
+// Offset returns the offset just past the last trade returned by Next.
+func (t *FileSource) Offset() int64 {
+	return t.offset
+}
+
+// Commit records the offset to resume from, replacing the file holding it atomically.
+func (t *FileSource) Commit(offset int64) error {
+	path := t.path + offsetSuffix
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "create offset file failed")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(strconv.FormatInt(offset, 10) + "\n"); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "write offset file failed")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "sync offset file failed")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "close offset file failed")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), path), "rename offset file failed")
+}
+
+// Stop makes Next return io.EOF rather than wait for more trades, e.g. to drain the trades read before shutting down.
+func (t *FileSource) Stop() {
+	t.once.Do(func() {
+		close(t.stop)
+	})
+}
+
+// Close closes the file.
+func (t *FileSource) Close() error {
+	if t.f == nil {
+		return nil
+	}
+	return errors.Wrap(t.f.Close(), "close trade file failed")
+}
+
+// committed reads the offset last committed, or zero if none has been.
+func (t *FileSource) committed() (int64, error) {
+	b, err := os.ReadFile(t.path + offsetSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "read offset file failed")
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "parse offset failed")
+	}
+	return offset, nil
+}
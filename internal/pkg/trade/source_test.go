@@ -0,0 +1,64 @@
+package trade
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSource(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "trades.jsonl")
+	first := `{"instrument_id":1,"account_id":2,"size":"1.5","price":"100.25","timestamp":"2022-01-01T00:00:01Z"}` + "\n"
+	second := `{"instrument_id":1,"size":"-1","price":"101","timestamp":"2022-01-01T00:00:02Z"}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(first+"not a trade\n"), 0o600))
+
+	source := NewFileSource(path)
+	require.NoError(t, source.Prepare(ctx))
+	trade, err := source.Next()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), trade.AccountID)
+	require.Equal(t, "1.5", trade.Size.String())
+	require.Equal(t, "trades.jsonl:0", trade.Ref)
+	require.Equal(t, int64(len(first)), source.Offset())
+
+	// trades appended to the file are read as they are written, skipping lines which are not trades
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(second[:10])
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() {
+		next, err := source.Next()
+		trade = next
+		done <- err
+	}()
+	_, err = f.WriteString(second[10:])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, <-done)
+	require.Equal(t, "-1", trade.Size.String())
+	require.Equal(t, fmt.Sprintf("trades.jsonl:%d", len(first)+len("not a trade\n")), trade.Ref)
+	require.NoError(t, source.Commit(source.Offset()))
+
+	// once stopped, there are no more trades
+	source.Stop()
+	_, err = source.Next()
+	require.ErrorIs(t, err, io.EOF)
+	require.NoError(t, source.Close())
+
+	// a restarted source resumes from the committed offset
+	require.NoError(t, os.WriteFile(path, []byte(first+"not a trade\n"+second+first), 0o600))
+	source = NewFileSource(path)
+	require.NoError(t, source.Prepare(ctx))
+	trade, err = source.Next()
+	require.NoError(t, err)
+	require.Equal(t, "1.5", trade.Size.String())
+	require.Equal(t, int64(len(first)*2+len("not a trade\n")+len(second)), source.Offset())
+	require.NoError(t, source.Close())
+}
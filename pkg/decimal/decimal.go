@@ -0,0 +1,317 @@
+// Package decimal implements an arbitrary-precision fixed-point decimal type for money.
+//
+// A Decimal is an integer coefficient and a scale, the number of digits after the decimal point,
+// so that values such as prices are represented exactly, unlike float64.
+// It round-trips exactly to the postgres numeric type and to JSON strings, keeping its scale,
+// e.g. 10.50 stays 10.50 rather than becoming 10.5.
+package decimal
+
+import (
+	"database/sql/driver"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalid is returned when a value cannot be parsed as a decimal.
+var ErrInvalid = errors.New("invalid decimal")
+
+// PriceScale is the number of decimal places that derived prices, such as average prices, are rounded to.
+const PriceScale int32 = 8
+
+var ten = big.NewInt(10)
+
+// Decimal is a fixed-point decimal number. The zero value is 0.
+// Decimals are immutable, and arithmetic returns a new Decimal.
+type Decimal struct {
+	coef  *big.Int // nil if zero, so that equal decimals of the same scale are deeply equal
+	scale int32
+}
+
+// Zero is the decimal 0.
+var Zero = Decimal{}
+
+// New creates the decimal coef×10^-scale, e.g. New(1050, 2) is 10.50. A negative scale is treated as zero.
+func New(coef int64, scale int32) Decimal {
+	return newDecimal(big.NewInt(coef), scale)
+}
+
+// NewFromInt creates a decimal from an integer.
+func NewFromInt(i int64) Decimal {
+	return New(i, 0)
+}
+
+// newDecimal creates a decimal, taking ownership of the coefficient.
+func newDecimal(coef *big.Int, scale int32) Decimal {
+	if scale < 0 {
+		coef.Mul(coef, pow10(-scale))
+		scale = 0
+	}
+	if coef.Sign() == 0 {
+		coef = nil
+	}
+	return Decimal{coef: coef, scale: scale}
+}
+
+// Parse parses a decimal in plain notation, e.g. -12.340, keeping its scale.
+func Parse(s string) (Decimal, error) {
+	digits, neg := s, false
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		digits, neg = s[1:], s[0] == '-'
+	}
+	var scale int32
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		scale = int32(len(digits) - i - 1)
+		digits = digits[:i] + digits[i+1:]
+	}
+	if digits == "" || strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return Decimal{}, errors.Wrapf(ErrInvalid, "%q", s)
+	}
+	coef, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, errors.Wrapf(ErrInvalid, "%q", s)
+	}
+	if neg {
+		coef.Neg(coef)
+	}
+	return newDecimal(coef, scale), nil
+}
+
+// MustParse parses a decimal, panicking if it is invalid. It is intended for constants and tests.
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// String formats the decimal in plain notation with its scale, e.g. 10.50.
+func (d Decimal) String() string {
+	if d.coef == nil {
+		if d.scale == 0 {
+			return "0"
+		}
+		return "0." + strings.Repeat("0", int(d.scale))
+	}
+	digits := new(big.Int).Abs(d.coef).String()
+	if d.scale > 0 {
+		if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		digits = digits[:len(digits)-int(d.scale)] + "." + digits[len(digits)-int(d.scale):]
+	}
+	if d.coef.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Scale returns the number of digits after the decimal point.
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// Sign returns -1, 0 or +1 depending on whether the decimal is negative, zero or positive.
+func (d Decimal) Sign() int {
+	if d.coef == nil {
+		return 0
+	}
+	return d.coef.Sign()
+}
+
+// IsZero returns true if the decimal is 0, whatever its scale.
+func (d Decimal) IsZero() bool {
+	return d.coef == nil
+}
+
+// Cmp compares the decimals by value, returning -1, 0 or +1 if d is less than, equal to or greater than d2.
+func (d Decimal) Cmp(d2 Decimal) int {
+	scale := max(d.scale, d2.scale)
+	return d.rescaled(scale).Cmp(d2.rescaled(scale))
+}
+
+// Equal returns true if the decimals are equal in value, whatever their scale, e.g. 10.5 equals 10.50.
+func (d Decimal) Equal(d2 Decimal) bool {
+	return d.Cmp(d2) == 0
+}
+
+// Add returns d+d2, with the larger scale of the two.
+func (d Decimal) Add(d2 Decimal) Decimal {
+	scale := max(d.scale, d2.scale)
+	return newDecimal(new(big.Int).Add(d.rescaled(scale), d2.rescaled(scale)), scale)
+}
+
+// Sub returns d-d2, with the larger scale of the two.
+func (d Decimal) Sub(d2 Decimal) Decimal {
+	scale := max(d.scale, d2.scale)
+	return newDecimal(new(big.Int).Sub(d.rescaled(scale), d2.rescaled(scale)), scale)
+}
+
+// Mul returns d×d2 exactly, with the sum of their scales.
+func (d Decimal) Mul(d2 Decimal) Decimal {
+	return newDecimal(new(big.Int).Mul(d.rescaled(d.scale), d2.rescaled(d2.scale)), d.scale+d2.scale)
+}
+
+// MulInt returns d×n exactly, with the scale of d.
+func (d Decimal) MulInt(n int64) Decimal {
+	return d.Mul(NewFromInt(n))
+}
+
+// Div returns d/d2 rounded half away from zero to the given scale, without trailing zeros
+// beyond the scale of d. It panics if d2 is zero.
+func (d Decimal) Div(d2 Decimal, scale int32) Decimal {
+	if d2.coef == nil {
+		panic("decimal division by zero")
+	}
+	if scale < 0 {
+		scale = 0
+	}
+	// d/d2 = (a/10^sa)/(b/10^sb), so its coefficient at the scale is a×10^(sb+scale)/(b×10^sa)
+	num := new(big.Int).Mul(d.rescaled(d.scale), pow10(d2.scale+scale))
+	den := new(big.Int).Mul(d2.coef, pow10(d.scale))
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() != 0 && new(big.Int).Abs(new(big.Int).Lsh(r, 1)).Cmp(new(big.Int).Abs(den)) >= 0 {
+		if num.Sign() == den.Sign() {
+			q.Add(q, big.NewInt(1))
+		} else {
+			q.Sub(q, big.NewInt(1))
+		}
+	}
+	return newDecimal(q, scale).trim(d.scale)
+}
+
+// DivInt returns d/n rounded half away from zero to the given scale, as Div.
+func (d Decimal) DivInt(n int64, scale int32) Decimal {
+	return d.Div(NewFromInt(n), scale)
+}
+
+// Round returns d rounded half away from zero to the given scale.
+func (d Decimal) Round(scale int32) Decimal {
+	if scale >= d.scale {
+		return d.rescale(scale)
+	}
+	return d.Div(NewFromInt(1), scale).rescale(scale)
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return newDecimal(new(big.Int).Neg(d.rescaled(d.scale)), d.scale)
+}
+
+// Abs returns the absolute value of d.
+func (d Decimal) Abs() Decimal {
+	return newDecimal(new(big.Int).Abs(d.rescaled(d.scale)), d.scale)
+}
+
+// Float64 returns the nearest float64 to d, for statistics which need not be exact.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Scan implements the sql.Scanner interface, so that a decimal can be scanned from a numeric column.
+func (d *Decimal) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case string:
+		*d, err = Parse(v)
+	case []byte:
+		*d, err = Parse(string(v))
+	case int64:
+		*d = NewFromInt(v)
+	case float64:
+		*d, err = Parse(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return errors.Errorf("cannot scan %T into a decimal", src)
+	}
+	return err
+}
+
+// Value implements the driver.Valuer interface, so that a decimal is written to a numeric column exactly.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// MarshalJSON marshals the decimal as a JSON string, so that it is not parsed as a float64 by readers.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// UnmarshalJSON unmarshals the decimal from a JSON string or number.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	if strings.ContainsAny(s, "eE") {
+		// a JSON number in exponent notation, e.g. written as a float64 by an earlier version
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errors.Wrapf(ErrInvalid, "%q", s)
+		}
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// rescaled returns the coefficient of d at a scale at least as large as its own.
+func (d Decimal) rescaled(scale int32) *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Mul(d.coef, pow10(scale-d.scale))
+}
+
+// rescale returns d at a scale at least as large as its own.
+func (d Decimal) rescale(scale int32) Decimal {
+	if scale <= d.scale {
+		return d
+	}
+	return newDecimal(d.rescaled(scale), scale)
+}
+
+// trim removes trailing zeros down to the minimum scale.
+func (d Decimal) trim(minScale int32) Decimal {
+	if d.coef == nil {
+		return Decimal{scale: min(d.scale, minScale)}
+	}
+	coef, scale := new(big.Int).Set(d.coef), d.scale
+	r := new(big.Int)
+	for scale > minScale {
+		q, m := new(big.Int).QuoRem(coef, ten, r)
+		if m.Sign() != 0 {
+			break
+		}
+		coef, scale = q, scale-1
+	}
+	return newDecimal(coef, scale)
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(ten, big.NewInt(int64(n)), nil)
+}
+
+func max(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,100 @@
+package decimal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"0", "0.00", "1", "-1", "10.50", "-0.001", "123456789012345678901234567890.123456789"} {
+		d, err := Parse(s)
+		require.NoError(t, err, s)
+		require.Equal(t, s, d.String())
+	}
+	d, err := Parse("+.5")
+	require.NoError(t, err)
+	require.Equal(t, "0.5", d.String())
+	require.Equal(t, MustParse("0"), Zero)
+	for _, s := range []string{"", "-", ".", "1.2.3", "1e3", "NaN", "1,5", "+-1"} {
+		_, err := Parse(s)
+		require.ErrorIs(t, err, ErrInvalid, s)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	require.Equal(t, "11.25", MustParse("10.5").Add(MustParse("0.75")).String())
+	require.Equal(t, "-0.25", MustParse("0.5").Sub(MustParse("0.75")).String())
+	require.Equal(t, "0.3", MustParse("0.1").Add(MustParse("0.2")).String())
+	require.Equal(t, "1005.0", MustParse("100.5").MulInt(10).String())
+	require.Equal(t, "-0.0625", MustParse("0.25").Mul(MustParse("-0.25")).String())
+	require.Equal(t, "-10.5", MustParse("10.5").Neg().String())
+	require.Equal(t, "10.5", MustParse("-10.5").Abs().String())
+	require.Equal(t, "0.00", MustParse("0.01").Sub(MustParse("0.01")).String())
+	require.True(t, MustParse("10.5").Equal(MustParse("10.50")))
+	require.Equal(t, -1, MustParse("9.99").Cmp(MustParse("10")))
+	require.Equal(t, 1, MustParse("-1").Cmp(MustParse("-1.5")))
+	require.Equal(t, MustParse("-1"), NewFromInt(-1))
+	require.Equal(t, MustParse("10.50"), New(1050, 2))
+}
+
+func TestDiv(t *testing.T) {
+	tests := []struct {
+		d, d2 string
+		scale int32
+		want  string
+	}{
+		{"10", "4", 8, "2.5"},
+		{"2100", "20", 8, "105"},
+		{"1", "3", 4, "0.3333"},
+		{"2", "3", 4, "0.6667"},
+		{"-2", "3", 4, "-0.6667"},
+		{"1", "8", 2, "0.13"},
+		{"-1", "8", 2, "-0.13"},
+		{"10.50", "1", 8, "10.50"},
+		{"0", "7", 8, "0"},
+		{"1.5", "0.5", 8, "3.0"},
+	}
+	for _, test := range tests {
+		got := MustParse(test.d).Div(MustParse(test.d2), test.scale)
+		require.Equal(t, test.want, got.String(), "%s/%s", test.d, test.d2)
+	}
+	require.Panics(t, func() { NewFromInt(1).Div(Zero, 2) })
+	require.Equal(t, "1.235", MustParse("1.2345").Round(3).String())
+	require.Equal(t, "1.20", MustParse("1.2").Round(2).String())
+}
+
+func TestScanValue(t *testing.T) {
+	var d Decimal
+	require.NoError(t, d.Scan("100.10"))
+	require.Equal(t, "100.10", d.String())
+	require.NoError(t, d.Scan([]byte("-3")))
+	require.Equal(t, NewFromInt(-3), d)
+	require.NoError(t, d.Scan(int64(7)))
+	require.Equal(t, NewFromInt(7), d)
+	require.NoError(t, d.Scan(100.5))
+	require.Equal(t, MustParse("100.5"), d)
+	require.Error(t, d.Scan(nil))
+	v, err := MustParse("100.10").Value()
+	require.NoError(t, err)
+	require.Equal(t, "100.10", v)
+}
+
+func TestJSON(t *testing.T) {
+	type price struct {
+		Price Decimal `json:"price"`
+	}
+	b, err := json.Marshal(price{Price: MustParse("100.10")})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"price":"100.10"}`, string(b))
+	var p price
+	require.NoError(t, json.Unmarshal(b, &p))
+	require.Equal(t, MustParse("100.10"), p.Price)
+	// numbers written before prices were decimals are still read
+	require.NoError(t, json.Unmarshal([]byte(`{"price":100.5}`), &p))
+	require.Equal(t, MustParse("100.5"), p.Price)
+	require.NoError(t, json.Unmarshal([]byte(`{"price":1e-7}`), &p))
+	require.Equal(t, MustParse("0.0000001"), p.Price)
+	require.Error(t, json.Unmarshal([]byte(`{"price":"x"}`), &p))
+}
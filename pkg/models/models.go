@@ -1,23 +1,154 @@
 // Package models contains the data models used by the application.
 package models
 
-import "time"
+import (
+	"time"
+
+	"tradetracker/pkg/decimal"
+)
 
 // Trade represents a trade.
 type Trade struct {
-	ID           int64     `validate:"required" json:"id,omitempty"`
-	CreatedAt    string    `validate:"required" json:"created_at,omitempty"`
-	InstrumentID int64     `validate:"required" json:"instrument_id,omitempty"`
-	Size         int64     `validate:"required" json:"size,omitempty"`
-	Price        float64   `validate:"required" json:"price,omitempty"` // not a suitable money type, but ok for demo purposes
-	Timestamp    time.Time `validate:"required" json:"timestamp,omitempty"`
+	ID           int64           `validate:"required" json:"id,omitempty"`
+	CreatedAt    string          `validate:"required" json:"created_at,omitempty"`
+	InstrumentID int64           `validate:"required" json:"instrument_id,omitempty"`
+	AccountID    int64           `json:"account_id,omitempty"`
+	Size         decimal.Decimal `validate:"required" json:"size,omitempty"`
+	Price        decimal.Decimal `validate:"required" json:"price,omitempty"`
+	Timestamp    time.Time       `validate:"required" json:"timestamp,omitempty"`
+	Ref          string          `json:"ref,omitempty"` // identifies the trade in its source, so that it is only stored once
 }
 
-// Position represents a position.
+// Position represents a position held by an account.
+// Positions aggregated over a portfolio of accounts have no ID or account ID.
+// TradeIDs are the trades which changed the position from the previous position of the account.
 type Position struct {
+	ID           int64           `validate:"required" json:"id,omitempty"`
+	CreatedAt    string          `validate:"required" json:"created_at,omitempty"`
+	InstrumentID int64           `validate:"required" json:"instrument_id,omitempty"`
+	AccountID    int64           `json:"account_id,omitempty"`
+	Size         decimal.Decimal `validate:"required" json:"size,omitempty"`
+	Timestamp    time.Time       `validate:"required" json:"timestamp,omitempty"`
+	TradeIDs     []int64         `json:"trade_ids,omitempty"`
+}
+
+// Bar represents an OHLCV bar summarising the trades in an instrument over a fixed interval.
+type Bar struct {
+	ID              int64           `validate:"required" json:"id,omitempty"`
+	CreatedAt       string          `validate:"required" json:"created_at,omitempty"`
+	InstrumentID    int64           `validate:"required" json:"instrument_id,omitempty"`
+	IntervalSeconds int64           `validate:"required" json:"interval_seconds,omitempty"`
+	Open            decimal.Decimal `validate:"required" json:"open,omitempty"`
+	High            decimal.Decimal `validate:"required" json:"high,omitempty"`
+	Low             decimal.Decimal `validate:"required" json:"low,omitempty"`
+	Close           decimal.Decimal `validate:"required" json:"close,omitempty"`
+	Volume          decimal.Decimal `validate:"required" json:"volume,omitempty"`
+	VWAP            decimal.Decimal `validate:"required" json:"vwap,omitempty"`
+	TradeCount      int64           `validate:"required" json:"trade_count,omitempty"`
+	Timestamp       time.Time       `validate:"required" json:"timestamp,omitempty"` // the start of the interval
+}
+
+// Portfolio represents a node in the hierarchy of books that accounts are grouped into.
+// A portfolio without a parent is a root of the hierarchy, e.g. the firm.
+type Portfolio struct {
+	ID         int64   `validate:"required" json:"id,omitempty"`
+	CreatedAt  string  `validate:"required" json:"created_at,omitempty"`
+	Name       string  `validate:"required" json:"name,omitempty"`
+	ParentID   int64   `json:"parent_id,omitempty"`
+	AccountIDs []int64 `json:"account_ids,omitempty"`
+}
+
+// Instrument represents the reference data for a tradable instrument.
+// Zero active dates are unbounded. QuantityScale is the number of decimal places that trade sizes
+// may be given to, e.g. 0 for whole shares or 8 for bitcoin.
+type Instrument struct {
+	ID            int64           `validate:"required" json:"id,omitempty"`
+	CreatedAt     string          `validate:"required" json:"created_at,omitempty"`
+	Symbol        string          `validate:"required" json:"symbol,omitempty"`
+	ISIN          string          `json:"isin,omitempty"`
+	CUSIP         string          `json:"cusip,omitempty"`
+	AssetClass    string          `validate:"required" json:"asset_class,omitempty"`
+	Currency      string          `validate:"required" json:"currency,omitempty"`
+	LotSize       int64           `validate:"required" json:"lot_size,omitempty"`
+	TickSize      decimal.Decimal `validate:"required" json:"tick_size,omitempty"`
+	Multiplier    decimal.Decimal `validate:"required" json:"multiplier,omitempty"`
+	QuantityScale int32           `json:"quantity_scale,omitempty"`
+	ActiveFrom    time.Time       `json:"active_from,omitempty"`
+	ActiveTo      time.Time       `json:"active_to,omitempty"`
+}
+
+// Stats summarises the trading activity and the firm-wide position in an instrument over a period.
+// Turnover is the gross volume traded relative to the time-weighted average absolute position,
+// and the time spent flat, long and short is measured within the period.
+type Stats struct {
+	InstrumentID int64           `validate:"required" json:"instrument_id,omitempty"`
+	Period       time.Time       `validate:"required" json:"period,omitempty"` // the start of the period
+	TradeCount   int64           `json:"trade_count"`
+	GrossVolume  decimal.Decimal `json:"gross_volume"`
+	NetVolume    decimal.Decimal `json:"net_volume"`
+	Notional     decimal.Decimal `json:"notional"`
+	Turnover     float64         `json:"turnover"`
+	LargestTrade decimal.Decimal `json:"largest_trade"` // the size of the trade with the largest absolute size
+	MaxPosition  decimal.Decimal `json:"max_position"`
+	MinPosition  decimal.Decimal `json:"min_position"`
+	AvgPosition  float64         `json:"avg_position"` // time-weighted
+	Flat         time.Duration   `json:"flat"`
+	Long         time.Duration   `json:"long"`
+	Short        time.Duration   `json:"short"`
+}
+
+// RetentionPolicy is how long the trades and positions in an instrument are kept in the database before
+// they may be archived.
+type RetentionPolicy struct {
+	InstrumentID int64         `validate:"required" json:"instrument_id,omitempty"`
+	Retain       time.Duration `validate:"required" json:"retain,omitempty"`
+}
+
+// Archive records the trades and positions in an instrument before a time which have been moved out of the
+// database into archive files. RestoredAt is zero unless the archive has been restored.
+type Archive struct {
 	ID           int64     `validate:"required" json:"id,omitempty"`
-	CreatedAt    string    `validate:"required" json:"created_at,omitempty"`
 	InstrumentID int64     `validate:"required" json:"instrument_id,omitempty"`
-	Size         int64     `validate:"required" json:"size,omitempty"`
-	Timestamp    time.Time `validate:"required" json:"timestamp,omitempty"`
+	Before       time.Time `validate:"required" json:"before,omitempty"`
+	ArchivedAt   time.Time `validate:"required" json:"archived_at,omitempty"`
+	Trades       int64     `json:"trades"`
+	Positions    int64     `json:"positions"`
+	RestoredAt   time.Time `json:"restored_at,omitempty"`
+}
+
+// ArchivedTrade is a trade as written to an archive, with every column needed to restore it exactly.
+type ArchivedTrade struct {
+	ID           int64           `json:"id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	InstrumentID int64           `json:"instrument_id"`
+	AccountID    int64           `json:"account_id"`
+	Size         decimal.Decimal `json:"size"`
+	Price        decimal.Decimal `json:"price"`
+	Timestamp    time.Time       `json:"timestamp"`
+	Ref          string          `json:"ref,omitempty"`
+}
+
+// ArchivedPosition is a position as written to an archive, with every column needed to restore it exactly,
+// including any generation which had been superseded. Seed positions stand in for an earlier archive.
+type ArchivedPosition struct {
+	ID           int64           `json:"id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	InstrumentID int64           `json:"instrument_id"`
+	AccountID    int64           `json:"account_id"`
+	Size         decimal.Decimal `json:"size"`
+	Timestamp    time.Time       `json:"timestamp"`
+	SupersededAt *time.Time      `json:"superseded_at,omitempty"`
+	TradeIDs     []int64         `json:"trade_ids,omitempty"`
+	Seed         bool            `json:"seed,omitempty"`
+}
+
+// Lock is an advisory lock on an instrument, held by the database session of a process writing its positions.
+// Holder describes the process, and PID is the database backend serving its session.
+type Lock struct {
+	InstrumentID int64     `json:"instrument_id"`
+	PID          int64     `json:"pid"`
+	Holder       string    `json:"holder"`
+	User         string    `json:"user"`
+	ClientAddr   string    `json:"client_addr,omitempty"`
+	Since        time.Time `json:"since"`
 }